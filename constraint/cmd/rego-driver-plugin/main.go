@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/plugin"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/rego"
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "rego-driver-plugin",
+	Short: "rego-driver-plugin serves the Rego driver as an out-of-process driver plugin",
+	Long: `
+The rego-driver-plugin is the reference implementation of the driver plugin protocol.  It serves
+the Rego driver, either over its stdin and stdout when started as a subprocess with
+plugin.Command, or on a socket when run as a sidecar and connected to with plugin.Network.
+Each connection to the sidecar is served a driver of its own.
+
+Example usage as a sidecar:
+go run ./cmd/rego-driver-plugin/main.go \
+  --network unix \
+  --listen /var/run/rego-driver.sock
+`,
+	// Usage is printed to stdout, which is the protocol stream when serving over
+	// stdio.
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return rootCmdFn()
+	},
+}
+
+var (
+	network     string
+	address     string
+	tracing     bool
+	gatherStats bool
+)
+
+func init() {
+	rootCmd.Flags().StringVar(
+		&network, "network", "unix", "The network to listen on, such as unix or tcp")
+	rootCmd.Flags().StringVar(
+		&address, "listen", "", "The address to listen on, serves over stdin and stdout if empty")
+	rootCmd.Flags().BoolVar(
+		&tracing, "tracing", false, "Trace every query, regardless of whether the client asks to")
+	rootCmd.Flags().BoolVar(
+		&gatherStats, "gather-stats", false, "Gather stats for every query, regardless of whether the client asks to")
+}
+
+type stdio struct{}
+
+func (stdio) Read(b []byte) (int, error) {
+	return os.Stdin.Read(b)
+}
+
+func (stdio) Write(b []byte) (int, error) {
+	return os.Stdout.Write(b)
+}
+
+func rootCmdFn() error {
+	args := []rego.Arg{rego.Tracing(tracing)}
+	if gatherStats {
+		args = append(args, rego.GatherStats())
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if address == "" {
+		driver, err := rego.New(args...)
+		if err != nil {
+			return err
+		}
+		return plugin.Serve(ctx, driver, stdio{})
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	// Each client is served a Driver of its own.
+	return plugin.ServeListener(ctx, func() (drivers.Driver, error) {
+		return rego.New(args...)
+	}, listener)
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "%+v\n", err)
+		os.Exit(1)
+	}
+}
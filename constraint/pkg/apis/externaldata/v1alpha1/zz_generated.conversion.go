@@ -34,6 +34,46 @@ func init() {
 // RegisterConversions adds conversion functions to the given scheme.
 // Public to allow building arbitrary schemes.
 func RegisterConversions(s *runtime.Scheme) error {
+	if err := s.AddGeneratedConversionFunc((*BearerTokenAuth)(nil), (*unversioned.BearerTokenAuth)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_BearerTokenAuth_To_unversioned_BearerTokenAuth(a.(*BearerTokenAuth), b.(*unversioned.BearerTokenAuth), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*unversioned.BearerTokenAuth)(nil), (*BearerTokenAuth)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_unversioned_BearerTokenAuth_To_v1alpha1_BearerTokenAuth(a.(*unversioned.BearerTokenAuth), b.(*BearerTokenAuth), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*CircuitBreaker)(nil), (*unversioned.CircuitBreaker)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_CircuitBreaker_To_unversioned_CircuitBreaker(a.(*CircuitBreaker), b.(*unversioned.CircuitBreaker), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*unversioned.CircuitBreaker)(nil), (*CircuitBreaker)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_unversioned_CircuitBreaker_To_v1alpha1_CircuitBreaker(a.(*unversioned.CircuitBreaker), b.(*CircuitBreaker), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*ClientCertAuth)(nil), (*unversioned.ClientCertAuth)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_ClientCertAuth_To_unversioned_ClientCertAuth(a.(*ClientCertAuth), b.(*unversioned.ClientCertAuth), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*unversioned.ClientCertAuth)(nil), (*ClientCertAuth)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_unversioned_ClientCertAuth_To_v1alpha1_ClientCertAuth(a.(*unversioned.ClientCertAuth), b.(*ClientCertAuth), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*HTTPSignatureAuth)(nil), (*unversioned.HTTPSignatureAuth)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_HTTPSignatureAuth_To_unversioned_HTTPSignatureAuth(a.(*HTTPSignatureAuth), b.(*unversioned.HTTPSignatureAuth), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*unversioned.HTTPSignatureAuth)(nil), (*HTTPSignatureAuth)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_unversioned_HTTPSignatureAuth_To_v1alpha1_HTTPSignatureAuth(a.(*unversioned.HTTPSignatureAuth), b.(*HTTPSignatureAuth), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*Provider)(nil), (*unversioned.Provider)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_Provider_To_unversioned_Provider(a.(*Provider), b.(*unversioned.Provider), scope)
 	}); err != nil {
@@ -44,6 +84,16 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*ProviderAuth)(nil), (*unversioned.ProviderAuth)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_ProviderAuth_To_unversioned_ProviderAuth(a.(*ProviderAuth), b.(*unversioned.ProviderAuth), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*unversioned.ProviderAuth)(nil), (*ProviderAuth)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_unversioned_ProviderAuth_To_v1alpha1_ProviderAuth(a.(*unversioned.ProviderAuth), b.(*ProviderAuth), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*ProviderList)(nil), (*unversioned.ProviderList)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_ProviderList_To_unversioned_ProviderList(a.(*ProviderList), b.(*unversioned.ProviderList), scope)
 	}); err != nil {
@@ -64,9 +114,131 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*ResponseCachePolicy)(nil), (*unversioned.ResponseCachePolicy)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_ResponseCachePolicy_To_unversioned_ResponseCachePolicy(a.(*ResponseCachePolicy), b.(*unversioned.ResponseCachePolicy), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*unversioned.ResponseCachePolicy)(nil), (*ResponseCachePolicy)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_unversioned_ResponseCachePolicy_To_v1alpha1_ResponseCachePolicy(a.(*unversioned.ResponseCachePolicy), b.(*ResponseCachePolicy), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*RetryPolicy)(nil), (*unversioned.RetryPolicy)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_RetryPolicy_To_unversioned_RetryPolicy(a.(*RetryPolicy), b.(*unversioned.RetryPolicy), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*unversioned.RetryPolicy)(nil), (*RetryPolicy)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_unversioned_RetryPolicy_To_v1alpha1_RetryPolicy(a.(*unversioned.RetryPolicy), b.(*RetryPolicy), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*SecretReference)(nil), (*unversioned.SecretReference)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_SecretReference_To_unversioned_SecretReference(a.(*SecretReference), b.(*unversioned.SecretReference), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*unversioned.SecretReference)(nil), (*SecretReference)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_unversioned_SecretReference_To_v1alpha1_SecretReference(a.(*unversioned.SecretReference), b.(*SecretReference), scope)
+	}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func autoConvert_v1alpha1_BearerTokenAuth_To_unversioned_BearerTokenAuth(in *BearerTokenAuth, out *unversioned.BearerTokenAuth, s conversion.Scope) error {
+	out.TokenFile = in.TokenFile
+	out.SecretRef = (*unversioned.SecretReference)(unsafe.Pointer(in.SecretRef))
+	return nil
+}
+
+// Convert_v1alpha1_BearerTokenAuth_To_unversioned_BearerTokenAuth is an autogenerated conversion function.
+func Convert_v1alpha1_BearerTokenAuth_To_unversioned_BearerTokenAuth(in *BearerTokenAuth, out *unversioned.BearerTokenAuth, s conversion.Scope) error {
+	return autoConvert_v1alpha1_BearerTokenAuth_To_unversioned_BearerTokenAuth(in, out, s)
+}
+
+func autoConvert_unversioned_BearerTokenAuth_To_v1alpha1_BearerTokenAuth(in *unversioned.BearerTokenAuth, out *BearerTokenAuth, s conversion.Scope) error {
+	out.TokenFile = in.TokenFile
+	out.SecretRef = (*SecretReference)(unsafe.Pointer(in.SecretRef))
+	return nil
+}
+
+// Convert_unversioned_BearerTokenAuth_To_v1alpha1_BearerTokenAuth is an autogenerated conversion function.
+func Convert_unversioned_BearerTokenAuth_To_v1alpha1_BearerTokenAuth(in *unversioned.BearerTokenAuth, out *BearerTokenAuth, s conversion.Scope) error {
+	return autoConvert_unversioned_BearerTokenAuth_To_v1alpha1_BearerTokenAuth(in, out, s)
+}
+
+func autoConvert_v1alpha1_CircuitBreaker_To_unversioned_CircuitBreaker(in *CircuitBreaker, out *unversioned.CircuitBreaker, s conversion.Scope) error {
+	out.FailureThreshold = in.FailureThreshold
+	out.OpenSeconds = in.OpenSeconds
+	return nil
+}
+
+// Convert_v1alpha1_CircuitBreaker_To_unversioned_CircuitBreaker is an autogenerated conversion function.
+func Convert_v1alpha1_CircuitBreaker_To_unversioned_CircuitBreaker(in *CircuitBreaker, out *unversioned.CircuitBreaker, s conversion.Scope) error {
+	return autoConvert_v1alpha1_CircuitBreaker_To_unversioned_CircuitBreaker(in, out, s)
+}
+
+func autoConvert_unversioned_CircuitBreaker_To_v1alpha1_CircuitBreaker(in *unversioned.CircuitBreaker, out *CircuitBreaker, s conversion.Scope) error {
+	out.FailureThreshold = in.FailureThreshold
+	out.OpenSeconds = in.OpenSeconds
+	return nil
+}
+
+// Convert_unversioned_CircuitBreaker_To_v1alpha1_CircuitBreaker is an autogenerated conversion function.
+func Convert_unversioned_CircuitBreaker_To_v1alpha1_CircuitBreaker(in *unversioned.CircuitBreaker, out *CircuitBreaker, s conversion.Scope) error {
+	return autoConvert_unversioned_CircuitBreaker_To_v1alpha1_CircuitBreaker(in, out, s)
+}
+
+func autoConvert_v1alpha1_ClientCertAuth_To_unversioned_ClientCertAuth(in *ClientCertAuth, out *unversioned.ClientCertAuth, s conversion.Scope) error {
+	out.CertFile = in.CertFile
+	out.KeyFile = in.KeyFile
+	out.SecretRef = (*unversioned.SecretReference)(unsafe.Pointer(in.SecretRef))
+	return nil
+}
+
+// Convert_v1alpha1_ClientCertAuth_To_unversioned_ClientCertAuth is an autogenerated conversion function.
+func Convert_v1alpha1_ClientCertAuth_To_unversioned_ClientCertAuth(in *ClientCertAuth, out *unversioned.ClientCertAuth, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ClientCertAuth_To_unversioned_ClientCertAuth(in, out, s)
+}
+
+func autoConvert_unversioned_ClientCertAuth_To_v1alpha1_ClientCertAuth(in *unversioned.ClientCertAuth, out *ClientCertAuth, s conversion.Scope) error {
+	out.CertFile = in.CertFile
+	out.KeyFile = in.KeyFile
+	out.SecretRef = (*SecretReference)(unsafe.Pointer(in.SecretRef))
+	return nil
+}
+
+// Convert_unversioned_ClientCertAuth_To_v1alpha1_ClientCertAuth is an autogenerated conversion function.
+func Convert_unversioned_ClientCertAuth_To_v1alpha1_ClientCertAuth(in *unversioned.ClientCertAuth, out *ClientCertAuth, s conversion.Scope) error {
+	return autoConvert_unversioned_ClientCertAuth_To_v1alpha1_ClientCertAuth(in, out, s)
+}
+
+func autoConvert_v1alpha1_HTTPSignatureAuth_To_unversioned_HTTPSignatureAuth(in *HTTPSignatureAuth, out *unversioned.HTTPSignatureAuth, s conversion.Scope) error {
+	out.KeyID = in.KeyID
+	out.KeyFile = in.KeyFile
+	out.SecretRef = (*unversioned.SecretReference)(unsafe.Pointer(in.SecretRef))
+	return nil
+}
+
+// Convert_v1alpha1_HTTPSignatureAuth_To_unversioned_HTTPSignatureAuth is an autogenerated conversion function.
+func Convert_v1alpha1_HTTPSignatureAuth_To_unversioned_HTTPSignatureAuth(in *HTTPSignatureAuth, out *unversioned.HTTPSignatureAuth, s conversion.Scope) error {
+	return autoConvert_v1alpha1_HTTPSignatureAuth_To_unversioned_HTTPSignatureAuth(in, out, s)
+}
+
+func autoConvert_unversioned_HTTPSignatureAuth_To_v1alpha1_HTTPSignatureAuth(in *unversioned.HTTPSignatureAuth, out *HTTPSignatureAuth, s conversion.Scope) error {
+	out.KeyID = in.KeyID
+	out.KeyFile = in.KeyFile
+	out.SecretRef = (*SecretReference)(unsafe.Pointer(in.SecretRef))
 	return nil
 }
 
+// Convert_unversioned_HTTPSignatureAuth_To_v1alpha1_HTTPSignatureAuth is an autogenerated conversion function.
+func Convert_unversioned_HTTPSignatureAuth_To_v1alpha1_HTTPSignatureAuth(in *unversioned.HTTPSignatureAuth, out *HTTPSignatureAuth, s conversion.Scope) error {
+	return autoConvert_unversioned_HTTPSignatureAuth_To_v1alpha1_HTTPSignatureAuth(in, out, s)
+}
+
 func autoConvert_v1alpha1_Provider_To_unversioned_Provider(in *Provider, out *unversioned.Provider, s conversion.Scope) error {
 	out.ObjectMeta = in.ObjectMeta
 	if err := Convert_v1alpha1_ProviderSpec_To_unversioned_ProviderSpec(&in.Spec, &out.Spec, s); err != nil {
@@ -93,6 +265,30 @@ func Convert_unversioned_Provider_To_v1alpha1_Provider(in *unversioned.Provider,
 	return autoConvert_unversioned_Provider_To_v1alpha1_Provider(in, out, s)
 }
 
+func autoConvert_v1alpha1_ProviderAuth_To_unversioned_ProviderAuth(in *ProviderAuth, out *unversioned.ProviderAuth, s conversion.Scope) error {
+	out.ClientCert = (*unversioned.ClientCertAuth)(unsafe.Pointer(in.ClientCert))
+	out.BearerToken = (*unversioned.BearerTokenAuth)(unsafe.Pointer(in.BearerToken))
+	out.HTTPSignature = (*unversioned.HTTPSignatureAuth)(unsafe.Pointer(in.HTTPSignature))
+	return nil
+}
+
+// Convert_v1alpha1_ProviderAuth_To_unversioned_ProviderAuth is an autogenerated conversion function.
+func Convert_v1alpha1_ProviderAuth_To_unversioned_ProviderAuth(in *ProviderAuth, out *unversioned.ProviderAuth, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ProviderAuth_To_unversioned_ProviderAuth(in, out, s)
+}
+
+func autoConvert_unversioned_ProviderAuth_To_v1alpha1_ProviderAuth(in *unversioned.ProviderAuth, out *ProviderAuth, s conversion.Scope) error {
+	out.ClientCert = (*ClientCertAuth)(unsafe.Pointer(in.ClientCert))
+	out.BearerToken = (*BearerTokenAuth)(unsafe.Pointer(in.BearerToken))
+	out.HTTPSignature = (*HTTPSignatureAuth)(unsafe.Pointer(in.HTTPSignature))
+	return nil
+}
+
+// Convert_unversioned_ProviderAuth_To_v1alpha1_ProviderAuth is an autogenerated conversion function.
+func Convert_unversioned_ProviderAuth_To_v1alpha1_ProviderAuth(in *unversioned.ProviderAuth, out *ProviderAuth, s conversion.Scope) error {
+	return autoConvert_unversioned_ProviderAuth_To_v1alpha1_ProviderAuth(in, out, s)
+}
+
 func autoConvert_v1alpha1_ProviderList_To_unversioned_ProviderList(in *ProviderList, out *unversioned.ProviderList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
 	out.Items = *(*[]unversioned.Provider)(unsafe.Pointer(&in.Items))
@@ -119,6 +315,11 @@ func autoConvert_v1alpha1_ProviderSpec_To_unversioned_ProviderSpec(in *ProviderS
 	out.URL = in.URL
 	out.Timeout = in.Timeout
 	out.CABundle = in.CABundle
+	out.RetryPolicy = (*unversioned.RetryPolicy)(unsafe.Pointer(in.RetryPolicy))
+	out.CircuitBreaker = (*unversioned.CircuitBreaker)(unsafe.Pointer(in.CircuitBreaker))
+	out.FailurePolicy = unversioned.FailurePolicyType(in.FailurePolicy)
+	out.ResponseCache = (*unversioned.ResponseCachePolicy)(unsafe.Pointer(in.ResponseCache))
+	out.Auth = (*unversioned.ProviderAuth)(unsafe.Pointer(in.Auth))
 	return nil
 }
 
@@ -131,6 +332,11 @@ func autoConvert_unversioned_ProviderSpec_To_v1alpha1_ProviderSpec(in *unversion
 	out.URL = in.URL
 	out.Timeout = in.Timeout
 	out.CABundle = in.CABundle
+	out.RetryPolicy = (*RetryPolicy)(unsafe.Pointer(in.RetryPolicy))
+	out.CircuitBreaker = (*CircuitBreaker)(unsafe.Pointer(in.CircuitBreaker))
+	out.FailurePolicy = FailurePolicyType(in.FailurePolicy)
+	out.ResponseCache = (*ResponseCachePolicy)(unsafe.Pointer(in.ResponseCache))
+	out.Auth = (*ProviderAuth)(unsafe.Pointer(in.Auth))
 	return nil
 }
 
@@ -138,3 +344,75 @@ func autoConvert_unversioned_ProviderSpec_To_v1alpha1_ProviderSpec(in *unversion
 func Convert_unversioned_ProviderSpec_To_v1alpha1_ProviderSpec(in *unversioned.ProviderSpec, out *ProviderSpec, s conversion.Scope) error {
 	return autoConvert_unversioned_ProviderSpec_To_v1alpha1_ProviderSpec(in, out, s)
 }
+
+func autoConvert_v1alpha1_ResponseCachePolicy_To_unversioned_ResponseCachePolicy(in *ResponseCachePolicy, out *unversioned.ResponseCachePolicy, s conversion.Scope) error {
+	out.TTLSeconds = in.TTLSeconds
+	out.ErrorTTLSeconds = in.ErrorTTLSeconds
+	return nil
+}
+
+// Convert_v1alpha1_ResponseCachePolicy_To_unversioned_ResponseCachePolicy is an autogenerated conversion function.
+func Convert_v1alpha1_ResponseCachePolicy_To_unversioned_ResponseCachePolicy(in *ResponseCachePolicy, out *unversioned.ResponseCachePolicy, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ResponseCachePolicy_To_unversioned_ResponseCachePolicy(in, out, s)
+}
+
+func autoConvert_unversioned_ResponseCachePolicy_To_v1alpha1_ResponseCachePolicy(in *unversioned.ResponseCachePolicy, out *ResponseCachePolicy, s conversion.Scope) error {
+	out.TTLSeconds = in.TTLSeconds
+	out.ErrorTTLSeconds = in.ErrorTTLSeconds
+	return nil
+}
+
+// Convert_unversioned_ResponseCachePolicy_To_v1alpha1_ResponseCachePolicy is an autogenerated conversion function.
+func Convert_unversioned_ResponseCachePolicy_To_v1alpha1_ResponseCachePolicy(in *unversioned.ResponseCachePolicy, out *ResponseCachePolicy, s conversion.Scope) error {
+	return autoConvert_unversioned_ResponseCachePolicy_To_v1alpha1_ResponseCachePolicy(in, out, s)
+}
+
+func autoConvert_v1alpha1_RetryPolicy_To_unversioned_RetryPolicy(in *RetryPolicy, out *unversioned.RetryPolicy, s conversion.Scope) error {
+	out.MaxRetries = in.MaxRetries
+	out.InitialBackoffMilliseconds = in.InitialBackoffMilliseconds
+	out.MaxBackoffMilliseconds = in.MaxBackoffMilliseconds
+	out.AssumeIdempotent = in.AssumeIdempotent
+	return nil
+}
+
+// Convert_v1alpha1_RetryPolicy_To_unversioned_RetryPolicy is an autogenerated conversion function.
+func Convert_v1alpha1_RetryPolicy_To_unversioned_RetryPolicy(in *RetryPolicy, out *unversioned.RetryPolicy, s conversion.Scope) error {
+	return autoConvert_v1alpha1_RetryPolicy_To_unversioned_RetryPolicy(in, out, s)
+}
+
+func autoConvert_unversioned_RetryPolicy_To_v1alpha1_RetryPolicy(in *unversioned.RetryPolicy, out *RetryPolicy, s conversion.Scope) error {
+	out.MaxRetries = in.MaxRetries
+	out.InitialBackoffMilliseconds = in.InitialBackoffMilliseconds
+	out.MaxBackoffMilliseconds = in.MaxBackoffMilliseconds
+	out.AssumeIdempotent = in.AssumeIdempotent
+	return nil
+}
+
+// Convert_unversioned_RetryPolicy_To_v1alpha1_RetryPolicy is an autogenerated conversion function.
+func Convert_unversioned_RetryPolicy_To_v1alpha1_RetryPolicy(in *unversioned.RetryPolicy, out *RetryPolicy, s conversion.Scope) error {
+	return autoConvert_unversioned_RetryPolicy_To_v1alpha1_RetryPolicy(in, out, s)
+}
+
+func autoConvert_v1alpha1_SecretReference_To_unversioned_SecretReference(in *SecretReference, out *unversioned.SecretReference, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Namespace = in.Namespace
+	out.Key = in.Key
+	return nil
+}
+
+// Convert_v1alpha1_SecretReference_To_unversioned_SecretReference is an autogenerated conversion function.
+func Convert_v1alpha1_SecretReference_To_unversioned_SecretReference(in *SecretReference, out *unversioned.SecretReference, s conversion.Scope) error {
+	return autoConvert_v1alpha1_SecretReference_To_unversioned_SecretReference(in, out, s)
+}
+
+func autoConvert_unversioned_SecretReference_To_v1alpha1_SecretReference(in *unversioned.SecretReference, out *SecretReference, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Namespace = in.Namespace
+	out.Key = in.Key
+	return nil
+}
+
+// Convert_unversioned_SecretReference_To_v1alpha1_SecretReference is an autogenerated conversion function.
+func Convert_unversioned_SecretReference_To_v1alpha1_SecretReference(in *unversioned.SecretReference, out *SecretReference, s conversion.Scope) error {
+	return autoConvert_unversioned_SecretReference_To_v1alpha1_SecretReference(in, out, s)
+}
@@ -28,8 +28,159 @@ type ProviderSpec struct {
 	// CABundle is a base64-encoded string that contains the TLS CA bundle in PEM format.
 	// It is used to verify the signature of the provider's certificate.
 	CABundle string `json:"caBundle,omitempty"`
+	// RetryPolicy configures retrying failed requests to the provider.
+	// If unset, failed requests are not retried.
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+	// CircuitBreaker configures failing requests to the provider without
+	// sending them while the provider is failing. If unset, requests are
+	// always sent.
+	// +optional
+	CircuitBreaker *CircuitBreaker `json:"circuitBreaker,omitempty"`
+	// FailurePolicy defines how a failure to query the provider is reported.
+	// With Fail, the failure is returned as an error. With Ignore, the provider
+	// is treated as having returned no items, and the failure is reported in
+	// the response's system error. Defaults to Fail.
+	// +kubebuilder:validation:Enum=Fail;Ignore
+	// +optional
+	FailurePolicy FailurePolicyType `json:"failurePolicy,omitempty"`
+	// ResponseCache configures how long the provider's responses are cached,
+	// if responses are cached. If unset, the cache's defaults apply.
+	// +optional
+	ResponseCache *ResponseCachePolicy `json:"responseCache,omitempty"`
+	// Auth configures how requests authenticate to the provider. If unset,
+	// requests present the driver's client certificate, if any.
+	// +optional
+	Auth *ProviderAuth `json:"auth,omitempty"`
 }
 
+// ProviderAuth configures how requests authenticate to a provider. Credentials
+// are read for each request, so rotated credentials take effect without a
+// restart.
+type ProviderAuth struct {
+	// ClientCert is the client certificate presented to the provider instead of
+	// the driver's client certificate.
+	// +optional
+	ClientCert *ClientCertAuth `json:"clientCert,omitempty"`
+	// BearerToken is a token sent in the Authorization header of each request.
+	// +optional
+	BearerToken *BearerTokenAuth `json:"bearerToken,omitempty"`
+	// HTTPSignature signs each request with a key shared with the provider.
+	// +optional
+	HTTPSignature *HTTPSignatureAuth `json:"httpSignature,omitempty"`
+}
+
+// ClientCertAuth locates a PEM-encoded client certificate and private key,
+// either in files or in a secret holding them as tls.crt and tls.key.
+type ClientCertAuth struct {
+	// CertFile is the path of the certificate file, which must be within a
+	// credential directory the driver allows.
+	// +optional
+	CertFile string `json:"certFile,omitempty"`
+	// KeyFile is the path of the private key file, which must be within a
+	// credential directory the driver allows.
+	// +optional
+	KeyFile string `json:"keyFile,omitempty"`
+	// SecretRef references the secret holding the certificate and key.
+	// +optional
+	SecretRef *SecretReference `json:"secretRef,omitempty"`
+}
+
+// BearerTokenAuth locates a bearer token, either in a file or in a secret.
+type BearerTokenAuth struct {
+	// TokenFile is the path of the file holding the token, which must be within
+	// a credential directory the driver allows.
+	// +optional
+	TokenFile string `json:"tokenFile,omitempty"`
+	// SecretRef references the secret holding the token. Key defaults to
+	// "token".
+	// +optional
+	SecretRef *SecretReference `json:"secretRef,omitempty"`
+}
+
+// HTTPSignatureAuth signs requests with HMAC-SHA256, adding Date, Digest, and
+// Signature headers which cover the request target, host, date, and digest of
+// the body.
+type HTTPSignatureAuth struct {
+	// KeyID identifies the key to the provider.
+	KeyID string `json:"keyID"`
+	// KeyFile is the path of the file holding the key, which must be within a
+	// credential directory the driver allows.
+	// +optional
+	KeyFile string `json:"keyFile,omitempty"`
+	// SecretRef references the secret holding the key. Key defaults to "key".
+	// +optional
+	SecretRef *SecretReference `json:"secretRef,omitempty"`
+}
+
+// SecretReference references a secret holding provider credentials.
+type SecretReference struct {
+	// Name is the name of the secret.
+	Name string `json:"name"`
+	// Namespace is the namespace of the secret. The driver may not allow
+	// secrets in every namespace.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Key is the key of the credential within the secret.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// ResponseCachePolicy configures how long the items of a provider's responses
+// are cached.
+type ResponseCachePolicy struct {
+	// TTLSeconds is how long items without errors are cached.
+	// Defaults to the cache's TTL.
+	TTLSeconds int `json:"ttlSeconds,omitempty"`
+	// ErrorTTLSeconds is how long items with errors are cached.
+	// Defaults to the cache's error TTL.
+	ErrorTTLSeconds int `json:"errorTTLSeconds,omitempty"`
+}
+
+// RetryPolicy configures retrying failed requests to a provider. Requests which
+// fail to reach the provider, or for which the provider responds with status
+// 429 or 5xx, are retried after an exponentially increasing, jittered backoff.
+// Requests are only retried once the provider has responded that its responses
+// are idempotent, unless AssumeIdempotent is set, and never after the provider
+// has responded that they are not.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of times a failed request is retried.
+	MaxRetries int `json:"maxRetries,omitempty"`
+	// InitialBackoffMilliseconds is the backoff before the first retry, which
+	// doubles with each subsequent retry. Defaults to 100.
+	InitialBackoffMilliseconds int `json:"initialBackoffMilliseconds,omitempty"`
+	// MaxBackoffMilliseconds is the maximum backoff between retries.
+	// Defaults to 5000.
+	MaxBackoffMilliseconds int `json:"maxBackoffMilliseconds,omitempty"`
+	// AssumeIdempotent allows failed requests to be retried before the provider
+	// has responded that its responses are idempotent. Set it only if requests
+	// to the provider are safe to repeat.
+	AssumeIdempotent bool `json:"assumeIdempotent,omitempty"`
+}
+
+// CircuitBreaker configures failing requests to a provider without sending
+// them after repeated failures. Once the circuit is open, a single trial request
+// is sent after OpenSeconds; the circuit closes if it succeeds.
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failed requests after which
+	// the circuit opens.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	// OpenSeconds is how long the circuit stays open before a trial request is
+	// sent. Defaults to 30.
+	OpenSeconds int `json:"openSeconds,omitempty"`
+}
+
+// FailurePolicyType defines how a failure to query a provider is reported.
+type FailurePolicyType string
+
+const (
+	// FailurePolicyFail returns failures as errors.
+	FailurePolicyFail FailurePolicyType = "Fail"
+	// FailurePolicyIgnore returns failures as responses with no items and a
+	// system error.
+	FailurePolicyIgnore FailurePolicyType = "Ignore"
+)
+
 // +genclient
 // +genclient:nonNamespaced
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
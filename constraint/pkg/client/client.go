@@ -7,6 +7,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	apiconstraints "github.com/open-policy-agent/frameworks/constraint/pkg/apis/constraints"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/client/crds"
@@ -59,6 +60,17 @@ type Client struct {
 
 	// templates is a map from a Template's name to its entry.
 	templates map[string]*templateClient
+
+	// shadow is non-nil if Templates are evaluated in shadow by their
+	// non-primary drivers.
+	shadow *shadowState
+	// shadowSampling is the number of reviews per review evaluated by shadow
+	// drivers. Zero is the same as one.
+	shadowSampling uint64
+	// shadowConcurrency is the maximum number of shadow queries in flight.
+	shadowConcurrency int
+	// shadowTimeout bounds each shadow query.
+	shadowTimeout time.Duration
 }
 
 // driverForTemplate returns the driver to be used for a template according
@@ -240,6 +252,8 @@ func (c *Client) AddTemplate(ctx context.Context, templ *templates.ConstraintTem
 		delete(cacheEntry.activeDrivers, oldDriverN)
 	}
 
+	c.syncShadowDrivers(ctx, cacheEntry)
+
 	resp.Handled[targetName] = true
 	return resp, nil
 }
@@ -279,6 +293,8 @@ func (c *Client) RemoveTemplate(ctx context.Context, templ *templates.Constraint
 
 	template := cached.getTemplate()
 
+	c.removeShadowTemplate(ctx, cached)
+
 	// remove the template from all active drivers
 	// to ensure cleanup in case of a botched update
 	for driverN := range cached.activeDrivers {
@@ -323,6 +339,57 @@ func (c *Client) GetTemplate(templ *templates.ConstraintTemplate) (*templates.Co
 	return template.getTemplate(), nil
 }
 
+// GetTemplateAnnotations returns the METADATA annotations declared in the Rego
+// of templ, keyed by target.
+func (c *Client) GetTemplateAnnotations(templ *templates.ConstraintTemplate) (map[string]*drivers.TemplateAnnotations, error) {
+	name := templ.GetName()
+
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	template := c.templates[name]
+	if template == nil {
+		return nil, templateNotFound(name)
+	}
+
+	return c.templateAnnotations(template.template)
+}
+
+// ListTemplateAnnotations returns the METADATA annotations of every Template
+// executed by a Driver which supports annotations, keyed by Template name and
+// then by target. Useful for generating catalogs of the installed policies.
+func (c *Client) ListTemplateAnnotations() (map[string]map[string]*drivers.TemplateAnnotations, error) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	result := make(map[string]map[string]*drivers.TemplateAnnotations, len(c.templates))
+	for name, template := range c.templates {
+		if _, ok := c.drivers[c.driverForTemplate(template.template)].(drivers.AnnotationsDriver); !ok {
+			continue
+		}
+
+		annotations, err := c.templateAnnotations(template.template)
+		if err != nil {
+			return nil, err
+		}
+
+		result[name] = annotations
+	}
+
+	return result, nil
+}
+
+func (c *Client) templateAnnotations(templ *templates.ConstraintTemplate) (map[string]*drivers.TemplateAnnotations, error) {
+	driverName := c.driverForTemplate(templ)
+	driver, ok := c.drivers[driverName].(drivers.AnnotationsDriver)
+	if !ok {
+		return nil, fmt.Errorf("%w: driver %q for template %q",
+			ErrAnnotationsUnsupported, driverName, templ.GetName())
+	}
+
+	return driver.GetTemplateAnnotations(templ.Spec.CRD.Spec.Names.Kind)
+}
+
 // getTemplateClientForKind returns the template entry for a given constraint.
 func (c *Client) getTemplateClientForKind(kind string) *templateClient {
 	name := strings.ToLower(kind)
@@ -373,6 +440,8 @@ func (c *Client) AddConstraint(ctx context.Context, constraint *unstructured.Uns
 		if err != nil {
 			return resp, err
 		}
+
+		c.addShadowConstraint(ctx, cached, constraintWithDefaults)
 	}
 
 	for _, target := range cached.targets {
@@ -418,6 +487,8 @@ func (c *Client) RemoveConstraint(ctx context.Context, constraint *unstructured.
 		}
 	}
 
+	c.removeShadowConstraint(ctx, cached, constraint)
+
 	for _, target := range cached.targets {
 		resp.Handled[target.GetName()] = true
 	}
@@ -494,7 +565,7 @@ func (c *Client) ValidateConstraint(constraint *unstructured.Unstructured) error
 // On error, the responses return value will still be populated so that
 // partial results can be analyzed.
 func (c *Client) AddData(ctx context.Context, data interface{}) (*types.Responses, error) {
-	// TODO(#189): Make AddData atomic across all Drivers/Targets.
+	// TODO(#189): Make AddData atomic across all Targets.
 
 	resp := types.NewResponses()
 	errMap := make(clienterrors.ErrorMap)
@@ -529,36 +600,45 @@ func (c *Client) AddData(ctx context.Context, data interface{}) (*types.Response
 			}
 		}
 
-		// Round trip data to force untyped JSON, as drivers are not type-aware
-		bytes, err := json.Marshal(processedData)
-		if err != nil {
-			errMap[name] = err
+		// To avoid maintaining duplicate caches, only Rego and Drivers which
+		// opt in to referential data get their own storage. We should work to
+		// remove the need for this special case by building a global storage
+		// object. Right now Rego needs its own cache to cache constraints.
+		referentialDrivers := c.referentialDrivers()
+		var added []drivers.Driver
+		for _, driver := range referentialDrivers {
+			// Force untyped JSON, as drivers are not type-aware. Each Driver gets
+			// its own copy so that none can modify another's data.
+			var processedDataCpy interface{}
+			processedDataCpy, err = toUntypedJSON(processedData)
+			if err != nil {
+				break
+			}
 
-			continue
+			err = driver.AddData(ctx, name, key, processedDataCpy)
+			if err != nil {
+				break
+			}
+			added = append(added, driver)
 		}
-		var processedDataCpy interface{}
-		err = json.Unmarshal(bytes, &processedDataCpy)
 		if err != nil {
+			// Remove the data from the Drivers which already stored it so that
+			// no Driver is left referencing data missing from the others and
+			// from the cache.
+			for _, driver := range added {
+				if removeErr := driver.RemoveData(ctx, name, key); removeErr != nil {
+					err = fmt.Errorf("%w; removing data from driver %q: %w", err, driver.Name(), removeErr)
+				}
+			}
 			errMap[name] = err
 
+			if cache != nil {
+				cache.Remove(key)
+			}
 			continue
 		}
 
-		// To avoid maintaining duplicate caches, only Rego should get its own
-		// storage. We should work to remove the need for this special case
-		// by building a global storage object. Right now Rego needs its own
-		// cache to cache constraints.
-		if _, ok := c.drivers[regoSchema.Name]; ok {
-			err = c.drivers[regoSchema.Name].AddData(ctx, name, key, processedDataCpy)
-			if err != nil {
-				errMap[name] = err
-
-				if cache != nil {
-					cache.Remove(key)
-				}
-				continue
-			}
-		} else if !c.ignoreNoReferentialDriverWarning {
+		if len(referentialDrivers) == 0 && !c.ignoreNoReferentialDriverWarning {
 			errMap[name] = ErrNoReferentialDriver
 		}
 
@@ -571,6 +651,94 @@ func (c *Client) AddData(ctx context.Context, data interface{}) (*types.Response
 	return resp, &errMap
 }
 
+// referentialDrivers returns the Drivers which store data for referential
+// Constraints, in order of priority. The Rego driver always stores data.
+func (c *Client) referentialDrivers() []drivers.Driver {
+	var result []drivers.Driver
+	for name, driver := range c.drivers {
+		if name == regoSchema.Name {
+			result = append(result, driver)
+			continue
+		}
+
+		if referential, ok := driver.(drivers.ReferentialDriver); ok && referential.SupportsReferentialData() {
+			result = append(result, driver)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return c.driverPriority[result[i].Name()] < c.driverPriority[result[j].Name()]
+	})
+
+	return result
+}
+
+// toUntypedJSON returns a copy of data containing only untyped JSON values.
+// Objects which are already untyped JSON, such as those in Unstructured, are
+// deep copied directly. Other objects are round-tripped through JSON.
+func toUntypedJSON(data interface{}) (interface{}, error) {
+	switch d := data.(type) {
+	case *unstructured.Unstructured:
+		if cpy, ok := deepCopyUntyped(d.Object); ok {
+			return cpy, nil
+		}
+	case map[string]interface{}:
+		if cpy, ok := deepCopyUntyped(d); ok {
+			return cpy, nil
+		}
+	}
+
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var cpy interface{}
+	err = json.Unmarshal(bytes, &cpy)
+	if err != nil {
+		return nil, err
+	}
+
+	return cpy, nil
+}
+
+// deepCopyUntyped deep copies an untyped JSON value. Returns false if value
+// contains anything other than untyped JSON.
+func deepCopyUntyped(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return nil, true
+		}
+		cpy := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			elemCpy, ok := deepCopyUntyped(elem)
+			if !ok {
+				return nil, false
+			}
+			cpy[key] = elemCpy
+		}
+		return cpy, true
+	case []interface{}:
+		if v == nil {
+			return nil, true
+		}
+		cpy := make([]interface{}, len(v))
+		for i, elem := range v {
+			elemCpy, ok := deepCopyUntyped(elem)
+			if !ok {
+				return nil, false
+			}
+			cpy[i] = elemCpy
+		}
+		return cpy, true
+	case string, bool, int64, float64, json.Number, nil:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
 // RemoveData removes data from OPA for every target that can handle the data.
 // On error, the responses return value will still be populated so that
 // partial results can be analyzed.
@@ -589,17 +757,20 @@ func (c *Client) RemoveData(ctx context.Context, data interface{}) (*types.Respo
 			continue
 		}
 
-		// To avoid maintaining duplicate caches, only Rego should get its own
-		// storage. We should work to remove the need for this special case
-		// by building a global storage object. Right now Rego needs its own
-		// cache to cache constraints.
-		if _, ok := c.drivers[regoSchema.Name]; ok {
-			err = c.drivers[regoSchema.Name].RemoveData(ctx, target, relPath)
+		// See AddData for why only some Drivers store data.
+		referentialDrivers := c.referentialDrivers()
+		for _, driver := range referentialDrivers {
+			err = driver.RemoveData(ctx, target, relPath)
 			if err != nil {
-				errMap[target] = err
-				continue
+				break
 			}
-		} else if !c.ignoreNoReferentialDriverWarning {
+		}
+		if err != nil {
+			errMap[target] = err
+			continue
+		}
+
+		if len(referentialDrivers) == 0 && !c.ignoreNoReferentialDriverWarning {
 			errMap[target] = ErrNoReferentialDriver
 		}
 
@@ -673,10 +844,14 @@ func (c *Client) Review(ctx context.Context, obj interface{}, opts ...drivers.Qu
 		constraintsByTarget[target] = targetConstraints
 	}
 
+	// Reviews are sampled rather than each target's queries, so ShadowSampling
+	// counts reviews.
+	shadowed := c.shadow != nil && c.shadow.sample(c.shadowSampling)
+
 	for target, review := range reviews {
 		constraints := constraintsByTarget[target]
 
-		resp, stats, err := c.review(ctx, target, constraints, review, opts...)
+		resp, stats, err := c.review(ctx, target, constraints, review, shadowed, opts...)
 		if err != nil {
 			errMap.Add(target, err)
 			continue
@@ -711,7 +886,7 @@ func (c *Client) Review(ctx context.Context, obj interface{}, opts ...drivers.Qu
 	return responses, &errMap
 }
 
-func (c *Client) review(ctx context.Context, target string, constraints []*unstructured.Unstructured, review interface{}, opts ...drivers.QueryOpt) (*types.Response, []*instrumentation.StatsEntry, error) {
+func (c *Client) review(ctx context.Context, target string, constraints []*unstructured.Unstructured, review interface{}, shadowed bool, opts ...drivers.QueryOpt) (*types.Response, []*instrumentation.StatsEntry, error) {
 	var results []*types.Result
 	var stats []*instrumentation.StatsEntry
 	var tracesBuilder strings.Builder
@@ -753,6 +928,10 @@ func (c *Client) review(ctx context.Context, target string, constraints []*unstr
 		}
 	}
 
+	if shadowed {
+		c.shadowReview(ctx, target, constraints, review, results, *errs)
+	}
+
 	traceStr := tracesBuilder.String()
 	var trace *string
 	if len(traceStr) != 0 {
@@ -791,6 +970,10 @@ func (c *Client) Dump(ctx context.Context) (string, error) {
 }
 
 func (c *Client) GetDescriptionForStat(source instrumentation.Source, statName string) string {
+	if desc, ok := shadowStatDescriptions[statName]; ok && c.shadow != nil {
+		return desc
+	}
+
 	if source.Type != instrumentation.EngineSourceType {
 		// only handle engine source for now
 		return instrumentation.UnknownDescription
@@ -2,6 +2,7 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strings"
@@ -1038,3 +1039,98 @@ func TestDriverForTemplate(t *testing.T) {
 		})
 	}
 }
+
+func TestToUntypedJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data interface{}
+		want interface{}
+	}{{
+		name: "unstructured",
+		data: &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "foo"},
+			"spec":     map[string]interface{}{"replicas": int64(3), "items": []interface{}{"a", true, nil}},
+		}},
+		want: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "foo"},
+			"spec":     map[string]interface{}{"replicas": int64(3), "items": []interface{}{"a", true, nil}},
+		},
+	}, {
+		name: "map with typed values",
+		data: map[string]interface{}{"names": []string{"foo"}},
+		want: map[string]interface{}{"names": []interface{}{"foo"}},
+	}, {
+		name: "struct",
+		data: &handlertest.Object{Name: "foo", Namespace: "bar"},
+		want: map[string]interface{}{"name": "foo", "namespace": "bar", "data": ""},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toUntypedJSON(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+
+	t.Run("copies", func(t *testing.T) {
+		data := map[string]interface{}{"spec": map[string]interface{}{"foo": "bar"}}
+
+		got, err := toUntypedJSON(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data["spec"].(map[string]interface{})["foo"] = "qux"
+		if diff := cmp.Diff(map[string]interface{}{"spec": map[string]interface{}{"foo": "bar"}}, got); diff != "" {
+			t.Error(diff)
+		}
+	})
+}
+
+// BenchmarkToUntypedJSON compares deep copying inventory objects directly with
+// round-tripping them through JSON.
+func BenchmarkToUntypedJSON(b *testing.B) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":      "foo",
+			"namespace": "bar",
+			"labels":    map[string]interface{}{"app": "foo", "team": "bar"},
+		},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "foo", "image": "example.com/foo:latest"},
+				map[string]interface{}{"name": "bar", "image": "other.com/bar:latest"},
+			},
+		},
+	}}
+
+	b.Run("json", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			bytes, err := json.Marshal(obj)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			var cpy interface{}
+			if err := json.Unmarshal(bytes, &cpy); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("direct", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := toUntypedJSON(obj); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
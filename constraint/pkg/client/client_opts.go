@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"time"
 
 	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/handler"
@@ -66,6 +67,71 @@ func Driver(d drivers.Driver) Opt {
 	}
 }
 
+// ShadowDrivers evaluates each Template which has code for more than one
+// registered driver with its non-primary drivers in shadow. On Review, each
+// Constraint's violations from shadow drivers are compared with those from the
+// primary driver chosen by driver priority. Differences and shadow driver
+// failures are counted in ShadowStats and passed to onMismatch, which may be
+// nil.
+//
+// Shadow drivers never change the Responses or errors returned by Client.
+// Shadow queries run in the background once the primary drivers have been
+// queried, so Review returns without waiting for them, and reads the reviewed
+// object after Review returns. Each shadow query is bounded by ShadowTimeout
+// rather than Review's context, and reviews sampled while ShadowConcurrency
+// queries are in flight are not shadowed. A Template or Constraint changed
+// while it is being shadowed may be reported as a mismatch. Use
+// ShadowSampling to shadow only some reviews.
+func ShadowDrivers(onMismatch ShadowMismatchHandler) Opt {
+	return func(client *Client) error {
+		client.shadow = newShadowState(onMismatch)
+		return nil
+	}
+}
+
+// ShadowSampling limits shadow evaluation to one in every n reviews, bounding
+// the cost of ShadowDrivers. Adding and removing Templates and Constraints
+// is always shadowed. Defaults to shadowing every review.
+func ShadowSampling(n int) Opt {
+	return func(client *Client) error {
+		if n < 1 {
+			return fmt.Errorf("%w: shadow sampling must be at least 1, got %d",
+				ErrCreatingClient, n)
+		}
+
+		client.shadowSampling = uint64(n)
+		return nil
+	}
+}
+
+// ShadowConcurrency limits the number of shadow queries in flight to n.
+// Defaults to GOMAXPROCS.
+func ShadowConcurrency(n int) Opt {
+	return func(client *Client) error {
+		if n < 1 {
+			return fmt.Errorf("%w: shadow concurrency must be at least 1, got %d",
+				ErrCreatingClient, n)
+		}
+
+		client.shadowConcurrency = n
+		return nil
+	}
+}
+
+// ShadowTimeout bounds each shadow query, which outlives the Review it
+// shadows. Defaults to 10 seconds.
+func ShadowTimeout(timeout time.Duration) Opt {
+	return func(client *Client) error {
+		if timeout <= 0 {
+			return fmt.Errorf("%w: shadow timeout must be positive, got %v",
+				ErrCreatingClient, timeout)
+		}
+
+		client.shadowTimeout = timeout
+		return nil
+	}
+}
+
 func IgnoreNoReferentialDriverWarning(ignore bool) Opt {
 	return func(client *Client) error {
 		client.ignoreNoReferentialDriverWarning = ignore
@@ -12,6 +12,7 @@ import (
 	"github.com/open-policy-agent/frameworks/constraint/pkg/client"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/fake"
 	fakeschema "github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/fake/schema"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/rego"
@@ -20,6 +21,8 @@ import (
 	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/handler"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/handler/handlertest"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/storage"
 	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -280,6 +283,117 @@ func TestClient_RemoveData(t *testing.T) {
 	}
 }
 
+// referentialDriver records the data passed to it by Client.
+type referentialDriver struct {
+	*fake.Driver
+	supported bool
+	data      map[string]interface{}
+	addErr    error
+}
+
+func (d *referentialDriver) SupportsReferentialData() bool {
+	return d.supported
+}
+
+func (d *referentialDriver) AddData(_ context.Context, target string, path storage.Path, data interface{}) error {
+	if d.addErr != nil {
+		return d.addErr
+	}
+	d.data[target+path.String()] = data
+	return nil
+}
+
+func (d *referentialDriver) RemoveData(_ context.Context, target string, path storage.Path) error {
+	delete(d.data, target+path.String())
+	return nil
+}
+
+func TestClient_AddData_ReferentialDriver(t *testing.T) {
+	tcs := []struct {
+		name      string
+		supported bool
+		withRego  bool
+		wantData  bool
+		wantError error
+	}{{
+		name:      "referential driver",
+		supported: true,
+		wantData:  true,
+	}, {
+		name:      "referential driver alongside rego",
+		supported: true,
+		withRego:  true,
+		wantData:  true,
+	}, {
+		name:      "driver without referential data",
+		supported: false,
+		wantError: &clienterrors.ErrorMap{handlertest.TargetName: client.ErrNoReferentialDriver},
+	}}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			d := &referentialDriver{Driver: fake.New("fake"), supported: tc.supported, data: map[string]interface{}{}}
+			opts := []client.Opt{client.Targets(&handlertest.Handler{}), client.Driver(d)}
+			if tc.withRego {
+				regoDriver, err := rego.New()
+				if err != nil {
+					t.Fatal(err)
+				}
+				opts = append(opts, client.Driver(regoDriver))
+			}
+
+			c, err := client.NewClient(opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			obj := &handlertest.Object{Namespace: "foo", Name: "bar"}
+			_, err = c.AddData(ctx, obj)
+			if !errors.Is(err, tc.wantError) {
+				t.Fatalf("got AddData() error = %v, want %v", err, tc.wantError)
+			}
+
+			if got := len(d.data) == 1; got != tc.wantData {
+				t.Fatalf("got data %v, want data stored = %t", d.data, tc.wantData)
+			}
+
+			_, err = c.RemoveData(ctx, obj)
+			if !errors.Is(err, tc.wantError) {
+				t.Fatalf("got RemoveData() error = %v, want %v", err, tc.wantError)
+			}
+
+			if len(d.data) != 0 {
+				t.Errorf("got data %v after RemoveData(), want none", d.data)
+			}
+		})
+	}
+}
+
+func TestClient_AddData_RollsBackDrivers(t *testing.T) {
+	ctx := context.Background()
+
+	errAdd := errors.New("add failed")
+	first := &referentialDriver{Driver: fake.New("first"), supported: true, data: map[string]interface{}{}}
+	second := &referentialDriver{Driver: fake.New("second"), supported: true, data: map[string]interface{}{}, addErr: errAdd}
+
+	c, err := client.NewClient(client.Targets(&handlertest.Handler{}), client.Driver(first), client.Driver(second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.AddData(ctx, &handlertest.Object{Namespace: "foo", Name: "bar"})
+	wantError := &clienterrors.ErrorMap{handlertest.TargetName: errAdd}
+	if !errors.Is(err, wantError) {
+		t.Fatalf("got AddData() error = %v, want %v", err, wantError)
+	}
+
+	if len(first.data) != 0 {
+		t.Errorf("got data %v in first driver after failed AddData(), want none", first.data)
+	}
+}
+
 func TestClient_AddTemplate(t *testing.T) {
 	tcs := []struct {
 		name              string
@@ -741,6 +855,76 @@ func TestClient_GetTemplate_ByNameOnly(t *testing.T) {
 	}
 }
 
+func TestClient_GetTemplateAnnotations(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := rego.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := client.NewClient(client.Targets(&handlertest.Handler{}), client.Driver(d), client.Driver(fake.New("fake")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	annotated := cts.New(cts.OptTargets(cts.Target(handlertest.TargetName, `# METADATA
+# title: Deny everything
+# custom:
+#   severity: high
+package foo
+
+violation[{"msg": "denied"}] {
+  true
+}
+`)))
+
+	_, err = c.GetTemplateAnnotations(annotated)
+	if !errors.Is(err, client.ErrMissingConstraintTemplate) {
+		t.Fatalf("got GetTemplateAnnotations() error = %v, want %v",
+			err, client.ErrMissingConstraintTemplate)
+	}
+
+	_, err = c.AddTemplate(ctx, annotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fakeTemplate := cts.New(cts.OptName("fakes2"), cts.OptCRDNames("Fakes2"),
+		cts.OptTargets(cts.TargetCustomEngines(handlertest.TargetName,
+			cts.Code("fake", (&fakeschema.Source{RejectWith: "rejected"}).ToUnstructured()))))
+	_, err = c.AddTemplate(ctx, fakeTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.GetTemplateAnnotations(annotated)
+	if err != nil {
+		t.Fatalf("got GetTemplateAnnotations() error = %v, want %v", err, nil)
+	}
+
+	pkg := got[handlertest.TargetName].Package
+	if pkg == nil || pkg.Title != "Deny everything" || pkg.Custom["severity"] != "high" {
+		t.Errorf("got package annotations %v, want title %q and severity %q", pkg, "Deny everything", "high")
+	}
+
+	_, err = c.GetTemplateAnnotations(fakeTemplate)
+	if !errors.Is(err, client.ErrAnnotationsUnsupported) {
+		t.Fatalf("got GetTemplateAnnotations() error = %v, want %v",
+			err, client.ErrAnnotationsUnsupported)
+	}
+
+	all, err := c.ListTemplateAnnotations()
+	if err != nil {
+		t.Fatalf("got ListTemplateAnnotations() error = %v, want %v", err, nil)
+	}
+
+	if diff := cmp.Diff(map[string]map[string]*drivers.TemplateAnnotations{annotated.GetName(): got}, all,
+		cmpopts.IgnoreUnexported(ast.Annotations{})); diff != "" {
+		t.Error(diff)
+	}
+}
+
 func TestClient_RemoveTemplate_CascadingDelete(t *testing.T) {
 	h := &handlertest.Handler{}
 
@@ -0,0 +1,33 @@
+package drivers
+
+import "github.com/open-policy-agent/opa/ast"
+
+// TemplateAnnotations are the METADATA annotations declared in the source of a
+// Template for a single target.
+//
+// See https://www.openpolicyagent.org/docs/latest/policy-language/#annotations
+type TemplateAnnotations struct {
+	// Package is the package or subpackages scoped annotation on the Template's
+	// package, if any.
+	Package *ast.Annotations `json:"package,omitempty"`
+
+	// Rules maps the names of the Template's rules, for example "violation", to
+	// the rule and document scoped annotations declared on them in the order
+	// they appear in the Template.
+	Rules map[string][]*ast.Annotations `json:"rules,omitempty"`
+
+	// Error is why the Template's annotations could not be parsed, if they could
+	// not. Malformed annotations do not prevent the Template from being added,
+	// but none of its annotations are reported.
+	Error string `json:"error,omitempty"`
+}
+
+// AnnotationsDriver is implemented by Drivers which can report the METADATA
+// annotations declared in Templates' source code.
+type AnnotationsDriver interface {
+	Driver
+
+	// GetTemplateAnnotations returns the annotations declared in the Template
+	// for kind, keyed by target.
+	GetTemplateAnnotations(kind string) (map[string]*TemplateAnnotations, error)
+}
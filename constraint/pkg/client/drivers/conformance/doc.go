@@ -0,0 +1,14 @@
+// Package conformance defines tests which every Driver is expected to pass,
+// regardless of the language its Templates are written in.
+//
+// Driver authors describe their Driver with a Suite, supplying Template code
+// in their Driver's language for each behavior the Suite checks, and call
+// Suite.Run from a test. Behaviors whose code is not supplied are skipped, so
+// a Driver which does not support referential data, for example, may still
+// run the rest of the Suite.
+//
+// Reviews and referential data use the handlertest target by default, exactly
+// as Client would pass them to the Driver. Drivers for other targets supply
+// their own reviews and data with the Suite's NewReview and NewData. Run the
+// Suite with -race to check that the Driver is threadsafe.
+package conformance
@@ -0,0 +1,65 @@
+package conformance
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"github.com/open-policy-agent/opa/storage"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// k8sTarget is the target of Templates evaluated by the K8sNativeValidation
+// driver.
+const k8sTarget = "admission.k8s.gatekeeper.sh"
+
+// K8sCELSuite returns a Suite for a Driver which evaluates Templates written in
+// CEL for the Kubernetes admission target, with code for every behavior.
+// Reviewed and referential Objects are ConfigMaps which hold their data under
+// the "value" key. Callers enable Tracing and Stats if their Driver supports
+// them, and must enable referential data.
+func K8sCELSuite(newDriver func(t *testing.T) drivers.Driver) *Suite {
+	return &Suite{
+		NewDriver: newDriver,
+		Target:    k8sTarget,
+		NewReview: func(data string) interface{} {
+			return configMap("reviewed", data)
+		},
+		NewData: func(name, data string) (storage.Path, interface{}) {
+			return storage.Path{"cluster", "v1", "ConfigMap", name}, configMap(name, data).Object
+		},
+		Deny:  celCode(schema.Validation{Expression: "false", Message: "denied"}),
+		Allow: celCodePtr(schema.Validation{Expression: "true", Message: "denied"}),
+		CheckData: celCodePtr(schema.Validation{
+			Expression:        "object.data.value == variables.params.wantData",
+			MessageExpression: `"got " + object.data.value + " but want " + variables.params.wantData + " for data"`,
+		}),
+		ForbidDuplicates: celCodePtr(schema.Validation{
+			Expression:        `!variables.gatekeeper_internal_inventory.objects("v1", "ConfigMap").exists(o, o.data.value == object.data.value)`,
+			MessageExpression: `"duplicate data " + object.data.value`,
+		}),
+		Invalid: celCodePtr(schema.Validation{Expression: `undefined_function("denied")`, Message: "denied"}),
+	}
+}
+
+// configMap returns a cluster-scoped ConfigMap named name holding data.
+func configMap(name, data string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": name},
+		"data":       map[string]interface{}{"value": data},
+	}}
+}
+
+func celCode(validation schema.Validation) templates.Code {
+	source := &schema.Source{Validations: []schema.Validation{validation}}
+	return cts.Code(schema.Name, source.MustToUnstructured())
+}
+
+func celCodePtr(validation schema.Validation) *templates.Code {
+	code := celCode(validation)
+	return &code
+}
@@ -0,0 +1,138 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/rego/schema"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Rego modules for tests of Rego Drivers beyond the Suite.
+const (
+	// ModuleInventory has a violation for each Namespace in referential data.
+	ModuleInventory = `
+package foo
+
+violation[{"msg": msg, "details": {"namespace": name}}] {
+  data.inventory.cluster.v1.Namespace[name]
+  msg := sprintf("namespace %v exists", [name])
+}
+`
+
+	// ModuleLib has a violation with the message defined in LibMessages.
+	ModuleLib = `
+package foo
+
+import data.lib.messages
+
+violation[{"msg": msg}] {
+  msg := messages.denied
+}
+`
+
+	// LibMessages is a library for ModuleLib.
+	LibMessages = `
+package lib.messages
+
+denied := "denied by lib"
+`
+)
+
+const (
+	moduleDeny = `
+package foo
+
+violation[{"msg": "denied"}] {
+  true
+}
+`
+
+	moduleAllow = `
+package foo
+
+violation[{"msg": "denied"}] {
+  false
+}
+`
+
+	moduleCheckData = `
+package foo
+
+violation[{"msg": msg}] {
+  wantData := input.parameters.wantData
+  gotData := input.review.object.data
+  wantData != gotData
+  msg := sprintf("got %v but want %v for data", [gotData, wantData])
+}
+`
+
+	moduleForbidDuplicates = `
+package foo
+
+violation[{"msg": msg}] {
+  obj := data.inventory.cluster[_]
+  gotData := input.review.object.data
+  gotData == obj.data
+  msg := sprintf("duplicate data %v", [gotData])
+}
+`
+
+	moduleInvalid = `
+package foo
+
+violation[{"msg": msg}] {
+  msg := undefined_function("denied")
+}
+`
+)
+
+// RegoSuite returns a Suite for a Driver which evaluates Templates written in
+// Rego, with code for every behavior. Callers enable Tracing and Stats if their
+// Driver supports them.
+func RegoSuite(newDriver func(t *testing.T) drivers.Driver) *Suite {
+	return &Suite{
+		NewDriver:        newDriver,
+		Deny:             regoCode(moduleDeny),
+		Allow:            regoCodePtr(moduleAllow),
+		CheckData:        regoCodePtr(moduleCheckData),
+		ForbidDuplicates: regoCodePtr(moduleForbidDuplicates),
+		Invalid:          regoCodePtr(moduleInvalid),
+	}
+}
+
+func regoCode(rego string) templates.Code {
+	return cts.Code(schema.Name, (&schema.Source{Rego: rego}).ToUnstructured())
+}
+
+func regoCodePtr(rego string) *templates.Code {
+	code := regoCode(rego)
+	return &code
+}
+
+// RegoTemplate returns a Template for the cts mock target with rego and libs
+// as its Rego code.
+func RegoTemplate(rego string, libs ...string) *templates.ConstraintTemplate {
+	return cts.New(cts.OptTargets(cts.Target(cts.MockTargetHandler, rego, libs...)))
+}
+
+// QueryMessages queries d for the cts mock target, and returns the message of
+// each result. Fails t if the query fails.
+func QueryMessages(ctx context.Context, t *testing.T, d drivers.Driver, review interface{}, constraints ...*unstructured.Unstructured) []string {
+	t.Helper()
+
+	resp, err := d.Query(ctx, cts.MockTargetHandler, constraints, review)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msgs []string
+	for _, r := range resp.Results {
+		msgs = append(msgs, r.Msg)
+	}
+
+	return msgs
+}
@@ -0,0 +1,626 @@
+package conformance
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/handler/handlertest"
+	"github.com/open-policy-agent/opa/storage"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	kindDeny             = "ConformanceDeny"
+	kindAllow            = "ConformanceAllow"
+	kindCheckData        = "ConformanceCheckData"
+	kindForbidDuplicates = "ConformanceForbidDuplicates"
+	kindChurn            = "ConformanceChurn"
+
+	// concurrency is the number of goroutines querying a Driver at once in the
+	// concurrency test, and iterations is how many times each operation is
+	// repeated.
+	concurrency = 4
+	iterations  = 20
+)
+
+// Suite describes a Driver under test and the Template code it evaluates. Code
+// is written in the Driver's language for Target, and its Engine must be one
+// the Driver accepts.
+type Suite struct {
+	// NewDriver returns a new Driver with no Templates, Constraints, or data.
+	// Called once for each test.
+	NewDriver func(t *testing.T) drivers.Driver
+
+	// Target is the target Templates are written for, and which reviews and
+	// data are passed to the Driver for. Defaults to the handlertest target.
+	Target string
+
+	// NewReview returns a review of an Object whose data is data, as Target's
+	// handler would pass it to the Driver. Defaults to a handlertest review.
+	NewReview func(data string) interface{}
+
+	// NewData returns the path and value Target's handler would pass to the
+	// Driver's AddData for a cluster-scoped Object named name whose data is
+	// data. Defaults to a handlertest Object.
+	NewData func(name, data string) (storage.Path, interface{})
+
+	// Deny is code for a Template which reports a violation for each of its
+	// Constraints on every review. Required.
+	Deny templates.Code
+
+	// Allow is code for a Template which never reports violations. If nil,
+	// tests which replace a Template's code are skipped.
+	Allow *templates.Code
+
+	// CheckData is code for a Template which reports a violation if the data
+	// of the reviewed Object differs from its Constraint's "wantData"
+	// parameter. If nil, tests of Constraint parameters are skipped.
+	CheckData *templates.Code
+
+	// ForbidDuplicates is code for a Template which reports a violation if an
+	// Object in the cluster-scoped inventory has the same data as the reviewed
+	// Object. If nil, tests of referential data are skipped.
+	ForbidDuplicates *templates.Code
+
+	// Invalid is code which the Driver refuses to add. If nil, the test of
+	// invalid Templates is skipped.
+	Invalid *templates.Code
+
+	// Tracing is whether Query returns a trace when passed drivers.Tracing.
+	Tracing bool
+
+	// Stats are the names of stats which the Driver describes in
+	// GetDescriptionForStat and returns from Query when passed drivers.Stats.
+	Stats []string
+}
+
+// Run runs each conformance test as a subtest of t.
+func (s *Suite) Run(t *testing.T) {
+	t.Run("Name", s.testName)
+	t.Run("AddTemplate", s.testAddTemplate)
+	t.Run("AddTemplate replaces code", s.testReplaceTemplate)
+	t.Run("AddTemplate invalid", s.testInvalidTemplate)
+	t.Run("RemoveTemplate", s.testRemoveTemplate)
+	t.Run("Constraints", s.testConstraints)
+	t.Run("Constraint parameters", s.testParameters)
+	t.Run("Multiple templates", s.testMultipleTemplates)
+	t.Run("Referential data", s.testReferentialData)
+	t.Run("Tracing", s.testTracing)
+	t.Run("Stats", s.testStats)
+	t.Run("Dump", s.testDump)
+	t.Run("Concurrency", s.testConcurrency)
+}
+
+func (s *Suite) testName(t *testing.T) {
+	d := s.NewDriver(t)
+
+	if d.Name() == "" {
+		t.Error("got empty Name()")
+	}
+}
+
+func (s *Suite) testAddTemplate(t *testing.T) {
+	ctx := context.Background()
+	d := s.NewDriver(t)
+
+	template := s.newTemplate(kindDeny, s.Deny)
+	addTemplate(ctx, t, d, template)
+	// Adding an identical Template is not an error.
+	addTemplate(ctx, t, d, template)
+
+	constraint := cts.MakeConstraint(t, kindDeny, "foo")
+	addConstraint(ctx, t, d, constraint)
+
+	qr := s.query(ctx, t, d, []*unstructured.Unstructured{constraint}, s.review("bar"))
+	wantViolations(t, qr, constraint)
+
+	for _, result := range qr.Results {
+		if result.Msg == "" {
+			t.Errorf("got result %+v with empty message", result)
+		}
+	}
+}
+
+func (s *Suite) testReplaceTemplate(t *testing.T) {
+	if s.Allow == nil {
+		t.Skip("no Allow code")
+	}
+
+	ctx := context.Background()
+	d := s.NewDriver(t)
+
+	addTemplate(ctx, t, d, s.newTemplate(kindDeny, *s.Allow))
+
+	constraint := cts.MakeConstraint(t, kindDeny, "foo")
+	addConstraint(ctx, t, d, constraint)
+
+	constraints := []*unstructured.Unstructured{constraint}
+	wantViolations(t, s.query(ctx, t, d, constraints, s.review("bar")))
+
+	// Constraints are kept when their Template's code is replaced.
+	addTemplate(ctx, t, d, s.newTemplate(kindDeny, s.Deny))
+	wantViolations(t, s.query(ctx, t, d, constraints, s.review("bar")), constraint)
+
+	addTemplate(ctx, t, d, s.newTemplate(kindDeny, *s.Allow))
+	wantViolations(t, s.query(ctx, t, d, constraints, s.review("bar")))
+}
+
+func (s *Suite) testInvalidTemplate(t *testing.T) {
+	ctx := context.Background()
+	d := s.NewDriver(t)
+
+	err := d.AddTemplate(ctx, s.newTemplate(kindDeny))
+	if err == nil {
+		t.Error("got AddTemplate() error = nil for Template without code, want error")
+	}
+
+	if s.Invalid == nil {
+		return
+	}
+
+	addTemplate(ctx, t, d, s.newTemplate(kindDeny, s.Deny))
+
+	constraint := cts.MakeConstraint(t, kindDeny, "foo")
+	addConstraint(ctx, t, d, constraint)
+
+	err = d.AddTemplate(ctx, s.newTemplate(kindDeny, *s.Invalid))
+	if err == nil {
+		t.Error("got AddTemplate() error = nil for invalid code, want error")
+	}
+
+	// The failed update leaves the previous Template in place.
+	wantViolations(t, s.query(ctx, t, d, []*unstructured.Unstructured{constraint}, s.review("bar")), constraint)
+}
+
+func (s *Suite) testRemoveTemplate(t *testing.T) {
+	ctx := context.Background()
+	d := s.NewDriver(t)
+
+	template := s.newTemplate(kindDeny, s.Deny)
+
+	// Removing a Template which was never added is not an error.
+	removeTemplate(ctx, t, d, template)
+
+	addTemplate(ctx, t, d, template)
+	constraint := cts.MakeConstraint(t, kindDeny, "foo")
+	addConstraint(ctx, t, d, constraint)
+
+	removeTemplate(ctx, t, d, template)
+	removeTemplate(ctx, t, d, template)
+
+	// RemoveTemplate removes the Template's Constraints, so removing them
+	// afterwards is not an error.
+	removeConstraint(ctx, t, d, constraint)
+
+	// The Template may be added again once removed.
+	addTemplate(ctx, t, d, template)
+	addConstraint(ctx, t, d, constraint)
+	wantViolations(t, s.query(ctx, t, d, []*unstructured.Unstructured{constraint}, s.review("bar")), constraint)
+}
+
+func (s *Suite) testConstraints(t *testing.T) {
+	ctx := context.Background()
+	d := s.NewDriver(t)
+
+	addTemplate(ctx, t, d, s.newTemplate(kindDeny, s.Deny))
+
+	foo := cts.MakeConstraint(t, kindDeny, "foo")
+	bar := cts.MakeConstraint(t, kindDeny, "bar")
+	addConstraint(ctx, t, d, foo)
+	addConstraint(ctx, t, d, bar)
+	// Adding an identical Constraint is not an error.
+	addConstraint(ctx, t, d, bar)
+
+	wantViolations(t, s.query(ctx, t, d, []*unstructured.Unstructured{foo, bar}, s.review("bar")), foo, bar)
+
+	// Only the passed Constraints are evaluated.
+	wantViolations(t, s.query(ctx, t, d, []*unstructured.Unstructured{foo}, s.review("bar")), foo)
+	wantViolations(t, s.query(ctx, t, d, nil, s.review("bar")))
+
+	removeConstraint(ctx, t, d, bar)
+	// Removing a Constraint which does not exist is not an error.
+	removeConstraint(ctx, t, d, bar)
+	removeConstraint(ctx, t, d, cts.MakeConstraint(t, kindAllow, "foo"))
+
+	wantViolations(t, s.query(ctx, t, d, []*unstructured.Unstructured{foo}, s.review("bar")), foo)
+}
+
+func (s *Suite) testParameters(t *testing.T) {
+	if s.CheckData == nil {
+		t.Skip("no CheckData code")
+	}
+
+	ctx := context.Background()
+	d := s.NewDriver(t)
+
+	addTemplate(ctx, t, d, s.newTemplate(kindCheckData, *s.CheckData))
+
+	constraint := cts.MakeConstraint(t, kindCheckData, "foo", cts.WantData("bar"))
+	addConstraint(ctx, t, d, constraint)
+
+	constraints := []*unstructured.Unstructured{constraint}
+	wantViolations(t, s.query(ctx, t, d, constraints, s.review("bar")))
+	wantViolations(t, s.query(ctx, t, d, constraints, s.review("qux")), constraint)
+
+	// Adding a Constraint again replaces its parameters.
+	constraint = cts.MakeConstraint(t, kindCheckData, "foo", cts.WantData("qux"))
+	addConstraint(ctx, t, d, constraint)
+
+	constraints = []*unstructured.Unstructured{constraint}
+	wantViolations(t, s.query(ctx, t, d, constraints, s.review("bar")), constraint)
+	wantViolations(t, s.query(ctx, t, d, constraints, s.review("qux")))
+}
+
+func (s *Suite) testMultipleTemplates(t *testing.T) {
+	ctx := context.Background()
+	d := s.NewDriver(t)
+
+	addTemplate(ctx, t, d, s.newTemplate(kindDeny, s.Deny))
+	addTemplate(ctx, t, d, s.newTemplate(kindChurn, s.Deny))
+
+	deny := cts.MakeConstraint(t, kindDeny, "foo")
+	churn := cts.MakeConstraint(t, kindChurn, "foo")
+	constraints := []*unstructured.Unstructured{deny, churn}
+
+	if s.Allow != nil {
+		addTemplate(ctx, t, d, s.newTemplate(kindAllow, *s.Allow))
+
+		allow := cts.MakeConstraint(t, kindAllow, "foo")
+		addConstraint(ctx, t, d, allow)
+		constraints = append(constraints, allow)
+	}
+
+	addConstraint(ctx, t, d, deny)
+	addConstraint(ctx, t, d, churn)
+
+	wantViolations(t, s.query(ctx, t, d, constraints, s.review("bar")), deny, churn)
+
+	// Removing one Template does not affect others.
+	removeTemplate(ctx, t, d, s.newTemplate(kindChurn, s.Deny))
+	wantViolations(t, s.query(ctx, t, d, []*unstructured.Unstructured{deny}, s.review("bar")), deny)
+}
+
+func (s *Suite) testReferentialData(t *testing.T) {
+	if s.ForbidDuplicates == nil {
+		t.Skip("no ForbidDuplicates code")
+	}
+
+	ctx := context.Background()
+	d := s.NewDriver(t)
+
+	addTemplate(ctx, t, d, s.newTemplate(kindForbidDuplicates, *s.ForbidDuplicates))
+
+	constraint := cts.MakeConstraint(t, kindForbidDuplicates, "foo")
+	addConstraint(ctx, t, d, constraint)
+	constraints := []*unstructured.Unstructured{constraint}
+
+	s.addData(ctx, t, d, "foo", "bar")
+
+	wantViolations(t, s.query(ctx, t, d, constraints, s.review("bar")), constraint)
+	wantViolations(t, s.query(ctx, t, d, constraints, s.review("qux")))
+
+	// Adding data again replaces it.
+	s.addData(ctx, t, d, "foo", "qux")
+
+	wantViolations(t, s.query(ctx, t, d, constraints, s.review("bar")))
+	wantViolations(t, s.query(ctx, t, d, constraints, s.review("qux")), constraint)
+
+	s.removeData(ctx, t, d, "foo")
+	// Removing data which does not exist is not an error.
+	s.removeData(ctx, t, d, "foo")
+
+	wantViolations(t, s.query(ctx, t, d, constraints, s.review("qux")))
+}
+
+func (s *Suite) testTracing(t *testing.T) {
+	if !s.Tracing {
+		t.Skip("Driver does not trace queries")
+	}
+
+	ctx := context.Background()
+	d := s.NewDriver(t)
+
+	addTemplate(ctx, t, d, s.newTemplate(kindDeny, s.Deny))
+	constraint := cts.MakeConstraint(t, kindDeny, "foo")
+	addConstraint(ctx, t, d, constraint)
+
+	qr := s.query(ctx, t, d, []*unstructured.Unstructured{constraint}, s.review("bar"), drivers.Tracing(true))
+	if qr.Trace == nil || *qr.Trace == "" {
+		t.Error("got no trace with drivers.Tracing(true), want trace")
+	}
+	wantViolations(t, qr, constraint)
+}
+
+func (s *Suite) testStats(t *testing.T) {
+	ctx := context.Background()
+	d := s.NewDriver(t)
+
+	for _, name := range s.Stats {
+		description, err := d.GetDescriptionForStat(name)
+		if err != nil {
+			t.Errorf("got GetDescriptionForStat(%q) error = %v, want nil", name, err)
+		} else if description == "" {
+			t.Errorf("got empty description for stat %q", name)
+		}
+	}
+
+	_, err := d.GetDescriptionForStat("conformanceUnknownStat")
+	if err == nil {
+		t.Error("got GetDescriptionForStat() error = nil for unknown stat, want error")
+	}
+
+	if len(s.Stats) == 0 {
+		return
+	}
+
+	addTemplate(ctx, t, d, s.newTemplate(kindDeny, s.Deny))
+	constraint := cts.MakeConstraint(t, kindDeny, "foo")
+	addConstraint(ctx, t, d, constraint)
+
+	qr := s.query(ctx, t, d, []*unstructured.Unstructured{constraint}, s.review("bar"), drivers.Stats(true))
+	wantViolations(t, qr, constraint)
+
+	got := make(map[string]bool)
+	for _, entry := range qr.StatsEntries {
+		for _, stat := range entry.Stats {
+			got[stat.Name] = true
+		}
+	}
+
+	for _, name := range s.Stats {
+		if !got[name] {
+			t.Errorf("got no stat %q with drivers.Stats(true), want stat", name)
+		}
+	}
+}
+
+func (s *Suite) testDump(t *testing.T) {
+	ctx := context.Background()
+	d := s.NewDriver(t)
+
+	addTemplate(ctx, t, d, s.newTemplate(kindDeny, s.Deny))
+	addConstraint(ctx, t, d, cts.MakeConstraint(t, kindDeny, "foo"))
+
+	_, err := d.Dump(ctx)
+	if err != nil {
+		t.Errorf("got Dump() error = %v, want nil", err)
+	}
+}
+
+// testConcurrency queries a Constraint while other Templates, Constraints, and
+// data are modified. Reviews of the queried Constraint must be unaffected.
+func (s *Suite) testConcurrency(t *testing.T) {
+	ctx := context.Background()
+	d := s.NewDriver(t)
+
+	addTemplate(ctx, t, d, s.newTemplate(kindDeny, s.Deny))
+	stable := cts.MakeConstraint(t, kindDeny, "stable")
+	addConstraint(ctx, t, d, stable)
+
+	want := []drivers.ConstraintKey{drivers.ConstraintKeyFrom(stable)}
+
+	var wg sync.WaitGroup
+	run := func(f func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				if err := f(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < concurrency; i++ {
+		run(func() error {
+			qr, err := d.Query(ctx, s.target(), []*unstructured.Unstructured{stable}, s.review("bar"))
+			if err != nil {
+				return err
+			}
+
+			if diff := cmp.Diff(want, violated(qr)); diff != "" {
+				t.Errorf("concurrent Query(): %s", diff)
+			}
+
+			return nil
+		})
+	}
+
+	churn := cts.MakeConstraint(t, kindDeny, "churn")
+	run(func() error {
+		if err := d.AddConstraint(ctx, churn); err != nil {
+			return err
+		}
+		return d.RemoveConstraint(ctx, churn)
+	})
+
+	churnTemplate := s.newTemplate(kindChurn, s.Deny)
+	run(func() error {
+		if err := d.AddTemplate(ctx, churnTemplate); err != nil {
+			return err
+		}
+		return d.RemoveTemplate(ctx, churnTemplate)
+	})
+
+	if s.ForbidDuplicates != nil {
+		path, data := s.newData("churn", "bar")
+		run(func() error {
+			if err := d.AddData(ctx, s.target(), path, data); err != nil {
+				return err
+			}
+			return d.RemoveData(ctx, s.target(), path)
+		})
+	}
+
+	wg.Wait()
+}
+
+// newTemplate returns a Template of kind for the Suite's target with the
+// passed code.
+func (s *Suite) newTemplate(kind string, code ...templates.Code) *templates.ConstraintTemplate {
+	codes := make([]templates.Code, len(code))
+	for i := range code {
+		// Copy code so Drivers cannot modify it for later tests.
+		code[i].DeepCopyInto(&codes[i])
+	}
+
+	return cts.New(
+		cts.OptName(strings.ToLower(kind)),
+		cts.OptCRDNames(kind),
+		cts.OptCRDSchema(cts.PropMap{"wantData": cts.PropTyped("string")}),
+		cts.OptTargets(cts.TargetCustomEngines(s.target(), codes...)),
+	)
+}
+
+func (s *Suite) target() string {
+	if s.Target == "" {
+		return handlertest.TargetName
+	}
+
+	return s.Target
+}
+
+// review returns a review of an Object with data.
+func (s *Suite) review(data string) interface{} {
+	if s.NewReview == nil {
+		return handlertest.NewReview("", "reviewed", data)
+	}
+
+	return s.NewReview(data)
+}
+
+// newData returns the path and value of a cluster-scoped Object named name
+// with data, as passed to AddData.
+func (s *Suite) newData(name, data string) (storage.Path, interface{}) {
+	if s.NewData == nil {
+		obj := &handlertest.Object{Name: name, Data: data}
+		// handlertest.Handler's data, after it is converted to untyped JSON by
+		// Client.
+		return obj.Key(), map[string]interface{}{
+			"name":      obj.Name,
+			"namespace": obj.Namespace,
+			"data":      obj.Data,
+		}
+	}
+
+	return s.NewData(name, data)
+}
+
+func addTemplate(ctx context.Context, t *testing.T, d drivers.Driver, template *templates.ConstraintTemplate) {
+	t.Helper()
+
+	if err := d.AddTemplate(ctx, template); err != nil {
+		t.Fatalf("got AddTemplate(%q) error = %v, want nil", template.GetName(), err)
+	}
+}
+
+func removeTemplate(ctx context.Context, t *testing.T, d drivers.Driver, template *templates.ConstraintTemplate) {
+	t.Helper()
+
+	if err := d.RemoveTemplate(ctx, template); err != nil {
+		t.Fatalf("got RemoveTemplate(%q) error = %v, want nil", template.GetName(), err)
+	}
+}
+
+func addConstraint(ctx context.Context, t *testing.T, d drivers.Driver, constraint *unstructured.Unstructured) {
+	t.Helper()
+
+	if err := d.AddConstraint(ctx, constraint); err != nil {
+		t.Fatalf("got AddConstraint(%v) error = %v, want nil", drivers.ConstraintKeyFrom(constraint), err)
+	}
+}
+
+func removeConstraint(ctx context.Context, t *testing.T, d drivers.Driver, constraint *unstructured.Unstructured) {
+	t.Helper()
+
+	if err := d.RemoveConstraint(ctx, constraint); err != nil {
+		t.Fatalf("got RemoveConstraint(%v) error = %v, want nil", drivers.ConstraintKeyFrom(constraint), err)
+	}
+}
+
+func (s *Suite) addData(ctx context.Context, t *testing.T, d drivers.Driver, name, data string) {
+	t.Helper()
+
+	path, value := s.newData(name, data)
+	if err := d.AddData(ctx, s.target(), path, value); err != nil {
+		t.Fatalf("got AddData(%v) error = %v, want nil", path, err)
+	}
+}
+
+func (s *Suite) removeData(ctx context.Context, t *testing.T, d drivers.Driver, name string) {
+	t.Helper()
+
+	path, _ := s.newData(name, "")
+	if err := d.RemoveData(ctx, s.target(), path); err != nil {
+		t.Fatalf("got RemoveData(%v) error = %v, want nil", path, err)
+	}
+}
+
+func (s *Suite) query(ctx context.Context, t *testing.T, d drivers.Driver, constraints []*unstructured.Unstructured, review interface{}, opts ...drivers.QueryOpt) *drivers.QueryResponse {
+	t.Helper()
+
+	qr, err := d.Query(ctx, s.target(), constraints, review, opts...)
+	if err != nil {
+		t.Fatalf("got Query() error = %v, want nil", err)
+	}
+
+	if qr == nil {
+		return &drivers.QueryResponse{}
+	}
+
+	return qr
+}
+
+// violated returns the sorted keys of the Constraints with results in qr.
+func violated(qr *drivers.QueryResponse) []drivers.ConstraintKey {
+	var keys []drivers.ConstraintKey
+	for _, result := range qr.Results {
+		if result.Constraint == nil {
+			// Results must identify their Constraint, so record this as a
+			// mismatch.
+			keys = append(keys, drivers.ConstraintKey{})
+			continue
+		}
+
+		keys = append(keys, drivers.ConstraintKeyFrom(result.Constraint))
+	}
+
+	sortKeys(keys)
+
+	return keys
+}
+
+// wantViolations checks that qr has exactly one result for each of the passed
+// Constraints.
+func wantViolations(t *testing.T, qr *drivers.QueryResponse, constraints ...*unstructured.Unstructured) {
+	t.Helper()
+
+	var want []drivers.ConstraintKey
+	for _, constraint := range constraints {
+		want = append(want, drivers.ConstraintKeyFrom(constraint))
+	}
+	sortKeys(want)
+
+	if diff := cmp.Diff(want, violated(qr)); diff != "" {
+		t.Errorf("unexpected violations (-want +got):\n%s", diff)
+	}
+}
+
+func sortKeys(keys []drivers.ConstraintKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Kind != keys[j].Kind {
+			return keys[i].Kind < keys[j].Kind
+		}
+		return keys[i].Name < keys[j].Name
+	})
+}
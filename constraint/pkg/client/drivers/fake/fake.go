@@ -198,6 +198,9 @@ func (d *Driver) RemoveData(_ context.Context, _ string, _ storage.Path) error {
 }
 
 func (d *Driver) Query(_ context.Context, _ string, constraints []*unstructured.Unstructured, _ interface{}, _ ...drivers.QueryOpt) (*drivers.QueryResponse, error) {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+
 	results := []*types.Result{}
 	for i := range constraints {
 		constraint := constraints[i]
@@ -0,0 +1,26 @@
+package fake
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/conformance"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/fake/schema"
+)
+
+func TestDriver_Conformance(t *testing.T) {
+	// The fake Driver rejects every review, so only the behaviors which don't
+	// depend on the review are checked.
+	invalid := cts.Code("fake", map[string]interface{}{})
+
+	suite := &conformance.Suite{
+		NewDriver: func(t *testing.T) drivers.Driver {
+			return New("fake")
+		},
+		Deny:    cts.Code("fake", (&schema.Source{RejectWith: "denied"}).ToUnstructured()),
+		Invalid: &invalid,
+	}
+
+	suite.Run(t)
+}
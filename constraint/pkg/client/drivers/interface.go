@@ -33,11 +33,19 @@ type Driver interface {
 
 	// AddData caches data to be used for referential Constraints. Replaces data
 	// if it already exists at the specified path. This is a deprecated method that
-	// will only be called for the "Rego" driver.
+	// will only be called for the "Rego" driver and Drivers implementing
+	// ReferentialDriver.
+	//
+	// Drivers may defer writing data, as the remote Driver batches writes to
+	// its OPA server. Such Drivers return only errors with the call itself from
+	// AddData and RemoveData, and return errors applying the data from a later
+	// Query or from their own Flush method, so an error never belongs to a
+	// different write.
 	AddData(ctx context.Context, target string, path storage.Path, data interface{}) error
 	// RemoveData removes cached data, so the data at the specified path can no
 	// longer be used in referential Constraints. This is a deprecated method that
-	// will only be called for the "Rego" driver.
+	// will only be called for the "Rego" driver and Drivers implementing
+	// ReferentialDriver.
 	RemoveData(ctx context.Context, target string, path storage.Path) error
 
 	// Query runs the passed target's Constraints against review.
@@ -54,6 +62,16 @@ type Driver interface {
 	GetDescriptionForStat(statName string) (string, error)
 }
 
+// ReferentialDriver is implemented by Drivers other than Rego which may store
+// data for referential Constraints.
+type ReferentialDriver interface {
+	Driver
+
+	// SupportsReferentialData returns true if Client should forward data to
+	// AddData and RemoveData.
+	SupportsReferentialData() bool
+}
+
 // ConstraintKey uniquely identifies a Constraint.
 type ConstraintKey struct {
 	Kind string `json:"kind"`
@@ -1,5 +1,13 @@
 package k8scel
 
+import (
+	"fmt"
+
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
 type Arg func(*Driver) error
 
 // GatherStats starts collecting various stats around the
@@ -11,3 +19,66 @@ func GatherStats() Arg {
 		return nil
 	}
 }
+
+// ReferentialData stores data passed to AddData so templates can reference it
+// through the gatekeeper_internal_inventory variable. Doing so duplicates the
+// data stored by the Rego driver.
+func ReferentialData() Arg {
+	return func(driver *Driver) error {
+		driver.referentialData = true
+
+		return nil
+	}
+}
+
+// RuntimeCostLimit sets the CEL runtime cost budget for evaluating each
+// Constraint, in place of the default of celconfig.PerCallLimit. Evaluations
+// which exceed it fail. Templates may set a lower limit with runtimeCostLimit.
+func RuntimeCostLimit(limit int64) Arg {
+	return func(driver *Driver) error {
+		if limit <= 0 {
+			return fmt.Errorf("%w: runtime cost limit must be positive, got %d",
+				clienterrors.ErrCreatingDriver, limit)
+		}
+
+		driver.runtimeCostLimit = limit
+
+		return nil
+	}
+}
+
+// UserInfo sets the requesting user of the admission requests synthesized for
+// reviews of objects rather than admission requests, such as during audit or
+// in CI. Templates see it as request.userInfo. Defaults to an anonymous user
+// with no name or groups.
+func UserInfo(info user.Info) Arg {
+	return func(driver *Driver) error {
+		driver.userInfo = info
+
+		return nil
+	}
+}
+
+// Namespaces resolves the Namespace of namespaced reviews, which templates
+// access through the namespaceObject variable. Without a resolver, Namespaces
+// are found in referential data if the driver was created with
+// ReferentialData, and namespaceObject is otherwise null.
+func Namespaces(resolver NamespaceResolver) Arg {
+	return func(driver *Driver) error {
+		driver.namespaceResolver = resolver
+
+		return nil
+	}
+}
+
+// Authorizer makes authz available to templates through the authorizer
+// variable, as for ValidatingAdmissionPolicies. Authorization checks are made
+// on behalf of the reviewed request's user. Without an Authorizer, templates
+// which reference authorizer fail to compile.
+func Authorizer(authz authorizer.Authorizer) Arg {
+	return func(driver *Driver) error {
+		driver.authorizer = authz
+
+		return nil
+	}
+}
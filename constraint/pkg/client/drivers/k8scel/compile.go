@@ -0,0 +1,106 @@
+package k8scel
+
+import (
+	"fmt"
+	"strings"
+
+	pSchema "github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/validating"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/matchconditions"
+	"k8s.io/apiserver/pkg/cel/environment"
+)
+
+// ErrorCodeCompile is the code of CreateCRDErrors for CEL expressions which do
+// not compile.
+const ErrorCodeCompile = "cel_compile_error"
+
+// CompilationError is returned by AddTemplate for templates with CEL
+// expressions which do not compile. Wraps ErrInvalidConstraintTemplate.
+type CompilationError struct {
+	// Template is the name of the template.
+	Template string
+
+	// Errors has an entry for each invalid expression. The
+	// Location of each is the path to the expression in the template's source,
+	// for example "validations[0].messageExpression".
+	Errors []templates.CreateCRDError
+}
+
+func (e *CompilationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = fmt.Sprintf("%s: %s", err.Location, err.Message)
+	}
+
+	return fmt.Sprintf("%v: template %q has invalid CEL expressions: %s",
+		clienterrors.ErrInvalidConstraintTemplate, e.Template, strings.Join(msgs, "; "))
+}
+
+func (e *CompilationError) Unwrap() error {
+	return clienterrors.ErrInvalidConstraintTemplate
+}
+
+// compileErrors returns the errors compiling each of source's expressions.
+// Expects source's variables to already be compiled and stored in compiler.
+// Message expressions are compiled with messageOptions, and all other
+// expressions with options.
+func compileErrors(compiler *cel.CompositedCompiler, source *pSchema.Source, options, messageOptions cel.OptionalVariableDeclarations) []templates.CreateCRDError {
+	var errs []templates.CreateCRDError
+
+	add := func(location string, result cel.CompilationResult) {
+		if result.Error == nil {
+			return
+		}
+
+		errs = append(errs, templates.CreateCRDError{
+			Code:     ErrorCodeCompile,
+			Message:  result.Error.Detail,
+			Location: location,
+		})
+	}
+
+	for i, v := range source.Variables {
+		add(fmt.Sprintf("variables[%d].expression", i), compiler.CompositionEnv.CompiledVariables[v.Name])
+	}
+
+	for i, mc := range source.MatchConditions {
+		add(fmt.Sprintf("matchConditions[%d].expression", i), compiler.CompileCELExpression(
+			&matchconditions.MatchCondition{Name: mc.Name, Expression: mc.Expression},
+			options, environment.StoredExpressions))
+	}
+
+	for i, v := range source.Validations {
+		add(fmt.Sprintf("validations[%d].expression", i), compiler.CompileCELExpression(
+			&validating.ValidationCondition{Expression: v.Expression, Message: v.Message},
+			options, environment.StoredExpressions))
+
+		if v.MessageExpression != "" {
+			add(fmt.Sprintf("validations[%d].messageExpression", i), compiler.CompileCELExpression(
+				&validating.MessageExpressionCondition{MessageExpression: v.MessageExpression},
+				messageOptions, environment.StoredExpressions))
+		}
+
+		if v.DetailsExpression != "" {
+			add(fmt.Sprintf("validations[%d].detailsExpression", i), compiler.CompileCELExpression(
+				&pSchema.DetailsCondition{DetailsExpression: v.DetailsExpression},
+				messageOptions, environment.StoredExpressions))
+		}
+
+		for j, a := range v.AuditAnnotations {
+			add(fmt.Sprintf("validations[%d].auditAnnotations[%d].valueExpression", i, j), compiler.CompileCELExpression(
+				&validating.AuditAnnotationCondition{Key: a.Key, ValueExpression: a.ValueExpression},
+				messageOptions, environment.StoredExpressions))
+		}
+	}
+
+	for i, a := range source.AuditAnnotations {
+		add(fmt.Sprintf("auditAnnotations[%d].valueExpression", i), compiler.CompileCELExpression(
+			&validating.AuditAnnotationCondition{Key: a.Key, ValueExpression: a.ValueExpression},
+			messageOptions, environment.StoredExpressions))
+	}
+
+	return errs
+}
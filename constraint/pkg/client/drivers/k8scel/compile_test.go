@@ -0,0 +1,121 @@
+package k8scel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+)
+
+func TestDriver_AddTemplate_CompilationErrors(t *testing.T) {
+	valid := schema.Validation{Expression: "true", Message: "ok"}
+
+	tests := []struct {
+		name   string
+		source *schema.Source
+		want   []templates.CreateCRDError
+	}{{
+		name: "valid",
+		source: &schema.Source{
+			Variables:       []schema.Variable{{Name: "name", Expression: "object.metadata.name"}},
+			MatchConditions: []schema.MatchCondition{{Name: "always", Expression: "true"}},
+			Validations: []schema.Validation{{
+				Expression:        `variables.name != "forbidden"`,
+				MessageExpression: `"forbidden name " + variables.name`,
+			}},
+		},
+	}, {
+		name: "invalid validation expression",
+		source: &schema.Source{
+			Validations: []schema.Validation{valid, {Expression: "object.metadata.name ==", Message: "bad"}},
+		},
+		want: []templates.CreateCRDError{{Code: ErrorCodeCompile, Location: "validations[1].expression"}},
+	}, {
+		name: "validation expression of the wrong type",
+		source: &schema.Source{
+			Validations: []schema.Validation{{Expression: "1", Message: "bad"}},
+		},
+		want: []templates.CreateCRDError{{Code: ErrorCodeCompile, Location: "validations[0].expression"}},
+	}, {
+		name: "invalid message expression",
+		source: &schema.Source{
+			Validations: []schema.Validation{{Expression: "true", MessageExpression: "1 +"}},
+		},
+		want: []templates.CreateCRDError{{Code: ErrorCodeCompile, Location: "validations[0].messageExpression"}},
+	}, {
+		name: "invalid match condition",
+		source: &schema.Source{
+			MatchConditions: []schema.MatchCondition{{Name: "always", Expression: "true"}, {Name: "bad", Expression: "undefined_variable"}},
+			Validations:     []schema.Validation{valid},
+		},
+		want: []templates.CreateCRDError{{Code: ErrorCodeCompile, Location: "matchConditions[1].expression"}},
+	}, {
+		name: "invalid variable",
+		source: &schema.Source{
+			Variables:   []schema.Variable{{Name: "bad", Expression: "object.metadata.name +"}},
+			Validations: []schema.Validation{valid},
+		},
+		want: []templates.CreateCRDError{{Code: ErrorCodeCompile, Location: "variables[0].expression"}},
+	}, {
+		name: "multiple errors",
+		source: &schema.Source{
+			Variables:   []schema.Variable{{Name: "bad", Expression: "("}},
+			Validations: []schema.Validation{{Expression: ")", MessageExpression: "("}},
+		},
+		want: []templates.CreateCRDError{
+			{Code: ErrorCodeCompile, Location: "variables[0].expression"},
+			{Code: ErrorCodeCompile, Location: "validations[0].expression"},
+			{Code: ErrorCodeCompile, Location: "validations[0].messageExpression"},
+		},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := New()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tmpl := cts.New(cts.OptName("k8stest"), cts.OptCRDNames("K8sTest"),
+				cts.OptTargets(cts.TargetCustomEngines(target, cts.Code(schema.Name, tt.source.MustToUnstructured()))))
+
+			err = d.AddTemplate(context.Background(), tmpl)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("got AddTemplate() error = %v, want %v", err, nil)
+				}
+				return
+			}
+
+			if !errors.Is(err, clienterrors.ErrInvalidConstraintTemplate) {
+				t.Fatalf("got AddTemplate() error = %v, want %v", err, clienterrors.ErrInvalidConstraintTemplate)
+			}
+
+			var compilationErr *CompilationError
+			if !errors.As(err, &compilationErr) {
+				t.Fatalf("got AddTemplate() error = %v, want %T", err, compilationErr)
+			}
+
+			if diff := cmp.Diff(tt.want, compilationErr.Errors,
+				cmpopts.IgnoreFields(templates.CreateCRDError{}, "Message")); diff != "" {
+				t.Error(diff)
+			}
+
+			for _, e := range compilationErr.Errors {
+				if e.Message == "" {
+					t.Errorf("got empty message for %v", e)
+				}
+			}
+
+			if _, found := d.validators[tmpl.GetName()]; found {
+				t.Error("got template added after compilation error, want not added")
+			}
+		})
+	}
+}
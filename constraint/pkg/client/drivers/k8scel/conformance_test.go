@@ -0,0 +1,22 @@
+package k8scel
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/conformance"
+)
+
+func TestDriver_Conformance(t *testing.T) {
+	suite := conformance.K8sCELSuite(func(t *testing.T) drivers.Driver {
+		d, err := New(ReferentialData())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return d
+	})
+	suite.Stats = []string{runTimeNS, runTimeCost}
+
+	suite.Run(t)
+}
@@ -0,0 +1,181 @@
+package k8scel
+
+import (
+	"context"
+	"fmt"
+
+	celgo "github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker"
+	pSchema "github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+	celAPI "k8s.io/apiserver/pkg/apis/cel"
+	apiservercel "k8s.io/apiserver/pkg/cel"
+	"k8s.io/apiserver/pkg/cel/environment"
+	"k8s.io/apiserver/pkg/cel/library"
+)
+
+const (
+	runTimeCost            = "runTimeCost"
+	runTimeCostDescription = "the CEL runtime cost of evaluating the constraint"
+)
+
+// CostEstimate is the estimated cost of evaluating one of a template's CEL
+// expressions.
+type CostEstimate struct {
+	// Location is the path to the expression in the template's source, for
+	// example "validations[0].expression".
+	Location string `json:"location"`
+
+	// Min and Max are the estimated best-case and worst-case costs.
+	Min uint64 `json:"min"`
+	Max uint64 `json:"max"`
+}
+
+// estimateCosts returns the estimated cost of each of source's expressions.
+// Variables are estimated on their own; the cost of referencing a variable
+// from another expression does not include the cost of evaluating it.
+func estimateCosts(compositionEnv *cel.CompositionEnv, source *pSchema.Source) ([]CostEstimate, error) {
+	requestType := cel.BuildRequestType()
+	namespaceType := cel.BuildNamespaceType()
+
+	// Mirror the variables the admission plugin declares when compiling
+	// expressions, so the same expressions type-check.
+	envSet, err := compositionEnv.EnvSet.Extend(environment.VersionedOptions{
+		IntroducedVersion: version.MajorMinor(1, 0),
+		EnvOptions: []celgo.EnvOption{
+			celgo.Variable(cel.ParamsVarName, celgo.DynType),
+			celgo.Variable(cel.ObjectVarName, celgo.DynType),
+			celgo.Variable(cel.OldObjectVarName, celgo.DynType),
+			celgo.Variable(cel.NamespaceVarName, namespaceType.CelType()),
+			celgo.Variable(cel.RequestVarName, requestType.CelType()),
+			celgo.Variable(cel.AuthorizerVarName, library.AuthorizerType),
+			celgo.Variable(cel.RequestResourceAuthorizerVarName, library.ResourceCheckType),
+		},
+		DeclTypes: []*apiservercel.DeclType{namespaceType, requestType},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := envSet.Env(environment.StoredExpressions)
+	if err != nil {
+		return nil, err
+	}
+
+	estimator := &library.CostEstimator{SizeEstimator: sizeEstimator{}}
+
+	var estimates []CostEstimate
+	estimate := func(location, expression string) error {
+		ast, issues := env.Compile(expression)
+		if issues != nil && issues.Err() != nil {
+			return fmt.Errorf("%s: %w", location, issues.Err())
+		}
+
+		cost, err := env.EstimateCost(ast, estimator)
+		if err != nil {
+			return fmt.Errorf("%s: %w", location, err)
+		}
+
+		estimates = append(estimates, CostEstimate{Location: location, Min: cost.Min, Max: cost.Max})
+		return nil
+	}
+
+	for i, v := range source.Variables {
+		if err := estimate(fmt.Sprintf("variables[%d].expression", i), v.Expression); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, mc := range source.MatchConditions {
+		if err := estimate(fmt.Sprintf("matchConditions[%d].expression", i), mc.Expression); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, v := range source.Validations {
+		if err := estimate(fmt.Sprintf("validations[%d].expression", i), v.Expression); err != nil {
+			return nil, err
+		}
+
+		if v.MessageExpression != "" {
+			if err := estimate(fmt.Sprintf("validations[%d].messageExpression", i), v.MessageExpression); err != nil {
+				return nil, err
+			}
+		}
+
+		if v.DetailsExpression != "" {
+			if err := estimate(fmt.Sprintf("validations[%d].detailsExpression", i), v.DetailsExpression); err != nil {
+				return nil, err
+			}
+		}
+
+		for j, a := range v.AuditAnnotations {
+			if err := estimate(fmt.Sprintf("validations[%d].auditAnnotations[%d].valueExpression", i, j), a.ValueExpression); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for i, a := range source.AuditAnnotations {
+		if err := estimate(fmt.Sprintf("auditAnnotations[%d].valueExpression", i), a.ValueExpression); err != nil {
+			return nil, err
+		}
+	}
+
+	return estimates, nil
+}
+
+// sizeEstimator bounds the sizes CEL cannot determine statically, such as the
+// number of items in a list of the object under review. Objects are
+// unstructured, so the only bound is the maximum size of a request: at worst
+// every other byte is a separate item. Worst-case estimates are therefore far
+// beyond the cost of evaluating real objects, which is why they are reported
+// but not enforced.
+type sizeEstimator struct{}
+
+func (sizeEstimator) EstimateSize(_ checker.AstNode) *checker.SizeEstimate {
+	return &checker.SizeEstimate{Min: 0, Max: uint64(celAPI.MaxRequestSizeBytes) / 2}
+}
+
+func (sizeEstimator) EstimateCallCost(_, _ string, _ *checker.AstNode, _ []checker.AstNode) *checker.CallEstimate {
+	return nil
+}
+
+type costTrackerKey struct{}
+
+// costTracker accumulates the runtime cost of the expressions evaluated for a
+// single constraint.
+type costTracker struct {
+	cost int64
+}
+
+// withCostTracker returns a context which costFilters report the cost of their
+// evaluations to.
+func withCostTracker(ctx context.Context, tracker *costTracker) context.Context {
+	return context.WithValue(ctx, costTrackerKey{}, tracker)
+}
+
+// costFilter reports the runtime cost spent by the wrapped Filter to the
+// context's costTracker. The validator does not otherwise expose the cost of
+// validating an object.
+type costFilter struct {
+	cel.Filter
+}
+
+func (f *costFilter) ForInput(ctx context.Context, versionedAttr *admission.VersionedAttributes, request *admissionv1.AdmissionRequest, optionalVars cel.OptionalVariableBindings, namespace *corev1.Namespace, runtimeCELCostBudget int64) ([]cel.EvaluationResult, int64, error) {
+	results, remaining, err := f.Filter.ForInput(ctx, versionedAttr, request, optionalVars, namespace, runtimeCELCostBudget)
+
+	if tracker, ok := ctx.Value(costTrackerKey{}).(*costTracker); ok {
+		if remaining < 0 {
+			// The filter ran out of budget, so it spent all of it.
+			remaining = 0
+		}
+		tracker.cost += runtimeCELCostBudget - remaining
+	}
+
+	return results, remaining, err
+}
@@ -0,0 +1,221 @@
+package k8scel
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/ptr"
+)
+
+func TestDriver_RuntimeCostLimit(t *testing.T) {
+	cheap := schema.Validation{Expression: `object.metadata.name != "forbidden"`, Message: "forbidden name"}
+	expensive := schema.Validation{Expression: `object.spec.rules.all(r, r.host.matches("^[a-z.]+$"))`, Message: "bad host"}
+
+	tests := []struct {
+		name          string
+		driverLimit   int64
+		templateLimit *int64
+		validations   []schema.Validation
+		wantLocations []string
+		wantCostLimit int64
+	}{{
+		name:          "no limit",
+		validations:   []schema.Validation{cheap, expensive},
+		wantLocations: []string{"validations[0].expression", "validations[1].expression"},
+	}, {
+		name:          "driver limit",
+		driverLimit:   1000,
+		validations:   []schema.Validation{cheap},
+		wantLocations: []string{"validations[0].expression"},
+		wantCostLimit: 1000,
+	}, {
+		// Worst-case estimates for unstructured objects are far beyond the
+		// limit, but limits are only enforced at runtime.
+		name:          "expensive expressions are accepted under a limit",
+		driverLimit:   1000,
+		templateLimit: ptr.To[int64](1000),
+		validations:   []schema.Validation{cheap, expensive},
+		wantLocations: []string{"validations[0].expression", "validations[1].expression"},
+		wantCostLimit: 1000,
+	}, {
+		name:          "lower template limit takes precedence",
+		driverLimit:   1000,
+		templateLimit: ptr.To[int64](100),
+		validations:   []schema.Validation{cheap},
+		wantLocations: []string{"validations[0].expression"},
+		wantCostLimit: 100,
+	}, {
+		name:          "lower driver limit takes precedence",
+		driverLimit:   100,
+		templateLimit: ptr.To[int64](1000),
+		validations:   []schema.Validation{cheap},
+		wantLocations: []string{"validations[0].expression"},
+		wantCostLimit: 100,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			var args []Arg
+			if tt.driverLimit != 0 {
+				args = append(args, RuntimeCostLimit(tt.driverLimit))
+			}
+
+			d, err := New(args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			source := &schema.Source{Validations: tt.validations, RuntimeCostLimit: tt.templateLimit}
+			tmpl := cts.New(cts.OptName("k8stest"), cts.OptCRDNames("K8sTest"),
+				cts.OptTargets(cts.TargetCustomEngines(target, cts.Code(schema.Name, source.MustToUnstructured()))))
+
+			err = d.AddTemplate(ctx, tmpl)
+			if err != nil {
+				t.Fatalf("got AddTemplate() error = %v, want %v", err, nil)
+			}
+
+			estimates, err := d.GetCostEstimates(tmpl.GetName())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotLocations []string
+			for _, estimate := range estimates {
+				gotLocations = append(gotLocations, estimate.Location)
+				if estimate.Min > estimate.Max {
+					t.Errorf("got estimate %+v with Min > Max", estimate)
+				}
+			}
+			if diff := cmp.Diff(tt.wantLocations, gotLocations); diff != "" {
+				t.Error(diff)
+			}
+
+			if got := d.templates[tmpl.GetName()].costLimit; got != tt.wantCostLimit {
+				t.Errorf("got cost limit %d, want %d", got, tt.wantCostLimit)
+			}
+		})
+	}
+}
+
+func TestDriver_RuntimeCostLimit_Exceeded(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &schema.Source{
+		Validations: []schema.Validation{{
+			Expression: `object.spec.rules.all(r, r.host.matches("^[a-z.]+$"))`,
+			Message:    "bad host",
+		}},
+		RuntimeCostLimit: ptr.To[int64](1),
+	}
+	tmpl := cts.New(cts.OptName("k8stest"), cts.OptCRDNames("K8sTest"),
+		cts.OptTargets(cts.TargetCustomEngines(target, cts.Code(schema.Name, source.MustToUnstructured()))))
+
+	err = d.AddTemplate(ctx, tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, "K8sTest", "foo")
+	resp, err := d.Query(ctx, target, []*unstructured.Unstructured{constraint},
+		makeIngressReview(t, makeIngress(t, "foo", "foo", "example.com")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The template is accepted, and exceeding its limit fails evaluation.
+	if len(resp.Results) != 1 || !strings.Contains(resp.Results[0].Msg, "cost budget") {
+		t.Errorf("got results %v, want a single cost budget violation", resp.Results)
+	}
+}
+
+func TestRuntimeCostLimit_Invalid(t *testing.T) {
+	_, err := New(RuntimeCostLimit(0))
+	if !errors.Is(err, clienterrors.ErrCreatingDriver) {
+		t.Errorf("got New() error = %v, want %v", err, clienterrors.ErrCreatingDriver)
+	}
+}
+
+func TestDriver_GetCostEstimates_MissingTemplate(t *testing.T) {
+	d, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = d.GetCostEstimates("missing")
+	if !errors.Is(err, clienterrors.ErrMissingConstraintTemplate) {
+		t.Errorf("got GetCostEstimates() error = %v, want %v", err, clienterrors.ErrMissingConstraintTemplate)
+	}
+}
+
+func TestDriver_Query_CostStat(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := New(RuntimeCostLimit(1000000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &schema.Source{
+		Variables: []schema.Variable{{Name: "name", Expression: "object.metadata.name"}},
+		Validations: []schema.Validation{{
+			Expression:        `variables.name != "foo"`,
+			MessageExpression: `"forbidden name " + variables.name`,
+		}},
+	}
+	tmpl := cts.New(cts.OptName("k8stest"), cts.OptCRDNames("K8sTest"),
+		cts.OptTargets(cts.TargetCustomEngines(target, cts.Code(schema.Name, source.MustToUnstructured()))))
+
+	err = d.AddTemplate(ctx, tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, "K8sTest", "foo")
+	resp, err := d.Query(ctx, target, []*unstructured.Unstructured{constraint},
+		makeIngressReview(t, makeIngress(t, "foo", "foo", "example.com")), drivers.Stats(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Results) != 1 || resp.Results[0].Msg != "forbidden name foo" {
+		t.Fatalf("got results %v, want a single violation", resp.Results)
+	}
+
+	if len(resp.StatsEntries) != 1 {
+		t.Fatalf("got %d stats entries, want %d", len(resp.StatsEntries), 1)
+	}
+
+	var cost uint64
+	found := false
+	for _, stat := range resp.StatsEntries[0].Stats {
+		if stat.Name == runTimeCost {
+			cost, found = stat.Value.(uint64), true
+		}
+	}
+	if !found {
+		t.Fatalf("got stats %v, want %q", resp.StatsEntries[0].Stats, runTimeCost)
+	}
+	if cost == 0 || cost > 1000 {
+		t.Errorf("got cost %d, want within (0, 1000] for a small object", cost)
+	}
+
+	description, err := d.GetDescriptionForStat(runTimeCost)
+	if err != nil || description != runTimeCostDescription {
+		t.Errorf("got description %q, %v, want %q", description, err, runTimeCostDescription)
+	}
+}
@@ -0,0 +1,153 @@
+package k8scel
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/google/cel-go/common/types"
+	pSchema "github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	ctypes "github.com/open-policy-agent/frameworks/constraint/pkg/types"
+	"google.golang.org/protobuf/types/known/structpb"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/validating"
+)
+
+// validationFilters evaluate the details and audit annotations of violations
+// of a validation.
+type validationFilters struct {
+	// details is nil if the validation has no detailsExpression.
+	details cel.Filter
+	// auditAnnotations is nil if the validation has no auditAnnotations.
+	auditAnnotations cel.Filter
+}
+
+// compileValidationFilters compiles the details and audit annotations of each
+// of source's validations.
+func (d *Driver) compileValidationFilters(compiler *cel.CompositedCompiler, source *pSchema.Source, options cel.OptionalVariableDeclarations) ([]validationFilters, error) {
+	filters := make([]validationFilters, len(source.Validations))
+	for i, v := range source.Validations {
+		if v.DetailsExpression != "" {
+			filters[i].details = d.compile(compiler, []cel.ExpressionAccessor{&pSchema.DetailsCondition{DetailsExpression: v.DetailsExpression}}, options)
+		}
+
+		auditAnnotations, err := v.GetAuditAnnotations()
+		if err != nil {
+			return nil, err
+		}
+		if len(auditAnnotations) > 0 {
+			filters[i].auditAnnotations = d.compile(compiler, auditAnnotations, options)
+		}
+	}
+
+	return filters, nil
+}
+
+// evalInput is what filters are evaluated against when describing the
+// violations of a Constraint.
+type evalInput struct {
+	attributes *admission.VersionedAttributes
+	request    *admissionv1.AdmissionRequest
+	params     runtime.Object
+	namespace  *corev1.Namespace
+	// budget is the runtime cost budget for evaluating the Constraint, shared
+	// with its validations.
+	budget int64
+	// tracker records the cost already spent evaluating the Constraint.
+	tracker *costTracker
+}
+
+func newEvalInput(attributes *admission.VersionedAttributes, params runtime.Object, namespace *corev1.Namespace, budget int64, tracker *costTracker) *evalInput {
+	return &evalInput{
+		attributes: attributes,
+		request:    cel.CreateAdmissionRequest(attributes.Attributes, metav1.GroupVersionResource(attributes.GetResource()), metav1.GroupVersionKind(attributes.VersionedKind)),
+		params:     params,
+		namespace:  namespace,
+		budget:     budget,
+		tracker:    tracker,
+	}
+}
+
+// evaluate returns the results of evaluating filter within what remains of
+// the budget, or nil if filter is nil, the budget is exhausted, or filter
+// cannot be evaluated.
+func (in *evalInput) evaluate(ctx context.Context, filter cel.Filter) []cel.EvaluationResult {
+	if filter == nil {
+		return nil
+	}
+
+	remaining := in.budget - in.tracker.cost
+	if remaining <= 0 {
+		return nil
+	}
+
+	results, _, err := filter.ForInput(withCostTracker(ctx, in.tracker), in.attributes, in.request, cel.OptionalVariableBindings{VersionedParams: in.params}, in.namespace, remaining)
+	if err != nil {
+		return nil
+	}
+	return results
+}
+
+// details returns the value of the details filter converted to JSON-compatible
+// types. As with Rego templates, details default to an empty object, which is
+// also the result if the expression fails to evaluate.
+func (in *evalInput) details(ctx context.Context, filter cel.Filter) interface{} {
+	for _, result := range in.evaluate(ctx, filter) {
+		if result.Error != nil || result.EvalResult == nil {
+			break
+		}
+
+		value, err := result.EvalResult.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+		if err != nil {
+			break
+		}
+		return value.(*structpb.Value).AsInterface()
+	}
+
+	return map[string]interface{}{}
+}
+
+// addAuditAnnotations adds the values of the auditAnnotations filter to
+// annotations. As for ValidatingAdmissionPolicies, annotations whose
+// expressions evaluate to null are omitted, as are those which fail to
+// evaluate.
+func (in *evalInput) addAuditAnnotations(ctx context.Context, filter cel.Filter, annotations map[string]string) {
+	for _, result := range in.evaluate(ctx, filter) {
+		if result.Error != nil {
+			continue
+		}
+
+		condition, ok := result.ExpressionAccessor.(*validating.AuditAnnotationCondition)
+		if !ok {
+			continue
+		}
+
+		if value, ok := result.EvalResult.(types.String); ok {
+			annotations[condition.Key] = string(value)
+		}
+	}
+}
+
+// describeViolation sets the details and annotations of result, a violation of
+// the template's validation at index, or -1 if it is not known which
+// validation was violated. The validation's audit annotations take precedence
+// over those of the template.
+func (e *templateEntry) describeViolation(ctx context.Context, input *evalInput, index int, result *ctypes.Result) {
+	var filters validationFilters
+	if index >= 0 && index < len(e.validationFilters) {
+		filters = e.validationFilters[index]
+	}
+
+	result.Metadata = map[string]interface{}{"details": input.details(ctx, filters.details)}
+
+	annotations := make(map[string]string)
+	input.addAuditAnnotations(ctx, e.auditAnnotations, annotations)
+	input.addAuditAnnotations(ctx, filters.auditAnnotations, annotations)
+	if len(annotations) > 0 {
+		result.Annotations = annotations
+	}
+}
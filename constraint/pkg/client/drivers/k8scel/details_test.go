@@ -0,0 +1,215 @@
+package k8scel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDriver_Query_DetailsAndAnnotations(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &schema.Source{
+		AuditAnnotations: []schema.AuditAnnotation{{
+			Key:             "host",
+			ValueExpression: "string(object.spec.rules[0].host)",
+		}, {
+			Key:             "owner",
+			ValueExpression: `has(object.metadata.labels) && "owner" in object.metadata.labels ? string(object.metadata.labels["owner"]) : "none"`,
+		}, {
+			Key:             "omitted",
+			ValueExpression: "null",
+		}},
+		Validations: []schema.Validation{{
+			Expression:        `object.metadata.name != "forbidden"`,
+			Message:           "forbidden name",
+			DetailsExpression: `{"name": object.metadata.name, "rules": dyn(size(object.spec.rules)), "hosts": dyn(object.spec.rules.map(r, r.host))}`,
+			AuditAnnotations: []schema.AuditAnnotation{{
+				Key:             "host",
+				ValueExpression: `"overridden " + object.spec.rules[0].host`,
+			}},
+		}, {
+			Expression: `!object.spec.rules[0].host.endsWith(".internal")`,
+			Message:    "internal host",
+		}, {
+			Expression:        `object.metadata.namespace != "forbidden"`,
+			Message:           "forbidden namespace",
+			DetailsExpression: `object.metadata.missing`,
+		}},
+	}
+	tmpl := cts.New(cts.OptName("k8sdetails"), cts.OptCRDNames("K8sDetails"),
+		cts.OptTargets(cts.TargetCustomEngines(target, cts.Code(schema.Name, source.MustToUnstructured()))))
+	if err := d.AddTemplate(ctx, tmpl); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		objName   string
+		host      string
+		labels    map[string]string
+		want      []*types.Result
+	}{{
+		name:      "no violations",
+		namespace: "foo",
+		objName:   "bar",
+		host:      "example.com",
+	}, {
+		name:      "details and validation annotations",
+		namespace: "foo",
+		objName:   "forbidden",
+		host:      "example.com",
+		labels:    map[string]string{"owner": "alice"},
+		want: []*types.Result{{
+			Msg: "forbidden name",
+			Metadata: map[string]interface{}{"details": map[string]interface{}{
+				"name":  "forbidden",
+				"rules": float64(1),
+				"hosts": []interface{}{"example.com"},
+			}},
+			Annotations: map[string]string{"host": "overridden example.com", "owner": "alice"},
+		}},
+	}, {
+		name:      "template annotations without details",
+		namespace: "foo",
+		objName:   "bar",
+		host:      "example.internal",
+		want: []*types.Result{{
+			Msg:         "internal host",
+			Metadata:    map[string]interface{}{"details": map[string]interface{}{}},
+			Annotations: map[string]string{"host": "example.internal", "owner": "none"},
+		}},
+	}, {
+		name:      "failing details expression",
+		namespace: "forbidden",
+		objName:   "bar",
+		host:      "example.com",
+		want: []*types.Result{{
+			Msg:         "forbidden namespace",
+			Metadata:    map[string]interface{}{"details": map[string]interface{}{}},
+			Annotations: map[string]string{"host": "example.com", "owner": "none"},
+		}},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review := &unstructured.Unstructured{Object: makeIngress(t, tt.namespace, tt.objName, tt.host)}
+			review.SetLabels(tt.labels)
+
+			constraint := cts.MakeConstraint(t, "K8sDetails", "details")
+			resp, err := d.Query(ctx, target, []*unstructured.Unstructured{constraint}, review)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range tt.want {
+				want.Target = target
+				want.Constraint = constraint
+				want.EnforcementAction = "deny"
+			}
+			if diff := cmp.Diff(tt.want, resp.Results, cmpopts.EquateEmpty()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestDriver_AddTemplate_DetailsCompilationErrors(t *testing.T) {
+	source := &schema.Source{
+		Validations: []schema.Validation{{
+			Expression:        "true",
+			DetailsExpression: "object.metadata.name +",
+			AuditAnnotations: []schema.AuditAnnotation{{
+				Key:             "count",
+				ValueExpression: "size(object.spec.rules)",
+			}},
+		}},
+		AuditAnnotations: []schema.AuditAnnotation{{
+			Key:             "name",
+			ValueExpression: "object.metadata.name +",
+		}},
+	}
+	tmpl := cts.New(cts.OptName("k8sdetails"), cts.OptCRDNames("K8sDetails"),
+		cts.OptTargets(cts.TargetCustomEngines(target, cts.Code(schema.Name, source.MustToUnstructured()))))
+
+	d, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.AddTemplate(context.Background(), tmpl)
+	var compilationErr *CompilationError
+	if !errors.As(err, &compilationErr) || !errors.Is(err, clienterrors.ErrInvalidConstraintTemplate) {
+		t.Fatalf("got AddTemplate() error = %v, want a CompilationError", err)
+	}
+
+	var got []string
+	for _, e := range compilationErr.Errors {
+		got = append(got, e.Location)
+	}
+	want := []string{
+		"validations[0].detailsExpression",
+		"validations[0].auditAnnotations[0].valueExpression",
+		"auditAnnotations[0].valueExpression",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestDriver_Query_DetailsCostBudget(t *testing.T) {
+	ctx := context.Background()
+
+	// Each validation costs little to evaluate, but its details cost more than
+	// half of the budget. Details share the budget with the validations, so
+	// only the first violation's details fit in what remains.
+	d, err := New(RuntimeCostLimit(60))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validation := schema.Validation{
+		Expression:        `object.metadata.name != "forbidden"`,
+		Message:           "forbidden name",
+		DetailsExpression: `{"name": object.metadata.name, "namespace": object.metadata.namespace}`,
+	}
+	source := &schema.Source{Validations: []schema.Validation{validation, validation}}
+	tmpl := cts.New(cts.OptName("k8sdetails"), cts.OptCRDNames("K8sDetails"),
+		cts.OptTargets(cts.TargetCustomEngines(target, cts.Code(schema.Name, source.MustToUnstructured()))))
+	if err := d.AddTemplate(ctx, tmpl); err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, "K8sDetails", "details")
+	review := &unstructured.Unstructured{Object: makeIngress(t, "foo", "forbidden", "example.com")}
+	resp, err := d.Query(ctx, target, []*unstructured.Unstructured{constraint}, review)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []interface{}
+	for _, result := range resp.Results {
+		got = append(got, result.Metadata["details"])
+	}
+	want := []interface{}{
+		map[string]interface{}{"name": "forbidden", "namespace": "foo"},
+		map[string]interface{}{},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error(diff)
+	}
+}
@@ -2,7 +2,7 @@ package k8scel
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
@@ -12,16 +12,21 @@ import (
 	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
 	pSchema "github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/transform"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/instrumentation"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/types"
 	"github.com/open-policy-agent/opa/storage"
 	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apiserver/pkg/admission"
 	"k8s.io/apiserver/pkg/admission/plugin/cel"
-	"k8s.io/apiserver/pkg/admission/plugin/validatingadmissionpolicy"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/validating"
 	"k8s.io/apiserver/pkg/admission/plugin/webhook/matchconditions"
 	celAPI "k8s.io/apiserver/pkg/apis/cel"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
 	"k8s.io/apiserver/pkg/cel/environment"
 )
 
@@ -51,8 +56,65 @@ var _ drivers.Driver = &Driver{}
 
 type Driver struct {
 	mux         sync.RWMutex
-	validators  map[string]validatingadmissionpolicy.Validator
+	validators  map[string]validating.Validator
 	gatherStats bool
+
+	// envSet is the CEL environment templates are compiled in.
+	envSet *environment.EnvSet
+
+	// referentialData is whether the driver stores data passed to AddData for
+	// use by referential Constraints.
+	referentialData bool
+	inventory       inventory
+
+	// templates are the loaded templates, keyed by template name.
+	templates map[string]*templateEntry
+
+	// runtimeCostLimit is the CEL runtime cost budget for evaluating each
+	// Constraint. Zero if not configured.
+	runtimeCostLimit int64
+
+	// userInfo is the requesting user of the admission requests synthesized
+	// for reviews of objects rather than requests.
+	userInfo user.Info
+
+	// namespaceResolver resolves the Namespaces bound to namespaceObject.
+	namespaceResolver NamespaceResolver
+	// authorizer is bound to the authorizer variable. If nil, templates may
+	// not reference authorizer.
+	authorizer authorizer.Authorizer
+}
+
+// templateEntry records how a template was loaded.
+type templateEntry struct {
+	kind   string
+	target string
+	source *pSchema.Source
+	// variables are the template's variables, including those injected by the
+	// driver.
+	variables []cel.NamedExpressionAccessor
+
+	// auditAnnotations evaluates the template's auditAnnotations for every
+	// violation. Nil if the template has none.
+	auditAnnotations cel.Filter
+	// validationFilters evaluates the details and audit annotations of
+	// violations of each of the template's validations.
+	validationFilters []validationFilters
+
+	// costLimit is the lower of the driver's and the template's runtime cost
+	// limits. Zero if neither is configured.
+	costLimit     int64
+	costEstimates []CostEstimate
+}
+
+// costBudget returns the runtime cost budget for evaluating a Constraint of
+// the template.
+func (e *templateEntry) costBudget() int64 {
+	if e.costLimit == 0 {
+		return celAPI.PerCallLimit
+	}
+
+	return e.costLimit
 }
 
 func (d *Driver) Name() string {
@@ -65,10 +127,14 @@ func (d *Driver) AddTemplate(_ context.Context, ct *templates.ConstraintTemplate
 		return err
 	}
 
-	// FRICTION: Note that compilation errors are possible, but we cannot introspect to see whether any
-	// occurred
+	// FRICTION: Note that compilation errors are possible, but the validator does not expose them, so
+	// they are checked for separately by compileErrors.
 	celVars := cel.OptionalVariableDeclarations{}
 
+	// As for ValidatingAdmissionPolicies, validations and match conditions may
+	// also reference the authorizer, but message expressions may not.
+	celVarsWithAuthorizer := cel.OptionalVariableDeclarations{HasAuthorizer: d.authorizer != nil}
+
 	// We don't want to have access to parameters for anything other than driver-defined logic, so we
 	// can keep the user from accessing the full constraint schema.
 	celVarsWithParameters := cel.OptionalVariableDeclarations{HasParams: true}
@@ -78,11 +144,28 @@ func (d *Driver) AddTemplate(_ context.Context, ct *templates.ConstraintTemplate
 		return err
 	}
 	vapVars = append(vapVars, transform.AllVariablesCEL()...)
-	filterCompiler, err := cel.NewCompositedCompiler(environment.MustBaseEnvSet(environment.DefaultCompatibilityVersion()))
+	paramsType := paramsDeclType(ct)
+	filterCompiler, err := newCompiler(d.envSet, paramsType)
 	if err != nil {
 		return err
 	}
-	filterCompiler.CompileAndStoreVariables(vapVars, celVarsWithParameters, environment.StoredExpressions)
+	compileVariables(filterCompiler, vapVars, celVarsWithParameters, paramsType != nil)
+
+	if errs := compileErrors(filterCompiler, source, celVarsWithAuthorizer, celVars); len(errs) > 0 {
+		return &CompilationError{Template: ct.GetName(), Errors: errs}
+	}
+
+	costEstimates, err := estimateCosts(filterCompiler.CompositionEnv, source)
+	if err != nil {
+		return fmt.Errorf("estimating CEL costs of template %q: %w", ct.GetName(), err)
+	}
+
+	// The limit is only enforced at runtime, against the cost of evaluating
+	// actual objects.
+	costLimit := d.runtimeCostLimit
+	if source.RuntimeCostLimit != nil && (costLimit == 0 || *source.RuntimeCostLimit < costLimit) {
+		costLimit = *source.RuntimeCostLimit
+	}
 
 	failurePolicy, err := source.GetFailurePolicy()
 	if err != nil {
@@ -93,7 +176,7 @@ func (d *Driver) AddTemplate(_ context.Context, ct *templates.ConstraintTemplate
 	if err != nil {
 		return err
 	}
-	matcher := matchconditions.NewMatcher(filterCompiler.Compile(matchAccessors, celVars, environment.StoredExpressions), failurePolicy, "validatingadmissionpolicy", "vap-matcher", ct.GetName())
+	matcher := matchconditions.NewMatcher(d.compile(filterCompiler, matchAccessors, celVarsWithAuthorizer), failurePolicy, "validatingadmissionpolicy", "vap-matcher", ct.GetName())
 
 	validationAccessors, err := source.GetValidations()
 	if err != nil {
@@ -105,24 +188,72 @@ func (d *Driver) AddTemplate(_ context.Context, ct *templates.ConstraintTemplate
 		return err
 	}
 
-	validator := validatingadmissionpolicy.NewValidator(
-		filterCompiler.Compile(validationAccessors, celVars, environment.StoredExpressions),
+	auditAnnotationAccessors, err := source.GetAuditAnnotations()
+	if err != nil {
+		return err
+	}
+	var auditAnnotations cel.Filter
+	if len(auditAnnotationAccessors) > 0 {
+		auditAnnotations = d.compile(filterCompiler, auditAnnotationAccessors, celVars)
+	}
+
+	validationFilters, err := d.compileValidationFilters(filterCompiler, source, celVars)
+	if err != nil {
+		return err
+	}
+
+	validator := validating.NewValidator(
+		d.compile(filterCompiler, validationAccessors, celVarsWithAuthorizer),
 		matcher,
-		filterCompiler.Compile(nil, celVars, environment.StoredExpressions),
-		filterCompiler.Compile(messageAccessors, celVars, environment.StoredExpressions),
+		d.compile(filterCompiler, nil, celVars),
+		d.compile(filterCompiler, messageAccessors, celVars),
 		failurePolicy,
 	)
 
+	entry := &templateEntry{
+		kind:      ct.Spec.CRD.Spec.Names.Kind,
+		target:    ct.Spec.Targets[0].Target,
+		source:    source,
+		variables: vapVars,
+
+		auditAnnotations:  auditAnnotations,
+		validationFilters: validationFilters,
+
+		costLimit:     costLimit,
+		costEstimates: costEstimates,
+	}
+
 	d.mux.Lock()
 	defer d.mux.Unlock()
 	d.validators[ct.GetName()] = validator
+	d.templates[ct.GetName()] = entry
 	return nil
 }
 
+// compile compiles expressions into a Filter which reports its runtime cost.
+func (d *Driver) compile(compiler *cel.CompositedCompiler, expressions []cel.ExpressionAccessor, options cel.OptionalVariableDeclarations) cel.Filter {
+	return &costFilter{Filter: compiler.Compile(expressions, options, environment.StoredExpressions)}
+}
+
+// GetCostEstimates returns the estimated cost of each of the named template's
+// CEL expressions, as computed when it was added.
+func (d *Driver) GetCostEstimates(templateName string) ([]CostEstimate, error) {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	entry, found := d.templates[templateName]
+	if !found {
+		return nil, fmt.Errorf("%w: %q", clienterrors.ErrMissingConstraintTemplate, templateName)
+	}
+
+	return entry.costEstimates, nil
+}
+
 func (d *Driver) RemoveTemplate(_ context.Context, ct *templates.ConstraintTemplate) error {
 	d.mux.Lock()
 	defer d.mux.Unlock()
 	delete(d.validators, ct.GetName())
+	delete(d.templates, ct.GetName())
 	return nil
 }
 
@@ -134,11 +265,31 @@ func (d *Driver) RemoveConstraint(_ context.Context, _ *unstructured.Unstructure
 	return nil
 }
 
-func (d *Driver) AddData(_ context.Context, _ string, _ storage.Path, _ interface{}) error {
+// SupportsReferentialData returns true if the driver was created with
+// ReferentialData.
+func (d *Driver) SupportsReferentialData() bool {
+	return d.referentialData
+}
+
+// AddData stores data for use by referential Constraints, which access it
+// through the inventory variable. Does nothing unless the driver was created
+// with ReferentialData.
+func (d *Driver) AddData(_ context.Context, target string, path storage.Path, data interface{}) error {
+	if !d.referentialData {
+		return nil
+	}
+
+	d.inventory.add(target, path, data)
 	return nil
 }
 
-func (d *Driver) RemoveData(_ context.Context, _ string, _ storage.Path) error {
+// RemoveData removes data stored by AddData.
+func (d *Driver) RemoveData(_ context.Context, target string, path storage.Path) error {
+	if !d.referentialData {
+		return nil
+	}
+
+	d.inventory.remove(target, path)
 	return nil
 }
 
@@ -153,28 +304,42 @@ func (d *Driver) Query(ctx context.Context, target string, constraints []*unstru
 
 	var statsEntries []*instrumentation.StatsEntry
 
-	arGetter, ok := review.(ARGetter)
-	if !ok {
-		return nil, errors.New("cannot convert review to ARGetter")
-	}
-	aRequest := arGetter.GetAdmissionRequest()
-	versionedAttr, err := transform.RequestToVersionedAttributes(aRequest)
+	versionedAttr, err := d.reviewAttributes(review)
 	if err != nil {
 		return nil, err
 	}
 
 	results := []*types.Result{}
 
+	var targetInventory map[string]interface{}
+	if d.referentialData {
+		d.inventory.mtx.RLock()
+		defer d.inventory.mtx.RUnlock()
+		targetInventory = d.inventory.get(target)
+	}
+
+	namespace, err := d.resolveNamespace(ctx, versionedAttr.GetNamespace(), targetInventory)
+	if err != nil {
+		return nil, err
+	}
+
 	for _, constraint := range constraints {
 		evalStartTime := time.Now()
 		// template name is the lowercase of its kind
-		validator := d.validators[strings.ToLower(constraint.GetKind())]
-		if validator == nil {
+		templateName := strings.ToLower(constraint.GetKind())
+		validator := d.validators[templateName]
+		entry := d.templates[templateName]
+		if validator == nil || entry == nil {
 			return nil, fmt.Errorf("unknown constraint template validator: %s", constraint.GetKind())
 		}
 
-		// TODO: should namespace be made available, if possible? Generally that context should be present
-		response := validator.Validate(ctx, versionedAttr.GetResource(), versionedAttr, constraint, nil, celAPI.PerCallLimit, nil)
+		params := constraint
+		if targetInventory != nil {
+			params = withInventory(constraint, targetInventory)
+		}
+
+		tracker := &costTracker{}
+		response := validator.Validate(withCostTracker(ctx, tracker), versionedAttr.GetResource(), versionedAttr, params, namespace, entry.costBudget(), d.authorizer)
 
 		enforcementAction, found, err := unstructured.NestedString(constraint.Object, "spec", "enforcementAction")
 		if err != nil {
@@ -183,14 +348,23 @@ func (d *Driver) Query(ctx context.Context, target string, constraints []*unstru
 		if !found {
 			enforcementAction = apiconstraints.EnforcementActionDeny
 		}
-		for _, decision := range response.Decisions {
-			if decision.Action == validatingadmissionpolicy.ActionDeny {
-				results = append(results, &types.Result{
+		// Decisions correspond to validations, unless evaluation failed.
+		correspond := len(response.Decisions) == len(entry.source.Validations)
+		input := newEvalInput(versionedAttr, params, namespace, entry.costBudget(), tracker)
+		for i, decision := range response.Decisions {
+			if decision.Action == validating.ActionDeny {
+				result := &types.Result{
 					Target:            target,
 					Msg:               decision.Message,
 					Constraint:        constraint,
 					EnforcementAction: enforcementAction,
-				})
+				}
+				index := i
+				if !correspond {
+					index = -1
+				}
+				entry.describeViolation(ctx, input, index, result)
+				results = append(results, result)
 			}
 		}
 		evalElapsedTime := time.Since(evalStartTime)
@@ -208,6 +382,14 @@ func (d *Driver) Query(ctx context.Context, target string, constraints []*unstru
 								Value: pSchema.Name,
 							},
 						},
+						{
+							Name:  runTimeCost,
+							Value: uint64(tracker.cost),
+							Source: instrumentation.Source{
+								Type:  instrumentation.EngineSourceType,
+								Value: pSchema.Name,
+							},
+						},
 					},
 				})
 		}
@@ -215,19 +397,137 @@ func (d *Driver) Query(ctx context.Context, target string, constraints []*unstru
 	return &drivers.QueryResponse{Results: results, StatsEntries: statsEntries}, nil
 }
 
+// templateDump is the contents of the module Dump outputs for a loaded
+// template.
+type templateDump struct {
+	Validations     []pSchema.Validation     `json:"validations,omitempty"`
+	MatchConditions []pSchema.MatchCondition `json:"matchConditions,omitempty"`
+	Variables       []pSchema.Variable       `json:"variables,omitempty"`
+	FailurePolicy   string                   `json:"failurePolicy"`
+
+	AuditAnnotations []pSchema.AuditAnnotation `json:"auditAnnotations,omitempty"`
+	// RuntimeCostLimit is omitted if no limit is configured.
+	RuntimeCostLimit int64          `json:"runtimeCostLimit,omitempty"`
+	CostEstimates    []CostEstimate `json:"costEstimates,omitempty"`
+}
+
+// Dump outputs the loaded templates and any referential data, in the same
+// shape as the Rego driver:
+//
+//	targetName.modules.kind.moduleName = contents
+//	targetName.data = data
+//
+// Each template has a single module, named after this driver, whose contents
+// are the JSON encoding of the template's compiled validations, match
+// conditions, variables, and costs. Unlike Rego modules, the contents are not
+// source code which can be evaluated on its own.
 func (d *Driver) Dump(_ context.Context) (string, error) {
-	return "", nil
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+
+	dt := make(map[string]map[string]interface{})
+	for _, entry := range d.templates {
+		targetModules, ok := dt[entry.target]["modules"].(map[string]map[string]string)
+		if !ok {
+			targetModules = make(map[string]map[string]string)
+			dt[entry.target] = map[string]interface{}{"modules": targetModules}
+		}
+
+		failurePolicy := string(admissionregistrationv1.Fail)
+		if entry.source.FailurePolicy != nil {
+			failurePolicy = *entry.source.FailurePolicy
+		}
+
+		variables := make([]pSchema.Variable, len(entry.variables))
+		for i, v := range entry.variables {
+			variables[i] = pSchema.Variable{Name: v.GetName(), Expression: v.GetExpression()}
+		}
+
+		contents, err := json.MarshalIndent(templateDump{
+			Validations:     entry.source.Validations,
+			MatchConditions: entry.source.MatchConditions,
+			Variables:       variables,
+			FailurePolicy:   failurePolicy,
+
+			AuditAnnotations: entry.source.AuditAnnotations,
+
+			RuntimeCostLimit: entry.costLimit,
+			CostEstimates:    entry.costEstimates,
+		}, "", "   ")
+		if err != nil {
+			return "", err
+		}
+
+		targetModules[entry.kind] = map[string]string{pSchema.Name: string(contents)}
+	}
+
+	if d.referentialData {
+		d.inventory.mtx.RLock()
+		defer d.inventory.mtx.RUnlock()
+
+		for target, data := range d.inventory.data {
+			if dt[target] == nil {
+				dt[target] = make(map[string]interface{})
+			}
+			dt[target]["data"] = data
+		}
+	}
+
+	b, err := json.MarshalIndent(dt, "", "   ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
 }
 
 func (d *Driver) GetDescriptionForStat(statName string) (string, error) {
 	switch statName {
 	case runTimeNS:
 		return runTimeNSDescription, nil
+	case runTimeCost:
+		return runTimeCostDescription, nil
 	default:
 		return "", fmt.Errorf("unknown stat name for K8sNativeValidation: %s", statName)
 	}
 }
 
+// withInventory returns a shallow copy of constraint with inventory attached,
+// so it can be bound to the inventory variable.
+func withInventory(constraint *unstructured.Unstructured, inventory map[string]interface{}) *unstructured.Unstructured {
+	obj := make(map[string]interface{}, len(constraint.Object)+1)
+	for k, v := range constraint.Object {
+		obj[k] = v
+	}
+	obj[pSchema.InventoryName] = inventory
+
+	return &unstructured.Unstructured{Object: obj}
+}
+
+// reviewAttributes returns the admission attributes to validate for review.
+// Reviews of bare objects are evaluated as though the object were being
+// created, or updated from its old object.
+func (d *Driver) reviewAttributes(review interface{}) (*admission.VersionedAttributes, error) {
+	switch r := review.(type) {
+	case ARGetter:
+		return transform.RequestToVersionedAttributes(r.GetAdmissionRequest())
+	case ObjectGetter:
+		return transform.ObjectToVersionedAttributes(r.GetObject(), r.GetOldObject(), d.userInfo)
+	case *unstructured.Unstructured:
+		return transform.ObjectToVersionedAttributes(r, nil, d.userInfo)
+	default:
+		return nil, fmt.Errorf("cannot convert review of type %T to ARGetter, ObjectGetter, or *unstructured.Unstructured", review)
+	}
+}
+
 type ARGetter interface {
 	GetAdmissionRequest() *admissionv1.AdmissionRequest
 }
+
+// ObjectGetter is a review of an object outside of an admission request, such
+// as during audit or in CI. GetOldObject returns nil unless the review is of
+// an update.
+type ObjectGetter interface {
+	GetObject() *unstructured.Unstructured
+	GetOldObject() *unstructured.Unstructured
+}
@@ -0,0 +1,129 @@
+package k8scel
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	"k8s.io/utils/ptr"
+)
+
+func TestDriver_Dump(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := New(ReferentialData())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &schema.Source{
+		FailurePolicy: ptr.To[string]("Ignore"),
+		MatchConditions: []schema.MatchCondition{{
+			Name:       "is_pod",
+			Expression: `request.kind.kind == "Pod"`,
+		}},
+		Variables: []schema.Variable{{
+			Name:       "name",
+			Expression: "object.metadata.name",
+		}},
+		Validations: []schema.Validation{{
+			Expression: `variables.name != "forbidden"`,
+			Message:    "forbidden name",
+		}, {
+			Expression:        `object.metadata.name.startsWith("a")`,
+			MessageExpression: `"name " + object.metadata.name + " must start with a"`,
+		}},
+	}
+
+	tmpl := cts.New(cts.OptName("k8sforbiddenname"), cts.OptCRDNames("K8sForbiddenName"),
+		cts.OptTargets(cts.TargetCustomEngines(target, cts.Code(schema.Name, source.MustToUnstructured()))))
+
+	err = d.AddTemplate(ctx, tmpl)
+	if err != nil {
+		t.Fatalf("got AddTemplate() error = %v, want %v", err, nil)
+	}
+
+	err = d.AddData(ctx, target, ingressPath("foo", "foo"), makeIngress(t, "foo", "foo", "example.com"))
+	if err != nil {
+		t.Fatalf("got AddData() error = %v, want %v", err, nil)
+	}
+
+	dump, err := d.Dump(ctx)
+	if err != nil {
+		t.Fatalf("got Dump() error = %v, want %v", err, nil)
+	}
+
+	// Dump has the same shape as the Rego driver's: modules.kind.moduleName is
+	// a string.
+	var got map[string]struct {
+		Modules map[string]map[string]string `json:"modules"`
+		Data    interface{}                  `json:"data"`
+	}
+	err = json.Unmarshal([]byte(dump), &got)
+	if err != nil {
+		t.Fatalf("got invalid Dump() JSON: %v\n%s", err, dump)
+	}
+
+	modules, found := got[target].Modules["K8sForbiddenName"]
+	if !found {
+		t.Fatalf("got Dump() = %s, want template K8sForbiddenName for target %q", dump, target)
+	}
+
+	if len(modules) != 1 {
+		t.Fatalf("got modules %v, want only %q", modules, schema.Name)
+	}
+
+	var gotTemplate templateDump
+	err = json.Unmarshal([]byte(modules[schema.Name]), &gotTemplate)
+	if err != nil {
+		t.Fatalf("got invalid module JSON: %v\n%s", err, modules[schema.Name])
+	}
+
+	var gotVariables []string
+	for _, v := range gotTemplate.Variables {
+		gotVariables = append(gotVariables, v.Name)
+	}
+	wantVariables := []string{"name", schema.ParamsName, schema.InventoryName}
+	if diff := cmp.Diff(wantVariables, gotVariables); diff != "" {
+		t.Error(diff)
+	}
+
+	if diff := cmp.Diff(source.Validations, gotTemplate.Validations); diff != "" {
+		t.Error(diff)
+	}
+
+	if diff := cmp.Diff(source.MatchConditions, gotTemplate.MatchConditions); diff != "" {
+		t.Error(diff)
+	}
+
+	if gotTemplate.FailurePolicy != "Ignore" {
+		t.Errorf("got failurePolicy %q, want %q", gotTemplate.FailurePolicy, "Ignore")
+	}
+
+	if got[target].Data == nil {
+		t.Errorf("got Dump() = %s, want data for target %q", dump, target)
+	}
+
+	err = d.RemoveTemplate(ctx, tmpl)
+	if err != nil {
+		t.Fatalf("got RemoveTemplate() error = %v, want %v", err, nil)
+	}
+
+	dump, err = d.Dump(ctx)
+	if err != nil {
+		t.Fatalf("got Dump() error = %v, want %v", err, nil)
+	}
+
+	got = nil
+	err = json.Unmarshal([]byte(dump), &got)
+	if err != nil {
+		t.Fatalf("got invalid Dump() JSON: %v\n%s", err, dump)
+	}
+
+	if len(got[target].Modules) != 0 {
+		t.Errorf("got Dump() = %s, want no templates after RemoveTemplate", dump)
+	}
+}
@@ -0,0 +1,264 @@
+package k8scel
+
+import (
+	"sort"
+	"sync"
+
+	celgo "github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/open-policy-agent/opa/storage"
+)
+
+const (
+	// inventoryCluster and inventoryNamespace are the roots under which the
+	// Kubernetes target stores cluster-scoped and namespace-scoped objects:
+	//   cluster[apiVersion][kind][name]
+	//   namespace[namespace][apiVersion][kind][name]
+	inventoryCluster   = "cluster"
+	inventoryNamespace = "namespace"
+)
+
+// inventory stores the data used by referential Constraints, keyed by target.
+type inventory struct {
+	mtx sync.RWMutex
+
+	data map[string]map[string]interface{}
+}
+
+// add stores value at path in target's inventory, replacing any existing
+// value.
+func (i *inventory) add(target string, path storage.Path, value interface{}) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	if i.data == nil {
+		i.data = make(map[string]map[string]interface{})
+	}
+
+	if len(path) == 0 {
+		if obj, ok := value.(map[string]interface{}); ok {
+			i.data[target] = obj
+		}
+		return
+	}
+
+	parent := i.data[target]
+	if parent == nil {
+		parent = make(map[string]interface{})
+		i.data[target] = parent
+	}
+
+	for _, key := range path[:len(path)-1] {
+		child, ok := parent[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			parent[key] = child
+		}
+		parent = child
+	}
+
+	parent[path[len(path)-1]] = value
+}
+
+// remove deletes the value at path in target's inventory, and any objects left
+// empty as a result. Does nothing if there is no value at path.
+func (i *inventory) remove(target string, path storage.Path) {
+	i.mtx.Lock()
+	defer i.mtx.Unlock()
+
+	if len(path) == 0 {
+		delete(i.data, target)
+		return
+	}
+
+	removePath(i.data[target], path)
+}
+
+// removePath deletes path from obj. Returns true if obj is empty afterwards.
+func removePath(obj map[string]interface{}, path storage.Path) bool {
+	if obj == nil {
+		return false
+	}
+
+	key := path[0]
+	if len(path) == 1 {
+		delete(obj, key)
+		return len(obj) == 0
+	}
+
+	child, ok := obj[key].(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	if removePath(child, path[1:]) {
+		delete(obj, key)
+	}
+
+	return len(obj) == 0
+}
+
+// get returns target's inventory. The caller must hold i.mtx for reading for
+// as long as the result is used.
+func (i *inventory) get(target string) map[string]interface{} {
+	return i.data[target]
+}
+
+// inventoryFunctions declares the helper functions templates may call on the
+// inventory variable, for example:
+//
+//	variables.gatekeeper_internal_inventory.lookup("v1", "Namespace", "", "foo")
+//	variables.gatekeeper_internal_inventory.objects("networking.k8s.io/v1", "Ingress")
+//	variables.gatekeeper_internal_inventory.objects("apps/v1", "Deployment", "foo")
+//
+// An empty namespace refers to cluster-scoped objects.
+func inventoryFunctions() []celgo.EnvOption {
+	return []celgo.EnvOption{
+		celgo.Function("lookup",
+			celgo.MemberOverload("inventory_lookup_string_string_string_string",
+				[]*celgo.Type{celgo.DynType, celgo.StringType, celgo.StringType, celgo.StringType, celgo.StringType},
+				celgo.DynType,
+				celgo.FunctionBinding(inventoryLookup),
+			),
+		),
+		celgo.Function("objects",
+			celgo.MemberOverload("inventory_objects_string_string",
+				[]*celgo.Type{celgo.DynType, celgo.StringType, celgo.StringType},
+				celgo.ListType(celgo.DynType),
+				celgo.FunctionBinding(inventoryObjects),
+			),
+			celgo.MemberOverload("inventory_objects_string_string_string",
+				[]*celgo.Type{celgo.DynType, celgo.StringType, celgo.StringType, celgo.StringType},
+				celgo.ListType(celgo.DynType),
+				celgo.FunctionBinding(inventoryObjectsInNamespace),
+			),
+		),
+	}
+}
+
+// inventoryLookup returns the object with the passed apiVersion, kind,
+// namespace, and name, or null if there is no such object.
+func inventoryLookup(args ...ref.Val) ref.Val {
+	strs, err := stringArgs(args[1:])
+	if err != nil {
+		return err
+	}
+	apiVersion, kind, namespace, name := strs[0], strs[1], strs[2], strs[3]
+
+	obj := find(args[0], scopePath(namespace, apiVersion, kind, name)...)
+	if obj == nil {
+		return types.NullValue
+	}
+
+	return obj
+}
+
+// inventoryObjects returns all objects with the passed apiVersion and kind,
+// cluster-scoped and in any namespace, ordered by namespace and name.
+func inventoryObjects(args ...ref.Val) ref.Val {
+	strs, err := stringArgs(args[1:])
+	if err != nil {
+		return err
+	}
+	apiVersion, kind := strs[0], strs[1]
+
+	objects := values(find(args[0], scopePath("", apiVersion, kind)...))
+
+	namespaces := find(args[0], inventoryNamespace)
+	for _, namespace := range keys(namespaces) {
+		objects = append(objects, values(find(namespaces, namespace, apiVersion, kind))...)
+	}
+
+	return types.NewRefValList(types.DefaultTypeAdapter, objects)
+}
+
+// inventoryObjectsInNamespace returns all objects with the passed apiVersion
+// and kind in namespace, ordered by name.
+func inventoryObjectsInNamespace(args ...ref.Val) ref.Val {
+	strs, err := stringArgs(args[1:])
+	if err != nil {
+		return err
+	}
+	apiVersion, kind, namespace := strs[0], strs[1], strs[2]
+
+	objects := values(find(args[0], scopePath(namespace, apiVersion, kind)...))
+
+	return types.NewRefValList(types.DefaultTypeAdapter, objects)
+}
+
+// scopePath returns the path in the inventory of objects in namespace, or of
+// cluster-scoped objects if namespace is empty.
+func scopePath(namespace string, path ...string) []string {
+	if namespace == "" {
+		return append([]string{inventoryCluster}, path...)
+	}
+
+	return append([]string{inventoryNamespace, namespace}, path...)
+}
+
+// find returns the value at path in val, or nil if there is none.
+func find(val ref.Val, path ...string) ref.Val {
+	for _, key := range path {
+		mapper, ok := val.(traits.Mapper)
+		if !ok {
+			return nil
+		}
+
+		val, ok = mapper.Find(types.String(key))
+		if !ok {
+			return nil
+		}
+	}
+
+	return val
+}
+
+// keys returns the sorted string keys of val if it is a map.
+func keys(val ref.Val) []string {
+	mapper, ok := val.(traits.Mapper)
+	if !ok {
+		return nil
+	}
+
+	var result []string
+	for it := mapper.Iterator(); it.HasNext() == types.True; {
+		if key, ok := it.Next().(types.String); ok {
+			result = append(result, string(key))
+		}
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// values returns the values of val, ordered by key, if it is a map.
+func values(val ref.Val) []ref.Val {
+	mapper, ok := val.(traits.Mapper)
+	if !ok {
+		return nil
+	}
+
+	var result []ref.Val
+	for _, key := range keys(val) {
+		result = append(result, mapper.Get(types.String(key)))
+	}
+
+	return result
+}
+
+// stringArgs converts args to strings. Returns an error value if any of args
+// is not a string.
+func stringArgs(args []ref.Val) ([]string, ref.Val) {
+	result := make([]string, len(args))
+	for i, arg := range args {
+		s, ok := arg.(types.String)
+		if !ok {
+			return nil, types.MaybeNoSuchOverloadErr(arg)
+		}
+		result[i] = string(s)
+	}
+
+	return result, nil
+}
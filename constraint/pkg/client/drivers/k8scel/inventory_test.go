@@ -0,0 +1,217 @@
+package k8scel
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	"github.com/open-policy-agent/opa/storage"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const target = "admission.k8s.gatekeeper.sh"
+
+type fakeARGetter struct {
+	request *admissionv1.AdmissionRequest
+}
+
+func (f *fakeARGetter) GetAdmissionRequest() *admissionv1.AdmissionRequest {
+	return f.request
+}
+
+func makeIngress(t *testing.T, namespace, name, host string) map[string]interface{} {
+	t.Helper()
+
+	return map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "Ingress",
+		"metadata": map[string]interface{}{
+			"namespace": namespace,
+			"name":      name,
+		},
+		"spec": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{"host": host},
+			},
+		},
+	}
+}
+
+func makeIngressReview(t *testing.T, obj map[string]interface{}) *fakeARGetter {
+	t.Helper()
+
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &fakeARGetter{request: &admissionv1.AdmissionRequest{
+		Kind:      metav1.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"},
+		Resource:  metav1.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+		Operation: admissionv1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+}
+
+func ingressPath(namespace, name string) storage.Path {
+	return storage.Path{"namespace", namespace, "networking.k8s.io/v1", "Ingress", name}
+}
+
+func TestDriver_ReferentialData(t *testing.T) {
+	source := &schema.Source{
+		Validations: []schema.Validation{{
+			Expression: `!variables.gatekeeper_internal_inventory.objects("networking.k8s.io/v1", "Ingress").exists(other,
+  !(other.metadata.namespace == object.metadata.namespace && other.metadata.name == object.metadata.name) &&
+  other.spec.rules.exists(r, object.spec.rules.exists(o, o.host == r.host)))`,
+			Message: "ingress host conflicts with an existing ingress",
+		}, {
+			Expression: `variables.gatekeeper_internal_inventory.lookup("networking.k8s.io/v1", "Ingress", "reserved", "reserved") == null ||
+  variables.gatekeeper_internal_inventory.objects("networking.k8s.io/v1", "Ingress", object.metadata.namespace).size() < 2`,
+			Message: "too many ingresses",
+		}},
+	}
+
+	tmpl := cts.New(cts.OptName("k8suniqueingresshost"), cts.OptCRDNames("K8sUniqueIngressHost"),
+		cts.OptTargets(cts.TargetCustomEngines(target, cts.Code(schema.Name, source.MustToUnstructured()))))
+
+	tests := []struct {
+		name            string
+		referentialData bool
+		data            map[string]map[string]interface{}
+		removed         []string
+		review          map[string]interface{}
+		wantMessages    []string
+	}{{
+		name:            "no conflicting ingress",
+		referentialData: true,
+		data: map[string]map[string]interface{}{
+			"foo": makeIngress(t, "foo", "foo", "foo.example.com"),
+		},
+		review: makeIngress(t, "bar", "bar", "bar.example.com"),
+	}, {
+		name:            "conflicting ingress",
+		referentialData: true,
+		data: map[string]map[string]interface{}{
+			"foo": makeIngress(t, "foo", "foo", "example.com"),
+		},
+		review:       makeIngress(t, "bar", "bar", "example.com"),
+		wantMessages: []string{"ingress host conflicts with an existing ingress"},
+	}, {
+		name:            "updating the same ingress",
+		referentialData: true,
+		data: map[string]map[string]interface{}{
+			"foo": makeIngress(t, "foo", "foo", "example.com"),
+		},
+		review: makeIngress(t, "foo", "foo", "example.com"),
+	}, {
+		name:            "conflicting ingress removed",
+		referentialData: true,
+		data: map[string]map[string]interface{}{
+			"foo": makeIngress(t, "foo", "foo", "example.com"),
+		},
+		removed: []string{"foo"},
+		review:  makeIngress(t, "bar", "bar", "example.com"),
+	}, {
+		name:            "lookup and namespaced objects",
+		referentialData: true,
+		data: map[string]map[string]interface{}{
+			"reserved": makeIngress(t, "reserved", "reserved", "reserved.example.com"),
+			"a":        makeIngress(t, "bar", "a", "a.example.com"),
+			"b":        makeIngress(t, "bar", "b", "b.example.com"),
+		},
+		review:       makeIngress(t, "bar", "c", "c.example.com"),
+		wantMessages: []string{"too many ingresses"},
+	}, {
+		name:            "referential data disabled",
+		referentialData: false,
+		data: map[string]map[string]interface{}{
+			"foo": makeIngress(t, "foo", "foo", "example.com"),
+		},
+		review: makeIngress(t, "bar", "bar", "example.com"),
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			var args []Arg
+			if tt.referentialData {
+				args = append(args, ReferentialData())
+			}
+
+			d, err := New(args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := d.SupportsReferentialData(); got != tt.referentialData {
+				t.Errorf("got SupportsReferentialData() = %t, want %t", got, tt.referentialData)
+			}
+
+			err = d.AddTemplate(ctx, tmpl)
+			if err != nil {
+				t.Fatalf("got AddTemplate() error = %v, want %v", err, nil)
+			}
+
+			for _, obj := range tt.data {
+				u := unstructured.Unstructured{Object: obj}
+				err = d.AddData(ctx, target, ingressPath(u.GetNamespace(), u.GetName()), obj)
+				if err != nil {
+					t.Fatalf("got AddData() error = %v, want %v", err, nil)
+				}
+			}
+
+			for _, key := range tt.removed {
+				u := unstructured.Unstructured{Object: tt.data[key]}
+				err = d.RemoveData(ctx, target, ingressPath(u.GetNamespace(), u.GetName()))
+				if err != nil {
+					t.Fatalf("got RemoveData() error = %v, want %v", err, nil)
+				}
+			}
+
+			constraint := cts.MakeConstraint(t, "K8sUniqueIngressHost", "unique")
+			resp, err := d.Query(ctx, target, []*unstructured.Unstructured{constraint}, makeIngressReview(t, tt.review))
+			if err != nil {
+				t.Fatalf("got Query() error = %v, want %v", err, nil)
+			}
+
+			var gotMessages []string
+			for _, result := range resp.Results {
+				gotMessages = append(gotMessages, result.Msg)
+			}
+
+			if len(gotMessages) != len(tt.wantMessages) {
+				t.Fatalf("got messages %v, want %v", gotMessages, tt.wantMessages)
+			}
+			for i := range gotMessages {
+				if gotMessages[i] != tt.wantMessages[i] {
+					t.Errorf("got messages %v, want %v", gotMessages, tt.wantMessages)
+				}
+			}
+		})
+	}
+}
+
+func TestInventory_Remove(t *testing.T) {
+	inv := inventory{}
+	inv.add(target, ingressPath("foo", "foo"), "foo")
+	inv.add(target, ingressPath("foo", "bar"), "bar")
+
+	inv.remove(target, ingressPath("foo", "foo"))
+	inv.remove(target, ingressPath("missing", "foo"))
+
+	if got := len(inv.get(target)["namespace"].(map[string]interface{})); got != 1 {
+		t.Fatalf("got %d namespaces, want %d", got, 1)
+	}
+
+	inv.remove(target, ingressPath("foo", "bar"))
+
+	if got := len(inv.get(target)); got != 0 {
+		t.Fatalf("got inventory %v, want empty", inv.get(target))
+	}
+}
@@ -0,0 +1,66 @@
+package k8scel
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// NamespaceResolver resolves the Namespace of namespaced reviews, which
+// templates access through the namespaceObject variable.
+type NamespaceResolver interface {
+	// ResolveNamespace returns the Namespace named name, or nil if there is no
+	// such Namespace.
+	ResolveNamespace(ctx context.Context, name string) (*corev1.Namespace, error)
+}
+
+// NamespaceResolverFunc adapts a function, such as a lookup in a target
+// handler's cache, to a NamespaceResolver.
+type NamespaceResolverFunc func(ctx context.Context, name string) (*corev1.Namespace, error)
+
+func (f NamespaceResolverFunc) ResolveNamespace(ctx context.Context, name string) (*corev1.Namespace, error) {
+	return f(ctx, name)
+}
+
+// resolveNamespace returns the Namespace named name for binding to
+// namespaceObject. Namespaces are resolved by the driver's NamespaceResolver
+// if it has one, and otherwise from targetInventory if referential data is
+// enabled. Returns nil for cluster-scoped reviews, or if the Namespace cannot
+// be found.
+func (d *Driver) resolveNamespace(ctx context.Context, name string, targetInventory map[string]interface{}) (*corev1.Namespace, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	if d.namespaceResolver != nil {
+		namespace, err := d.namespaceResolver.ResolveNamespace(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("resolving namespace %q: %w", name, err)
+		}
+		return namespace, nil
+	}
+
+	return namespaceFromInventory(targetInventory, name)
+}
+
+// namespaceFromInventory returns the Namespace named name from targetInventory,
+// or nil if it has not been added as referential data.
+func namespaceFromInventory(targetInventory map[string]interface{}, name string) (*corev1.Namespace, error) {
+	value, _, err := unstructured.NestedFieldNoCopy(targetInventory, scopePath("", "v1", "Namespace", name)...)
+	if err != nil {
+		return nil, nil
+	}
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	namespace := &corev1.Namespace{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, namespace); err != nil {
+		return nil, fmt.Errorf("converting inventory namespace %q: %w", name, err)
+	}
+	return namespace, nil
+}
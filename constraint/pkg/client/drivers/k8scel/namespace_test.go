@@ -0,0 +1,211 @@
+package k8scel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/opa/storage"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+var errResolve = errors.New("resolve failed")
+
+func restrictedNamespace(name string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"env": "restricted"}}}
+}
+
+func TestDriver_Query_NamespaceObject(t *testing.T) {
+	source := &schema.Source{
+		Validations: []schema.Validation{{
+			Expression:        `namespaceObject == null || !has(namespaceObject.metadata.labels) || namespaceObject.metadata.labels["env"] != "restricted"`,
+			MessageExpression: `"namespace " + namespaceObject.metadata.name + " is restricted"`,
+		}},
+	}
+	tmpl := cts.New(cts.OptName("k8srestricted"), cts.OptCRDNames("K8sRestricted"),
+		cts.OptTargets(cts.TargetCustomEngines(target, cts.Code(schema.Name, source.MustToUnstructured()))))
+
+	resolver := NamespaceResolverFunc(func(_ context.Context, name string) (*corev1.Namespace, error) {
+		if name == "foo" {
+			return restrictedNamespace(name), nil
+		}
+		return nil, nil
+	})
+
+	tests := []struct {
+		name      string
+		args      []Arg
+		data      map[string]interface{}
+		namespace string
+		wantMsgs  []string
+		wantErr   error
+	}{{
+		name:      "no resolver",
+		namespace: "foo",
+	}, {
+		name:      "resolver finds namespace",
+		args:      []Arg{Namespaces(resolver)},
+		namespace: "foo",
+		wantMsgs:  []string{"namespace foo is restricted"},
+	}, {
+		name:      "resolver does not find namespace",
+		args:      []Arg{Namespaces(resolver)},
+		namespace: "bar",
+	}, {
+		name: "resolver fails",
+		args: []Arg{Namespaces(NamespaceResolverFunc(func(context.Context, string) (*corev1.Namespace, error) {
+			return nil, errResolve
+		}))},
+		namespace: "foo",
+		wantErr:   errResolve,
+	}, {
+		name: "namespace in referential data",
+		args: []Arg{ReferentialData()},
+		data: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": "foo", "labels": map[string]interface{}{"env": "restricted"}},
+		},
+		namespace: "foo",
+		wantMsgs:  []string{"namespace foo is restricted"},
+	}, {
+		name:      "namespace missing from referential data",
+		args:      []Arg{ReferentialData()},
+		namespace: "foo",
+	}, {
+		name: "cluster-scoped object",
+		args: []Arg{Namespaces(NamespaceResolverFunc(func(context.Context, string) (*corev1.Namespace, error) {
+			return nil, errResolve
+		}))},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			d, err := New(tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := d.AddTemplate(ctx, tmpl); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.data != nil {
+				if err := d.AddData(ctx, target, storage.Path{"cluster", "v1", "Namespace", "foo"}, tt.data); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			review := &unstructured.Unstructured{Object: makeIngress(t, tt.namespace, "bar", "example.com")}
+			constraint := cts.MakeConstraint(t, "K8sRestricted", "restricted")
+			resp, err := d.Query(ctx, target, []*unstructured.Unstructured{constraint}, review)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got Query() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			var gotMsgs []string
+			for _, result := range resp.Results {
+				gotMsgs = append(gotMsgs, result.Msg)
+			}
+			if diff := cmp.Diff(tt.wantMsgs, gotMsgs, cmpopts.EquateEmpty()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestDriver_Query_Authorizer(t *testing.T) {
+	ctx := context.Background()
+
+	source := &schema.Source{
+		MatchConditions: []schema.MatchCondition{{
+			Name:       "not_admin",
+			Expression: `!authorizer.group("").resource("namespaces").check("delete").allowed()`,
+		}},
+		Validations: []schema.Validation{{
+			Expression: `authorizer.group("networking.k8s.io").resource("ingresses").namespace(object.metadata.namespace).check("create").allowed()`,
+			Message:    "not allowed to create ingresses",
+		}},
+	}
+	tmpl := cts.New(cts.OptName("k8sauthorized"), cts.OptCRDNames("K8sAuthorized"),
+		cts.OptTargets(cts.TargetCustomEngines(target, cts.Code(schema.Name, source.MustToUnstructured()))))
+
+	d, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.AddTemplate(ctx, tmpl)
+	if !errors.Is(err, clienterrors.ErrInvalidConstraintTemplate) {
+		t.Fatalf("got AddTemplate() error = %v without an authorizer, want %v", err, clienterrors.ErrInvalidConstraintTemplate)
+	}
+
+	// Allows admins everything, and developers to create ingresses in their
+	// own namespace.
+	authz := authorizer.AuthorizerFunc(func(_ context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+		switch {
+		case a.GetUser().GetName() == "admin":
+			return authorizer.DecisionAllow, "", nil
+		case a.GetUser().GetName() == "dev" && a.GetResource() == "ingresses" && a.GetNamespace() == "dev":
+			return authorizer.DecisionAllow, "", nil
+		default:
+			return authorizer.DecisionNoOpinion, "", nil
+		}
+	})
+
+	tests := []struct {
+		user      string
+		namespace string
+		wantMsgs  []string
+	}{{
+		user:      "admin",
+		namespace: "prod",
+	}, {
+		user:      "dev",
+		namespace: "dev",
+	}, {
+		user:      "dev",
+		namespace: "prod",
+		wantMsgs:  []string{"not allowed to create ingresses"},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.user+"/"+tt.namespace, func(t *testing.T) {
+			d, err := New(Authorizer(authz), UserInfo(&user.DefaultInfo{Name: tt.user}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := d.AddTemplate(ctx, tmpl); err != nil {
+				t.Fatal(err)
+			}
+
+			review := &unstructured.Unstructured{Object: makeIngress(t, tt.namespace, "bar", "example.com")}
+			constraint := cts.MakeConstraint(t, "K8sAuthorized", "authorized")
+			resp, err := d.Query(ctx, target, []*unstructured.Unstructured{constraint}, review)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotMsgs []string
+			for _, result := range resp.Results {
+				gotMsgs = append(gotMsgs, result.Msg)
+			}
+			if diff := cmp.Diff(tt.wantMsgs, gotMsgs, cmpopts.EquateEmpty()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
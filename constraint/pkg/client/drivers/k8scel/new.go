@@ -1,17 +1,34 @@
 package k8scel
 
 import (
-	"k8s.io/apiserver/pkg/admission/plugin/validatingadmissionpolicy"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/validating"
+	"k8s.io/apiserver/pkg/cel/environment"
 )
 
 func New(args ...Arg) (*Driver, error) {
 	driver := &Driver{
-		validators: map[string]validatingadmissionpolicy.Validator{},
+		validators: map[string]validating.Validator{},
+		templates:  map[string]*templateEntry{},
 	}
 	for _, arg := range args {
 		if err := arg(driver); err != nil {
 			return nil, err
 		}
 	}
+
+	envSet, err := environment.MustBaseEnvSet(environment.DefaultCompatibilityVersion(), false).Extend(
+		environment.VersionedOptions{
+			IntroducedVersion: version.MajorMinor(1, 0),
+			EnvOptions:        inventoryFunctions(),
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating CEL environment: %w", err)
+	}
+	driver.envSet = envSet
+
 	return driver, nil
 }
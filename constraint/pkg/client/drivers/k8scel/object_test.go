@@ -0,0 +1,121 @@
+package k8scel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+type fakeObjectGetter struct {
+	object    *unstructured.Unstructured
+	oldObject *unstructured.Unstructured
+}
+
+func (f *fakeObjectGetter) GetObject() *unstructured.Unstructured {
+	return f.object
+}
+
+func (f *fakeObjectGetter) GetOldObject() *unstructured.Unstructured {
+	return f.oldObject
+}
+
+func TestDriver_Query_Objects(t *testing.T) {
+	source := &schema.Source{
+		Validations: []schema.Validation{{
+			Expression:        `request.operation != "UPDATE" || object.spec.rules[0].host == oldObject.spec.rules[0].host`,
+			MessageExpression: `"host changed by " + request.userInfo.username`,
+		}, {
+			Expression:        `!object.spec.rules[0].host.endsWith(".internal")`,
+			MessageExpression: `request.operation + " of " + request.resource.resource + " " + request.namespace + "/" + request.name + " uses internal host"`,
+		}},
+	}
+	tmpl := cts.New(cts.OptName("k8shosts"), cts.OptCRDNames("K8sHosts"),
+		cts.OptTargets(cts.TargetCustomEngines(target, cts.Code(schema.Name, source.MustToUnstructured()))))
+
+	ingress := func(host string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: makeIngress(t, "foo", "bar", host)}
+	}
+
+	request := makeIngressReview(t, makeIngress(t, "foo", "bar", "example.internal"))
+	request.request.Namespace = "foo"
+	request.request.Name = "bar"
+
+	tests := []struct {
+		name     string
+		args     []Arg
+		review   interface{}
+		wantMsgs []string
+		wantErr  bool
+	}{{
+		name:   "allowed object",
+		review: ingress("example.com"),
+	}, {
+		name:     "object is created",
+		review:   ingress("example.internal"),
+		wantMsgs: []string{"CREATE of ingresses foo/bar uses internal host"},
+	}, {
+		name:     "object getter without old object is created",
+		review:   &fakeObjectGetter{object: ingress("example.internal")},
+		wantMsgs: []string{"CREATE of ingresses foo/bar uses internal host"},
+	}, {
+		name:     "object getter with old object is updated",
+		args:     []Arg{UserInfo(&user.DefaultInfo{Name: "auditor"})},
+		review:   &fakeObjectGetter{object: ingress("example.internal"), oldObject: ingress("example.com")},
+		wantMsgs: []string{"host changed by auditor", "UPDATE of ingresses foo/bar uses internal host"},
+	}, {
+		name:     "admission requests are still supported",
+		review:   request,
+		wantMsgs: []string{"CREATE of ingresses foo/bar uses internal host"},
+	}, {
+		name:    "object without kind",
+		review:  &unstructured.Unstructured{Object: map[string]interface{}{"metadata": map[string]interface{}{"name": "bar"}}},
+		wantErr: true,
+	}, {
+		name:    "old object of another kind",
+		review:  &fakeObjectGetter{object: ingress("example.com"), oldObject: cts.MakeConstraint(t, "K8sHosts", "bar")},
+		wantErr: true,
+	}, {
+		name:    "unsupported review",
+		review:  &admissionv1.AdmissionRequest{},
+		wantErr: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			d, err := New(tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := d.AddTemplate(ctx, tmpl); err != nil {
+				t.Fatal(err)
+			}
+
+			constraint := cts.MakeConstraint(t, "K8sHosts", "hosts")
+			resp, err := d.Query(ctx, target, []*unstructured.Unstructured{constraint}, tt.review)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got Query() error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var gotMsgs []string
+			for _, result := range resp.Results {
+				gotMsgs = append(gotMsgs, result.Msg)
+			}
+			if diff := cmp.Diff(tt.wantMsgs, gotMsgs, cmpopts.EquateEmpty()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package k8scel
+
+import (
+	celgo "github.com/google/cel-go/cel"
+	pSchema "github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	ctschema "github.com/open-policy-agent/frameworks/constraint/pkg/schema"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/cel/model"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+	apiservercel "k8s.io/apiserver/pkg/cel"
+	"k8s.io/apiserver/pkg/cel/environment"
+)
+
+// paramsTypeName is the CEL type name of typed parameters. Nested objects are
+// named after their path, for example params.labels.
+const paramsTypeName = "params"
+
+// paramsDeclType returns the CEL type of the parameters of ct's Constraints,
+// derived from its OpenAPIV3Schema, or nil if parameters must remain
+// dynamically typed. This is the case if ct has no schema, if the schema is
+// not structural, or if it permits unknown fields anywhere, as typing would
+// hide those fields from expressions which reference them.
+func paramsDeclType(ct *templates.ConstraintTemplate) *apiservercel.DeclType {
+	if ct.Spec.CRD.Spec.Validation == nil || ct.Spec.CRD.Spec.Validation.OpenAPIV3Schema == nil {
+		return nil
+	}
+
+	structural, err := ctschema.Structural(ct.Spec.CRD.Spec.Validation.OpenAPIV3Schema)
+	if err != nil || len(structural.Properties) == 0 || preservesUnknownFields(structural) {
+		return nil
+	}
+
+	declType := model.SchemaDeclType(structural, false)
+	if declType == nil {
+		return nil
+	}
+
+	return declType.MaybeAssignTypeName(paramsTypeName)
+}
+
+// preservesUnknownFields returns true if s or any schema nested in it permits
+// unknown fields.
+func preservesUnknownFields(s *structuralschema.Structural) bool {
+	if s == nil {
+		return false
+	}
+
+	if s.XPreserveUnknownFields || s.XEmbeddedResource {
+		return true
+	}
+
+	for _, property := range s.Properties {
+		property := property
+		if preservesUnknownFields(&property) {
+			return true
+		}
+	}
+
+	if s.AdditionalProperties != nil && preservesUnknownFields(s.AdditionalProperties.Structural) {
+		return true
+	}
+
+	return preservesUnknownFields(s.Items)
+}
+
+// newCompiler returns a compiler for templates whose parameters have type
+// paramsType, or are dynamically typed if paramsType is nil.
+//
+// FRICTION: CompositedCompiler declares every variable as dynamically typed,
+// so typing variables.params requires assembling the compiler by hand.
+func newCompiler(envSet *environment.EnvSet, paramsType *apiservercel.DeclType) (*cel.CompositedCompiler, error) {
+	if paramsType == nil {
+		return cel.NewCompositedCompiler(envSet)
+	}
+
+	variablesType := apiservercel.NewObjectType(cel.VariablesTypeName, map[string]*apiservercel.DeclField{
+		pSchema.ParamsName: apiservercel.NewDeclField(pSchema.ParamsName, paramsType, false, nil, nil),
+	})
+
+	extended, err := envSet.Extend(environment.VersionedOptions{
+		IntroducedVersion: version.MajorMinor(1, 0),
+		EnvOptions:        []celgo.EnvOption{celgo.Variable("variables", variablesType.CelType())},
+		DeclTypes:         []*apiservercel.DeclType{variablesType},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &cel.CompositedCompiler{
+		Compiler:       cel.NewCompiler(extended),
+		FilterCompiler: cel.NewFilterCompiler(extended),
+		CompositionEnv: &cel.CompositionEnv{
+			EnvSet:            extended,
+			MapType:           variablesType,
+			CompiledVariables: map[string]cel.CompilationResult{},
+		},
+	}, nil
+}
+
+// compileVariables compiles and stores variables in compiler. If the
+// parameters are typed, the params variable is stored without redeclaring it
+// as dynamically typed.
+func compileVariables(compiler *cel.CompositedCompiler, variables []cel.NamedExpressionAccessor, options cel.OptionalVariableDeclarations, typedParams bool) {
+	for _, v := range variables {
+		if typedParams && v.GetName() == pSchema.ParamsName {
+			compiler.CompositionEnv.CompiledVariables[v.GetName()] = compiler.CompileCELExpression(v, options, environment.StoredExpressions)
+			continue
+		}
+
+		compiler.CompileAndStoreVariable(v, options, environment.StoredExpressions)
+	}
+}
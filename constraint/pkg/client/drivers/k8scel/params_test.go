@@ -0,0 +1,152 @@
+package k8scel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func labelsSchema() cts.PropMap {
+	return cts.PropMap{
+		"labels":  {Type: "array", Items: &apiextensions.JSONSchemaPropsOrArray{Schema: &apiextensions.JSONSchemaProps{Type: "string"}}},
+		"message": cts.PropTyped("string"),
+		"exempt":  cts.Prop(cts.PropMap{"names": {Type: "array", Items: &apiextensions.JSONSchemaPropsOrArray{Schema: &apiextensions.JSONSchemaProps{Type: "string"}}}}),
+	}
+}
+
+func paramsTemplate(pm cts.PropMap, source *schema.Source) *templates.ConstraintTemplate {
+	opts := []cts.Opt{
+		cts.OptName("k8srequiredlabels"), cts.OptCRDNames("K8sRequiredLabels"),
+		cts.OptTargets(cts.TargetCustomEngines(target, cts.Code(schema.Name, source.MustToUnstructured()))),
+	}
+	if pm != nil {
+		opts = append(opts, cts.OptCRDSchema(pm))
+	}
+
+	return cts.New(opts...)
+}
+
+func TestDriver_AddTemplate_TypedParams(t *testing.T) {
+	unknownFields := labelsSchema()
+	unknownFields["extra"] = cts.PropUnstructured()
+
+	tests := []struct {
+		name       string
+		schema     cts.PropMap
+		expression string
+		wantErr    error
+	}{{
+		name:       "valid reference",
+		schema:     labelsSchema(),
+		expression: `variables.params.labels.all(l, l in object.metadata.labels)`,
+	}, {
+		name:       "valid nested reference",
+		schema:     labelsSchema(),
+		expression: `object.metadata.name in variables.params.exempt.names`,
+	}, {
+		name:       "undeclared parameter",
+		schema:     labelsSchema(),
+		expression: `variables.params.lables.all(l, l in object.metadata.labels)`,
+		wantErr:    clienterrors.ErrInvalidConstraintTemplate,
+	}, {
+		name:       "wrong type",
+		schema:     labelsSchema(),
+		expression: `variables.params.message > 1`,
+		wantErr:    clienterrors.ErrInvalidConstraintTemplate,
+	}, {
+		name:       "unknown fields permitted",
+		schema:     unknownFields,
+		expression: `variables.params.lables.all(l, l in object.metadata.labels)`,
+	}, {
+		name:       "no parameters",
+		expression: `variables.params.lables.all(l, l in object.metadata.labels)`,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := New()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			source := &schema.Source{Validations: []schema.Validation{{Expression: tt.expression}}}
+			err = d.AddTemplate(context.Background(), paramsTemplate(tt.schema, source))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got AddTemplate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDriver_Query_TypedParams(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &schema.Source{
+		Variables: []schema.Variable{{
+			Name:       "missing",
+			Expression: `variables.params.labels.filter(l, !has(object.metadata.labels) || !(l in object.metadata.labels))`,
+		}},
+		Validations: []schema.Validation{{
+			Expression:        `object.metadata.name in variables.params.exempt.names || size(variables.missing) == 0`,
+			MessageExpression: `variables.params.message + ": " + variables.missing.join(", ")`,
+		}},
+	}
+	if err := d.AddTemplate(ctx, paramsTemplate(labelsSchema(), source)); err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, "K8sRequiredLabels", "owner",
+		cts.Set([]interface{}{"owner", "team"}, "spec", "parameters", "labels"),
+		cts.Set("missing labels", "spec", "parameters", "message"),
+		cts.Set([]interface{}{"exempt"}, "spec", "parameters", "exempt", "names"))
+
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		wantMsgs []string
+	}{{
+		name:   "exempt",
+		labels: nil,
+	}, {
+		name:   "labeled",
+		labels: map[string]string{"owner": "foo", "team": "bar"},
+	}, {
+		name:     "unlabeled",
+		labels:   map[string]string{"team": "bar"},
+		wantMsgs: []string{"missing labels: owner"},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review := &unstructured.Unstructured{Object: makeIngress(t, "foo", tt.name, "example.com")}
+			review.SetLabels(tt.labels)
+
+			resp, err := d.Query(ctx, target, []*unstructured.Unstructured{constraint}, review)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var gotMsgs []string
+			for _, result := range resp.Results {
+				gotMsgs = append(gotMsgs, result.Msg)
+			}
+			if diff := cmp.Diff(tt.wantMsgs, gotMsgs, cmpopts.EquateEmpty()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
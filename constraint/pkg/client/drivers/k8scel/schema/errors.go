@@ -3,7 +3,9 @@ package schema
 import "errors"
 
 var (
-	ErrBadMatchCondition = errors.New("invalid match condition")
-	ErrBadVariable       = errors.New("invalid variable definition")
-	ErrBadFailurePolicy  = errors.New("invalid failure policy")
+	ErrBadMatchCondition  = errors.New("invalid match condition")
+	ErrBadVariable        = errors.New("invalid variable definition")
+	ErrBadFailurePolicy   = errors.New("invalid failure policy")
+	ErrBadCostLimit       = errors.New("invalid runtime cost limit")
+	ErrBadAuditAnnotation = errors.New("invalid audit annotation")
 )
@@ -5,12 +5,14 @@ import (
 	"fmt"
 	"strings"
 
+	celgo "github.com/google/cel-go/cel"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
 	admissionv1 "k8s.io/api/admissionregistration/v1"
 	admissionv1alpha1 "k8s.io/api/admissionregistration/v1alpha1"
+	admissionv1beta1 "k8s.io/api/admissionregistration/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apiserver/pkg/admission/plugin/cel"
-	"k8s.io/apiserver/pkg/admission/plugin/validatingadmissionpolicy"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/validating"
 	"k8s.io/apiserver/pkg/admission/plugin/webhook/matchconditions"
 )
 
@@ -22,6 +24,10 @@ const (
 	ReservedPrefix = "gatekeeper_internal_"
 	// ParamsName is the VAP variable constraint parameters will be bound to.
 	ParamsName = "params"
+	// InventoryName is the variable the K8sNativeValidation driver binds
+	// referential data to. Only available when evaluating templates with the
+	// driver, not in generated ValidatingAdmissionPolicies.
+	InventoryName = ReservedPrefix + "inventory"
 )
 
 var (
@@ -34,6 +40,18 @@ type Validation struct {
 	Expression        string `json:"expression,omitempty"`
 	Message           string `json:"message,omitempty"`
 	MessageExpression string `json:"messageExpression,omitempty"`
+
+	// DetailsExpression is a CEL expression whose value is reported as the
+	// `details` metadata of violations of this validation, as Rego templates
+	// report with `details`. Has no ValidatingAdmissionPolicy equivalent.
+	// As in ValidatingAdmissionPolicies, map and list literals must be
+	// homogeneous, so values of differing types must be wrapped in dyn().
+	DetailsExpression string `json:"detailsExpression,omitempty"`
+
+	// AuditAnnotations are evaluated for violations of this validation and
+	// reported as the violation's annotations, in addition to the template's
+	// auditAnnotations. Has no ValidatingAdmissionPolicy equivalent.
+	AuditAnnotations []AuditAnnotation `json:"auditAnnotations,omitempty"`
 }
 
 type MatchCondition struct {
@@ -47,6 +65,12 @@ type Variable struct {
 	Expression string `json:"expression,omitempty"`
 }
 
+type AuditAnnotation struct {
+	// Maps to ValidatingAdmissionPolicy's `spec.auditAnnotations`.
+	Key             string `json:"key"`
+	ValueExpression string `json:"valueExpression"`
+}
+
 type Source struct {
 	// Validations maps to ValidatingAdmissionPolicy's `spec.validations`.
 	Validations []Validation `json:"validations,omitempty"`
@@ -59,6 +83,14 @@ type Source struct {
 
 	// Variables maps to ValidatingAdmissionPolicy's `spec.variables`.
 	Variables []Variable `json:"variables,omitempty"`
+
+	// AuditAnnotations maps to ValidatingAdmissionPolicy's `spec.auditAnnotations`.
+	AuditAnnotations []AuditAnnotation `json:"auditAnnotations,omitempty"`
+
+	// RuntimeCostLimit caps the CEL runtime cost of evaluating a constraint
+	// of the template. Only enforced by the K8sNativeValidation driver, when
+	// evaluating constraints. Has no ValidatingAdmissionPolicy equivalent.
+	RuntimeCostLimit *int64 `json:"runtimeCostLimit,omitempty"`
 }
 
 func (in *Source) Validate() error {
@@ -68,9 +100,15 @@ func (in *Source) Validate() error {
 	if err := in.validateVariables(); err != nil {
 		return err
 	}
+	if err := in.validateAuditAnnotations(); err != nil {
+		return err
+	}
 	if _, err := in.GetFailurePolicy(); err != nil {
 		return err
 	}
+	if in.RuntimeCostLimit != nil && *in.RuntimeCostLimit <= 0 {
+		return fmt.Errorf("%w: %d; must be positive", ErrBadCostLimit, *in.RuntimeCostLimit)
+	}
 
 	return nil
 }
@@ -114,6 +152,36 @@ func (in *Source) GetV1Alpha1MatchConditions() ([]admissionv1alpha1.MatchConditi
 	return matchConditions, nil
 }
 
+func (in *Source) GetV1Beta1MatchConditions() ([]admissionv1beta1.MatchCondition, error) {
+	if err := in.validateMatchConditions(); err != nil {
+		return nil, err
+	}
+
+	var matchConditions []admissionv1beta1.MatchCondition
+	for _, mc := range in.MatchConditions {
+		matchConditions = append(matchConditions, admissionv1beta1.MatchCondition{
+			Name:       mc.Name,
+			Expression: mc.Expression,
+		})
+	}
+	return matchConditions, nil
+}
+
+func (in *Source) GetV1MatchConditions() ([]admissionv1.MatchCondition, error) {
+	if err := in.validateMatchConditions(); err != nil {
+		return nil, err
+	}
+
+	var matchConditions []admissionv1.MatchCondition
+	for _, mc := range in.MatchConditions {
+		matchConditions = append(matchConditions, admissionv1.MatchCondition{
+			Name:       mc.Name,
+			Expression: mc.Expression,
+		})
+	}
+	return matchConditions, nil
+}
+
 func (in *Source) validateVariables() error {
 	for _, v := range in.Variables {
 		if strings.HasPrefix(v.Name, ReservedPrefix) {
@@ -133,7 +201,7 @@ func (in *Source) GetVariables() ([]cel.NamedExpressionAccessor, error) {
 
 	vars := make([]cel.NamedExpressionAccessor, len(in.Variables))
 	for i, v := range in.Variables {
-		vars[i] = &validatingadmissionpolicy.Variable{
+		vars[i] = &validating.Variable{
 			Name:       v.Name,
 			Expression: v.Expression,
 		}
@@ -157,10 +225,40 @@ func (in *Source) GetV1Alpha1Variables() ([]admissionv1alpha1.Variable, error) {
 	return variables, nil
 }
 
+func (in *Source) GetV1Beta1Variables() ([]admissionv1beta1.Variable, error) {
+	if err := in.validateVariables(); err != nil {
+		return nil, err
+	}
+
+	var variables []admissionv1beta1.Variable
+	for _, v := range in.Variables {
+		variables = append(variables, admissionv1beta1.Variable{
+			Name:       v.Name,
+			Expression: v.Expression,
+		})
+	}
+	return variables, nil
+}
+
+func (in *Source) GetV1Variables() ([]admissionv1.Variable, error) {
+	if err := in.validateVariables(); err != nil {
+		return nil, err
+	}
+
+	var variables []admissionv1.Variable
+	for _, v := range in.Variables {
+		variables = append(variables, admissionv1.Variable{
+			Name:       v.Name,
+			Expression: v.Expression,
+		})
+	}
+	return variables, nil
+}
+
 func (in *Source) GetValidations() ([]cel.ExpressionAccessor, error) {
 	validations := make([]cel.ExpressionAccessor, len(in.Validations))
 	for i, validation := range in.Validations {
-		celValidation := validatingadmissionpolicy.ValidationCondition{
+		celValidation := validating.ValidationCondition{
 			Expression: validation.Expression,
 			Message:    validation.Message,
 		}
@@ -181,11 +279,152 @@ func (in *Source) GetV1Alpha1Validatons() ([]admissionv1alpha1.Validation, error
 	return validations, nil
 }
 
+func (in *Source) GetV1Beta1Validations() ([]admissionv1beta1.Validation, error) {
+	var validations []admissionv1beta1.Validation
+	for _, v := range in.Validations {
+		validations = append(validations, admissionv1beta1.Validation{
+			Expression:        v.Expression,
+			Message:           v.Message,
+			MessageExpression: v.MessageExpression,
+		})
+	}
+	return validations, nil
+}
+
+func (in *Source) GetV1Validations() ([]admissionv1.Validation, error) {
+	var validations []admissionv1.Validation
+	for _, v := range in.Validations {
+		validations = append(validations, admissionv1.Validation{
+			Expression:        v.Expression,
+			Message:           v.Message,
+			MessageExpression: v.MessageExpression,
+		})
+	}
+	return validations, nil
+}
+
+func (in *Source) validateAuditAnnotations() error {
+	if err := validateAuditAnnotations(in.AuditAnnotations); err != nil {
+		return err
+	}
+
+	for i, v := range in.Validations {
+		if err := validateAuditAnnotations(v.AuditAnnotations); err != nil {
+			return fmt.Errorf("validations[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateAuditAnnotations(auditAnnotations []AuditAnnotation) error {
+	keys := make(map[string]bool, len(auditAnnotations))
+	for _, a := range auditAnnotations {
+		if a.Key == "" || a.ValueExpression == "" {
+			return fmt.Errorf("%w: key and valueExpression are required", ErrBadAuditAnnotation)
+		}
+		if keys[a.Key] {
+			return fmt.Errorf("%w: duplicate key %q", ErrBadAuditAnnotation, a.Key)
+		}
+		keys[a.Key] = true
+	}
+	return nil
+}
+
+func (in *Source) GetV1Alpha1AuditAnnotations() ([]admissionv1alpha1.AuditAnnotation, error) {
+	if err := in.validateAuditAnnotations(); err != nil {
+		return nil, err
+	}
+
+	var auditAnnotations []admissionv1alpha1.AuditAnnotation
+	for _, a := range in.AuditAnnotations {
+		auditAnnotations = append(auditAnnotations, admissionv1alpha1.AuditAnnotation{
+			Key:             a.Key,
+			ValueExpression: a.ValueExpression,
+		})
+	}
+	return auditAnnotations, nil
+}
+
+func (in *Source) GetV1Beta1AuditAnnotations() ([]admissionv1beta1.AuditAnnotation, error) {
+	if err := in.validateAuditAnnotations(); err != nil {
+		return nil, err
+	}
+
+	var auditAnnotations []admissionv1beta1.AuditAnnotation
+	for _, a := range in.AuditAnnotations {
+		auditAnnotations = append(auditAnnotations, admissionv1beta1.AuditAnnotation{
+			Key:             a.Key,
+			ValueExpression: a.ValueExpression,
+		})
+	}
+	return auditAnnotations, nil
+}
+
+func (in *Source) GetV1AuditAnnotations() ([]admissionv1.AuditAnnotation, error) {
+	if err := in.validateAuditAnnotations(); err != nil {
+		return nil, err
+	}
+
+	var auditAnnotations []admissionv1.AuditAnnotation
+	for _, a := range in.AuditAnnotations {
+		auditAnnotations = append(auditAnnotations, admissionv1.AuditAnnotation{
+			Key:             a.Key,
+			ValueExpression: a.ValueExpression,
+		})
+	}
+	return auditAnnotations, nil
+}
+
+// GetAuditAnnotations returns the template's auditAnnotations, which are
+// evaluated for every violation.
+func (in *Source) GetAuditAnnotations() ([]cel.ExpressionAccessor, error) {
+	if err := in.validateAuditAnnotations(); err != nil {
+		return nil, err
+	}
+
+	return auditAnnotationConditions(in.AuditAnnotations), nil
+}
+
+// GetAuditAnnotations returns the auditAnnotations evaluated for violations of
+// the validation.
+func (v *Validation) GetAuditAnnotations() ([]cel.ExpressionAccessor, error) {
+	if err := validateAuditAnnotations(v.AuditAnnotations); err != nil {
+		return nil, err
+	}
+
+	return auditAnnotationConditions(v.AuditAnnotations), nil
+}
+
+func auditAnnotationConditions(auditAnnotations []AuditAnnotation) []cel.ExpressionAccessor {
+	conditions := make([]cel.ExpressionAccessor, len(auditAnnotations))
+	for i, a := range auditAnnotations {
+		conditions[i] = &validating.AuditAnnotationCondition{
+			Key:             a.Key,
+			ValueExpression: a.ValueExpression,
+		}
+	}
+	return conditions
+}
+
+// DetailsCondition is a validation's detailsExpression, which may evaluate to
+// any value.
+type DetailsCondition struct {
+	DetailsExpression string
+}
+
+func (c *DetailsCondition) GetExpression() string {
+	return c.DetailsExpression
+}
+
+func (c *DetailsCondition) ReturnTypes() []*celgo.Type {
+	return []*celgo.Type{celgo.AnyType}
+}
+
 func (in *Source) GetMessageExpressions() ([]cel.ExpressionAccessor, error) {
 	messageExpressions := make([]cel.ExpressionAccessor, len(in.Validations))
 	for i, validation := range in.Validations {
 		if validation.MessageExpression != "" {
-			condition := validatingadmissionpolicy.MessageExpressionCondition{
+			condition := validating.MessageExpressionCondition{
 				MessageExpression: validation.MessageExpression,
 			}
 			messageExpressions[i] = &condition
@@ -232,6 +471,25 @@ func (in *Source) GetV1alpha1FailurePolicy() (*admissionv1alpha1.FailurePolicyTy
 	return &out, nil
 }
 
+func (in *Source) GetV1Beta1FailurePolicy() (*admissionv1beta1.FailurePolicyType, error) {
+	if in.FailurePolicy == nil {
+		return nil, nil
+	}
+
+	var out admissionv1beta1.FailurePolicyType
+
+	switch *in.FailurePolicy {
+	case string(admissionv1.Fail):
+		out = admissionv1beta1.Fail
+	case string(admissionv1.Ignore):
+		out = admissionv1beta1.Ignore
+	default:
+		return nil, fmt.Errorf("%w: unrecognized failure policy: %s", ErrBadFailurePolicy, *in.FailurePolicy)
+	}
+
+	return &out, nil
+}
+
 // ToUnstructured() is a convenience method for converting to unstructured.
 // Intended for testing. It will panic on error.
 func (in *Source) MustToUnstructured() map[string]interface{} {
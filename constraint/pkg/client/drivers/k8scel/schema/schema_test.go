@@ -109,6 +109,79 @@ func TestValidationErrors(t *testing.T) {
 			},
 			expectedErr: ErrBadVariable,
 		},
+		{
+			name: "Valid Runtime Cost Limit",
+			source: &Source{
+				RuntimeCostLimit: ptr.To[int64](1000),
+			},
+		},
+		{
+			name: "Non-positive Runtime Cost Limit",
+			source: &Source{
+				RuntimeCostLimit: ptr.To[int64](0),
+			},
+			expectedErr: ErrBadCostLimit,
+		},
+		{
+			name: "Valid Audit Annotations",
+			source: &Source{
+				AuditAnnotations: []AuditAnnotation{
+					{
+						Key:             "name",
+						ValueExpression: "object.metadata.name",
+					},
+				},
+			},
+		},
+		{
+			name: "Duplicate Audit Annotation Key",
+			source: &Source{
+				AuditAnnotations: []AuditAnnotation{
+					{
+						Key:             "name",
+						ValueExpression: "object.metadata.name",
+					},
+					{
+						Key:             "name",
+						ValueExpression: "object.metadata.namespace",
+					},
+				},
+			},
+			expectedErr: ErrBadAuditAnnotation,
+		},
+		{
+			name: "Valid Validation Details And Audit Annotations",
+			source: &Source{
+				Validations: []Validation{
+					{
+						Expression:        "true",
+						DetailsExpression: `{"name": object.metadata.name}`,
+						AuditAnnotations: []AuditAnnotation{
+							{
+								Key:             "name",
+								ValueExpression: "object.metadata.name",
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "Validation Audit Annotation Missing Expression",
+			source: &Source{
+				Validations: []Validation{
+					{
+						Expression: "true",
+						AuditAnnotations: []AuditAnnotation{
+							{
+								Key: "name",
+							},
+						},
+					},
+				},
+			},
+			expectedErr: ErrBadAuditAnnotation,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -1,10 +1,14 @@
 package transform
 
 import (
+	"fmt"
+
 	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	admissionregistrationv1alpha1 "k8s.io/api/admissionregistration/v1alpha1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
 	"k8s.io/apiserver/pkg/admission/plugin/cel"
-	"k8s.io/apiserver/pkg/admission/plugin/validatingadmissionpolicy"
+	"k8s.io/apiserver/pkg/admission/plugin/policy/validating"
 	"k8s.io/apiserver/pkg/admission/plugin/webhook/matchconditions"
 )
 
@@ -48,10 +52,18 @@ const (
 			!has(params.spec.match.namespaces) ? true : (
 				[object, oldObject].exists(obj,
 					obj != null && (
-						// cluster-scoped objects always match
-						!has(obj.metadata.namespace) || obj.metadata.namespace == "" ? true : (
-							params.spec.match.namespaces.exists(nsMatcher,
-								(string(obj.metadata.namespace).matches("^" + string(nsMatcher).replace("*", ".*") + "$"))
+						// Namespace objects match on their own name, as ValidatingAdmissionPolicyBinding
+						// namespace selectors do
+						request.kind.group == "" && request.kind.kind == "Namespace" ? (
+							has(obj.metadata.name) && params.spec.match.namespaces.exists(nsMatcher,
+								(string(obj.metadata.name).matches("^" + string(nsMatcher).replace("*", ".*") + "$"))
+							)
+						) : (
+							// other cluster-scoped objects always match
+							!has(obj.metadata.namespace) || obj.metadata.namespace == "" ? true : (
+								params.spec.match.namespaces.exists(nsMatcher,
+									(string(obj.metadata.namespace).matches("^" + string(nsMatcher).replace("*", ".*") + "$"))
+								)
 							)
 						)
 					)
@@ -70,10 +82,18 @@ const (
 			!has(params.spec.match.excludedNamespaces) ? true : (
 				[object, oldObject].exists(obj,
 					obj != null && (
-						// cluster-scoped objects always match
-						!has(obj.metadata.namespace) || obj.metadata.namespace == "" ? true : (
-							!params.spec.match.excludedNamespaces.exists(nsMatcher,
-								(string(obj.metadata.namespace).matches("^" + string(nsMatcher).replace("*", ".*") + "$"))
+						// Namespace objects match on their own name, as ValidatingAdmissionPolicyBinding
+						// namespace selectors do
+						request.kind.group == "" && request.kind.kind == "Namespace" ? (
+							has(obj.metadata.name) && !params.spec.match.excludedNamespaces.exists(nsMatcher,
+								(string(obj.metadata.name).matches("^" + string(nsMatcher).replace("*", ".*") + "$"))
+							)
+						) : (
+							// other cluster-scoped objects always match
+							!has(obj.metadata.namespace) || obj.metadata.namespace == "" ? true : (
+								!params.spec.match.excludedNamespaces.exists(nsMatcher,
+									(string(obj.metadata.namespace).matches("^" + string(nsMatcher).replace("*", ".*") + "$"))
+								)
 							)
 						)
 					)
@@ -91,6 +111,22 @@ func MatchExcludedNamespacesGlobV1Alpha1() admissionregistrationv1alpha1.MatchCo
 	}
 }
 
+func MatchExcludedNamespacesGlobV1Beta1() admissionregistrationv1beta1.MatchCondition {
+	mc := MatchExcludedNamespacesGlobV1Alpha1()
+	return admissionregistrationv1beta1.MatchCondition{
+		Name:       mc.Name,
+		Expression: mc.Expression,
+	}
+}
+
+func MatchExcludedNamespacesGlobV1() admissionregistrationv1.MatchCondition {
+	mc := MatchExcludedNamespacesGlobV1Alpha1()
+	return admissionregistrationv1.MatchCondition{
+		Name:       mc.Name,
+		Expression: mc.Expression,
+	}
+}
+
 func MatchExcludedNamespacesGlobCEL() []cel.ExpressionAccessor {
 	mc := MatchExcludedNamespacesGlobV1Alpha1()
 	return []cel.ExpressionAccessor{
@@ -108,6 +144,22 @@ func MatchNamespacesGlobV1Alpha1() admissionregistrationv1alpha1.MatchCondition
 	}
 }
 
+func MatchNamespacesGlobV1Beta1() admissionregistrationv1beta1.MatchCondition {
+	mc := MatchNamespacesGlobV1Alpha1()
+	return admissionregistrationv1beta1.MatchCondition{
+		Name:       mc.Name,
+		Expression: mc.Expression,
+	}
+}
+
+func MatchNamespacesGlobV1() admissionregistrationv1.MatchCondition {
+	mc := MatchNamespacesGlobV1Alpha1()
+	return admissionregistrationv1.MatchCondition{
+		Name:       mc.Name,
+		Expression: mc.Expression,
+	}
+}
+
 func MatchNamespacesGlobCEL() []cel.ExpressionAccessor {
 	mc := MatchNamespacesGlobV1Alpha1()
 	return []cel.ExpressionAccessor{
@@ -125,6 +177,22 @@ func MatchNameGlobV1Alpha1() admissionregistrationv1alpha1.MatchCondition {
 	}
 }
 
+func MatchNameGlobV1Beta1() admissionregistrationv1beta1.MatchCondition {
+	mc := MatchNameGlobV1Alpha1()
+	return admissionregistrationv1beta1.MatchCondition{
+		Name:       mc.Name,
+		Expression: mc.Expression,
+	}
+}
+
+func MatchNameGlobV1() admissionregistrationv1.MatchCondition {
+	mc := MatchNameGlobV1Alpha1()
+	return admissionregistrationv1.MatchCondition{
+		Name:       mc.Name,
+		Expression: mc.Expression,
+	}
+}
+
 func MatchNameGlobCEL() []cel.ExpressionAccessor {
 	mc := MatchNameGlobV1Alpha1()
 	return []cel.ExpressionAccessor{
@@ -142,6 +210,22 @@ func MatchKindsV1Alpha1() admissionregistrationv1alpha1.MatchCondition {
 	}
 }
 
+func MatchKindsV1Beta1() admissionregistrationv1beta1.MatchCondition {
+	mc := MatchKindsV1Alpha1()
+	return admissionregistrationv1beta1.MatchCondition{
+		Name:       mc.Name,
+		Expression: mc.Expression,
+	}
+}
+
+func MatchKindsV1() admissionregistrationv1.MatchCondition {
+	mc := MatchKindsV1Alpha1()
+	return admissionregistrationv1.MatchCondition{
+		Name:       mc.Name,
+		Expression: mc.Expression,
+	}
+}
+
 func MatchKindsCEL() []cel.ExpressionAccessor {
 	mc := MatchKindsV1Alpha1()
 	return []cel.ExpressionAccessor{
@@ -159,16 +243,43 @@ func BindParamsV1Alpha1() admissionregistrationv1alpha1.Variable {
 	}
 }
 
+func BindParamsV1Beta1() admissionregistrationv1beta1.Variable {
+	v := BindParamsV1Alpha1()
+	return admissionregistrationv1beta1.Variable{
+		Name:       v.Name,
+		Expression: v.Expression,
+	}
+}
+
+func BindParamsV1() admissionregistrationv1.Variable {
+	v := BindParamsV1Alpha1()
+	return admissionregistrationv1.Variable{
+		Name:       v.Name,
+		Expression: v.Expression,
+	}
+}
+
 func BindParamsCEL() []cel.NamedExpressionAccessor {
 	v := BindParamsV1Alpha1()
 	return []cel.NamedExpressionAccessor{
-		&validatingadmissionpolicy.Variable{
+		&validating.Variable{
 			Name:       v.Name,
 			Expression: v.Expression,
 		},
 	}
 }
 
+// BindInventoryCEL binds the referential data the driver attaches to params to
+// the inventory variable. Evaluates to an empty map if no data is attached.
+func BindInventoryCEL() []cel.NamedExpressionAccessor {
+	return []cel.NamedExpressionAccessor{
+		&validating.Variable{
+			Name:       schema.InventoryName,
+			Expression: fmt.Sprintf("has(params.%[1]s) ? params.%[1]s : {}", schema.InventoryName),
+		},
+	}
+}
+
 func AllMatchersV1Alpha1() []admissionregistrationv1alpha1.MatchCondition {
 	return []admissionregistrationv1alpha1.MatchCondition{
 		MatchExcludedNamespacesGlobV1Alpha1(),
@@ -178,8 +289,30 @@ func AllMatchersV1Alpha1() []admissionregistrationv1alpha1.MatchCondition {
 	}
 }
 
+func AllMatchersV1Beta1() []admissionregistrationv1beta1.MatchCondition {
+	return []admissionregistrationv1beta1.MatchCondition{
+		MatchExcludedNamespacesGlobV1Beta1(),
+		MatchNamespacesGlobV1Beta1(),
+		MatchNameGlobV1Beta1(),
+		MatchKindsV1Beta1(),
+	}
+}
+
+func AllMatchersV1() []admissionregistrationv1.MatchCondition {
+	return []admissionregistrationv1.MatchCondition{
+		MatchExcludedNamespacesGlobV1(),
+		MatchNamespacesGlobV1(),
+		MatchNameGlobV1(),
+		MatchKindsV1(),
+	}
+}
+
+// AllVariablesCEL returns the variables available to templates evaluated by
+// the driver. Unlike AllVariablesV1Alpha1, AllVariablesV1Beta1, and
+// AllVariablesV1, this includes the inventory, which cannot be provided to
+// ValidatingAdmissionPolicies.
 func AllVariablesCEL() []cel.NamedExpressionAccessor {
-	return BindParamsCEL()
+	return append(BindParamsCEL(), BindInventoryCEL()...)
 }
 
 func AllVariablesV1Alpha1() []admissionregistrationv1alpha1.Variable {
@@ -187,3 +320,15 @@ func AllVariablesV1Alpha1() []admissionregistrationv1alpha1.Variable {
 		BindParamsV1Alpha1(),
 	}
 }
+
+func AllVariablesV1Beta1() []admissionregistrationv1beta1.Variable {
+	return []admissionregistrationv1beta1.Variable{
+		BindParamsV1Beta1(),
+	}
+}
+
+func AllVariablesV1() []admissionregistrationv1.Variable {
+	return []admissionregistrationv1.Variable{
+		BindParamsV1(),
+	}
+}
@@ -2,4 +2,8 @@ package transform
 
 import "errors"
 
-var ErrBadEnforcementAction = errors.New("invalid enforcement action")
+var (
+	ErrBadEnforcementAction = errors.New("invalid enforcement action")
+	ErrUnsupportedVersion   = errors.New("unsupported admissionregistration.k8s.io version")
+	ErrInvalidObject        = errors.New("invalid object")
+)
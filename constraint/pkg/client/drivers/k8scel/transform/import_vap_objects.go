@@ -0,0 +1,468 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	apiconstraints "github.com/open-policy-agent/frameworks/constraint/pkg/apis/constraints"
+	templatesv1beta1 "github.com/open-policy-agent/frameworks/constraint/pkg/apis/templates/v1beta1"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	rschema "k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// UnsupportedFeature is a feature of an imported object which cannot be
+// represented by the objects it was imported as.
+type UnsupportedFeature struct {
+	// Field is the path to the feature in the imported object, for example
+	// "spec.validations[0].reason".
+	Field string `json:"field"`
+
+	// Reason describes why the feature was not imported.
+	Reason string `json:"reason"`
+}
+
+// ImportReport lists the features of an imported object which were dropped or
+// only partially imported.
+type ImportReport struct {
+	Unsupported []UnsupportedFeature `json:"unsupported,omitempty"`
+}
+
+func (r *ImportReport) add(field, format string, args ...interface{}) {
+	r.Unsupported = append(r.Unsupported, UnsupportedFeature{Field: field, Reason: fmt.Sprintf(format, args...)})
+}
+
+// PolicyToTemplate converts policy into a ConstraintTemplate for target, with
+// a K8sNativeValidation source. The template's kind is derived from the
+// policy's name.
+//
+// If paramCRD is the CustomResourceDefinition of the policy's paramKind, the
+// schema of its spec becomes the schema of the template's parameters, and
+// references to params.spec are rewritten to the Constraint's
+// spec.parameters.
+func PolicyToTemplate(policy *admissionregistrationv1beta1.ValidatingAdmissionPolicy, target string, paramCRD *apiextensionsv1.CustomResourceDefinition) (*templates.ConstraintTemplate, *ImportReport, error) {
+	report := &ImportReport{}
+	kind := kindFromName(policy.GetName())
+
+	template := &templates.ConstraintTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: strings.ToLower(kind)},
+		Spec: templates.ConstraintTemplateSpec{
+			CRD: templates.CRD{Spec: templates.CRDSpec{Names: templates.Names{Kind: kind}}},
+		},
+	}
+	template.SetGroupVersionKind(templatesv1beta1.SchemeGroupVersion.WithKind("ConstraintTemplate"))
+
+	spec := policy.Spec
+	if spec.ParamKind != nil {
+		parametersSchema, err := paramsSchema(spec.ParamKind, paramCRD)
+		if err != nil {
+			return nil, nil, err
+		}
+		if parametersSchema == nil {
+			report.add("spec.paramKind", "no CustomResourceDefinition for %s %s was provided, so Constraints have no parameters schema",
+				spec.ParamKind.APIVersion, spec.ParamKind.Kind)
+		}
+		template.Spec.CRD.Spec.Validation = &templates.Validation{OpenAPIV3Schema: parametersSchema}
+	}
+
+	if spec.MatchConstraints != nil && !matchesEverything(spec.MatchConstraints) {
+		report.add("spec.matchConstraints", "templates cannot restrict the resources Constraints match; add these criteria to each Constraint's spec.match")
+	}
+
+	rewrite := func(field, expression string) (string, error) {
+		if spec.ParamKind == nil {
+			return expression, nil
+		}
+
+		out, unsupported, err := rewriteParams(expression)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", field, err)
+		}
+		if unsupported {
+			report.add(field, "references to params other than through params.spec cannot be mapped to Constraint parameters")
+		}
+		return out, nil
+	}
+
+	source := &schema.Source{}
+
+	for i, v := range spec.Variables {
+		field := fmt.Sprintf("spec.variables[%d]", i)
+		if v.Name == schema.ParamsName || strings.HasPrefix(v.Name, schema.ReservedPrefix) {
+			return nil, nil, fmt.Errorf("%w: %s: variable name %q is reserved", schema.ErrBadVariable, field, v.Name)
+		}
+
+		expression, err := rewrite(field+".expression", v.Expression)
+		if err != nil {
+			return nil, nil, err
+		}
+		source.Variables = append(source.Variables, schema.Variable{Name: v.Name, Expression: expression})
+	}
+
+	for i, mc := range spec.MatchConditions {
+		field := fmt.Sprintf("spec.matchConditions[%d]", i)
+		expression, err := rewrite(field+".expression", mc.Expression)
+		if err != nil {
+			return nil, nil, err
+		}
+		source.MatchConditions = append(source.MatchConditions, schema.MatchCondition{Name: mc.Name, Expression: expression})
+	}
+
+	for i, v := range spec.Validations {
+		field := fmt.Sprintf("spec.validations[%d]", i)
+		if v.Reason != nil {
+			report.add(field+".reason", "violations have no reason; %q is dropped", *v.Reason)
+		}
+
+		expression, err := rewrite(field+".expression", v.Expression)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		messageExpression := v.MessageExpression
+		if messageExpression != "" {
+			messageExpression, err = rewrite(field+".messageExpression", messageExpression)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
+		source.Validations = append(source.Validations, schema.Validation{
+			Expression:        expression,
+			Message:           v.Message,
+			MessageExpression: messageExpression,
+		})
+	}
+
+	for i, a := range spec.AuditAnnotations {
+		expression, err := rewrite(fmt.Sprintf("spec.auditAnnotations[%d].valueExpression", i), a.ValueExpression)
+		if err != nil {
+			return nil, nil, err
+		}
+		source.AuditAnnotations = append(source.AuditAnnotations, schema.AuditAnnotation{Key: a.Key, ValueExpression: expression})
+	}
+
+	if spec.FailurePolicy != nil {
+		failurePolicy := string(*spec.FailurePolicy)
+		source.FailurePolicy = &failurePolicy
+	}
+
+	if err := source.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	template.Spec.Targets = []templates.Target{{
+		Target: target,
+		Code: []templates.Code{{
+			Engine: schema.Name,
+			Source: &templates.Anything{Value: source.MustToUnstructured()},
+		}},
+	}}
+
+	return template, report, nil
+}
+
+// BindingToConstraint converts binding into a Constraint of template, which
+// should have been imported from the binding's policy. params is the object
+// referenced by the binding's paramRef, if any; its spec becomes the
+// Constraint's parameters. The Constraint is named after the binding, without
+// the prefix added by ConstraintToBinding.
+//
+// Resource rules are converted to spec.match.kinds using the RESTMapper
+// passed with WithRESTMapper. Without one, only rules matching all resources
+// in their groups are converted.
+func BindingToConstraint(binding *admissionregistrationv1beta1.ValidatingAdmissionPolicyBinding, template *templates.ConstraintTemplate, params *unstructured.Unstructured, opts ...MatchOpt) (*unstructured.Unstructured, *ImportReport, error) {
+	cfg := &matchConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	report := &ImportReport{}
+
+	constraint := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	constraint.SetGroupVersionKind(rschema.GroupVersionKind{
+		Group:   apiconstraints.Group,
+		Version: templatesv1beta1.SchemeGroupVersion.Version,
+		Kind:    template.Spec.CRD.Spec.Names.Kind,
+	})
+	constraint.SetName(strings.TrimPrefix(binding.GetName(), policyName("")))
+
+	action, err := enforcementAction(binding.Spec.ValidationActions, report)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := unstructured.SetNestedField(constraint.Object, action, "spec", "enforcementAction"); err != nil {
+		return nil, nil, err
+	}
+
+	if ref := binding.Spec.ParamRef; ref != nil {
+		if ref.Selector != nil {
+			report.add("spec.paramRef.selector", "Constraints have a single set of parameters and cannot select several param objects")
+		}
+		if ref.ParameterNotFoundAction != nil && *ref.ParameterNotFoundAction == admissionregistrationv1beta1.DenyAction {
+			report.add("spec.paramRef.parameterNotFoundAction", "Constraints always have their parameters, so requests are never denied for missing parameters")
+		}
+
+		if params != nil {
+			parameters, found, err := unstructured.NestedFieldCopy(params.Object, paramsSpecField)
+			if err != nil {
+				return nil, nil, err
+			}
+			if found {
+				if err := unstructured.SetNestedField(constraint.Object, parameters, "spec", "parameters"); err != nil {
+					return nil, nil, err
+				}
+			}
+		} else if ref.Name != "" {
+			report.add("spec.paramRef.name", "param object %q was not provided, so the Constraint has no parameters", ref.Name)
+		}
+	}
+
+	if resources := binding.Spec.MatchResources; resources != nil {
+		match, err := matchFromResources(resources, cfg.mapper, report)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(match) > 0 {
+			if err := unstructured.SetNestedMap(constraint.Object, match, "spec", "match"); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return constraint, report, nil
+}
+
+// paramsSchema returns the schema of the spec of paramKind's objects, or nil if
+// crd is nil.
+func paramsSchema(paramKind *admissionregistrationv1beta1.ParamKind, crd *apiextensionsv1.CustomResourceDefinition) (*apiextensions.JSONSchemaProps, error) {
+	if crd == nil {
+		return nil, nil
+	}
+
+	gv, err := rschema.ParseGroupVersion(paramKind.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	if crd.Spec.Group != gv.Group || crd.Spec.Names.Kind != paramKind.Kind {
+		return nil, fmt.Errorf("CustomResourceDefinition %q does not define %s %s", crd.GetName(), paramKind.APIVersion, paramKind.Kind)
+	}
+
+	for _, version := range crd.Spec.Versions {
+		if version.Name != gv.Version {
+			continue
+		}
+		if version.Schema == nil || version.Schema.OpenAPIV3Schema == nil {
+			return nil, nil
+		}
+
+		specSchema, found := version.Schema.OpenAPIV3Schema.Properties[paramsSpecField]
+		if !found {
+			return nil, nil
+		}
+
+		out := &apiextensions.JSONSchemaProps{}
+		if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(specSchema.DeepCopy(), out, nil); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	return nil, fmt.Errorf("CustomResourceDefinition %q does not serve version %q", crd.GetName(), gv.Version)
+}
+
+// enforcementAction returns the enforcement action equivalent to actions.
+// Constraints have a single enforcement action, so the most severe is chosen.
+func enforcementAction(actions []admissionregistrationv1beta1.ValidationAction, report *ImportReport) (string, error) {
+	// In order of decreasing severity.
+	candidates := []string{apiconstraints.EnforcementActionDeny, enforcementActionWarn, enforcementActionDryRun}
+
+	var chosen string
+	for _, candidate := range candidates {
+		for _, action := range actions {
+			if validationActions[candidate] == action {
+				chosen = candidate
+				break
+			}
+		}
+		if chosen != "" {
+			break
+		}
+	}
+
+	if chosen == "" {
+		return "", fmt.Errorf("%w: no recognized validation action in %v", ErrBadEnforcementAction, actions)
+	}
+	if len(actions) > 1 {
+		report.add("spec.validationActions", "Constraints have a single enforcement action; using %q for %v", chosen, actions)
+	}
+
+	return chosen, nil
+}
+
+// matchFromResources converts resources into the equivalent Constraint
+// spec.match, reporting the criteria which cannot be converted.
+func matchFromResources(resources *admissionregistrationv1beta1.MatchResources, mapper meta.RESTMapper, report *ImportReport) (map[string]interface{}, error) {
+	match := make(map[string]interface{})
+
+	for field, selector := range map[string]*metav1.LabelSelector{
+		MatchNamespaceSelector: resources.NamespaceSelector,
+		MatchLabelSelector:     resources.ObjectSelector,
+	} {
+		if selector == nil {
+			continue
+		}
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(selector)
+		if err != nil {
+			return nil, err
+		}
+		match[field] = u
+	}
+
+	if len(resources.ExcludeResourceRules) > 0 {
+		report.add("spec.matchResources.excludeResourceRules", "Constraints cannot exclude kinds")
+	}
+	if resources.MatchPolicy != nil && *resources.MatchPolicy == admissionregistrationv1beta1.Exact {
+		report.add("spec.matchResources.matchPolicy", "Constraints match kinds regardless of version, as with the Equivalent match policy")
+	}
+
+	var kinds []interface{}
+	for i, rule := range resources.ResourceRules {
+		field := fmt.Sprintf("spec.matchResources.resourceRules[%d]", i)
+
+		if !containsOperation(rule.Operations, admissionregistrationv1beta1.OperationAll) {
+			report.add(field+".operations", "Constraints match all operations")
+		}
+		if len(rule.ResourceNames) > 0 {
+			report.add(field+".resourceNames", "Constraints match a single name; add it to spec.match.name if appropriate")
+		}
+		if rule.Scope != nil && *rule.Scope != admissionregistrationv1beta1.AllScopes {
+			if len(resources.ResourceRules) == 1 {
+				match[MatchScope] = string(*rule.Scope)
+			} else {
+				report.add(field+".scope", "Constraints have a single scope for all kinds")
+			}
+		}
+
+		entry, err := kindsForRule(rule.Rule, mapper)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			report.add(field, "resources %v could not be mapped to kinds", rule.Resources)
+			continue
+		}
+		kinds = append(kinds, entry)
+	}
+	if len(kinds) > 0 {
+		match[MatchKinds] = kinds
+	}
+
+	return match, nil
+}
+
+// kindsForRule returns the spec.match.kinds entry matching the resources of
+// rule, or nil if they cannot be mapped.
+func kindsForRule(rule admissionregistrationv1beta1.Rule, mapper meta.RESTMapper) (map[string]interface{}, error) {
+	groups := make([]interface{}, len(rule.APIGroups))
+	for i, group := range rule.APIGroups {
+		groups[i] = group
+	}
+
+	if contains(rule.Resources, "*") {
+		return map[string]interface{}{"apiGroups": groups, "kinds": []interface{}{"*"}}, nil
+	}
+	if mapper == nil || contains(rule.APIGroups, "*") {
+		return nil, nil
+	}
+
+	kinds := make(map[string]bool)
+	for _, group := range rule.APIGroups {
+		for _, resource := range rule.Resources {
+			if strings.Contains(resource, "/") {
+				// Constraints do not match subresources.
+				return nil, nil
+			}
+
+			gvk, err := mapper.KindFor(rschema.GroupVersionResource{Group: group, Resource: resource})
+			if meta.IsNoMatchError(err) {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			kinds[gvk.Kind] = true
+		}
+	}
+
+	var kindList []string
+	for kind := range kinds {
+		kindList = append(kindList, kind)
+	}
+	sort.Strings(kindList)
+
+	out := make([]interface{}, len(kindList))
+	for i, kind := range kindList {
+		out[i] = kind
+	}
+	return map[string]interface{}{"apiGroups": groups, "kinds": out}, nil
+}
+
+// matchesEverything returns true if resources matches every request.
+func matchesEverything(resources *admissionregistrationv1beta1.MatchResources) bool {
+	if resources.NamespaceSelector != nil && (len(resources.NamespaceSelector.MatchLabels) > 0 || len(resources.NamespaceSelector.MatchExpressions) > 0) {
+		return false
+	}
+	if resources.ObjectSelector != nil && (len(resources.ObjectSelector.MatchLabels) > 0 || len(resources.ObjectSelector.MatchExpressions) > 0) {
+		return false
+	}
+	if len(resources.ExcludeResourceRules) > 0 {
+		return false
+	}
+
+	for _, rule := range resources.ResourceRules {
+		if containsOperation(rule.Operations, admissionregistrationv1beta1.OperationAll) &&
+			contains(rule.APIGroups, "*") && contains(rule.APIVersions, "*") && contains(rule.Resources, "*") &&
+			len(rule.ResourceNames) == 0 && (rule.Scope == nil || *rule.Scope == admissionregistrationv1beta1.AllScopes) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsOperation(operations []admissionregistrationv1beta1.OperationType, operation admissionregistrationv1beta1.OperationType) bool {
+	for _, o := range operations {
+		if o == operation {
+			return true
+		}
+	}
+	return false
+}
+
+// kindFromName converts a Kubernetes object name, such as "require-labels",
+// into a kind, such as "RequireLabels".
+func kindFromName(name string) string {
+	var kind strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		kind.WriteRune(r)
+	}
+	return kind.String()
+}
@@ -0,0 +1,288 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/ptr"
+)
+
+func TestRewriteParams(t *testing.T) {
+	tests := []struct {
+		expression      string
+		want            string
+		wantUnsupported bool
+	}{{
+		expression: `object.spec.replicas <= 3`,
+		want:       `object.spec.replicas <= 3`,
+	}, {
+		expression: `object.spec.replicas <= params.spec.maxReplicas`,
+		want:       `object.spec.replicas <= params.spec.parameters.maxReplicas`,
+	}, {
+		expression: `!has(params.spec) || has(params.spec.labels)`,
+		want:       `!has(params.spec.parameters) || has(params.spec.parameters.labels)`,
+	}, {
+		expression: `params.spec.labels.all(l, l in object.metadata.labels)`,
+		want:       `params.spec.parameters.labels.all(l, l in object.metadata.labels)`,
+	}, {
+		expression:      `object.metadata.name == params.data.name`,
+		want:            `object.metadata.name == params.data.name`,
+		wantUnsupported: true,
+	}, {
+		expression:      `params != null && params.spec.max > 1`,
+		want:            `params != null && params.spec.parameters.max > 1`,
+		wantUnsupported: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got, unsupported, err := rewriteParams(tt.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if unsupported != tt.wantUnsupported {
+				t.Errorf("got unsupported %t, want %t", unsupported, tt.wantUnsupported)
+			}
+		})
+	}
+}
+
+func replicaLimitsCRD() *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "replicalimits.example.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "example.com",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: "ReplicaLimit"},
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+				Name: "v1",
+				Schema: &apiextensionsv1.CustomResourceValidation{OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+					Type: "object",
+					Properties: map[string]apiextensionsv1.JSONSchemaProps{
+						"spec": {
+							Type: "object",
+							Properties: map[string]apiextensionsv1.JSONSchemaProps{
+								"maxReplicas": {Type: "integer"},
+							},
+						},
+					},
+				}},
+			}},
+		},
+	}
+}
+
+func TestPolicyToTemplate(t *testing.T) {
+	policy := &admissionregistrationv1beta1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "replica-limits"},
+		Spec: admissionregistrationv1beta1.ValidatingAdmissionPolicySpec{
+			ParamKind: &admissionregistrationv1beta1.ParamKind{APIVersion: "example.com/v1", Kind: "ReplicaLimit"},
+			MatchConstraints: &admissionregistrationv1beta1.MatchResources{
+				ResourceRules: []admissionregistrationv1beta1.NamedRuleWithOperations{{
+					RuleWithOperations: admissionregistrationv1beta1.RuleWithOperations{
+						Operations: []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.Create, admissionregistrationv1beta1.Update},
+						Rule:       admissionregistrationv1beta1.Rule{APIGroups: []string{"apps"}, APIVersions: []string{"v1"}, Resources: []string{"deployments"}},
+					},
+				}},
+			},
+			FailurePolicy:   ptr.To(admissionregistrationv1beta1.Ignore),
+			MatchConditions: []admissionregistrationv1beta1.MatchCondition{{Name: "not-system", Expression: `!object.metadata.name.startsWith("system-")`}},
+			Variables:       []admissionregistrationv1beta1.Variable{{Name: "replicas", Expression: "object.spec.replicas"}},
+			Validations: []admissionregistrationv1beta1.Validation{{
+				Expression:        "variables.replicas <= params.spec.maxReplicas",
+				MessageExpression: `"at most " + string(params.spec.maxReplicas) + " replicas"`,
+				Reason:            ptr.To(metav1.StatusReasonInvalid),
+			}},
+			AuditAnnotations: []admissionregistrationv1beta1.AuditAnnotation{{Key: "replicas", ValueExpression: "string(variables.replicas)"}},
+		},
+	}
+
+	template, report, err := PolicyToTemplate(policy, "admission.k8s.gatekeeper.sh", replicaLimitsCRD())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if template.GetName() != "replicalimits" || template.Spec.CRD.Spec.Names.Kind != "ReplicaLimits" {
+		t.Errorf("got template %q of kind %q, want %q of kind %q", template.GetName(), template.Spec.CRD.Spec.Names.Kind, "replicalimits", "ReplicaLimits")
+	}
+
+	wantSchema := &apiextensions.JSONSchemaProps{
+		Type:       "object",
+		Properties: map[string]apiextensions.JSONSchemaProps{"maxReplicas": {Type: "integer"}},
+	}
+	if diff := cmp.Diff(wantSchema, template.Spec.CRD.Spec.Validation.OpenAPIV3Schema); diff != "" {
+		t.Error(diff)
+	}
+
+	source, err := schema.GetSourceFromTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantSource := &schema.Source{
+		FailurePolicy:   ptr.To("Ignore"),
+		MatchConditions: []schema.MatchCondition{{Name: "not-system", Expression: `!object.metadata.name.startsWith("system-")`}},
+		Variables:       []schema.Variable{{Name: "replicas", Expression: "object.spec.replicas"}},
+		Validations: []schema.Validation{{
+			Expression:        "variables.replicas <= params.spec.parameters.maxReplicas",
+			MessageExpression: `"at most " + string(params.spec.parameters.maxReplicas) + " replicas"`,
+		}},
+		AuditAnnotations: []schema.AuditAnnotation{{Key: "replicas", ValueExpression: "string(variables.replicas)"}},
+	}
+	if diff := cmp.Diff(wantSource, source); diff != "" {
+		t.Error(diff)
+	}
+
+	wantFields := []string{"spec.matchConstraints", "spec.validations[0].reason"}
+	if diff := cmp.Diff(wantFields, reportFields(report), cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestPolicyToTemplate_NoParams(t *testing.T) {
+	policy := &admissionregistrationv1beta1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "no-latest-tag"},
+		Spec: admissionregistrationv1beta1.ValidatingAdmissionPolicySpec{
+			Validations: []admissionregistrationv1beta1.Validation{{
+				Expression: `object.spec.containers.all(c, !c.image.endsWith(":latest"))`,
+				Message:    "latest tag is not allowed",
+			}},
+		},
+	}
+
+	template, report, err := PolicyToTemplate(policy, "admission.k8s.gatekeeper.sh", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Unsupported) != 0 {
+		t.Errorf("got unsupported features %v, want none", report.Unsupported)
+	}
+	if template.Spec.CRD.Spec.Validation != nil {
+		t.Errorf("got parameters schema %v, want none", template.Spec.CRD.Spec.Validation)
+	}
+
+	source, err := schema.GetSourceFromTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]schema.Validation{{
+		Expression: `object.spec.containers.all(c, !c.image.endsWith(":latest"))`,
+		Message:    "latest tag is not allowed",
+	}}, source.Validations); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestBindingToConstraint(t *testing.T) {
+	template := &templates.ConstraintTemplate{
+		Spec: templates.ConstraintTemplateSpec{CRD: templates.CRD{Spec: templates.CRDSpec{Names: templates.Names{Kind: "ReplicaLimits"}}}},
+	}
+
+	binding := &admissionregistrationv1beta1.ValidatingAdmissionPolicyBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "replica-limits-prod"},
+		Spec: admissionregistrationv1beta1.ValidatingAdmissionPolicyBindingSpec{
+			PolicyName: "replica-limits",
+			ParamRef: &admissionregistrationv1beta1.ParamRef{
+				Name:                    "prod",
+				ParameterNotFoundAction: ptr.To(admissionregistrationv1beta1.DenyAction),
+			},
+			MatchResources: &admissionregistrationv1beta1.MatchResources{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+				ResourceRules: []admissionregistrationv1beta1.NamedRuleWithOperations{{
+					RuleWithOperations: admissionregistrationv1beta1.RuleWithOperations{
+						Operations: []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.OperationAll},
+						Rule: admissionregistrationv1beta1.Rule{
+							APIGroups: []string{"apps"}, APIVersions: []string{"*"}, Resources: []string{"deployments", "statefulsets"},
+							Scope: ptr.To(admissionregistrationv1beta1.NamespacedScope),
+						},
+					},
+				}},
+			},
+			ValidationActions: []admissionregistrationv1beta1.ValidationAction{admissionregistrationv1beta1.Warn, admissionregistrationv1beta1.Audit},
+		},
+	}
+
+	params := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "ReplicaLimit",
+		"metadata":   map[string]interface{}{"name": "prod"},
+		"spec":       map[string]interface{}{"maxReplicas": int64(3)},
+	}}
+
+	constraint, report, err := BindingToConstraint(binding, template, params, WithRESTMapper(testRESTMapper()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"apiVersion": "constraints.gatekeeper.sh/v1beta1",
+		"kind":       "ReplicaLimits",
+		"metadata":   map[string]interface{}{"name": "replica-limits-prod"},
+		"spec": map[string]interface{}{
+			"enforcementAction": "warn",
+			"parameters":        map[string]interface{}{"maxReplicas": int64(3)},
+			"match": map[string]interface{}{
+				"namespaceSelector": map[string]interface{}{"matchLabels": map[string]interface{}{"env": "prod"}},
+				"scope":             "Namespaced",
+				"kinds": []interface{}{
+					map[string]interface{}{"apiGroups": []interface{}{"apps"}, "kinds": []interface{}{"Deployment", "StatefulSet"}},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, constraint.Object); diff != "" {
+		t.Error(diff)
+	}
+
+	wantFields := []string{"spec.paramRef.parameterNotFoundAction", "spec.validationActions"}
+	if diff := cmp.Diff(wantFields, reportFields(report), cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestBindingToConstraint_RoundTrip(t *testing.T) {
+	template := &templates.ConstraintTemplate{
+		Spec: templates.ConstraintTemplateSpec{CRD: templates.CRD{Spec: templates.CRDSpec{Names: templates.Names{Kind: "FooTemplate"}}}},
+	}
+
+	original := newTestConstraint("dryrun", &metav1.LabelSelector{MatchLabels: map[string]string{"ns": "yes"}}, &metav1.LabelSelector{MatchLabels: map[string]string{"obj": "yes"}})
+
+	binding, err := ConstraintToBindingV1Beta1(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint, report, err := BindingToConstraint(binding, template, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if constraint.GetName() != original.GetName() {
+		t.Errorf("got name %q, want %q", constraint.GetName(), original.GetName())
+	}
+	if diff := cmp.Diff(original.Object["spec"], constraint.Object["spec"]); diff != "" {
+		t.Error(diff)
+	}
+	// The generated binding references the Constraint itself for parameters.
+	if diff := cmp.Diff([]string{"spec.paramRef.name"}, reportFields(report)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func reportFields(report *ImportReport) []string {
+	var fields []string
+	for _, feature := range report.Unsupported {
+		fields = append(fields, feature.Field)
+	}
+	return fields
+}
@@ -8,13 +8,28 @@ import (
 	templatesv1beta1 "github.com/open-policy-agent/frameworks/constraint/pkg/apis/templates/v1beta1"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	admissionregistrationv1alpha1 "k8s.io/api/admissionregistration/v1alpha1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/utils/ptr"
 )
 
+const (
+	enforcementActionWarn   = "warn"
+	enforcementActionDryRun = "dryrun"
+)
+
+// validationActions maps Gatekeeper's enforcement actions to the equivalent
+// ValidatingAdmissionPolicyBinding validation actions.
+var validationActions = map[string]admissionregistrationv1beta1.ValidationAction{
+	apiconstraints.EnforcementActionDeny: admissionregistrationv1beta1.Deny,
+	enforcementActionWarn:                admissionregistrationv1beta1.Warn,
+	enforcementActionDryRun:              admissionregistrationv1beta1.Audit,
+}
+
 func TemplateToPolicyDefinition(template *templates.ConstraintTemplate) (*admissionregistrationv1alpha1.ValidatingAdmissionPolicy, error) {
 	source, err := schema.GetSourceFromTemplate(template)
 	if err != nil {
@@ -43,9 +58,14 @@ func TemplateToPolicyDefinition(template *templates.ConstraintTemplate) (*admiss
 		return nil, err
 	}
 
+	auditAnnotations, err := source.GetV1Alpha1AuditAnnotations()
+	if err != nil {
+		return nil, err
+	}
+
 	policy := &admissionregistrationv1alpha1.ValidatingAdmissionPolicy{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: fmt.Sprintf("gatekeeper-%s", template.GetName()),
+			Name: policyName(template.GetName()),
 		},
 		Spec: admissionregistrationv1alpha1.ValidatingAdmissionPolicySpec{
 			ParamKind: &admissionregistrationv1alpha1.ParamKind{
@@ -65,67 +85,282 @@ func TemplateToPolicyDefinition(template *templates.ConstraintTemplate) (*admiss
 			MatchConditions:  matchConditions,
 			Validations:      validations,
 			FailurePolicy:    failurePolicy,
-			AuditAnnotations: nil,
+			AuditAnnotations: auditAnnotations,
+			Variables:        variables,
+		},
+	}
+	return policy, nil
+}
+
+func TemplateToPolicyDefinitionV1Beta1(template *templates.ConstraintTemplate) (*admissionregistrationv1beta1.ValidatingAdmissionPolicy, error) {
+	source, err := schema.GetSourceFromTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	matchConditions, err := source.GetV1Beta1MatchConditions()
+	if err != nil {
+		return nil, err
+	}
+	matchConditions = append(matchConditions, AllMatchersV1Beta1()...)
+
+	validations, err := source.GetV1Beta1Validations()
+	if err != nil {
+		return nil, err
+	}
+
+	variables, err := source.GetV1Beta1Variables()
+	if err != nil {
+		return nil, err
+	}
+	variables = append(variables, AllVariablesV1Beta1()...)
+
+	failurePolicy, err := source.GetV1Beta1FailurePolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	auditAnnotations, err := source.GetV1Beta1AuditAnnotations()
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &admissionregistrationv1beta1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: policyName(template.GetName()),
+		},
+		Spec: admissionregistrationv1beta1.ValidatingAdmissionPolicySpec{
+			ParamKind: &admissionregistrationv1beta1.ParamKind{
+				APIVersion: fmt.Sprintf("%s/%s", apiconstraints.Group, templatesv1beta1.SchemeGroupVersion.Version),
+				Kind:       template.Spec.CRD.Spec.Names.Kind,
+			},
+			MatchConstraints: &admissionregistrationv1beta1.MatchResources{
+				ResourceRules: []admissionregistrationv1beta1.NamedRuleWithOperations{
+					{
+						RuleWithOperations: admissionregistrationv1beta1.RuleWithOperations{
+							Operations: []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.OperationAll},
+							Rule:       admissionregistrationv1beta1.Rule{APIGroups: []string{"*"}, APIVersions: []string{"*"}, Resources: []string{"*"}},
+						},
+					},
+				},
+			},
+			MatchConditions:  matchConditions,
+			Validations:      validations,
+			FailurePolicy:    failurePolicy,
+			AuditAnnotations: auditAnnotations,
+			Variables:        variables,
+		},
+	}
+	return policy, nil
+}
+
+func TemplateToPolicyDefinitionV1(template *templates.ConstraintTemplate) (*admissionregistrationv1.ValidatingAdmissionPolicy, error) {
+	source, err := schema.GetSourceFromTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	matchConditions, err := source.GetV1MatchConditions()
+	if err != nil {
+		return nil, err
+	}
+	matchConditions = append(matchConditions, AllMatchersV1()...)
+
+	validations, err := source.GetV1Validations()
+	if err != nil {
+		return nil, err
+	}
+
+	variables, err := source.GetV1Variables()
+	if err != nil {
+		return nil, err
+	}
+	variables = append(variables, AllVariablesV1()...)
+
+	failurePolicy, err := source.GetFailurePolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	auditAnnotations, err := source.GetV1AuditAnnotations()
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &admissionregistrationv1.ValidatingAdmissionPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: policyName(template.GetName()),
+		},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicySpec{
+			ParamKind: &admissionregistrationv1.ParamKind{
+				APIVersion: fmt.Sprintf("%s/%s", apiconstraints.Group, templatesv1beta1.SchemeGroupVersion.Version),
+				Kind:       template.Spec.CRD.Spec.Names.Kind,
+			},
+			MatchConstraints: &admissionregistrationv1.MatchResources{
+				ResourceRules: []admissionregistrationv1.NamedRuleWithOperations{
+					{
+						RuleWithOperations: admissionregistrationv1.RuleWithOperations{
+							Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.OperationAll},
+							Rule:       admissionregistrationv1.Rule{APIGroups: []string{"*"}, APIVersions: []string{"*"}, Resources: []string{"*"}},
+						},
+					},
+				},
+			},
+			MatchConditions:  matchConditions,
+			Validations:      validations,
+			FailurePolicy:    failurePolicy,
+			AuditAnnotations: auditAnnotations,
 			Variables:        variables,
 		},
 	}
 	return policy, nil
 }
 
-func ConstraintToBinding(constraint *unstructured.Unstructured) (*admissionregistrationv1alpha1.ValidatingAdmissionPolicyBinding, error) {
-	enforcementActionStr, err := apiconstraints.GetEnforcementAction(constraint)
+func ConstraintToBinding(constraint *unstructured.Unstructured, opts ...MatchOpt) (*admissionregistrationv1alpha1.ValidatingAdmissionPolicyBinding, error) {
+	enforcementAction, err := validationAction(constraint)
 	if err != nil {
 		return nil, err
 	}
 
-	var enforcementAction admissionregistrationv1alpha1.ValidationAction
-	switch enforcementActionStr {
-	case apiconstraints.EnforcementActionDeny:
-		enforcementAction = admissionregistrationv1alpha1.Deny
-	case "warn":
-		enforcementAction = admissionregistrationv1alpha1.Warn
-	default:
-		return nil, fmt.Errorf("%w: unrecognized enforcement action %s, must be `warn` or `deny`", ErrBadEnforcementAction, enforcementActionStr)
+	match, err := TranslateMatch(constraint, opts...)
+	if err != nil {
+		return nil, err
+	}
+	matchResources, err := toV1Alpha1MatchResources(match.MatchResources)
+	if err != nil {
+		return nil, err
 	}
 
 	binding := &admissionregistrationv1alpha1.ValidatingAdmissionPolicyBinding{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: fmt.Sprintf("gatekeeper-%s", constraint.GetName()),
+			Name: policyName(constraint.GetName()),
 		},
 		Spec: admissionregistrationv1alpha1.ValidatingAdmissionPolicyBindingSpec{
-			PolicyName: fmt.Sprintf("gatekeeper-%s", strings.ToLower(constraint.GetKind())),
+			PolicyName: policyName(strings.ToLower(constraint.GetKind())),
 			ParamRef: &admissionregistrationv1alpha1.ParamRef{
 				Name:                    constraint.GetName(),
 				ParameterNotFoundAction: ptr.To[admissionregistrationv1alpha1.ParameterNotFoundActionType](admissionregistrationv1alpha1.AllowAction),
 			},
-			MatchResources:    &admissionregistrationv1alpha1.MatchResources{},
-			ValidationActions: []admissionregistrationv1alpha1.ValidationAction{enforcementAction},
+			MatchResources:    matchResources,
+			ValidationActions: []admissionregistrationv1alpha1.ValidationAction{admissionregistrationv1alpha1.ValidationAction(enforcementAction)},
 		},
 	}
-	objectSelectorMap, found, err := unstructured.NestedMap(constraint.Object, "spec", "match", "labelSelector")
+
+	return binding, nil
+}
+
+func ConstraintToBindingV1Beta1(constraint *unstructured.Unstructured, opts ...MatchOpt) (*admissionregistrationv1beta1.ValidatingAdmissionPolicyBinding, error) {
+	enforcementAction, err := validationAction(constraint)
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := TranslateMatch(constraint, opts...)
 	if err != nil {
 		return nil, err
 	}
-	var objectSelector *metav1.LabelSelector
-	if found {
-		objectSelector = &metav1.LabelSelector{}
-		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(objectSelectorMap, objectSelector); err != nil {
-			return nil, err
-		}
-		binding.Spec.MatchResources.ObjectSelector = objectSelector
+
+	binding := &admissionregistrationv1beta1.ValidatingAdmissionPolicyBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: policyName(constraint.GetName()),
+		},
+		Spec: admissionregistrationv1beta1.ValidatingAdmissionPolicyBindingSpec{
+			PolicyName: policyName(strings.ToLower(constraint.GetKind())),
+			ParamRef: &admissionregistrationv1beta1.ParamRef{
+				Name:                    constraint.GetName(),
+				ParameterNotFoundAction: ptr.To[admissionregistrationv1beta1.ParameterNotFoundActionType](admissionregistrationv1beta1.AllowAction),
+			},
+			MatchResources:    match.MatchResources,
+			ValidationActions: []admissionregistrationv1beta1.ValidationAction{enforcementAction},
+		},
 	}
 
-	namespaceSelectorMap, found, err := unstructured.NestedMap(constraint.Object, "spec", "match", "namespaceSelector")
+	return binding, nil
+}
+
+func ConstraintToBindingV1(constraint *unstructured.Unstructured, opts ...MatchOpt) (*admissionregistrationv1.ValidatingAdmissionPolicyBinding, error) {
+	enforcementAction, err := validationAction(constraint)
 	if err != nil {
 		return nil, err
 	}
-	var namespaceSelector *metav1.LabelSelector
-	if found {
-		namespaceSelector = &metav1.LabelSelector{}
-		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(namespaceSelectorMap, namespaceSelector); err != nil {
-			return nil, err
-		}
-		binding.Spec.MatchResources.NamespaceSelector = namespaceSelector
+
+	match, err := TranslateMatch(constraint, opts...)
+	if err != nil {
+		return nil, err
+	}
+	matchResources, err := toV1MatchResources(match.MatchResources)
+	if err != nil {
+		return nil, err
+	}
+
+	binding := &admissionregistrationv1.ValidatingAdmissionPolicyBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: policyName(constraint.GetName()),
+		},
+		Spec: admissionregistrationv1.ValidatingAdmissionPolicyBindingSpec{
+			PolicyName: policyName(strings.ToLower(constraint.GetKind())),
+			ParamRef: &admissionregistrationv1.ParamRef{
+				Name:                    constraint.GetName(),
+				ParameterNotFoundAction: ptr.To[admissionregistrationv1.ParameterNotFoundActionType](admissionregistrationv1.AllowAction),
+			},
+			MatchResources:    matchResources,
+			ValidationActions: []admissionregistrationv1.ValidationAction{admissionregistrationv1.ValidationAction(enforcementAction)},
+		},
 	}
+
 	return binding, nil
 }
+
+// policyName returns the name of the ValidatingAdmissionPolicy or binding
+// generated for the object with the passed name.
+func policyName(name string) string {
+	return fmt.Sprintf("gatekeeper-%s", name)
+}
+
+// validationAction returns the validation action equivalent to constraint's
+// enforcement action.
+func validationAction(constraint *unstructured.Unstructured) (admissionregistrationv1beta1.ValidationAction, error) {
+	enforcementAction, err := apiconstraints.GetEnforcementAction(constraint)
+	if err != nil {
+		return "", err
+	}
+
+	action, found := validationActions[enforcementAction]
+	if !found {
+		return "", fmt.Errorf("%w: unrecognized enforcement action %s, must be `deny`, `warn`, or `dryrun`", ErrBadEnforcementAction, enforcementAction)
+	}
+
+	return action, nil
+}
+
+// matchSelectors returns constraint's object and namespace selectors, or nil
+// for each which is not set.
+func matchSelectors(constraint *unstructured.Unstructured) (*metav1.LabelSelector, *metav1.LabelSelector, error) {
+	objectSelector, err := labelSelector(constraint, "labelSelector")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	namespaceSelector, err := labelSelector(constraint, "namespaceSelector")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return objectSelector, namespaceSelector, nil
+}
+
+func labelSelector(constraint *unstructured.Unstructured, field string) (*metav1.LabelSelector, error) {
+	selectorMap, found, err := unstructured.NestedMap(constraint.Object, "spec", "match", field)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+
+	selector := &metav1.LabelSelector{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(selectorMap, selector); err != nil {
+		return nil, err
+	}
+	return selector, nil
+}
@@ -389,6 +389,24 @@ func TestConstraintToBinding(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:       "with dryrun",
+			constraint: newTestConstraint("dryrun", nil, nil),
+			expected: &admissionregistrationv1alpha1.ValidatingAdmissionPolicyBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "gatekeeper-foo-name",
+				},
+				Spec: admissionregistrationv1alpha1.ValidatingAdmissionPolicyBindingSpec{
+					PolicyName: "gatekeeper-footemplate",
+					ParamRef: &admissionregistrationv1alpha1.ParamRef{
+						Name:                    "foo-name",
+						ParameterNotFoundAction: ptr.To[admissionregistrationv1alpha1.ParameterNotFoundActionType](admissionregistrationv1alpha1.AllowAction),
+					},
+					MatchResources:    &admissionregistrationv1alpha1.MatchResources{},
+					ValidationActions: []admissionregistrationv1alpha1.ValidationAction{admissionregistrationv1alpha1.Audit},
+				},
+			},
+		},
 		{
 			name:        "unrecognized enforcement action",
 			constraint:  newTestConstraint("magicunicorns", nil, nil),
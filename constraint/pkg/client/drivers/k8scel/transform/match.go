@@ -0,0 +1,311 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	admissionregistrationv1alpha1 "k8s.io/api/admissionregistration/v1alpha1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	rschema "k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The spec.match criteria of Constraints.
+const (
+	MatchKinds              = "kinds"
+	MatchNamespaces         = "namespaces"
+	MatchExcludedNamespaces = "excludedNamespaces"
+	MatchScope              = "scope"
+	MatchName               = "name"
+	MatchLabelSelector      = "labelSelector"
+	MatchNamespaceSelector  = "namespaceSelector"
+)
+
+// MatchTranslation is how a Constraint's match criteria are expressed in a
+// ValidatingAdmissionPolicyBinding.
+type MatchTranslation struct {
+	// MatchResources is the binding's matchResources.
+	MatchResources *admissionregistrationv1beta1.MatchResources
+
+	// Native are the criteria exactly expressed by MatchResources.
+	Native []string
+
+	// Conditions are the criteria which are only enforced by the policy's
+	// match conditions.
+	Conditions []string
+}
+
+type matchConfig struct {
+	mapper meta.RESTMapper
+}
+
+// MatchOpt configures how match criteria are translated.
+type MatchOpt func(*matchConfig)
+
+// WithRESTMapper uses mapper to translate kinds into the resources
+// ValidatingAdmissionPolicyBindings match on. Without a RESTMapper, only kinds
+// criteria matching every kind in a group are translated natively.
+func WithRESTMapper(mapper meta.RESTMapper) MatchOpt {
+	return func(cfg *matchConfig) {
+		cfg.mapper = mapper
+	}
+}
+
+// TranslateMatch translates constraint's spec.match into native matchResources
+// where the criteria are exactly expressible. The remaining criteria are left
+// to the match conditions of the generated policy, which evaluate all
+// criteria.
+func TranslateMatch(constraint *unstructured.Unstructured, opts ...MatchOpt) (*MatchTranslation, error) {
+	cfg := &matchConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	match, _, err := unstructured.NestedMap(constraint.Object, "spec", "match")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MatchTranslation{MatchResources: &admissionregistrationv1beta1.MatchResources{}}
+	record := func(criterion string, native bool) {
+		if _, found := match[criterion]; !found {
+			return
+		}
+		if native {
+			result.Native = append(result.Native, criterion)
+		} else {
+			result.Conditions = append(result.Conditions, criterion)
+		}
+	}
+
+	objectSelector, namespaceSelector, err := matchSelectors(constraint)
+	if err != nil {
+		return nil, err
+	}
+	result.MatchResources.ObjectSelector = objectSelector
+	record(MatchLabelSelector, true)
+	record(MatchNamespaceSelector, true)
+
+	// Exact namespaces are matched natively by the kubernetes.io/metadata.name
+	// label of the object's Namespace. Bindings match Namespace objects on their
+	// own labels and never skip other cluster-scoped objects, as the match
+	// conditions do.
+	var nsRequirements []metav1.LabelSelectorRequirement
+	for _, criterion := range []struct {
+		name     string
+		operator metav1.LabelSelectorOperator
+	}{{MatchNamespaces, metav1.LabelSelectorOpIn}, {MatchExcludedNamespaces, metav1.LabelSelectorOpNotIn}} {
+		namespaces, _, err := unstructured.NestedStringSlice(match, criterion.name)
+		if err != nil {
+			return nil, err
+		}
+
+		// An empty namespaces list only matches cluster-scoped objects, which
+		// a namespace selector cannot express.
+		native := !hasGlob(namespaces) && (len(namespaces) > 0 || criterion.operator == metav1.LabelSelectorOpNotIn)
+		if native && len(namespaces) > 0 {
+			nsRequirements = append(nsRequirements, metav1.LabelSelectorRequirement{
+				Key:      corev1.LabelMetadataName,
+				Operator: criterion.operator,
+				Values:   namespaces,
+			})
+		}
+		record(criterion.name, native)
+	}
+	if len(nsRequirements) > 0 {
+		if namespaceSelector == nil {
+			namespaceSelector = &metav1.LabelSelector{}
+		}
+		namespaceSelector.MatchExpressions = append(namespaceSelector.MatchExpressions, nsRequirements...)
+	}
+	result.MatchResources.NamespaceSelector = namespaceSelector
+
+	rules, nativeKinds, err := kindRules(match, cfg.mapper)
+	if err != nil {
+		return nil, err
+	}
+	record(MatchKinds, nativeKinds)
+
+	scope, _, err := unstructured.NestedString(match, MatchScope)
+	if err != nil {
+		return nil, err
+	}
+	var scopeType *admissionregistrationv1beta1.ScopeType
+	switch scope {
+	case "", string(admissionregistrationv1beta1.AllScopes):
+	case string(admissionregistrationv1beta1.ClusterScope), string(admissionregistrationv1beta1.NamespacedScope):
+		s := admissionregistrationv1beta1.ScopeType(scope)
+		scopeType = &s
+	default:
+		return nil, fmt.Errorf("unrecognized scope %q", scope)
+	}
+	record(MatchScope, true)
+
+	name, _, err := unstructured.NestedString(match, MatchName)
+	if err != nil {
+		return nil, err
+	}
+	nativeName := !strings.Contains(name, "*")
+	record(MatchName, nativeName)
+
+	if scopeType == nil && (name == "" || !nativeName) && rules == nil {
+		return result, nil
+	}
+
+	if rules == nil {
+		rules = []admissionregistrationv1beta1.Rule{{APIGroups: []string{"*"}, APIVersions: []string{"*"}, Resources: []string{"*"}}}
+	}
+	for _, rule := range rules {
+		rule.Scope = scopeType
+
+		namedRule := admissionregistrationv1beta1.NamedRuleWithOperations{
+			RuleWithOperations: admissionregistrationv1beta1.RuleWithOperations{
+				Operations: []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.OperationAll},
+				Rule:       rule,
+			},
+		}
+		if name != "" && nativeName {
+			namedRule.ResourceNames = []string{name}
+		}
+
+		result.MatchResources.ResourceRules = append(result.MatchResources.ResourceRules, namedRule)
+	}
+
+	return result, nil
+}
+
+// kindRules returns the rules matching the resources of match's kinds, and
+// whether they match exactly those kinds. Returns nil rules if any resource
+// matches.
+func kindRules(match map[string]interface{}, mapper meta.RESTMapper) ([]admissionregistrationv1beta1.Rule, bool, error) {
+	kinds, found, err := unstructured.NestedSlice(match, MatchKinds)
+	if err != nil || !found || len(kinds) == 0 {
+		return nil, true, err
+	}
+
+	var rules []admissionregistrationv1beta1.Rule
+	for _, k := range kinds {
+		entry, ok := k.(map[string]interface{})
+		if !ok {
+			return nil, false, fmt.Errorf("invalid spec.match.kinds entry %v", k)
+		}
+
+		groups, _, err := unstructured.NestedStringSlice(entry, "apiGroups")
+		if err != nil {
+			return nil, false, err
+		}
+		kindNames, _, err := unstructured.NestedStringSlice(entry, "kinds")
+		if err != nil {
+			return nil, false, err
+		}
+
+		anyGroup := len(groups) == 0 || contains(groups, "*")
+		anyKind := len(kindNames) == 0 || contains(kindNames, "*")
+
+		switch {
+		case anyGroup && anyKind:
+			// Matches everything, as if kinds were not set.
+			return nil, true, nil
+		case anyKind:
+			rules = append(rules, admissionregistrationv1beta1.Rule{APIGroups: groups, APIVersions: []string{"*"}, Resources: []string{"*"}})
+		case anyGroup || mapper == nil:
+			// A kind in any group may be served by resources which do not
+			// exist yet, and without a mapper kinds cannot be resolved.
+			return nil, false, nil
+		default:
+			for _, group := range groups {
+				resources, err := kindResources(mapper, group, kindNames)
+				if err != nil {
+					return nil, false, err
+				}
+				if len(resources) == 0 {
+					return nil, false, nil
+				}
+
+				rules = append(rules, admissionregistrationv1beta1.Rule{APIGroups: []string{group}, APIVersions: []string{"*"}, Resources: resources})
+			}
+		}
+	}
+
+	return rules, true, nil
+}
+
+// kindResources returns the sorted names of the resources serving kinds in
+// group. Returns nil if any kind is unknown to mapper.
+func kindResources(mapper meta.RESTMapper, group string, kinds []string) ([]string, error) {
+	resources := make(map[string]bool)
+	for _, kind := range kinds {
+		mappings, err := mapper.RESTMappings(rschema.GroupKind{Group: group, Kind: kind})
+		if meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, mapping := range mappings {
+			resources[mapping.Resource.Resource] = true
+		}
+	}
+
+	result := make([]string, 0, len(resources))
+	for resource := range resources {
+		result = append(result, resource)
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// toV1Alpha1MatchResources converts in to v1alpha1, which has the same
+// schema.
+func toV1Alpha1MatchResources(in *admissionregistrationv1beta1.MatchResources) (*admissionregistrationv1alpha1.MatchResources, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(in)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &admissionregistrationv1alpha1.MatchResources{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// toV1MatchResources converts in to v1, which has the same schema.
+func toV1MatchResources(in *admissionregistrationv1beta1.MatchResources) (*admissionregistrationv1.MatchResources, error) {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(in)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &admissionregistrationv1.MatchResources{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func hasGlob(values []string) bool {
+	for _, v := range values {
+		if strings.Contains(v, "*") {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
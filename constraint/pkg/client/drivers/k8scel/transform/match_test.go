@@ -0,0 +1,321 @@
+package transform
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	admissionregistrationv1alpha1 "k8s.io/api/admissionregistration/v1alpha1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	rschema "k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/matchconditions"
+	"k8s.io/apiserver/pkg/cel/environment"
+	"k8s.io/utils/ptr"
+)
+
+func newMatchConstraint(t *testing.T, match map[string]interface{}) *unstructured.Unstructured {
+	t.Helper()
+
+	constraint := newTestConstraint("", nil, nil)
+	if err := unstructured.SetNestedMap(constraint.Object, match, "spec", "match"); err != nil {
+		t.Fatal(err)
+	}
+	return constraint
+}
+
+func testRESTMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper([]rschema.GroupVersion{{Version: "v1"}, {Group: "apps", Version: "v1"}})
+	mapper.Add(rschema.GroupVersionKind{Version: "v1", Kind: "Pod"}, meta.RESTScopeNamespace)
+	mapper.Add(rschema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(rschema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"}, meta.RESTScopeNamespace)
+	return mapper
+}
+
+func allResourcesRule(scope *admissionregistrationv1beta1.ScopeType, names ...string) admissionregistrationv1beta1.NamedRuleWithOperations {
+	return admissionregistrationv1beta1.NamedRuleWithOperations{
+		ResourceNames: names,
+		RuleWithOperations: admissionregistrationv1beta1.RuleWithOperations{
+			Operations: []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.OperationAll},
+			Rule:       admissionregistrationv1beta1.Rule{APIGroups: []string{"*"}, APIVersions: []string{"*"}, Resources: []string{"*"}, Scope: scope},
+		},
+	}
+}
+
+func TestTranslateMatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		match          map[string]interface{}
+		opts           []MatchOpt
+		want           *admissionregistrationv1beta1.MatchResources
+		wantNative     []string
+		wantConditions []string
+	}{{
+		name: "no match criteria",
+		want: &admissionregistrationv1beta1.MatchResources{},
+	}, {
+		name: "namespaces and excluded namespaces",
+		match: map[string]interface{}{
+			"namespaces":         []interface{}{"foo", "bar"},
+			"excludedNamespaces": []interface{}{"kube-system"},
+			"namespaceSelector":  map[string]interface{}{"matchLabels": map[string]interface{}{"env": "prod"}},
+		},
+		want: &admissionregistrationv1beta1.MatchResources{
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"env": "prod"},
+				MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "kubernetes.io/metadata.name", Operator: metav1.LabelSelectorOpIn, Values: []string{"foo", "bar"}},
+					{Key: "kubernetes.io/metadata.name", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"kube-system"}},
+				},
+			},
+		},
+		wantNative: []string{MatchNamespaceSelector, MatchNamespaces, MatchExcludedNamespaces},
+	}, {
+		name: "namespace globs",
+		match: map[string]interface{}{
+			"namespaces":         []interface{}{"foo-*"},
+			"excludedNamespaces": []interface{}{"kube-*"},
+		},
+		want:           &admissionregistrationv1beta1.MatchResources{},
+		wantConditions: []string{MatchNamespaces, MatchExcludedNamespaces},
+	}, {
+		name:           "empty namespaces",
+		match:          map[string]interface{}{"namespaces": []interface{}{}},
+		want:           &admissionregistrationv1beta1.MatchResources{},
+		wantConditions: []string{MatchNamespaces},
+	}, {
+		name:       "scope and name",
+		match:      map[string]interface{}{"scope": "Namespaced", "name": "foo"},
+		want:       &admissionregistrationv1beta1.MatchResources{ResourceRules: []admissionregistrationv1beta1.NamedRuleWithOperations{allResourcesRule(ptr.To(admissionregistrationv1beta1.NamespacedScope), "foo")}},
+		wantNative: []string{MatchScope, MatchName},
+	}, {
+		name:           "name glob",
+		match:          map[string]interface{}{"name": "foo-*"},
+		want:           &admissionregistrationv1beta1.MatchResources{},
+		wantConditions: []string{MatchName},
+	}, {
+		name: "kinds of any group and kind",
+		match: map[string]interface{}{"kinds": []interface{}{
+			map[string]interface{}{"apiGroups": []interface{}{"*"}, "kinds": []interface{}{"*"}},
+		}},
+		want:       &admissionregistrationv1beta1.MatchResources{},
+		wantNative: []string{MatchKinds},
+	}, {
+		name: "kinds of any kind in a group",
+		match: map[string]interface{}{"kinds": []interface{}{
+			map[string]interface{}{"apiGroups": []interface{}{"apps"}},
+		}},
+		want: &admissionregistrationv1beta1.MatchResources{ResourceRules: []admissionregistrationv1beta1.NamedRuleWithOperations{{
+			RuleWithOperations: admissionregistrationv1beta1.RuleWithOperations{
+				Operations: []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.OperationAll},
+				Rule:       admissionregistrationv1beta1.Rule{APIGroups: []string{"apps"}, APIVersions: []string{"*"}, Resources: []string{"*"}},
+			},
+		}}},
+		wantNative: []string{MatchKinds},
+	}, {
+		name: "specific kinds without a mapper",
+		match: map[string]interface{}{"kinds": []interface{}{
+			map[string]interface{}{"apiGroups": []interface{}{""}, "kinds": []interface{}{"Pod"}},
+		}},
+		want:           &admissionregistrationv1beta1.MatchResources{},
+		wantConditions: []string{MatchKinds},
+	}, {
+		name: "specific kinds with a mapper",
+		match: map[string]interface{}{
+			"kinds": []interface{}{
+				map[string]interface{}{"apiGroups": []interface{}{""}, "kinds": []interface{}{"Pod"}},
+				map[string]interface{}{"apiGroups": []interface{}{"apps"}, "kinds": []interface{}{"StatefulSet", "Deployment"}},
+			},
+			"scope": "Namespaced",
+		},
+		opts: []MatchOpt{WithRESTMapper(testRESTMapper())},
+		want: &admissionregistrationv1beta1.MatchResources{ResourceRules: []admissionregistrationv1beta1.NamedRuleWithOperations{{
+			RuleWithOperations: admissionregistrationv1beta1.RuleWithOperations{
+				Operations: []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.OperationAll},
+				Rule:       admissionregistrationv1beta1.Rule{APIGroups: []string{""}, APIVersions: []string{"*"}, Resources: []string{"pods"}, Scope: ptr.To(admissionregistrationv1beta1.NamespacedScope)},
+			},
+		}, {
+			RuleWithOperations: admissionregistrationv1beta1.RuleWithOperations{
+				Operations: []admissionregistrationv1beta1.OperationType{admissionregistrationv1beta1.OperationAll},
+				Rule:       admissionregistrationv1beta1.Rule{APIGroups: []string{"apps"}, APIVersions: []string{"*"}, Resources: []string{"deployments", "statefulsets"}, Scope: ptr.To(admissionregistrationv1beta1.NamespacedScope)},
+			},
+		}}},
+		wantNative: []string{MatchKinds, MatchScope},
+	}, {
+		name: "unknown kind with a mapper",
+		match: map[string]interface{}{"kinds": []interface{}{
+			map[string]interface{}{"apiGroups": []interface{}{"example.com"}, "kinds": []interface{}{"Widget"}},
+		}},
+		opts:           []MatchOpt{WithRESTMapper(testRESTMapper())},
+		want:           &admissionregistrationv1beta1.MatchResources{},
+		wantConditions: []string{MatchKinds},
+	}, {
+		name: "kinds in any group with a mapper",
+		match: map[string]interface{}{"kinds": []interface{}{
+			map[string]interface{}{"apiGroups": []interface{}{"*"}, "kinds": []interface{}{"Pod"}},
+		}},
+		opts:           []MatchOpt{WithRESTMapper(testRESTMapper())},
+		want:           &admissionregistrationv1beta1.MatchResources{},
+		wantConditions: []string{MatchKinds},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			constraint := newTestConstraint("", nil, nil)
+			if tt.match != nil {
+				constraint = newMatchConstraint(t, tt.match)
+			}
+
+			got, err := TranslateMatch(constraint, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(tt.want, got.MatchResources); diff != "" {
+				t.Error(diff)
+			}
+			sorted := cmpopts.SortSlices(func(a, b string) bool { return a < b })
+			if diff := cmp.Diff(tt.wantNative, got.Native, sorted, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("native criteria: %s", diff)
+			}
+			if diff := cmp.Diff(tt.wantConditions, got.Conditions, sorted, cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("conditions criteria: %s", diff)
+			}
+		})
+	}
+}
+
+func TestConstraintToBinding_MatchResources(t *testing.T) {
+	constraint := newMatchConstraint(t, map[string]interface{}{
+		"namespaces": []interface{}{"foo"},
+		"scope":      "Cluster",
+	})
+
+	binding, err := ConstraintToBinding(constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &admissionregistrationv1alpha1.MatchResources{
+		NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "kubernetes.io/metadata.name", Operator: metav1.LabelSelectorOpIn, Values: []string{"foo"}},
+		}},
+		ResourceRules: []admissionregistrationv1alpha1.NamedRuleWithOperations{{
+			RuleWithOperations: admissionregistrationv1alpha1.RuleWithOperations{
+				Operations: []admissionregistrationv1alpha1.OperationType{admissionregistrationv1alpha1.OperationAll},
+				Rule:       admissionregistrationv1alpha1.Rule{APIGroups: []string{"*"}, APIVersions: []string{"*"}, Resources: []string{"*"}, Scope: ptr.To(admissionregistrationv1alpha1.ClusterScope)},
+			},
+		}},
+	}
+	if diff := cmp.Diff(want, binding.Spec.MatchResources); diff != "" {
+		t.Error(diff)
+	}
+}
+
+// TestTranslateMatch_ClusterScopedObjects checks that bindings match the same
+// Namespace and other cluster-scoped objects as the policy's match conditions,
+// as bindings evaluate namespace selectors against the labels of Namespace
+// objects themselves.
+func TestTranslateMatch_ClusterScopedObjects(t *testing.T) {
+	constraint := newMatchConstraint(t, map[string]interface{}{
+		"namespaces":         []interface{}{"foo"},
+		"excludedNamespaces": []interface{}{"kube-system"},
+	})
+
+	translation, err := TranslateMatch(constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bindings match every namespace if they set no namespace selector.
+	selector := labels.Everything()
+	if translation.MatchResources.NamespaceSelector != nil {
+		selector, err = metav1.LabelSelectorAsSelector(translation.MatchResources.NamespaceSelector)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filterCompiler, err := cel.NewCompositedCompiler(environment.MustBaseEnvSet(environment.DefaultCompatibilityVersion(), false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	celOpts := cel.OptionalVariableDeclarations{HasParams: true}
+	filterCompiler.CompileAndStoreVariables(BindParamsCEL(), celOpts, environment.StoredExpressions)
+	matcher := matchconditions.NewMatcher(filterCompiler.Compile(
+		append(MatchNamespacesGlobCEL(), MatchExcludedNamespacesGlobCEL()...), celOpts, environment.StoredExpressions),
+		ptr.To[admissionregistrationv1.FailurePolicyType](admissionregistrationv1.Fail), "matchTest", "namespaces", "namespaces")
+
+	tests := []struct {
+		name string
+		gvk  rschema.GroupVersionKind
+		want bool
+	}{{
+		name: "foo",
+		gvk:  rschema.GroupVersionKind{Version: "v1", Kind: "Namespace"},
+		want: true,
+	}, {
+		name: "bar",
+		gvk:  rschema.GroupVersionKind{Version: "v1", Kind: "Namespace"},
+		want: false,
+	}, {
+		name: "kube-system",
+		gvk:  rschema.GroupVersionKind{Version: "v1", Kind: "Namespace"},
+		want: false,
+	}, {
+		name: "admin",
+		gvk:  rschema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"},
+		want: true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.gvk.Kind+"/"+tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{}
+			obj.SetGroupVersionKind(tt.gvk)
+			obj.SetName(tt.name)
+			if tt.gvk.Kind == "Namespace" {
+				obj.SetLabels(map[string]string{corev1.LabelMetadataName: tt.name})
+			}
+
+			raw, err := json.Marshal(obj.Object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			attributes, err := RequestToVersionedAttributes(&admissionv1.AdmissionRequest{
+				Kind:   metav1.GroupVersionKind{Group: tt.gvk.Group, Version: tt.gvk.Version, Kind: tt.gvk.Kind},
+				Name:   tt.name,
+				Object: runtime.RawExtension{Raw: raw},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := matcher.Match(context.Background(), attributes, constraint, nil)
+			if result.Error != nil {
+				t.Fatal(result.Error)
+			}
+			if result.Matches != tt.want {
+				t.Errorf("got match conditions matching = %t, want %t", result.Matches, tt.want)
+			}
+
+			// Bindings match Namespace objects against their own labels, and
+			// ignore namespace selectors for other cluster-scoped objects.
+			if tt.gvk.Kind != "Namespace" {
+				return
+			}
+			if got := selector.Matches(labels.Set(obj.GetLabels())); got != tt.want {
+				t.Errorf("got binding matching = %t, want %t as the match conditions", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package transform
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// ObjectToVersionedAttributes synthesizes the attributes of an admission
+// request for object, so templates written for admission can also evaluate
+// objects which are not part of one, such as during audit or in CI. The
+// request is an UPDATE from oldObject if it is non-nil, and a CREATE
+// otherwise. The resource is guessed from object's kind, as no discovery
+// information is available.
+func ObjectToVersionedAttributes(object, oldObject *unstructured.Unstructured, userInfo user.Info) (*admission.VersionedAttributes, error) {
+	if object == nil {
+		return nil, fmt.Errorf("%w: object must not be nil", ErrInvalidObject)
+	}
+
+	gvk := object.GroupVersionKind()
+	if gvk.Kind == "" || gvk.Version == "" {
+		return nil, fmt.Errorf("%w: object %q has no apiVersion or kind", ErrInvalidObject, object.GetName())
+	}
+	resource, _ := meta.UnsafeGuessKindToResource(gvk)
+
+	if userInfo == nil {
+		userInfo = &user.DefaultInfo{}
+	}
+
+	operation := admission.Create
+	var options runtime.Object = &metav1.CreateOptions{}
+	// A nil *Unstructured must not be passed as a non-nil runtime.Object.
+	var old runtime.Object
+	if oldObject != nil {
+		if oldObject.GroupVersionKind() != gvk {
+			return nil, fmt.Errorf("%w: old object is a %v, but object is a %v", ErrInvalidObject, oldObject.GroupVersionKind(), gvk)
+		}
+
+		operation = admission.Update
+		options = &metav1.UpdateOptions{}
+		old = oldObject
+	}
+
+	attributes := admission.NewAttributesRecord(object, old, gvk, object.GetNamespace(), object.GetName(), resource, "", operation, options, false, userInfo)
+	return &admission.VersionedAttributes{
+		Attributes:         attributes,
+		VersionedKind:      gvk,
+		VersionedOldObject: old,
+		VersionedObject:    object,
+	}, nil
+}
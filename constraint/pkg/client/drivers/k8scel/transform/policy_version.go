@@ -0,0 +1,90 @@
+package transform
+
+import (
+	"fmt"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	admissionregistrationv1alpha1 "k8s.io/api/admissionregistration/v1alpha1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// PolicyVersion is a version of the admissionregistration.k8s.io API which
+// ValidatingAdmissionPolicies and their bindings can be generated for.
+type PolicyVersion string
+
+const (
+	PolicyVersionV1Alpha1 PolicyVersion = "v1alpha1"
+	PolicyVersionV1Beta1  PolicyVersion = "v1beta1"
+	PolicyVersionV1       PolicyVersion = "v1"
+)
+
+const (
+	policyKind        = "ValidatingAdmissionPolicy"
+	policyBindingKind = "ValidatingAdmissionPolicyBinding"
+)
+
+// TemplateToPolicyDefinitionForVersion generates the ValidatingAdmissionPolicy
+// for template in the passed version of the admissionregistration.k8s.io API.
+// Unlike TemplateToPolicyDefinition, the result has its apiVersion and kind
+// set.
+func TemplateToPolicyDefinitionForVersion(template *templates.ConstraintTemplate, version PolicyVersion) (runtime.Object, error) {
+	switch version {
+	case PolicyVersionV1Alpha1:
+		policy, err := TemplateToPolicyDefinition(template)
+		if err != nil {
+			return nil, err
+		}
+		policy.SetGroupVersionKind(admissionregistrationv1alpha1.SchemeGroupVersion.WithKind(policyKind))
+		return policy, nil
+	case PolicyVersionV1Beta1:
+		policy, err := TemplateToPolicyDefinitionV1Beta1(template)
+		if err != nil {
+			return nil, err
+		}
+		policy.SetGroupVersionKind(admissionregistrationv1beta1.SchemeGroupVersion.WithKind(policyKind))
+		return policy, nil
+	case PolicyVersionV1:
+		policy, err := TemplateToPolicyDefinitionV1(template)
+		if err != nil {
+			return nil, err
+		}
+		policy.SetGroupVersionKind(admissionregistrationv1.SchemeGroupVersion.WithKind(policyKind))
+		return policy, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedVersion, version)
+	}
+}
+
+// ConstraintToBindingForVersion generates the ValidatingAdmissionPolicyBinding
+// for constraint in the passed version of the admissionregistration.k8s.io
+// API. Unlike ConstraintToBinding, the result has its apiVersion and kind set.
+func ConstraintToBindingForVersion(constraint *unstructured.Unstructured, version PolicyVersion, opts ...MatchOpt) (runtime.Object, error) {
+	switch version {
+	case PolicyVersionV1Alpha1:
+		binding, err := ConstraintToBinding(constraint, opts...)
+		if err != nil {
+			return nil, err
+		}
+		binding.SetGroupVersionKind(admissionregistrationv1alpha1.SchemeGroupVersion.WithKind(policyBindingKind))
+		return binding, nil
+	case PolicyVersionV1Beta1:
+		binding, err := ConstraintToBindingV1Beta1(constraint, opts...)
+		if err != nil {
+			return nil, err
+		}
+		binding.SetGroupVersionKind(admissionregistrationv1beta1.SchemeGroupVersion.WithKind(policyBindingKind))
+		return binding, nil
+	case PolicyVersionV1:
+		binding, err := ConstraintToBindingV1(constraint, opts...)
+		if err != nil {
+			return nil, err
+		}
+		binding.SetGroupVersionKind(admissionregistrationv1.SchemeGroupVersion.WithKind(policyBindingKind))
+		return binding, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedVersion, version)
+	}
+}
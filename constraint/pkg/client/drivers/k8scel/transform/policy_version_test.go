@@ -0,0 +1,223 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/k8scel/schema"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	admissionregistrationv1alpha1 "k8s.io/api/admissionregistration/v1alpha1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+)
+
+func newTestTemplate(source *schema.Source) *templates.ConstraintTemplate {
+	return &templates.ConstraintTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "footemplate"},
+		Spec: templates.ConstraintTemplateSpec{
+			CRD: templates.CRD{Spec: templates.CRDSpec{Names: templates.Names{Kind: "FooTemplate"}}},
+			Targets: []templates.Target{{
+				Code: []templates.Code{{
+					Engine: schema.Name,
+					Source: &templates.Anything{Value: source.MustToUnstructured()},
+				}},
+			}},
+		},
+	}
+}
+
+// roundTrip serializes obj and strictly decodes it into out, then returns
+// both serializations so callers can check no fields were lost.
+func roundTrip(t *testing.T, obj runtime.Object, out runtime.Object) (map[string]interface{}, map[string]interface{}) {
+	t.Helper()
+
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		t.Fatalf("decoding %s into %T: %v", raw, out, err)
+	}
+
+	reencoded, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want, got map[string]interface{}
+	if err := json.Unmarshal(raw, &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(reencoded, &got); err != nil {
+		t.Fatal(err)
+	}
+	// Typed objects always serialize these, even when empty.
+	delete(got, "status")
+	delete(got["metadata"].(map[string]interface{}), "creationTimestamp")
+	delete(want, "status")
+	delete(want["metadata"].(map[string]interface{}), "creationTimestamp")
+
+	return want, got
+}
+
+func TestTemplateToPolicyDefinitionForVersion(t *testing.T) {
+	template := newTestTemplate(&schema.Source{
+		FailurePolicy:   ptr.To[string]("Ignore"),
+		MatchConditions: []schema.MatchCondition{{Name: "must_match_something", Expression: "true == true"}},
+		Variables:       []schema.Variable{{Name: "my_variable", Expression: "true"}},
+		Validations: []schema.Validation{{
+			Expression:        "1 == 1",
+			Message:           "some fallback message",
+			MessageExpression: `"some CEL string"`,
+		}},
+		AuditAnnotations: []schema.AuditAnnotation{{Key: "name", ValueExpression: "object.metadata.name"}},
+	})
+
+	tests := []struct {
+		version        PolicyVersion
+		wantAPIVersion string
+		decodeInto     runtime.Object
+	}{{
+		version:        PolicyVersionV1Alpha1,
+		wantAPIVersion: "admissionregistration.k8s.io/v1alpha1",
+		decodeInto:     &admissionregistrationv1alpha1.ValidatingAdmissionPolicy{},
+	}, {
+		version:        PolicyVersionV1Beta1,
+		wantAPIVersion: "admissionregistration.k8s.io/v1beta1",
+		decodeInto:     &admissionregistrationv1beta1.ValidatingAdmissionPolicy{},
+	}, {
+		version:        PolicyVersionV1,
+		wantAPIVersion: "admissionregistration.k8s.io/v1",
+		decodeInto:     &admissionregistrationv1.ValidatingAdmissionPolicy{},
+	}}
+
+	want, err := TemplateToPolicyDefinitionV1Beta1(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.version), func(t *testing.T) {
+			obj, err := TemplateToPolicyDefinitionForVersion(template, tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gvk := obj.GetObjectKind().GroupVersionKind()
+			if gvk.GroupVersion().String() != tt.wantAPIVersion || gvk.Kind != "ValidatingAdmissionPolicy" {
+				t.Errorf("got %v, want %s ValidatingAdmissionPolicy", gvk, tt.wantAPIVersion)
+			}
+
+			wantJSON, gotJSON := roundTrip(t, obj, tt.decodeInto)
+			if diff := cmp.Diff(wantJSON, gotJSON); diff != "" {
+				t.Errorf("fields lost in round trip: %s", diff)
+			}
+
+			// Every version carries the same spec.
+			wantSpec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&want.Spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(wantSpec, gotJSON["spec"], cmp.Transformer("normalize", normalize)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+
+	if diff := cmp.Diff([]admissionregistrationv1beta1.AuditAnnotation{{Key: "name", ValueExpression: "object.metadata.name"}}, want.Spec.AuditAnnotations); diff != "" {
+		t.Error(diff)
+	}
+	if *want.Spec.FailurePolicy != admissionregistrationv1beta1.Ignore {
+		t.Errorf("got failure policy %v, want %v", *want.Spec.FailurePolicy, admissionregistrationv1beta1.Ignore)
+	}
+}
+
+func TestConstraintToBindingForVersion(t *testing.T) {
+	tests := []struct {
+		enforcementAction string
+		want              string
+		wantErr           error
+	}{
+		{enforcementAction: "", want: "Deny"},
+		{enforcementAction: "deny", want: "Deny"},
+		{enforcementAction: "warn", want: "Warn"},
+		{enforcementAction: "dryrun", want: "Audit"},
+		{enforcementAction: "magicunicorns", wantErr: ErrBadEnforcementAction},
+	}
+
+	versions := map[PolicyVersion]runtime.Object{
+		PolicyVersionV1Alpha1: &admissionregistrationv1alpha1.ValidatingAdmissionPolicyBinding{},
+		PolicyVersionV1Beta1:  &admissionregistrationv1beta1.ValidatingAdmissionPolicyBinding{},
+		PolicyVersionV1:       &admissionregistrationv1.ValidatingAdmissionPolicyBinding{},
+	}
+
+	for version, decodeInto := range versions {
+		for _, tt := range tests {
+			t.Run(string(version)+"/"+tt.enforcementAction, func(t *testing.T) {
+				constraint := newTestConstraint(tt.enforcementAction, nil, &metav1.LabelSelector{MatchLabels: map[string]string{"match": "yes"}})
+
+				obj, err := ConstraintToBindingForVersion(constraint, version)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				if tt.wantErr != nil {
+					return
+				}
+
+				gvk := obj.GetObjectKind().GroupVersionKind()
+				if gvk.Version != string(version) || gvk.Kind != "ValidatingAdmissionPolicyBinding" {
+					t.Errorf("got %v, want %s ValidatingAdmissionPolicyBinding", gvk, version)
+				}
+
+				wantJSON, gotJSON := roundTrip(t, obj, decodeInto)
+				if diff := cmp.Diff(wantJSON, gotJSON); diff != "" {
+					t.Errorf("fields lost in round trip: %s", diff)
+				}
+
+				spec := gotJSON["spec"].(map[string]interface{})
+				if diff := cmp.Diff([]interface{}{tt.want}, spec["validationActions"]); diff != "" {
+					t.Error(diff)
+				}
+				if spec["policyName"] != "gatekeeper-footemplate" {
+					t.Errorf("got policyName %v, want %q", spec["policyName"], "gatekeeper-footemplate")
+				}
+			})
+		}
+	}
+}
+
+func TestForVersion_Unsupported(t *testing.T) {
+	_, err := TemplateToPolicyDefinitionForVersion(newTestTemplate(&schema.Source{}), "v2")
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("got error %v, want %v", err, ErrUnsupportedVersion)
+	}
+
+	_, err = ConstraintToBindingForVersion(newTestConstraint("", nil, nil), "v2")
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("got error %v, want %v", err, ErrUnsupportedVersion)
+	}
+}
+
+// normalize converts v to the types produced by decoding JSON, so values
+// converted from typed objects compare equal to decoded ones.
+func normalize(v map[string]interface{}) map[string]interface{} {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	var out map[string]interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		panic(err)
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package transform
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/common"
+	"github.com/google/cel-go/parser"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+)
+
+// paramsSpecField is the field of a ValidatingAdmissionPolicy's param object
+// which imported templates store in Constraints' spec.parameters.
+const paramsSpecField = "spec"
+
+// rewriteParams rewrites references to params.spec in expression to
+// params.spec.parameters, where Constraints store the parameters of imported
+// templates. Returns expression unchanged if it does not reference
+// params.spec. Also returns whether expression references params other than
+// through params.spec, which cannot be rewritten.
+func rewriteParams(expression string) (string, bool, error) {
+	p, err := parser.NewParser(parser.Macros(parser.AllMacros...), parser.PopulateMacroCalls(true))
+	if err != nil {
+		return "", false, err
+	}
+
+	parsed, errs := p.Parse(common.NewTextSource(expression))
+	if len(errs.GetErrors()) > 0 {
+		return "", false, fmt.Errorf("parsing %q: %s", expression, errs.ToDisplayString())
+	}
+
+	r := &paramsRewriter{inserted: make(map[*exprpb.Expr_Select]bool)}
+	r.walk(parsed.GetExpr())
+	for _, call := range parsed.GetSourceInfo().GetMacroCalls() {
+		r.walk(call)
+	}
+
+	if !r.rewritten {
+		return expression, r.unsupported, nil
+	}
+
+	out, err := parser.Unparse(parsed.GetExpr(), parsed.GetSourceInfo())
+	if err != nil {
+		return "", false, err
+	}
+	return out, r.unsupported, nil
+}
+
+type paramsRewriter struct {
+	// rewritten is whether any reference to params.spec was rewritten.
+	rewritten bool
+	// unsupported is whether there are references to params other than
+	// through params.spec.
+	unsupported bool
+
+	// inserted are the params.spec selections added by rewriting. Macro calls
+	// may share nodes with the expanded expression, so these must not be
+	// rewritten again.
+	inserted map[*exprpb.Expr_Select]bool
+}
+
+func (r *paramsRewriter) walk(e *exprpb.Expr) {
+	if e == nil {
+		return
+	}
+
+	switch kind := e.GetExprKind().(type) {
+	case *exprpb.Expr_IdentExpr:
+		if kind.IdentExpr.GetName() == cel.ParamsVarName {
+			r.unsupported = true
+		}
+	case *exprpb.Expr_SelectExpr:
+		sel := kind.SelectExpr
+		if r.inserted[sel] {
+			return
+		}
+		if sel.GetOperand().GetIdentExpr().GetName() == cel.ParamsVarName {
+			if sel.GetField() != paramsSpecField {
+				r.unsupported = true
+				return
+			}
+
+			// params.spec becomes params.spec.parameters, preserving whether
+			// this is a has() test.
+			spec := &exprpb.Expr_Select{Operand: sel.GetOperand(), Field: paramsSpecField}
+			r.inserted[spec] = true
+			sel.Operand = &exprpb.Expr{ExprKind: &exprpb.Expr_SelectExpr{SelectExpr: spec}}
+			sel.Field = "parameters"
+			r.rewritten = true
+			return
+		}
+		r.walk(sel.GetOperand())
+	case *exprpb.Expr_CallExpr:
+		r.walk(kind.CallExpr.GetTarget())
+		for _, arg := range kind.CallExpr.GetArgs() {
+			r.walk(arg)
+		}
+	case *exprpb.Expr_ListExpr:
+		for _, elem := range kind.ListExpr.GetElements() {
+			r.walk(elem)
+		}
+	case *exprpb.Expr_StructExpr:
+		for _, entry := range kind.StructExpr.GetEntries() {
+			r.walk(entry.GetMapKey())
+			r.walk(entry.GetValue())
+		}
+	case *exprpb.Expr_ComprehensionExpr:
+		c := kind.ComprehensionExpr
+		r.walk(c.GetIterRange())
+		r.walk(c.GetAccuInit())
+		r.walk(c.GetLoopCondition())
+		r.walk(c.GetLoopStep())
+		r.walk(c.GetResult())
+	}
+}
@@ -0,0 +1,40 @@
+package plugin
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultDialTimeout bounds how long New waits to connect to the plugin.
+const defaultDialTimeout = 30 * time.Second
+
+type Arg func(*Driver) error
+
+// HealthCheckInterval checks the plugin's health every interval, and restarts
+// it if it does not respond healthily within interval. By default, the plugin
+// is only restarted once a call to it fails.
+func HealthCheckInterval(interval time.Duration) Arg {
+	return func(d *Driver) error {
+		if interval <= 0 {
+			return fmt.Errorf("health check interval must be positive, got %v", interval)
+		}
+
+		d.healthCheckInterval = interval
+
+		return nil
+	}
+}
+
+// DialTimeout bounds how long New waits to connect to the plugin. Defaults to
+// 30 seconds.
+func DialTimeout(timeout time.Duration) Arg {
+	return func(d *Driver) error {
+		if timeout <= 0 {
+			return fmt.Errorf("dial timeout must be positive, got %v", timeout)
+		}
+
+		d.dialTimeout = timeout
+
+		return nil
+	}
+}
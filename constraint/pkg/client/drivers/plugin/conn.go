@@ -0,0 +1,187 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// errAbandoned is returned by calls whose context was done after their
+// request was sent, so the plugin may or may not act on the request.
+var errAbandoned = errors.New("call abandoned after its request was sent")
+
+// conn is a connection to a plugin which multiplexes concurrent calls.
+type conn struct {
+	rwc io.ReadWriteCloser
+
+	// requests are handed to write, which sends them in order. Calls stop
+	// waiting to hand over a request once their context is done, so a plugin
+	// which stops reading doesn't block callers.
+	requests chan *Request
+
+	mtx     sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan *Response
+	// err is why the connection failed. Nil while the connection is usable.
+	err error
+	// done is closed once the connection fails.
+	done chan struct{}
+}
+
+func newConn(rwc io.ReadWriteCloser) *conn {
+	c := &conn{
+		rwc:      rwc,
+		requests: make(chan *Request),
+		pending:  make(map[uint64]chan *Response),
+		done:     make(chan struct{}),
+	}
+
+	go c.read()
+	go c.write()
+
+	return c
+}
+
+// read delivers Responses to the calls awaiting them until the connection
+// fails.
+func (c *conn) read() {
+	decoder := json.NewDecoder(c.rwc)
+	for {
+		resp := &Response{}
+		if err := decoder.Decode(resp); err != nil {
+			c.fail(err)
+			return
+		}
+
+		c.mtx.Lock()
+		ch, found := c.pending[resp.ID]
+		delete(c.pending, resp.ID)
+		c.mtx.Unlock()
+
+		// Responses to abandoned calls are dropped.
+		if found {
+			ch <- resp
+		}
+	}
+}
+
+// write sends the requests handed to it until the connection fails.
+func (c *conn) write() {
+	encoder := json.NewEncoder(c.rwc)
+	for {
+		select {
+		case req := <-c.requests:
+			if err := encoder.Encode(req); err != nil {
+				c.fail(err)
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// fail marks the connection as failed because of err, and closes it. Calls
+// awaiting responses return ErrConnection.
+func (c *conn) fail(err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	c.err = fmt.Errorf("%w: %v", ErrConnection, err)
+	close(c.done)
+	_ = c.rwc.Close()
+}
+
+// call calls method with params, and decodes its result into result unless
+// result is nil. Returns an error wrapping errAbandoned if ctx is done after
+// the request was handed over to be sent.
+func (c *conn) call(ctx context.Context, method string, params, result interface{}) error {
+	req := &Request{Method: method}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("encoding %s parameters: %w", method, err)
+		}
+		req.Params = raw
+	}
+
+	ch := make(chan *Response, 1)
+
+	c.mtx.Lock()
+	if c.err != nil {
+		c.mtx.Unlock()
+		return c.err
+	}
+	c.nextID++
+	req.ID = c.nextID
+	c.pending[req.ID] = ch
+	c.mtx.Unlock()
+
+	abandon := func() {
+		c.mtx.Lock()
+		delete(c.pending, req.ID)
+		c.mtx.Unlock()
+	}
+
+	select {
+	case c.requests <- req:
+	case <-c.done:
+		abandon()
+		return c.failure()
+	case <-ctx.Done():
+		abandon()
+		return ctx.Err()
+	}
+
+	select {
+	case resp := <-ch:
+		return decodeResult(method, resp, result)
+	case <-c.done:
+		// read delivers a response before failing the connection, so prefer
+		// the response if the plugin responded and then disconnected.
+		select {
+		case resp := <-ch:
+			return decodeResult(method, resp, result)
+		default:
+		}
+		abandon()
+		return c.failure()
+	case <-ctx.Done():
+		abandon()
+		return fmt.Errorf("%w: %w", errAbandoned, ctx.Err())
+	}
+}
+
+// decodeResult returns the error in resp, or decodes its result into result
+// unless result is nil.
+func decodeResult(method string, resp *Response, result interface{}) error {
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("%w: decoding %s result: %v", ErrProtocol, method, err)
+	}
+	return nil
+}
+
+// failure returns why the connection failed.
+func (c *conn) failure() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.err
+}
+
+func (c *conn) close() {
+	c.fail(ErrClosed)
+}
@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+)
+
+// Dialer connects to a plugin, starting it if necessary. The Driver dials
+// again to restart a plugin whose connection has failed.
+type Dialer func(ctx context.Context) (io.ReadWriteCloser, error)
+
+// Command runs the plugin as a subprocess, which speaks the plugin protocol
+// over its stdin and stdout. Its stderr is passed through. Closing the
+// connection kills the subprocess.
+func Command(name string, args ...string) Dialer {
+	return func(ctx context.Context) (io.ReadWriteCloser, error) {
+		// The subprocess must outlive ctx, which only bounds dialing.
+		cmd := exec.Command(name, args...) //nolint:gosec // The plugin command is chosen by the caller.
+		cmd.Stderr = os.Stderr
+
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("%w: starting %s: %v", ErrConnection, name, err)
+		}
+
+		if ctx.Err() != nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			return nil, ctx.Err()
+		}
+
+		return &process{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+	}
+}
+
+// Network connects to a plugin listening at address, such as a sidecar
+// listening on a Unix socket.
+func Network(network, address string) Dialer {
+	return func(ctx context.Context) (io.ReadWriteCloser, error) {
+		var d net.Dialer
+		c, err := d.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrConnection, err)
+		}
+		return c, nil
+	}
+}
+
+// process is a connection to a plugin subprocess.
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+}
+
+func (p *process) Read(b []byte) (int, error) {
+	return p.stdout.Read(b)
+}
+
+func (p *process) Write(b []byte) (int, error) {
+	return p.stdin.Write(b)
+}
+
+// Close kills the subprocess and waits for it to exit.
+func (p *process) Close() error {
+	_ = p.stdin.Close()
+
+	err := p.cmd.Process.Kill()
+	if errors.Is(err, os.ErrProcessDone) {
+		err = nil
+	}
+	_ = p.cmd.Wait()
+
+	return err
+}
@@ -0,0 +1,549 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"github.com/open-policy-agent/opa/storage"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ drivers.ReferentialDriver = &Driver{}
+
+// Driver is a drivers.Driver which forwards calls to a plugin running out of
+// process.
+//
+// Driver records the templates, Constraints, and data it has added, so if the
+// connection to the plugin fails, for example because the plugin crashed, it
+// restarts the plugin by dialing again, restores that state, and retries the
+// failed call once.
+//
+// Mutations are serialized with each other and with restarts, so a restarted
+// plugin is restored to exactly the state its predecessor accepted. If a
+// mutation's context is done after its request was sent, the mutation's
+// outcome is unknown: it is re-issued before the next mutation, or to the
+// restarted plugin if the plugin is restarted first, until the plugin either
+// applies or rejects it.
+type Driver struct {
+	dial                Dialer
+	healthCheckInterval time.Duration
+	dialTimeout         time.Duration
+
+	// name and referentialData are reported by the plugin during the first
+	// handshake, and must not change across restarts.
+	name            string
+	referentialData bool
+
+	// connMtx guards conn, and is held while restarting the plugin.
+	connMtx sync.Mutex
+	conn    *conn
+	closed  bool
+
+	// stateLock is held while mutating the plugin and recording the result,
+	// and while restarting the plugin. It guards the state restored to
+	// restarted plugins. It is a channel so waiting for it can be cancelled.
+	stateLock   chan struct{}
+	templates   map[string]*templates.ConstraintTemplate
+	constraints map[drivers.ConstraintKey]*unstructured.Unstructured
+	data        map[string]map[string]*DataParams
+	// pending are mutations whose outcome is unknown, in the order they were
+	// made.
+	pending []*mutation
+
+	stop chan struct{}
+}
+
+// New connects to the plugin with dial, and returns a Driver which forwards
+// calls to it.
+func New(dial Dialer, args ...Arg) (*Driver, error) {
+	d := &Driver{
+		dial:        dial,
+		dialTimeout: defaultDialTimeout,
+		stateLock:   make(chan struct{}, 1),
+		templates:   make(map[string]*templates.ConstraintTemplate),
+		constraints: make(map[drivers.ConstraintKey]*unstructured.Unstructured),
+		data:        make(map[string]map[string]*DataParams),
+		stop:        make(chan struct{}),
+	}
+	for _, arg := range args {
+		if err := arg(d); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.dialTimeout)
+	defer cancel()
+
+	c, handshake, err := d.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.conn = c
+	d.name = handshake.Name
+	d.referentialData = handshake.ReferentialData
+
+	if d.healthCheckInterval > 0 {
+		go d.checkHealth()
+	}
+
+	return d, nil
+}
+
+// connect dials the plugin and checks it speaks the plugin protocol.
+func (d *Driver) connect(ctx context.Context) (*conn, *HandshakeResult, error) {
+	rwc, err := d.dial(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := newConn(rwc)
+	handshake := &HandshakeResult{}
+	if err := c.call(ctx, MethodHandshake, nil, handshake); err != nil {
+		c.close()
+		return nil, nil, err
+	}
+
+	if handshake.ProtocolVersion != ProtocolVersion {
+		c.close()
+		return nil, nil, fmt.Errorf("%w: plugin speaks protocol version %d, want %d", ErrProtocol, handshake.ProtocolVersion, ProtocolVersion)
+	}
+
+	if d.name != "" && (handshake.Name != d.name || handshake.ReferentialData != d.referentialData) {
+		c.close()
+		return nil, nil, fmt.Errorf("%w: restarted plugin is driver %q, want %q", ErrProtocol, handshake.Name, d.name)
+	}
+
+	return c, handshake, nil
+}
+
+// connection returns the current connection to the plugin.
+func (d *Driver) connection() (*conn, error) {
+	d.connMtx.Lock()
+	defer d.connMtx.Unlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+	return d.conn, nil
+}
+
+// lockState acquires the state lock, unless ctx is done first.
+func (d *Driver) lockState(ctx context.Context) error {
+	select {
+	case d.stateLock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Driver) unlockState() {
+	<-d.stateLock
+}
+
+// restart replaces failed, the connection to a plugin which has stopped
+// responding, and restores the plugin's state. Does nothing if failed was
+// already replaced. The state lock must be held.
+func (d *Driver) restart(ctx context.Context, failed *conn) (*conn, error) {
+	d.connMtx.Lock()
+	defer d.connMtx.Unlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+	if d.conn != failed {
+		return d.conn, nil
+	}
+
+	failed.close()
+
+	c, _, err := d.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.restore(ctx, c); err != nil {
+		c.close()
+		return nil, fmt.Errorf("restoring plugin state: %w", err)
+	}
+
+	d.conn = c
+	return c, nil
+}
+
+// restore adds the recorded templates, Constraints, and data to the plugin
+// connected to with c, and then re-issues the pending mutations. The state
+// lock must be held.
+func (d *Driver) restore(ctx context.Context, c *conn) error {
+	for _, template := range d.templates {
+		if err := c.call(ctx, MethodAddTemplate, &TemplateParams{Template: template}, nil); err != nil {
+			return err
+		}
+	}
+
+	for _, constraint := range d.constraints {
+		if err := c.call(ctx, MethodAddConstraint, &ConstraintParams{Constraint: constraint}, nil); err != nil {
+			return err
+		}
+	}
+
+	for _, targetData := range d.data {
+		if err := restoreData(ctx, c, targetData); err != nil {
+			return err
+		}
+	}
+
+	return d.reissue(ctx, c.call)
+}
+
+// reissue re-issues the pending mutations in order with call, recording those
+// the plugin applies and dropping those it rejects. Stops at the first
+// mutation whose outcome is still unknown. The state lock must be held.
+func (d *Driver) reissue(ctx context.Context, call func(ctx context.Context, method string, params, result interface{}) error) error {
+	for len(d.pending) > 0 {
+		m := d.pending[0]
+		err := call(ctx, m.method, m.params, nil)
+		if !settled(err) {
+			return err
+		}
+
+		d.pending = d.pending[1:]
+		if err == nil {
+			m.record()
+		}
+	}
+
+	return nil
+}
+
+// restoreData adds a target's recorded data to the plugin. Data is added
+// parents first, as adding data at a path replaces anything beneath it.
+func restoreData(ctx context.Context, c *conn, targetData map[string]*DataParams) error {
+	keys := make([]string, 0, len(targetData))
+	for key := range targetData {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		left, right := targetData[keys[i]].Path, targetData[keys[j]].Path
+		if len(left) != len(right) {
+			return len(left) < len(right)
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, key := range keys {
+		if err := c.call(ctx, MethodAddData, targetData[key], nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// call calls method on the plugin, restarting the plugin and retrying once if
+// the connection to it has failed.
+func (d *Driver) call(ctx context.Context, method string, params, result interface{}) error {
+	c, err := d.connection()
+	if err != nil {
+		return err
+	}
+
+	err = c.call(ctx, method, params, result)
+	if !errors.Is(err, ErrConnection) {
+		return err
+	}
+
+	if err := d.lockState(ctx); err != nil {
+		return err
+	}
+	defer d.unlockState()
+
+	return d.retry(ctx, c, method, params, result)
+}
+
+// callLocked is call for callers already holding the state lock.
+func (d *Driver) callLocked(ctx context.Context, method string, params, result interface{}) error {
+	c, err := d.connection()
+	if err != nil {
+		return err
+	}
+
+	err = c.call(ctx, method, params, result)
+	if !errors.Is(err, ErrConnection) {
+		return err
+	}
+
+	return d.retry(ctx, c, method, params, result)
+}
+
+// retry restarts the plugin connected to with failed, and calls method on the
+// restarted plugin. The state lock must be held.
+func (d *Driver) retry(ctx context.Context, failed *conn, method string, params, result interface{}) error {
+	c, err := d.restart(ctx, failed)
+	if err != nil {
+		return err
+	}
+
+	return c.call(ctx, method, params, result)
+}
+
+// mutation is a call which changes the plugin's state.
+type mutation struct {
+	method string
+	params interface{}
+	// record records the change once the plugin has applied it.
+	record func()
+}
+
+// mutate makes m once any pending mutations are settled, and records it if
+// the plugin applies it. If m's outcome is unknown it becomes pending.
+func (d *Driver) mutate(ctx context.Context, m *mutation) error {
+	if err := d.lockState(ctx); err != nil {
+		return err
+	}
+	defer d.unlockState()
+
+	if err := d.reissue(ctx, d.callLocked); err != nil {
+		return err
+	}
+
+	err := d.callLocked(ctx, m.method, m.params, nil)
+	switch {
+	case err == nil:
+		m.record()
+	case !settled(err):
+		d.pending = append(d.pending, m)
+	}
+
+	return err
+}
+
+// settled returns true if a mutation which returned err was either applied or
+// rejected by the plugin. Mutations sent to a plugin whose connection then
+// failed are settled, as the plugin is restarted and restored to the recorded
+// state before it is used again.
+func settled(err error) bool {
+	return !errors.Is(err, errAbandoned)
+}
+
+// checkHealth restarts the plugin if it fails a health check, until the
+// Driver is closed.
+func (d *Driver) checkHealth() {
+	ticker := time.NewTicker(d.healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+
+		c, err := d.connection()
+		if err != nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), d.healthCheckInterval)
+		err = c.call(ctx, MethodHealth, nil, nil)
+		if err != nil {
+			// Failing the connection first unblocks calls waiting on the
+			// unhealthy plugin, including any mutation holding the state lock.
+			// Restart failures are retried at the next check, or by the next
+			// call.
+			c.close()
+			if d.lockState(ctx) == nil {
+				_, _ = d.restart(ctx, c)
+				d.unlockState()
+			}
+		}
+		cancel()
+	}
+}
+
+// Health returns an error if the plugin is unable to serve requests.
+func (d *Driver) Health(ctx context.Context) error {
+	c, err := d.connection()
+	if err != nil {
+		return err
+	}
+
+	return c.call(ctx, MethodHealth, nil, nil)
+}
+
+// Close disconnects from the plugin, killing it if it is a subprocess.
+func (d *Driver) Close() error {
+	d.connMtx.Lock()
+	defer d.connMtx.Unlock()
+
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	close(d.stop)
+	d.conn.close()
+
+	return nil
+}
+
+// Name returns the name of the plugin's Driver.
+func (d *Driver) Name() string {
+	return d.name
+}
+
+// SupportsReferentialData returns true if the plugin's Driver stores data for
+// referential Constraints.
+func (d *Driver) SupportsReferentialData() bool {
+	return d.referentialData
+}
+
+func (d *Driver) AddTemplate(ctx context.Context, ct *templates.ConstraintTemplate) error {
+	ct = ct.DeepCopy()
+	return d.mutate(ctx, &mutation{
+		method: MethodAddTemplate,
+		params: &TemplateParams{Template: ct},
+		record: func() {
+			d.templates[ct.GetName()] = ct
+		},
+	})
+}
+
+func (d *Driver) RemoveTemplate(ctx context.Context, ct *templates.ConstraintTemplate) error {
+	ct = ct.DeepCopy()
+	return d.mutate(ctx, &mutation{
+		method: MethodRemoveTemplate,
+		params: &TemplateParams{Template: ct},
+		record: func() {
+			delete(d.templates, ct.GetName())
+			// The plugin removes the template's Constraints along with it.
+			for key := range d.constraints {
+				if key.Kind == ct.Spec.CRD.Spec.Names.Kind {
+					delete(d.constraints, key)
+				}
+			}
+		},
+	})
+}
+
+func (d *Driver) AddConstraint(ctx context.Context, constraint *unstructured.Unstructured) error {
+	constraint = constraint.DeepCopy()
+	return d.mutate(ctx, &mutation{
+		method: MethodAddConstraint,
+		params: &ConstraintParams{Constraint: constraint},
+		record: func() {
+			d.constraints[drivers.ConstraintKeyFrom(constraint)] = constraint
+		},
+	})
+}
+
+func (d *Driver) RemoveConstraint(ctx context.Context, constraint *unstructured.Unstructured) error {
+	constraint = constraint.DeepCopy()
+	return d.mutate(ctx, &mutation{
+		method: MethodRemoveConstraint,
+		params: &ConstraintParams{Constraint: constraint},
+		record: func() {
+			delete(d.constraints, drivers.ConstraintKeyFrom(constraint))
+		},
+	})
+}
+
+func (d *Driver) AddData(ctx context.Context, target string, path storage.Path, data interface{}) error {
+	params := &DataParams{Target: target, Path: path, Data: data}
+	return d.mutate(ctx, &mutation{
+		method: MethodAddData,
+		params: params,
+		record: func() {
+			if d.data[target] == nil {
+				d.data[target] = make(map[string]*DataParams)
+			}
+			// Adding data at a path replaces any data beneath it, so the
+			// recorded data never has a parent added after its children.
+			d.removeRecordedData(target, path)
+			d.data[target][path.String()] = params
+		},
+	})
+}
+
+func (d *Driver) RemoveData(ctx context.Context, target string, path storage.Path) error {
+	return d.mutate(ctx, &mutation{
+		method: MethodRemoveData,
+		params: &DataParams{Target: target, Path: path},
+		record: func() {
+			d.removeRecordedData(target, path)
+		},
+	})
+}
+
+// removeRecordedData removes the recorded data at path and beneath it.
+// The state lock must be held.
+func (d *Driver) removeRecordedData(target string, path storage.Path) {
+	prefix := path.String()
+	for key, data := range d.data[target] {
+		if storage.Path(data.Path).HasPrefix(path) || key == prefix {
+			delete(d.data[target], key)
+		}
+	}
+}
+
+// Query runs the target's Constraints against review in the plugin. review
+// must be encodable as JSON, and is decoded by the plugin.
+func (d *Driver) Query(ctx context.Context, target string, constraints []*unstructured.Unstructured, review interface{}, opts ...drivers.QueryOpt) (*drivers.QueryResponse, error) {
+	cfg := &drivers.QueryCfg{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	rawReview, err := json.Marshal(review)
+	if err != nil {
+		return nil, fmt.Errorf("encoding review: %w", err)
+	}
+
+	params := &QueryParams{
+		Target:      target,
+		Constraints: constraints,
+		Review:      rawReview,
+		Tracing:     cfg.TracingEnabled,
+		Stats:       cfg.StatsEnabled,
+	}
+
+	result := &QueryResult{}
+	if err := d.call(ctx, MethodQuery, params, result); err != nil {
+		return nil, err
+	}
+
+	// Results refer to the passed Constraints rather than copies decoded from
+	// the plugin's response.
+	byKey := make(map[drivers.ConstraintKey]*unstructured.Unstructured, len(constraints))
+	for _, constraint := range constraints {
+		byKey[drivers.ConstraintKeyFrom(constraint)] = constraint
+	}
+	for _, r := range result.Results {
+		if r.Constraint == nil {
+			continue
+		}
+		if constraint, found := byKey[drivers.ConstraintKeyFrom(r.Constraint)]; found {
+			r.Constraint = constraint
+		}
+	}
+
+	return &drivers.QueryResponse{Results: result.Results, Trace: result.Trace, StatsEntries: result.StatsEntries}, nil
+}
+
+func (d *Driver) Dump(ctx context.Context) (string, error) {
+	var dump string
+	err := d.call(ctx, MethodDump, nil, &dump)
+	return dump, err
+}
+
+func (d *Driver) GetDescriptionForStat(statName string) (string, error) {
+	var description string
+	err := d.call(context.Background(), MethodGetDescriptionForStat, &StatParams{Name: statName}, &description)
+	return description, err
+}
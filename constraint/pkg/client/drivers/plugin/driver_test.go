@@ -0,0 +1,571 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/rego"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/handler/handlertest"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/types"
+	"github.com/open-policy-agent/opa/storage"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// pipePlugin serves a fresh Rego Driver over an in-memory pipe each time it
+// is dialed, as if the plugin were a subprocess being (re)started.
+type pipePlugin struct {
+	t testing.TB
+	// wrap, if set, wraps the Driver served for the nth dial, counting from 1.
+	wrap func(n int, d drivers.Driver) drivers.Driver
+
+	mtx   sync.Mutex
+	dials int
+	// server is the plugin's end of the most recent connection.
+	server net.Conn
+}
+
+func (p *pipePlugin) dial(ctx context.Context) (io.ReadWriteCloser, error) {
+	driver, err := rego.New()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.dials++
+
+	var served drivers.Driver = driver
+	if p.wrap != nil {
+		served = p.wrap(p.dials, driver)
+	}
+
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		_ = Serve(context.Background(), served, serverConn)
+		_ = serverConn.Close()
+	}()
+	p.server = serverConn
+
+	return clientConn, nil
+}
+
+// crash breaks the current connection to the plugin.
+func (p *pipePlugin) crash() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	_ = p.server.Close()
+}
+
+func (p *pipePlugin) dialCount() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.dials
+}
+
+func newPipeDriver(t *testing.T, args ...Arg) (*Driver, *pipePlugin) {
+	t.Helper()
+
+	return newPipeDriverFor(t, &pipePlugin{t: t}, args...)
+}
+
+func newPipeDriverFor(t *testing.T, p *pipePlugin, args ...Arg) (*Driver, *pipePlugin) {
+	t.Helper()
+
+	d, err := New(p.dial, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = d.Close()
+	})
+
+	return d, p
+}
+
+func TestNew_Handshake(t *testing.T) {
+	d, _ := newPipeDriver(t)
+
+	if got := d.Name(); got != "Rego" {
+		t.Errorf("got Name() = %q, want %q", got, "Rego")
+	}
+	// The Rego Driver is sent referential data by name rather than by
+	// implementing ReferentialDriver.
+	if d.SupportsReferentialData() {
+		t.Error("got SupportsReferentialData() = true, want false")
+	}
+}
+
+func TestNew_ProtocolVersionMismatch(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		defer serverConn.Close()
+		// Answer the handshake as a plugin speaking a future protocol.
+		req := &Request{}
+		if err := json.NewDecoder(serverConn).Decode(req); err != nil {
+			return
+		}
+		_ = json.NewEncoder(serverConn).Encode(&Response{ID: req.ID, Result: []byte(`{"protocolVersion":2,"name":"Future"}`)})
+	}()
+
+	_, err := New(func(context.Context) (io.ReadWriteCloser, error) {
+		return clientConn, nil
+	})
+	if !errors.Is(err, ErrProtocol) {
+		t.Fatalf("got New() error = %v, want %v", err, ErrProtocol)
+	}
+}
+
+func TestDriver_Query(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newPipeDriver(t)
+
+	err := d.AddTemplate(ctx, cts.New(cts.OptTargets(cts.Target(cts.MockTargetHandler, cts.ModuleDeny))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*types.Result{{
+		Msg:               "denied",
+		Constraint:        constraint,
+		EnforcementAction: "deny",
+		Metadata:          map[string]interface{}{"details": map[string]interface{}{}},
+	}}
+	if diff := cmp.Diff(want, resp.Results); diff != "" {
+		t.Error(diff)
+	}
+	if resp.Results[0].Constraint != constraint {
+		t.Error("got Result.Constraint which is not the queried Constraint")
+	}
+}
+
+func TestDriver_Errors(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newPipeDriver(t)
+
+	err := d.AddTemplate(ctx, cts.New(cts.OptTargets(cts.Target(cts.MockTargetHandler, "package foo\nviolation[{\"msg\": msg}] {"))))
+	if !errors.Is(err, clienterrors.ErrInvalidConstraintTemplate) {
+		t.Errorf("got AddTemplate() error = %v, want %v", err, clienterrors.ErrInvalidConstraintTemplate)
+	}
+
+	_, err = d.GetDescriptionForStat("not a stat")
+	if err == nil {
+		t.Error("got GetDescriptionForStat() error = nil, want error")
+	}
+}
+
+func TestDriver_Restart(t *testing.T) {
+	ctx := context.Background()
+	d, p := newPipeDriver(t)
+
+	err := d.AddTemplate(ctx, cts.New(cts.OptTargets(cts.Target(cts.MockTargetHandler, `
+package foo
+
+violation[{"msg": msg}] {
+  data.inventory.cluster.v1.Namespace[name]
+  msg := name
+}
+`))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "default"}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "removed"}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.RemoveData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "removed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.crash()
+
+	resp, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := p.dialCount(); got != 2 {
+		t.Errorf("got %d dials, want 2", got)
+	}
+
+	var got []string
+	for _, r := range resp.Results {
+		got = append(got, r.Msg)
+	}
+	if diff := cmp.Diff([]string{"default"}, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestDriver_Restart_DataOrder(t *testing.T) {
+	ctx := context.Background()
+	d, p := newPipeDriver(t)
+
+	err := d.AddTemplate(ctx, cts.New(cts.OptTargets(cts.Target(cts.MockTargetHandler, `
+package foo
+
+violation[{"msg": msg}] {
+  data.inventory.cluster.v1.Namespace[name]
+  msg := name
+}
+`))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	namespaces := storage.Path{"cluster", "v1", "Namespace"}
+	// Adding the parent replaces "replaced", and "child" is added beneath the
+	// parent afterwards, so both depend on the order data is restored in.
+	for _, add := range []struct {
+		path storage.Path
+		data interface{}
+	}{
+		{path: append(namespaces[:3:3], "replaced"), data: map[string]interface{}{}},
+		{path: namespaces, data: map[string]interface{}{"parent": map[string]interface{}{}}},
+		{path: append(namespaces[:3:3], "child"), data: map[string]interface{}{}},
+	} {
+		if err := d.AddData(ctx, cts.MockTargetHandler, add.path, add.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p.crash()
+
+	resp, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]bool)
+	for _, r := range resp.Results {
+		got[r.Msg] = true
+	}
+	if diff := cmp.Diff(map[string]bool{"parent": true, "child": true}, got); diff != "" {
+		t.Error(diff)
+	}
+}
+
+// blockingDriver blocks AddTemplate until unblock is closed.
+type blockingDriver struct {
+	drivers.Driver
+
+	unblock chan struct{}
+}
+
+func (d *blockingDriver) AddTemplate(ctx context.Context, ct *templates.ConstraintTemplate) error {
+	<-d.unblock
+	return d.Driver.AddTemplate(ctx, ct)
+}
+
+// newAbandonedTemplateDriver returns a Driver whose AddTemplate of the returned
+// template was abandoned after the request was sent, while the first plugin
+// is blocked in AddTemplate until unblock is closed.
+func newAbandonedTemplateDriver(t *testing.T) (*Driver, *pipePlugin, *templates.ConstraintTemplate, chan struct{}) {
+	t.Helper()
+
+	unblock := make(chan struct{})
+	t.Cleanup(func() {
+		select {
+		case <-unblock:
+		default:
+			close(unblock)
+		}
+	})
+
+	d, p := newPipeDriverFor(t, &pipePlugin{t: t, wrap: func(n int, d drivers.Driver) drivers.Driver {
+		if n > 1 {
+			return d
+		}
+		return &blockingDriver{Driver: d, unblock: unblock}
+	}})
+
+	ct := cts.New()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := d.AddTemplate(ctx, ct)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got AddTemplate() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	return d, p, ct, unblock
+}
+
+// recordedTemplates returns the names of the templates d has recorded, and the
+// number of pending mutations.
+func recordedTemplates(t *testing.T, d *Driver) ([]string, int) {
+	t.Helper()
+
+	if err := d.lockState(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer d.unlockState()
+
+	var names []string
+	for name := range d.templates {
+		names = append(names, name)
+	}
+	return names, len(d.pending)
+}
+
+func TestDriver_AbandonedMutation_ReissuedByNextMutation(t *testing.T) {
+	ctx := context.Background()
+	d, _, ct, unblock := newAbandonedTemplateDriver(t)
+
+	// The plugin applies the abandoned AddTemplate after its caller gave up.
+	close(unblock)
+
+	err := d.AddConstraint(ctx, cts.MakeConstraint(t, cts.MockTemplate, "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, pending := recordedTemplates(t, d)
+	if diff := cmp.Diff([]string{ct.GetName()}, names); diff != "" {
+		t.Error(diff)
+	}
+	if pending != 0 {
+		t.Errorf("got %d pending mutations, want 0", pending)
+	}
+}
+
+func TestDriver_AbandonedMutation_ReissuedAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	d, p, ct, _ := newAbandonedTemplateDriver(t)
+
+	// The plugin crashes before applying the abandoned AddTemplate.
+	p.crash()
+
+	dump, err := d.Dump(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := p.dialCount(); got != 2 {
+		t.Errorf("got %d dials, want 2", got)
+	}
+	if !strings.Contains(dump, cts.MockTemplate) {
+		t.Errorf("got Dump() = %q, want restarted plugin to have template %q", dump, cts.MockTemplate)
+	}
+
+	names, pending := recordedTemplates(t, d)
+	if diff := cmp.Diff([]string{ct.GetName()}, names); diff != "" {
+		t.Error(diff)
+	}
+	if pending != 0 {
+		t.Errorf("got %d pending mutations, want 0", pending)
+	}
+}
+
+func TestDriver_RejectedMutation_NotRecorded(t *testing.T) {
+	ctx := context.Background()
+	d, p := newPipeDriver(t)
+
+	err := d.AddTemplate(ctx, cts.New(cts.OptTargets(cts.Target(cts.MockTargetHandler, "package foo\nviolation[{\"msg\": msg}] {"))))
+	if !errors.Is(err, clienterrors.ErrInvalidConstraintTemplate) {
+		t.Fatalf("got AddTemplate() error = %v, want %v", err, clienterrors.ErrInvalidConstraintTemplate)
+	}
+
+	// Restoring a rejected template would fail the restart.
+	p.crash()
+
+	_, err = d.Dump(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, pending := recordedTemplates(t, d)
+	if len(names) != 0 || pending != 0 {
+		t.Errorf("got templates %v and %d pending mutations, want none", names, pending)
+	}
+}
+
+func TestConn_PluginNotReading(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() {
+		_ = clientConn.Close()
+		_ = serverConn.Close()
+	})
+
+	c := newConn(clientConn)
+	t.Cleanup(c.close)
+
+	// The plugin never reads, so the first call's request is never written
+	// and later calls can't hand theirs over.
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		done := make(chan error, 1)
+		go func() {
+			done <- c.call(ctx, MethodHealth, nil, nil)
+		}()
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("got call() error = %v, want %v", err, context.DeadlineExceeded)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("call blocked on a plugin which is not reading")
+		}
+		cancel()
+	}
+}
+
+func TestServeListener_DriverPerConnection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- ServeListener(ctx, func() (drivers.Driver, error) {
+			return rego.New()
+		}, listener)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Errorf("got ServeListener() error = %v", err)
+		}
+	})
+
+	var clients []*Driver
+	for i := 0; i < 2; i++ {
+		d, err := New(Network("tcp", listener.Addr().String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = d.Close()
+		})
+		clients = append(clients, d)
+	}
+
+	err = clients[0].AddTemplate(ctx, cts.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dump, err := clients[1].Dump(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(dump, cts.MockTemplate) {
+		t.Errorf("got Dump() = %q, want no template added by another client", dump)
+	}
+}
+
+func TestDriver_HealthCheck(t *testing.T) {
+	ctx := context.Background()
+	d, p := newPipeDriver(t, HealthCheckInterval(10*time.Millisecond))
+
+	err := d.Health(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.crash()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for p.dialCount() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("plugin was not restarted after failing health check")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err = d.Health(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDriver_Close(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newPipeDriver(t)
+
+	err := d.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.Health(ctx)
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("got Health() error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestClient_Review(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newPipeDriver(t)
+
+	c, err := client.NewClient(client.Targets(&handlertest.Handler{}), client.Driver(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.AddTemplate(ctx, cts.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.AddConstraint(ctx, cts.MakeConstraint(t, cts.MockTemplate, "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := c.Review(ctx, handlertest.NewReview("", "foo", "bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := resp.Results()
+	if len(results) != 1 || results[0].Msg != "denied" {
+		t.Errorf("got results %v, want one denied result", results)
+	}
+}
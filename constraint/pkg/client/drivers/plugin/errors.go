@@ -0,0 +1,76 @@
+package plugin
+
+import (
+	"errors"
+
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+)
+
+var (
+	// ErrConnection indicates the connection to the plugin failed, for example
+	// because the plugin exited.
+	ErrConnection = errors.New("plugin connection failed")
+	// ErrProtocol indicates the plugin does not speak a compatible version of
+	// the plugin protocol.
+	ErrProtocol = errors.New("plugin protocol error")
+	// ErrUnknownMethod indicates the plugin does not implement a method.
+	ErrUnknownMethod = errors.New("unknown plugin method")
+	// ErrClosed indicates the Driver was closed.
+	ErrClosed = errors.New("plugin driver closed")
+)
+
+// errorCodes identify errors which callers may check for with errors.Is, so
+// they survive the trip from the plugin. Errors are identified by the first
+// matching code.
+var errorCodes = []struct {
+	code string
+	err  error
+}{
+	{"invalid_constraint_template", clienterrors.ErrInvalidConstraintTemplate},
+	{"missing_constraint_template", clienterrors.ErrMissingConstraintTemplate},
+	{"invalid_module", clienterrors.ErrInvalidModule},
+	{"module_name", clienterrors.ErrModuleName},
+	{"parse", clienterrors.ErrParse},
+	{"compile", clienterrors.ErrCompile},
+	{"module_prefix", clienterrors.ErrModulePrefix},
+	{"path_invalid", clienterrors.ErrPathInvalid},
+	{"path_conflict", clienterrors.ErrPathConflict},
+	{"write", clienterrors.ErrWrite},
+	{"read", clienterrors.ErrRead},
+	{"transaction", clienterrors.ErrTransaction},
+	{"autoreject", clienterrors.ErrAutoreject},
+	{"unknown_method", ErrUnknownMethod},
+}
+
+// Error is an error returned by the plugin.
+type Error struct {
+	// Code identifies the kind of error, if it is one callers may check for.
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the error identified by Code, if any.
+func (e *Error) Unwrap() error {
+	for _, c := range errorCodes {
+		if c.code == e.Code {
+			return c.err
+		}
+	}
+
+	return nil
+}
+
+// toError converts err to an Error to return to the client.
+func toError(err error) *Error {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return &Error{Code: c.code, Message: err.Error()}
+		}
+	}
+
+	return &Error{Message: err.Error()}
+}
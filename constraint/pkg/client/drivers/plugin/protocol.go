@@ -0,0 +1,101 @@
+package plugin
+
+import (
+	"encoding/json"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/instrumentation"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// The plugin protocol exchanges newline-delimited JSON messages over a byte
+// stream, such as a subprocess's stdin and stdout or a socket to a sidecar.
+// The client sends Requests, and the plugin replies to each with a Response
+// with the same ID. Requests may be answered in any order, so clients may
+// issue several at once.
+//
+// Each method mirrors the drivers.Driver method of the same name, except for
+// Handshake, which the client calls first on every new connection, and
+// Health, which reports whether the plugin is able to serve requests.
+
+// ProtocolVersion is the version of the plugin protocol. Clients refuse to
+// use plugins which report a different version.
+const ProtocolVersion = 1
+
+const (
+	MethodHandshake             = "Handshake"
+	MethodHealth                = "Health"
+	MethodAddTemplate           = "AddTemplate"
+	MethodRemoveTemplate        = "RemoveTemplate"
+	MethodAddConstraint         = "AddConstraint"
+	MethodRemoveConstraint      = "RemoveConstraint"
+	MethodAddData               = "AddData"
+	MethodRemoveData            = "RemoveData"
+	MethodQuery                 = "Query"
+	MethodDump                  = "Dump"
+	MethodGetDescriptionForStat = "GetDescriptionForStat"
+)
+
+// Request is a call to a method of the plugin's Driver.
+type Request struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is the plugin's reply to the Request with the same ID. Exactly one
+// of Result and Error is set.
+type Response struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// HandshakeResult describes the plugin's Driver.
+type HandshakeResult struct {
+	ProtocolVersion int    `json:"protocolVersion"`
+	Name            string `json:"name"`
+	// ReferentialData is whether the Driver stores data for referential
+	// Constraints.
+	ReferentialData bool `json:"referentialData,omitempty"`
+}
+
+// TemplateParams are the parameters of AddTemplate and RemoveTemplate.
+type TemplateParams struct {
+	Template *templates.ConstraintTemplate `json:"template"`
+}
+
+// ConstraintParams are the parameters of AddConstraint and RemoveConstraint.
+type ConstraintParams struct {
+	Constraint *unstructured.Unstructured `json:"constraint"`
+}
+
+// DataParams are the parameters of AddData and RemoveData. Data is omitted for
+// RemoveData.
+type DataParams struct {
+	Target string      `json:"target"`
+	Path   []string    `json:"path"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// QueryParams are the parameters of Query.
+type QueryParams struct {
+	Target      string                       `json:"target"`
+	Constraints []*unstructured.Unstructured `json:"constraints"`
+	Review      json.RawMessage              `json:"review"`
+	Tracing     bool                         `json:"tracing,omitempty"`
+	Stats       bool                         `json:"stats,omitempty"`
+}
+
+// QueryResult is the result of Query.
+type QueryResult struct {
+	Results      []*types.Result               `json:"results,omitempty"`
+	Trace        *string                       `json:"trace,omitempty"`
+	StatsEntries []*instrumentation.StatsEntry `json:"statsEntries,omitempty"`
+}
+
+// StatParams are the parameters of GetDescriptionForStat.
+type StatParams struct {
+	Name string `json:"name"`
+}
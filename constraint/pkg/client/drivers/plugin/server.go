@@ -0,0 +1,252 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/opa/storage"
+)
+
+// ServeArg configures how a plugin serves its Driver.
+type ServeArg func(*server)
+
+// ReviewDecoder decodes the reviews passed to Query into the type the Driver
+// expects. By default, reviews are decoded into generic JSON values, which
+// suits Drivers such as Rego which accept any review.
+func ReviewDecoder(decode func(json.RawMessage) (interface{}, error)) ServeArg {
+	return func(s *server) {
+		s.decodeReview = decode
+	}
+}
+
+// HealthCheck reports whether the plugin is able to serve requests, in
+// response to Health. By default, a plugin is healthy as long as it responds.
+func HealthCheck(check func(ctx context.Context) error) ServeArg {
+	return func(s *server) {
+		s.healthCheck = check
+	}
+}
+
+type server struct {
+	driver       drivers.Driver
+	decodeReview func(json.RawMessage) (interface{}, error)
+	healthCheck  func(ctx context.Context) error
+}
+
+func newServer(driver drivers.Driver, args ...ServeArg) *server {
+	s := &server{
+		driver: driver,
+		decodeReview: func(raw json.RawMessage) (interface{}, error) {
+			var review interface{}
+			err := json.Unmarshal(raw, &review)
+			return review, err
+		},
+		healthCheck: func(context.Context) error { return nil },
+	}
+	for _, arg := range args {
+		arg(s)
+	}
+
+	return s
+}
+
+// Serve serves driver over rw, such as the plugin's stdin and stdout, until ctx
+// is done or rw reaches EOF. Requests are handled concurrently, so driver must
+// be safe for concurrent use.
+func Serve(ctx context.Context, driver drivers.Driver, rw io.ReadWriter, args ...ServeArg) error {
+	return newServer(driver, args...).serve(ctx, rw)
+}
+
+// ServeListener serves each connection accepted by listener, such as from the
+// clients of a sidecar, until ctx is done. Closes listener on return.
+//
+// Each connection is served a Driver of its own, created with newDriver, so
+// clients don't see or overwrite each other's templates, Constraints, and data,
+// and a client which reconnects after a failure starts from a fresh Driver to
+// restore its state to. A connection whose Driver can't be created is closed.
+func ServeListener(ctx context.Context, newDriver func() (drivers.Driver, error), listener net.Listener, args ...ServeArg) error {
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+
+			driver, err := newDriver()
+			if err != nil {
+				return
+			}
+			_ = newServer(driver, args...).serve(ctx, conn)
+		}()
+	}
+}
+
+func (s *server) serve(ctx context.Context, rw io.ReadWriter) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Unblock the decoder when ctx is done, if rw can be closed.
+	if closer, ok := rw.(io.Closer); ok {
+		go func() {
+			<-ctx.Done()
+			_ = closer.Close()
+		}()
+	}
+
+	decoder := json.NewDecoder(rw)
+	encoder := json.NewEncoder(rw)
+	var encodeMtx sync.Mutex
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		req := &Request{}
+		if err := decoder.Decode(req); err != nil {
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("%w: reading request: %v", ErrProtocol, err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp := s.handle(ctx, req)
+
+			encodeMtx.Lock()
+			defer encodeMtx.Unlock()
+			// A failed write means the client is gone, which the decoder
+			// also observes.
+			_ = encoder.Encode(resp)
+		}()
+	}
+}
+
+// handle calls the Driver method req is for.
+func (s *server) handle(ctx context.Context, req *Request) *Response {
+	result, err := s.call(ctx, req)
+	if err != nil {
+		return &Response{ID: req.ID, Error: toError(err)}
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return &Response{ID: req.ID, Error: toError(fmt.Errorf("encoding result: %w", err))}
+	}
+
+	return &Response{ID: req.ID, Result: raw}
+}
+
+func (s *server) call(ctx context.Context, req *Request) (interface{}, error) {
+	switch req.Method {
+	case MethodHandshake:
+		result := &HandshakeResult{ProtocolVersion: ProtocolVersion, Name: s.driver.Name()}
+		if referential, ok := s.driver.(drivers.ReferentialDriver); ok {
+			result.ReferentialData = referential.SupportsReferentialData()
+		}
+		return result, nil
+
+	case MethodHealth:
+		return struct{}{}, s.healthCheck(ctx)
+
+	case MethodAddTemplate, MethodRemoveTemplate:
+		params := &TemplateParams{}
+		if err := decodeParams(req, params); err != nil {
+			return nil, err
+		}
+		if req.Method == MethodAddTemplate {
+			return struct{}{}, s.driver.AddTemplate(ctx, params.Template)
+		}
+		return struct{}{}, s.driver.RemoveTemplate(ctx, params.Template)
+
+	case MethodAddConstraint, MethodRemoveConstraint:
+		params := &ConstraintParams{}
+		if err := decodeParams(req, params); err != nil {
+			return nil, err
+		}
+		if req.Method == MethodAddConstraint {
+			return struct{}{}, s.driver.AddConstraint(ctx, params.Constraint)
+		}
+		return struct{}{}, s.driver.RemoveConstraint(ctx, params.Constraint)
+
+	case MethodAddData, MethodRemoveData:
+		params := &DataParams{}
+		if err := decodeParams(req, params); err != nil {
+			return nil, err
+		}
+		if req.Method == MethodAddData {
+			return struct{}{}, s.driver.AddData(ctx, params.Target, storage.Path(params.Path), params.Data)
+		}
+		return struct{}{}, s.driver.RemoveData(ctx, params.Target, storage.Path(params.Path))
+
+	case MethodQuery:
+		return s.query(ctx, req)
+
+	case MethodDump:
+		return s.driver.Dump(ctx)
+
+	case MethodGetDescriptionForStat:
+		params := &StatParams{}
+		if err := decodeParams(req, params); err != nil {
+			return nil, err
+		}
+		return s.driver.GetDescriptionForStat(params.Name)
+
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMethod, req.Method)
+	}
+}
+
+func (s *server) query(ctx context.Context, req *Request) (*QueryResult, error) {
+	params := &QueryParams{}
+	if err := decodeParams(req, params); err != nil {
+		return nil, err
+	}
+
+	review, err := s.decodeReview(params.Review)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decoding review: %v", ErrProtocol, err)
+	}
+
+	resp, err := s.driver.Query(ctx, params.Target, params.Constraints, review,
+		drivers.Tracing(params.Tracing), drivers.Stats(params.Stats))
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil {
+		// Drivers may return no response if there were no Constraints to query.
+		return &QueryResult{}, nil
+	}
+
+	return &QueryResult{Results: resp.Results, Trace: resp.Trace, StatsEntries: resp.StatsEntries}, nil
+}
+
+func decodeParams(req *Request, params interface{}) error {
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		return fmt.Errorf("%w: decoding %s parameters: %v", ErrProtocol, req.Method, err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package rego
+
+import (
+	"strings"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/types"
+	"github.com/open-policy-agent/opa/ast"
+)
+
+// customFields returns the values of the custom annotation fields named by
+// fields which apply to violations of the Template. Annotations on violation
+// rules take precedence over those on the package.
+func customFields(a *drivers.TemplateAnnotations, fields []string) map[string]interface{} {
+	if a == nil || len(fields) == 0 {
+		return nil
+	}
+
+	annotations := append([]*ast.Annotations{}, a.Rules[violation]...)
+	if a.Package != nil {
+		annotations = append(annotations, a.Package)
+	}
+
+	var result map[string]interface{}
+	for _, field := range fields {
+		for _, annotation := range annotations {
+			value, found := annotation.Custom[field]
+			if !found {
+				continue
+			}
+
+			if result == nil {
+				result = make(map[string]interface{})
+			}
+			result[field] = value
+			break
+		}
+	}
+
+	return result
+}
+
+// templateAnnotations returns the annotations declared in the entry point
+// module of each of templ's targets, keyed by target. Annotations in libraries
+// are not included.
+//
+// Annotations are parsed separately from the modules AddTemplate compiles, so
+// malformed annotations are reported in the result rather than preventing the
+// Template from being added.
+func templateAnnotations(templ *templates.ConstraintTemplate) map[string]*drivers.TemplateAnnotations {
+	result := make(map[string]*drivers.TemplateAnnotations)
+
+	for i := range templ.Spec.Targets {
+		target := &templ.Spec.Targets[i]
+		regoSrc, err := targetSource(target)
+		if err != nil {
+			// The Template would not have compiled, so there is nothing to report.
+			continue
+		}
+
+		module, err := ast.ParseModuleWithOpts(templatePath, regoSrc.Rego, ast.ParserOptions{ProcessAnnotation: true})
+		if err != nil {
+			result[target.Target] = &drivers.TemplateAnnotations{Error: err.Error()}
+			continue
+		}
+
+		result[target.Target] = moduleAnnotations(module)
+	}
+
+	return result
+}
+
+func moduleAnnotations(module *ast.Module) *drivers.TemplateAnnotations {
+	result := &drivers.TemplateAnnotations{}
+
+	for _, annotation := range module.Annotations {
+		switch annotation.Scope {
+		case "package", "subpackages":
+			result.Package = annotation
+		case "rule", "document":
+			name := ruleName(module.Package.Path, annotation.GetTargetPath())
+
+			if result.Rules == nil {
+				result.Rules = make(map[string][]*ast.Annotations)
+			}
+			result.Rules[name] = append(result.Rules[name], annotation)
+		}
+	}
+
+	return result
+}
+
+// ruleName returns the name of the rule at path, relative to pkg. For example,
+// "violation" for data.template.violation.
+func ruleName(pkg, path ast.Ref) string {
+	if path.HasPrefix(pkg) {
+		path = path[len(pkg):]
+	}
+
+	parts := make([]string, len(path))
+	for i, term := range path {
+		switch v := term.Value.(type) {
+		case ast.String:
+			parts[i] = string(v)
+		case ast.Var:
+			parts[i] = string(v)
+		default:
+			parts[i] = v.String()
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// addResultMetadata copies the custom annotation fields named by fields into
+// the Metadata of each of results. Does not overwrite existing Metadata, such
+// as the details of a violation.
+func addResultMetadata(results []*types.Result, annotations *drivers.TemplateAnnotations, fields []string) {
+	custom := customFields(annotations, fields)
+	if len(custom) == 0 {
+		return
+	}
+
+	for _, result := range results {
+		if result.Metadata == nil {
+			result.Metadata = make(map[string]interface{}, len(custom))
+		}
+
+		for field, value := range custom {
+			if _, exists := result.Metadata[field]; exists {
+				continue
+			}
+			result.Metadata[field] = value
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package rego
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const annotatedRego = `# METADATA
+# title: Required labels
+# description: Requires resources to have a set of labels.
+# custom:
+#   severity: low
+#   remediationURL: https://example.com/required-labels
+package foo
+
+# METADATA
+# title: Missing label
+# custom:
+#   severity: high
+violation[{"msg": "missing label", "details": {"severity": "from details"}}] {
+  input.parameters.details
+}
+
+violation[{"msg": "missing label"}] {
+  not input.parameters.details
+}
+`
+
+func TestDriver_GetTemplateAnnotations(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = d.GetTemplateAnnotations(cts.MockTemplate)
+	if !errors.Is(err, clienterrors.ErrMissingConstraintTemplate) {
+		t.Fatalf("got GetTemplateAnnotations() error = %v, want %v",
+			err, clienterrors.ErrMissingConstraintTemplate)
+	}
+
+	tmpl := cts.New(cts.OptTargets(cts.Target(cts.MockTargetHandler, annotatedRego)))
+	err = d.AddTemplate(ctx, tmpl)
+	if err != nil {
+		t.Fatalf("got AddTemplate() error = %v, want %v", err, nil)
+	}
+
+	got, err := d.GetTemplateAnnotations(cts.MockTemplate)
+	if err != nil {
+		t.Fatalf("got GetTemplateAnnotations() error = %v, want %v", err, nil)
+	}
+
+	annotations := got[cts.MockTargetHandler]
+	if annotations == nil || annotations.Package == nil {
+		t.Fatalf("got annotations %v, want package annotations", got)
+	}
+
+	if annotations.Package.Title != "Required labels" {
+		t.Errorf("got package title %q, want %q", annotations.Package.Title, "Required labels")
+	}
+
+	if len(annotations.Rules[violation]) != 1 || annotations.Rules[violation][0].Title != "Missing label" {
+		t.Errorf("got violation annotations %v, want one titled %q", annotations.Rules[violation], "Missing label")
+	}
+
+	err = d.RemoveTemplate(ctx, tmpl)
+	if err != nil {
+		t.Fatalf("got RemoveTemplate() error = %v, want %v", err, nil)
+	}
+
+	_, err = d.GetTemplateAnnotations(cts.MockTemplate)
+	if !errors.Is(err, clienterrors.ErrMissingConstraintTemplate) {
+		t.Fatalf("got GetTemplateAnnotations() error = %v, want %v",
+			err, clienterrors.ErrMissingConstraintTemplate)
+	}
+}
+
+func TestDriver_GetTemplateAnnotations_Malformed(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := New(AnnotationMetadata("severity"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The METADATA block is not valid YAML, but the Template compiled before
+	// annotations were supported so it must still be added.
+	tmpl := cts.New(cts.OptTargets(cts.Target(cts.MockTargetHandler, `# METADATA
+# title: [unterminated
+package foo
+
+violation[{"msg": "denied"}] {
+  true
+}
+`)))
+	err = d.AddTemplate(ctx, tmpl)
+	if err != nil {
+		t.Fatalf("got AddTemplate() error = %v, want %v", err, nil)
+	}
+
+	got, err := d.GetTemplateAnnotations(cts.MockTemplate)
+	if err != nil {
+		t.Fatalf("got GetTemplateAnnotations() error = %v, want %v", err, nil)
+	}
+
+	annotations := got[cts.MockTargetHandler]
+	if annotations == nil || annotations.Error == "" {
+		t.Fatalf("got annotations %v, want error", annotations)
+	}
+	if annotations.Package != nil || len(annotations.Rules) != 0 {
+		t.Errorf("got annotations %v, want none", annotations)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatalf("got AddConstraint() error = %v, want %v", err, nil)
+	}
+
+	resp, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("got Query() error = %v, want %v", err, nil)
+	}
+	if len(resp.Results) != 1 {
+		t.Fatalf("got %d results, want %d", len(resp.Results), 1)
+	}
+}
+
+func TestDriver_AnnotationMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		// detailed is whether the Constraint produces details.
+		detailed bool
+		want     map[string]interface{}
+	}{{
+		name:   "no fields",
+		fields: nil,
+		want:   map[string]interface{}{"details": map[string]interface{}{}},
+	}, {
+		name:   "rule annotations take precedence over package",
+		fields: []string{"severity", "remediationURL", "missing"},
+		want: map[string]interface{}{
+			"details":        map[string]interface{}{},
+			"severity":       "high",
+			"remediationURL": "https://example.com/required-labels",
+		},
+	}, {
+		name:     "existing metadata is not overwritten",
+		fields:   []string{"details"},
+		detailed: true,
+		want: map[string]interface{}{
+			"details": map[string]interface{}{"severity": "from details"},
+		},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			d, err := New(AnnotationMetadata(tt.fields...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = d.AddTemplate(ctx, cts.New(cts.OptTargets(cts.Target(cts.MockTargetHandler, annotatedRego))))
+			if err != nil {
+				t.Fatalf("got AddTemplate() error = %v, want %v", err, nil)
+			}
+
+			constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo",
+				cts.Set(tt.detailed, "spec", "parameters", "details"))
+			err = d.AddConstraint(ctx, constraint)
+			if err != nil {
+				t.Fatalf("got AddConstraint() error = %v, want %v", err, nil)
+			}
+
+			resp, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, map[string]interface{}{})
+			if err != nil {
+				t.Fatalf("got Query() error = %v, want %v", err, nil)
+			}
+
+			if len(resp.Results) != 1 {
+				t.Fatalf("got %d results, want %d", len(resp.Results), 1)
+			}
+
+			if diff := cmp.Diff(tt.want, resp.Results[0].Metadata); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -2,7 +2,10 @@ package rego
 
 import (
 	"fmt"
+	"path/filepath"
+	"time"
 
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/externaldata"
 	"github.com/open-policy-agent/opa/ast"
@@ -34,6 +37,10 @@ func Defaults() Arg {
 			d.targets = make(map[string][]string)
 		}
 
+		if d.annotations == nil {
+			d.annotations = make(map[string]map[string]*drivers.TemplateAnnotations)
+		}
+
 		// adding external_data builtin otherwise capabilities get overridden
 		// if a capability, like http.send, is disabled
 		if d.providerCache != nil {
@@ -45,7 +52,11 @@ func Defaults() Arg {
 		}
 
 		if d.sendRequestToProvider == nil {
-			d.sendRequestToProvider = externaldata.DefaultSendRequestToProvider
+			d.sendRequestToProvider = externaldata.NewAuthenticator(d.externalDataCredentialResolver, d.externalDataCredentialDirs...).Send
+		}
+
+		if d.externalDataResilience == nil {
+			d.externalDataResilience = externaldata.NewResilience()
 		}
 
 		return nil
@@ -94,7 +105,37 @@ func AddExternalDataProviderCache(providerCache *externaldata.ProviderCache) Arg
 
 func AddExternalDataProviderResponseCache(providerResponseCache *externaldata.ProviderResponseCache) Arg {
 	return func(d *Driver) error {
-		d.providerResponseCache = providerResponseCache
+		if providerResponseCache != nil {
+			d.providerResponseCache = providerResponseCache
+		}
+
+		return nil
+	}
+}
+
+// ExternalDataResponseCache caches the items of external data responses in
+// cache, such as a size-bounded LRUProviderResponseCache, instead of the
+// default ProviderResponseCache.
+func ExternalDataResponseCache(cache externaldata.ResponseCache) Arg {
+	return func(d *Driver) error {
+		d.providerResponseCache = cache
+
+		return nil
+	}
+}
+
+// ExternalDataCoalescing merges concurrent external_data calls for the same
+// provider made within window into a single request to the provider, with at
+// most maxBatchSize distinct keys. If maxBatchSize is not positive, requests
+// are limited only by window.
+func ExternalDataCoalescing(window time.Duration, maxBatchSize int) Arg {
+	return func(d *Driver) error {
+		if window <= 0 {
+			return fmt.Errorf("%w: external data coalescing window must be positive, got %v",
+				errors.ErrCreatingDriver, window)
+		}
+
+		d.externalDataCoalescer = externaldata.NewCoalescer(window, maxBatchSize)
 
 		return nil
 	}
@@ -140,6 +181,35 @@ func EnableExternalDataClientAuth() Arg {
 	}
 }
 
+// ExternalDataCredentialResolver resolves the secrets referenced by the auth of
+// external data providers. Providers which authenticate with credentials in
+// files do not need a resolver. Wrap resolver with externaldata.AllowNamespaces
+// to limit which secrets providers may use.
+func ExternalDataCredentialResolver(resolver externaldata.CredentialResolver) Arg {
+	return func(d *Driver) error {
+		d.externalDataCredentialResolver = resolver
+
+		return nil
+	}
+}
+
+// ExternalDataCredentialDirs sets the directories external data providers may
+// read credential files from. If unset, providers may not authenticate with
+// credential files.
+func ExternalDataCredentialDirs(dirs ...string) Arg {
+	return func(d *Driver) error {
+		for _, dir := range dirs {
+			if !filepath.IsAbs(dir) {
+				return fmt.Errorf("%w: external data credential directory %q is not an absolute path",
+					errors.ErrCreatingDriver, dir)
+			}
+		}
+		d.externalDataCredentialDirs = dirs
+
+		return nil
+	}
+}
+
 // Externs sets the fields under `data` that Rego in ConstraintTemplates
 // can access. If unset, all fields can be accessed. Only fields recognized by
 // the system can be enabled.
@@ -172,6 +242,52 @@ func GatherStats() Arg {
 	}
 }
 
+// LintParameters checks each Template's references to input.parameters against
+// its parameter schema when it is added, reporting undeclared parameters,
+// unused parameters, and type mismatches to report if it is non-nil.
+//
+// If failOnError is true, AddTemplate returns an error wrapping
+// ErrInvalidConstraintTemplate for Templates with LintError issues.
+func LintParameters(report LintReporter, failOnError bool) Arg {
+	return func(driver *Driver) error {
+		driver.lintEnabled = true
+		driver.lintReporter = report
+		driver.lintFailOnError = failOnError
+
+		return nil
+	}
+}
+
+// AnnotationMetadata copies the named custom fields of Templates' METADATA
+// annotations, for example "severity", into the Metadata of each violation.
+// Annotations on violation rules take precedence over annotations on the
+// Template's package. Fields already present in Metadata are not overwritten.
+func AnnotationMetadata(fields ...string) Arg {
+	return func(driver *Driver) error {
+		driver.annotationMetadataFields = append(driver.annotationMetadataFields, fields...)
+
+		return nil
+	}
+}
+
+// QueryParallelism evaluates up to workers Template kinds concurrently within a
+// single call to Query. By default, kinds are evaluated sequentially.
+//
+// Results, traces, and stats are merged in a deterministic order regardless
+// of the number of workers.
+func QueryParallelism(workers int) Arg {
+	return func(driver *Driver) error {
+		if workers < 1 {
+			return fmt.Errorf("%w: query parallelism must be at least 1, got %d",
+				errors.ErrCreatingDriver, workers)
+		}
+
+		driver.queryParallelism = workers
+
+		return nil
+	}
+}
+
 // Currently rules should only access data.inventory.
 var validDataFields = map[string]bool{
 	"inventory": true,
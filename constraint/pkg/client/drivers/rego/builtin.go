@@ -1,9 +1,12 @@
 package rego
 
 import (
+	"context"
+	"crypto/tls"
 	"net/http"
 	"time"
 
+	"github.com/open-policy-agent/frameworks/constraint/pkg/apis/externaldata/unversioned"
 	"github.com/open-policy-agent/frameworks/constraint/pkg/externaldata"
 	"github.com/open-policy-agent/opa/ast"
 	"github.com/open-policy-agent/opa/rego"
@@ -50,7 +53,7 @@ func externalDataBuiltin(d *Driver) func(bctx rego.BuiltinContext, regorequest *
 					Key:          k,
 				},
 			)
-			if err != nil || time.Since(time.Unix(cachedResponse.Received, 0)) > d.providerResponseCache.TTL {
+			if err != nil {
 				// key is not found or cache entry is stale, add key to the provider request keys
 				providerRequestKeys = append(providerRequestKeys, k)
 			} else {
@@ -71,7 +74,7 @@ func externalDataBuiltin(d *Driver) func(bctx rego.BuiltinContext, regorequest *
 		}
 
 		if len(providerRequestKeys) > 0 {
-			externaldataResponse, statusCode, err := d.sendRequestToProvider(bctx.Context, &provider, providerRequestKeys, clientCert)
+			externaldataResponse, statusCode, err := d.sendExternalDataRequest(bctx.Context, &provider, providerRequestKeys, clientCert)
 			if err != nil {
 				return externaldata.HandleError(statusCode, err)
 			}
@@ -89,6 +92,7 @@ func externalDataBuiltin(d *Driver) func(bctx rego.BuiltinContext, regorequest *
 							Value:      item.Value,
 							Error:      item.Error,
 							Idempotent: externaldataResponse.Response.Idempotent,
+							TTL:        cacheTTL(&provider, item.Error),
 						},
 					)
 				}
@@ -115,3 +119,32 @@ func externalDataBuiltin(d *Driver) func(bctx rego.BuiltinContext, regorequest *
 		return externaldata.PrepareRegoResponse(regoResponse)
 	}
 }
+
+// sendExternalDataRequest sends keys to provider, merged with concurrent
+// requests to the same provider if coalescing is enabled, and subject to the
+// provider's retry, circuit breaker, and failure policies.
+func (d *Driver) sendExternalDataRequest(ctx context.Context, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate) (*externaldata.ProviderResponse, int, error) {
+	send := func(ctx context.Context, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate) (*externaldata.ProviderResponse, int, error) {
+		return d.externalDataResilience.Send(ctx, d.sendRequestToProvider, provider, keys, clientCert)
+	}
+
+	if d.externalDataCoalescer == nil {
+		return send(ctx, provider, keys, clientCert)
+	}
+
+	return d.externalDataCoalescer.Send(ctx, send, provider, keys, clientCert)
+}
+
+// cacheTTL returns how long provider's ResponseCache policy caches an item with
+// the given error, or zero if the cache's default applies.
+func cacheTTL(provider *unversioned.Provider, itemError string) time.Duration {
+	policy := provider.Spec.ResponseCache
+	if policy == nil {
+		return 0
+	}
+
+	if itemError != "" {
+		return time.Duration(policy.ErrorTTLSeconds) * time.Second
+	}
+	return time.Duration(policy.TTLSeconds) * time.Second
+}
@@ -30,29 +30,45 @@ type Compilers struct {
 }
 
 func (d *Compilers) addTemplate(templ *templates.ConstraintTemplate, printEnabled bool) error {
+	compilers, err := d.compileTemplate(templ, printEnabled)
+	if err != nil {
+		return err
+	}
+
+	d.setTemplate(templ.Spec.CRD.Spec.Names.Kind, compilers)
+	return nil
+}
+
+// compileTemplate compiles templ for each of its targets without adding it to
+// the store. Returns a map from target name to the compiler for that target.
+func (d *Compilers) compileTemplate(templ *templates.ConstraintTemplate, printEnabled bool) (map[string]*ast.Compiler, error) {
 	compilers := make(map[string]*ast.Compiler)
 
 	modules, err := parseConstraintTemplate(templ, d.externs)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for target, targetModules := range modules {
 		compiler, err := compileTemplateTarget(targetModules, d.capabilities, printEnabled)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		compilers[target] = compiler
 	}
 
+	return compilers, nil
+}
+
+// setTemplate replaces the compilers for kind with compilers.
+func (d *Compilers) setTemplate(kind string, compilers map[string]*ast.Compiler) {
 	// Don't lock the mutex until after compilation is done. Compilation is
 	// expensive, so this allows templates to be compiled in parallel through
 	// separate calls but added serially.
 	d.mtx.Lock()
 	defer d.mtx.Unlock()
 
-	kind := templ.Spec.CRD.Spec.Names.Kind
 	for target, targetCompilers := range d.compilers {
 		delete(targetCompilers, kind)
 		d.compilers[target] = targetCompilers
@@ -70,8 +86,6 @@ func (d *Compilers) addTemplate(templ *templates.ConstraintTemplate, printEnable
 		targetCompilers[kind] = compiler
 		d.compilers[target] = targetCompilers
 	}
-
-	return nil
 }
 
 func (d *Compilers) getCompiler(target, kind string) *ast.Compiler {
@@ -142,20 +156,71 @@ func parseConstraintTemplate(templ *templates.ConstraintTemplate, externs []stri
 	return mods, nil
 }
 
-func parseConstraintTemplateTarget(rr *regorewriter.RegoRewriter, targetSpec *templates.Target) ([]*ast.Module, error) {
-	var regoCode templates.Code
-	found := false
+// targetSource returns the Rego source of targetSpec.
+func targetSource(targetSpec *templates.Target) (*schema.Source, error) {
 	for _, code := range targetSpec.Code {
 		if code.Engine == schema.Name {
-			found = true
-			regoCode = code
-			break
+			return schema.GetSource(code)
 		}
 	}
-	if !found {
-		return nil, ErrNoRego
+
+	return nil, ErrNoRego
+}
+
+func parseConstraintTemplateTarget(rr *regorewriter.RegoRewriter, targetSpec *templates.Target) ([]*ast.Module, error) {
+	sources, err := rewriteTarget(rr, targetSpec, templatePackage(), func(idx int) string {
+		return fmt.Sprintf(`%s["lib_%d"]`, templateLibPrefix, idx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var mods []*ast.Module
+	for _, m := range sources.EntryPoints {
+		mods = append(mods, m.Module)
+	}
+	for _, m := range sources.Libs {
+		mods = append(mods, m.Module)
+	}
+
+	return mods, nil
+}
+
+// ParseTarget parses and rewrites the Rego of targetSpec as AddTemplate does,
+// except that the entry point is moved to package pkg and libraries are moved
+// beneath libPrefix. This lets Drivers which store many Templates' modules
+// side by side, such as in an OPA server, validate Templates exactly as the
+// Rego Driver does. Returns the rewritten entry point, and the rewritten
+// libraries in the order targetSpec lists them.
+//
+// externs are the subpaths of "data" the Template may reference without
+// defining, for example "data.inventory".
+func ParseTarget(targetSpec *templates.Target, pkg ast.Ref, libPrefix string, externs []string) (*ast.Module, []*ast.Module, error) {
+	rr, err := regorewriter.New(regorewriter.NewPackagePrefixer(libPrefix), []string{libRoot}, externs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating rego rewriter: %w", err)
+	}
+
+	sources, err := rewriteTarget(rr, targetSpec, pkg, func(idx int) string {
+		return fmt.Sprintf("lib_%d", idx)
+	})
+	if err != nil {
+		return nil, nil, err
 	}
-	regoSrc, err := schema.GetSource(regoCode)
+
+	libs := make([]*ast.Module, len(sources.Libs))
+	for i, m := range sources.Libs {
+		libs[i] = m.Module
+	}
+
+	return sources.EntryPoints[0].Module, libs, nil
+}
+
+// rewriteTarget parses the Rego of targetSpec, moves its entry point to package
+// pkg, and rewrites it and its libraries with rr. libPath names the library at
+// each index.
+func rewriteTarget(rr *regorewriter.RegoRewriter, targetSpec *templates.Target, pkg ast.Ref, libPath func(idx int) string) (*regorewriter.Sources, error) {
+	regoSrc, err := targetSource(targetSpec)
 	if err != nil {
 		return nil, err
 	}
@@ -169,7 +234,7 @@ func parseConstraintTemplateTarget(rr *regorewriter.RegoRewriter, targetSpec *te
 			clienterrors.ErrInvalidConstraintTemplate)
 	}
 
-	if err := rewriteModulePackage(entryPoint); err != nil {
+	if err := rewriteModulePackage(entryPoint, pkg); err != nil {
 		return nil, err
 	}
 
@@ -182,15 +247,13 @@ func parseConstraintTemplateTarget(rr *regorewriter.RegoRewriter, targetSpec *te
 
 	rr.AddEntryPointModule(templatePath, entryPoint)
 	for idx, libSrc := range regoSrc.Libs {
-		libPath := fmt.Sprintf(`%s["lib_%d"]`, templateLibPrefix, idx)
-
-		m, err := parseModule(libPath, libSrc)
+		m, err := parseModule(libPath(idx), libSrc)
 		if err != nil {
 			return nil, fmt.Errorf("%w: %v",
 				clienterrors.ErrInvalidConstraintTemplate, err)
 		}
 
-		if err = rr.AddLib(libPath, m); err != nil {
+		if err = rr.AddLib(libPath(idx), m); err != nil {
 			return nil, fmt.Errorf("%w: %v",
 				clienterrors.ErrInvalidConstraintTemplate, err)
 		}
@@ -202,22 +265,33 @@ func parseConstraintTemplateTarget(rr *regorewriter.RegoRewriter, targetSpec *te
 			clienterrors.ErrInvalidConstraintTemplate, err)
 	}
 
-	var mods []*ast.Module
-	for _, m := range sources.EntryPoints {
-		mods = append(mods, m.Module)
+	return sources, nil
+}
+
+// TemplateModules parses and rewrites the Rego in templ for each of its
+// targets exactly as AddTemplate does. Returns a map from target name to the
+// modules to compile for that target, keyed by module path, including the hook
+// module which Query evaluates.
+//
+// externs are the subpaths of "data" the Template may reference without
+// defining, for example "data.inventory".
+func TemplateModules(templ *templates.ConstraintTemplate, externs []string) (map[string]map[string]*ast.Module, error) {
+	mods, err := parseConstraintTemplate(templ, externs)
+	if err != nil {
+		return nil, err
 	}
-	for _, m := range sources.Libs {
-		mods = append(mods, m.Module)
+
+	result := make(map[string]map[string]*ast.Module, len(mods))
+	for target, targetMods := range mods {
+		result[target] = toModuleMap(targetMods)
 	}
 
-	return mods, nil
+	return result, nil
 }
 
-func compileTemplateTarget(module []*ast.Module, capabilities *ast.Capabilities, printEnabled bool) (*ast.Compiler, error) {
-	compiler := ast.NewCompiler().
-		WithCapabilities(capabilities).
-		WithEnablePrintStatements(printEnabled)
-
+// toModuleMap keys the Template's rewritten modules by path and adds the hook
+// module.
+func toModuleMap(module []*ast.Module) map[string]*ast.Module {
 	modules := make(map[string]*ast.Module, len(module)+1)
 	modules[hookModulePath] = hookModule
 
@@ -226,6 +300,16 @@ func compileTemplateTarget(module []*ast.Module, capabilities *ast.Capabilities,
 		modules[libPath] = lib
 	}
 
+	return modules
+}
+
+func compileTemplateTarget(module []*ast.Module, capabilities *ast.Capabilities, printEnabled bool) (*ast.Compiler, error) {
+	compiler := ast.NewCompiler().
+		WithCapabilities(capabilities).
+		WithEnablePrintStatements(printEnabled)
+
+	modules := toModuleMap(module)
+
 	compiler.Compile(modules)
 	if compiler.Failed() {
 		return nil, fmt.Errorf("%w: %v", clienterrors.ErrCompile, compiler.Errors)
@@ -0,0 +1,23 @@
+package rego
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/conformance"
+)
+
+func TestDriver_Conformance(t *testing.T) {
+	suite := conformance.RegoSuite(func(t *testing.T) drivers.Driver {
+		d, err := New()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return d
+	})
+	suite.Tracing = true
+	suite.Stats = []string{templateRunTimeNS, constraintCountName}
+
+	suite.Run(t)
+}
@@ -39,11 +39,18 @@ const (
 	constraintCountName        = "constraintCount"
 	constraintCountDescription = "the number of constraints that were evaluated for the given constraint kind"
 
+	externalDataCacheHitsName             = "externalDataCacheHits"
+	externalDataCacheHitsDescription      = "the number of times a cached external data response was used for the given provider"
+	externalDataCacheMissesName           = "externalDataCacheMisses"
+	externalDataCacheMissesDescription    = "the number of times no cached external data response was found for the given provider"
+	externalDataCacheEvictionsName        = "externalDataCacheEvictions"
+	externalDataCacheEvictionsDescription = "the number of cached external data responses evicted for the given provider"
+
 	tracingEnabledLabelName = "TracingEnabled"
 	printEnabledLabelName   = "PrintEnabled"
 )
 
-var _ drivers.Driver = &Driver{}
+var _ drivers.AnnotationsDriver = &Driver{}
 
 // Driver is a threadsafe Rego environment for compiling Rego in ConstraintTemplates,
 // registering Constraints, and executing queries.
@@ -51,6 +58,9 @@ type Driver struct {
 	// compilers is a store of Rego Compilers for each Template.
 	compilers Compilers
 
+	// preparedQueries caches queries prepared against each Template's compiler.
+	preparedQueries preparedQueries
+
 	// mtx guards access to the storage and target maps.
 	mtx sync.RWMutex
 
@@ -74,11 +84,26 @@ type Driver struct {
 	providerCache *externaldata.ProviderCache
 
 	// providerResponseCache allows to cache responses from external_data providers.
-	providerResponseCache *externaldata.ProviderResponseCache
+	providerResponseCache externaldata.ResponseCache
 
 	// sendRequestToProvider allows Rego to send requests to the provider specified in external_data.
 	sendRequestToProvider externaldata.SendRequestToProvider
 
+	// externalDataCoalescer, if set, merges concurrent requests to the same provider.
+	externalDataCoalescer *externaldata.Coalescer
+
+	// externalDataResilience retries, fails fast, and applies failure policies to
+	// requests according to each provider's spec.
+	externalDataResilience *externaldata.Resilience
+
+	// externalDataCredentialResolver resolves the secrets referenced by
+	// providers' auth.
+	externalDataCredentialResolver externaldata.CredentialResolver
+
+	// externalDataCredentialDirs are the directories providers may read
+	// credential files from.
+	externalDataCredentialDirs []string
+
 	// enableExternalDataClientAuth enables the injection of a TLS certificate into an HTTP client
 	// that is used to communicate with providers.
 	enableExternalDataClientAuth bool
@@ -88,6 +113,30 @@ type Driver struct {
 
 	// gatherStats controls whether the driver gathers any stats around its API calls.
 	gatherStats bool
+
+	// lintEnabled is whether Templates' references to input.parameters are
+	// checked against their parameter schema on AddTemplate.
+	lintEnabled bool
+
+	// lintReporter receives the issues found when linting each Template.
+	lintReporter LintReporter
+
+	// lintFailOnError is whether AddTemplate fails for Templates with
+	// error-level lint issues.
+	lintFailOnError bool
+
+	// annotations is a map from each Template's kind to the METADATA annotations
+	// declared in its Rego, keyed by target.
+	annotations map[string]map[string]*drivers.TemplateAnnotations
+
+	// annotationMetadataFields are the custom annotation fields copied into the
+	// Metadata of each violation.
+	annotationMetadataFields []string
+
+	// queryParallelism is the maximum number of Template kinds evaluated
+	// concurrently within a single call to Query. Values less than 2 evaluate
+	// kinds sequentially.
+	queryParallelism int
 }
 
 // Name returns the name of the driver.
@@ -114,7 +163,28 @@ func (d *Driver) AddTemplate(ctx context.Context, templ *templates.ConstraintTem
 	defer d.mtx.Unlock()
 
 	d.targets[kind] = targets
-	return d.compilers.addTemplate(templ, d.printEnabled)
+	compilers, err := d.compilers.compileTemplate(templ, d.printEnabled)
+	if err != nil {
+		return err
+	}
+
+	if d.lintEnabled {
+		issues := lintParameters(templ, compilers)
+		if d.lintReporter != nil {
+			d.lintReporter(kind, issues)
+		}
+
+		if d.lintFailOnError {
+			if err := lintErrors(kind, issues); err != nil {
+				return err
+			}
+		}
+	}
+
+	d.compilers.setTemplate(kind, compilers)
+	d.preparedQueries.removeKind(kind)
+	d.annotations[kind] = templateAnnotations(templ)
+	return nil
 }
 
 // RemoveTemplate removes all Compilers and Constraints for templ.
@@ -132,7 +202,9 @@ func (d *Driver) RemoveTemplate(ctx context.Context, templ *templates.Constraint
 	}
 
 	d.compilers.removeTemplate(kind)
+	d.preparedQueries.removeKind(kind)
 	delete(d.targets, kind)
+	delete(d.annotations, kind)
 	return nil
 }
 
@@ -202,13 +274,6 @@ func (d *Driver) eval(ctx context.Context, compiler *ast.Compiler, target string
 		opt(cfg)
 	}
 
-	queryPath := strings.Builder{}
-	queryPath.WriteString("data")
-	for _, p := range path {
-		queryPath.WriteString(".")
-		queryPath.WriteString(p)
-	}
-
 	store, err := d.storage.getStorage(ctx, target)
 	if err != nil {
 		return nil, nil, err
@@ -218,7 +283,7 @@ func (d *Driver) eval(ctx context.Context, compiler *ast.Compiler, target string
 		rego.Compiler(compiler),
 		rego.Store(store),
 		rego.ParsedInput(input),
-		rego.Query(queryPath.String()),
+		rego.Query(toQueryPath(path)),
 		rego.EnablePrintStatements(d.printEnabled),
 		rego.PrintHook(d.printHook),
 	}
@@ -241,6 +306,67 @@ func (d *Driver) eval(ctx context.Context, compiler *ast.Compiler, target string
 	return res, t, err
 }
 
+// evalPrepared runs a query against the compiler for kind, reusing the query
+// prepared for kind by a previous call if one exists.
+// Otherwise behaves identically to eval.
+func (d *Driver) evalPrepared(ctx context.Context, compiler *ast.Compiler, target string, kind string, path []string, input ast.Value, opts ...drivers.QueryOpt) (rego.ResultSet, *string, error) {
+	cfg := &drivers.QueryCfg{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	tracingEnabled := d.traceEnabled || cfg.TracingEnabled
+
+	key := preparedQueryKey{
+		target:         target,
+		kind:           kind,
+		path:           toQueryPath(path),
+		tracingEnabled: tracingEnabled,
+		printEnabled:   d.printEnabled,
+	}
+
+	query, found := d.preparedQueries.get(key, compiler)
+	if !found {
+		store, err := d.storage.getStorage(ctx, target)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		r := rego.New(
+			rego.Compiler(compiler),
+			rego.Store(store),
+			rego.Query(key.path),
+			rego.EnablePrintStatements(d.printEnabled),
+			rego.PrintHook(d.printHook),
+		)
+
+		query, err = r.PrepareForEval(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		d.preparedQueries.set(key, compiler, query)
+	}
+
+	evalOpts := []rego.EvalOption{rego.EvalParsedInput(input)}
+
+	buf := topdown.NewBufferTracer()
+	if tracingEnabled {
+		evalOpts = append(evalOpts, rego.EvalQueryTracer(buf))
+	}
+
+	res, err := query.Eval(ctx, evalOpts...)
+
+	var t *string
+	if tracingEnabled {
+		b := &bytes.Buffer{}
+		topdown.PrettyTrace(b, *buf)
+		t = ptr.To[string](b.String())
+	}
+
+	return res, t, err
+}
+
 func (d *Driver) Query(ctx context.Context, target string, constraints []*unstructured.Unstructured, review interface{}, opts ...drivers.QueryOpt) (*drivers.QueryResponse, error) {
 	if len(constraints) == 0 {
 		return nil, nil
@@ -248,15 +374,22 @@ func (d *Driver) Query(ctx context.Context, target string, constraints []*unstru
 
 	constraintsByKind := toConstraintsByKind(constraints)
 
+	// Evaluate kinds in a stable order so results, traces, and stats are merged
+	// deterministically regardless of whether kinds are evaluated in parallel.
+	kinds := make([]string, 0, len(constraintsByKind))
+	for kind := range constraintsByKind {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
 	traceBuilder := strings.Builder{}
 	constraintsMap := drivers.KeyMap(constraints)
-	path := []string{"hooks", "violation[result]"}
 
 	var results []*types.Result
 
-	// Round-trip review through JSON so that the review object is round-tripped
-	// once per call to Query instead of once per compiler.
-	reviewMap, err := toInterfaceMap(review)
+	// Convert review into a Rego Value once per call to Query instead of once
+	// per compiler.
+	reviewValue, err := toReviewValue(review)
 	if err != nil {
 		return nil, err
 	}
@@ -269,88 +402,56 @@ func (d *Driver) Query(ctx context.Context, target string, constraints []*unstru
 		opt(cfg)
 	}
 
-	var statsEntries []*instrumentation.StatsEntry
+	kindResults := make([]kindQueryResult, len(kinds))
+	queryKind := func(i int) {
+		kind := kinds[i]
+		kindResults[i] = d.queryKind(ctx, target, kind, constraintsByKind[kind], constraintsMap, reviewValue, cfg, opts...)
+	}
 
-	for kind, kindConstraints := range constraintsByKind {
-		evalStartTime := time.Now()
-		compiler := d.compilers.getCompiler(target, kind)
-		if compiler == nil {
-			// The Template was just removed, so the Driver is in an inconsistent
-			// state with Client. Raise this as an error rather than attempting to
-			// continue.
-			return nil, fmt.Errorf("missing Template %q for target %q", kind, target)
+	if d.queryParallelism > 1 && len(kinds) > 1 {
+		workers := d.queryParallelism
+		if workers > len(kinds) {
+			workers = len(kinds)
 		}
 
-		// Parse input into an ast.Value to avoid round-tripping through JSON when
-		// possible.
-		parsedInput, err := toParsedInput(target, kindConstraints, reviewMap)
-		if err != nil {
-			return nil, err
+		next := make(chan int)
+		wg := sync.WaitGroup{}
+		wg.Add(workers)
+		for w := 0; w < workers; w++ {
+			go func() {
+				defer wg.Done()
+				for i := range next {
+					queryKind(i)
+				}
+			}()
 		}
 
-		resultSet, trace, err := d.eval(ctx, compiler, target, path, parsedInput, opts...)
-		evalEndTime := time.Since(evalStartTime)
-		if err != nil {
-			resultSet = make(rego.ResultSet, 0, len(kindConstraints))
-			for _, constraint := range kindConstraints {
-				resultSet = append(resultSet, rego.Result{
-					Bindings: map[string]interface{}{
-						"result": map[string]interface{}{
-							"msg": err.Error(),
-							"key": map[string]interface{}{
-								"kind": constraint.GetKind(),
-								"name": constraint.GetName(),
-							},
-						},
-					},
-				})
-			}
+		for i := range kinds {
+			next <- i
 		}
-		if trace != nil {
-			traceBuilder.WriteString(*trace)
+		close(next)
+		wg.Wait()
+	} else {
+		for i := range kinds {
+			queryKind(i)
 		}
+	}
 
-		kindResults, err := drivers.ToResults(constraintsMap, resultSet)
-		if err != nil {
-			return nil, err
+	var statsEntries []*instrumentation.StatsEntry
+
+	for _, kindResult := range kindResults {
+		if kindResult.err != nil {
+			return nil, kindResult.err
 		}
 
-		results = append(results, kindResults...)
-
-		if d.gatherStats || (cfg != nil && cfg.StatsEnabled) {
-			statsEntries = append(statsEntries,
-				&instrumentation.StatsEntry{
-					Scope:    instrumentation.TemplateScope,
-					StatsFor: kind,
-					Stats: []*instrumentation.Stat{
-						{
-							Name:  templateRunTimeNS,
-							Value: uint64(evalEndTime.Nanoseconds()),
-							Source: instrumentation.Source{
-								Type:  instrumentation.EngineSourceType,
-								Value: schema.Name,
-							},
-						},
-						{
-							Name:  constraintCountName,
-							Value: len(kindConstraints),
-							Source: instrumentation.Source{
-								Type:  instrumentation.EngineSourceType,
-								Value: schema.Name,
-							},
-						},
-					},
-					Labels: []*instrumentation.Label{
-						{
-							Name:  tracingEnabledLabelName,
-							Value: d.traceEnabled || cfg.TracingEnabled,
-						},
-						{
-							Name:  printEnabledLabelName,
-							Value: d.printEnabled,
-						},
-					},
-				})
+		if kindResult.trace != nil {
+			traceBuilder.WriteString(*kindResult.trace)
+		}
+
+		results = append(results, kindResult.results...)
+
+		if kindResult.stats != nil {
+			statsEntries = append(statsEntries, kindResult.stats)
 		}
 	}
 
@@ -362,6 +463,99 @@ func (d *Driver) Query(ctx context.Context, target string, constraints []*unstru
 	return &drivers.QueryResponse{Results: results, StatsEntries: statsEntries}, nil
 }
 
+// kindQueryResult is the outcome of evaluating a single Template kind's
+// Constraints as part of a call to Query.
+type kindQueryResult struct {
+	results []*types.Result
+	trace   *string
+	stats   *instrumentation.StatsEntry
+	err     error
+}
+
+// queryKind evaluates the Constraints of a single kind against review.
+// Safe to call concurrently for different kinds while d.mtx is read-locked.
+func (d *Driver) queryKind(ctx context.Context, target string, kind string, kindConstraints []*unstructured.Unstructured, constraintsMap map[drivers.ConstraintKey]*unstructured.Unstructured, review ast.Value, cfg *drivers.QueryCfg, opts ...drivers.QueryOpt) kindQueryResult {
+	path := []string{"hooks", "violation[result]"}
+
+	evalStartTime := time.Now()
+	compiler := d.compilers.getCompiler(target, kind)
+	if compiler == nil {
+		// The Template was just removed, so the Driver is in an inconsistent
+		// state with Client. Raise this as an error rather than attempting to
+		// continue.
+		return kindQueryResult{err: fmt.Errorf("missing Template %q for target %q", kind, target)}
+	}
+
+	parsedInput := toParsedInput(target, kindConstraints, review)
+
+	resultSet, trace, err := d.evalPrepared(ctx, compiler, target, kind, path, parsedInput, opts...)
+	evalEndTime := time.Since(evalStartTime)
+	if err != nil {
+		resultSet = make(rego.ResultSet, 0, len(kindConstraints))
+		for _, constraint := range kindConstraints {
+			resultSet = append(resultSet, rego.Result{
+				Bindings: map[string]interface{}{
+					"result": map[string]interface{}{
+						"msg": err.Error(),
+						"key": map[string]interface{}{
+							"kind": constraint.GetKind(),
+							"name": constraint.GetName(),
+						},
+					},
+				},
+			})
+		}
+	}
+
+	results, err := drivers.ToResults(constraintsMap, resultSet)
+	if err != nil {
+		return kindQueryResult{err: err}
+	}
+
+	if len(d.annotationMetadataFields) > 0 {
+		addResultMetadata(results, d.annotations[kind][target], d.annotationMetadataFields)
+	}
+
+	out := kindQueryResult{results: results, trace: trace}
+
+	if d.gatherStats || (cfg != nil && cfg.StatsEnabled) {
+		out.stats = &instrumentation.StatsEntry{
+			Scope:    instrumentation.TemplateScope,
+			StatsFor: kind,
+			Stats: []*instrumentation.Stat{
+				{
+					Name:  templateRunTimeNS,
+					Value: uint64(evalEndTime.Nanoseconds()),
+					Source: instrumentation.Source{
+						Type:  instrumentation.EngineSourceType,
+						Value: schema.Name,
+					},
+				},
+				{
+					Name:  constraintCountName,
+					Value: len(kindConstraints),
+					Source: instrumentation.Source{
+						Type:  instrumentation.EngineSourceType,
+						Value: schema.Name,
+					},
+				},
+			},
+			Labels: []*instrumentation.Label{
+				{
+					Name:  tracingEnabledLabelName,
+					Value: d.traceEnabled || cfg.TracingEnabled,
+				},
+				{
+					Name:  printEnabledLabelName,
+					Value: d.printEnabled,
+				},
+			},
+		}
+	}
+
+	return out
+}
+
 func (d *Driver) Dump(ctx context.Context) (string, error) {
 	// we want to create:
 	// targetName.modules.kind.moduleName = contents
@@ -402,17 +596,76 @@ func (d *Driver) Dump(ctx context.Context) (string, error) {
 	return string(b), nil
 }
 
+// GetTemplateAnnotations returns the METADATA annotations declared in the Rego
+// of the Template for kind, keyed by target.
+func (d *Driver) GetTemplateAnnotations(kind string) (map[string]*drivers.TemplateAnnotations, error) {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+
+	annotations, found := d.annotations[kind]
+	if !found {
+		return nil, fmt.Errorf("%w: no Template for kind %q",
+			clienterrors.ErrMissingConstraintTemplate, kind)
+	}
+
+	result := make(map[string]*drivers.TemplateAnnotations, len(annotations))
+	for target, targetAnnotations := range annotations {
+		result[target] = targetAnnotations
+	}
+
+	return result, nil
+}
+
 func (d *Driver) GetDescriptionForStat(statName string) (string, error) {
 	switch statName {
 	case templateRunTimeNS:
 		return templateRunTimeNsDesc, nil
 	case constraintCountName:
 		return constraintCountDescription, nil
+	case externalDataCacheHitsName:
+		return externalDataCacheHitsDescription, nil
+	case externalDataCacheMissesName:
+		return externalDataCacheMissesDescription, nil
+	case externalDataCacheEvictionsName:
+		return externalDataCacheEvictionsDescription, nil
 	default:
 		return "", fmt.Errorf("unknown stat name")
 	}
 }
 
+// ExternalDataCacheStats returns, for each external data provider, the number
+// of hits, misses, and evictions in the external data response cache. Counts
+// are cumulative since the cache was created. Returns nil unless the Driver
+// caches external data responses.
+func (d *Driver) ExternalDataCacheStats() []*instrumentation.StatsEntry {
+	if d.providerResponseCache == nil {
+		return nil
+	}
+
+	stats := d.providerResponseCache.Stats()
+	providers := make([]string, 0, len(stats))
+	for provider := range stats {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	entries := make([]*instrumentation.StatsEntry, 0, len(providers))
+	for _, provider := range providers {
+		providerStats := stats[provider]
+		entries = append(entries, &instrumentation.StatsEntry{
+			Scope:    instrumentation.ProviderScope,
+			StatsFor: provider,
+			Stats: []*instrumentation.Stat{
+				{Name: externalDataCacheHitsName, Value: providerStats.Hits, Source: instrumentation.RegoSource},
+				{Name: externalDataCacheMissesName, Value: providerStats.Misses, Source: instrumentation.RegoSource},
+				{Name: externalDataCacheEvictionsName, Value: providerStats.Evictions, Source: instrumentation.RegoSource},
+			},
+		})
+	}
+
+	return entries
+}
+
 func (d *Driver) getTLSCertificate() (*tls.Certificate, error) {
 	if !d.enableExternalDataClientAuth {
 		return nil, nil
@@ -426,13 +679,17 @@ func (d *Driver) getTLSCertificate() (*tls.Certificate, error) {
 }
 
 // rewriteModulePackage rewrites the module's package path to path.
-func rewriteModulePackage(module *ast.Module) error {
+func rewriteModulePackage(module *ast.Module, path ast.Ref) error {
+	module.Package.Path = path
+	return nil
+}
+
+// templatePackage is the package the Template's entry point is moved to.
+func templatePackage() ast.Ref {
 	pathParts := ast.Ref([]*ast.Term{ast.VarTerm(templatePath)})
 
 	packageRef := ast.Ref([]*ast.Term{ast.VarTerm("data")})
-	newPath := packageRef.Extend(pathParts)
-	module.Package.Path = newPath
-	return nil
+	return packageRef.Extend(pathParts)
 }
 
 // requireModuleRules makes sure the module contains all of the specified
@@ -460,6 +717,42 @@ func requireModuleRules(module *ast.Module, requiredRules map[string]struct{}) e
 	return nil
 }
 
+// ValueConverter is implemented by reviews which can convert themselves into
+// Rego Values directly, avoiding a round-trip through JSON on every Query.
+type ValueConverter interface {
+	// ToRegoValue returns the review as a Rego Value. The returned Value must
+	// be equivalent to the review round-tripped through JSON, and must not be
+	// modified after it is returned.
+	ToRegoValue() (ast.Value, error)
+}
+
+// toReviewValue converts review into a Rego Value. Known types are converted
+// directly; other types are round-tripped through JSON.
+func toReviewValue(review interface{}) (ast.Value, error) {
+	switch r := review.(type) {
+	case ast.Value:
+		return r, nil
+	case ValueConverter:
+		return r.ToRegoValue()
+	case *unstructured.Unstructured:
+		if r == nil {
+			return ast.NewObject(), nil
+		}
+		return ast.InterfaceToValue(r.Object)
+	case unstructured.Unstructured:
+		return ast.InterfaceToValue(r.Object)
+	case map[string]interface{}:
+		return ast.InterfaceToValue(r)
+	default:
+		reviewMap, err := toInterfaceMap(review)
+		if err != nil {
+			return nil, err
+		}
+
+		return ast.InterfaceToValue(reviewMap)
+	}
+}
+
 func toInterfaceMap(obj interface{}) (map[string]interface{}, error) {
 	jsn, err := json.Marshal(obj)
 	if err != nil {
@@ -474,17 +767,29 @@ func toInterfaceMap(obj interface{}) (map[string]interface{}, error) {
 	return result, nil
 }
 
-func toKeySlice(constraints []*unstructured.Unstructured) []interface{} {
-	var keys []interface{}
-	for _, constraint := range constraints {
+// toQueryPath converts path into a query against data.
+func toQueryPath(path []string) string {
+	queryPath := strings.Builder{}
+	queryPath.WriteString("data")
+	for _, p := range path {
+		queryPath.WriteString(".")
+		queryPath.WriteString(p)
+	}
+
+	return queryPath.String()
+}
+
+func toKeySlice(constraints []*unstructured.Unstructured) *ast.Array {
+	keys := make([]*ast.Term, len(constraints))
+	for i, constraint := range constraints {
 		key := drivers.ConstraintKeyFrom(constraint)
-		keys = append(keys, map[string]interface{}{
-			"kind": key.Kind,
-			"name": key.Name,
-		})
+		keys[i] = ast.ObjectTerm(
+			[2]*ast.Term{ast.StringTerm("kind"), ast.StringTerm(key.Kind)},
+			[2]*ast.Term{ast.StringTerm("name"), ast.StringTerm(key.Name)},
+		)
 	}
 
-	return keys
+	return ast.NewArray(keys...)
 }
 
 func toConstraintsByKind(constraints []*unstructured.Unstructured) map[string][]*unstructured.Unstructured {
@@ -497,18 +802,12 @@ func toConstraintsByKind(constraints []*unstructured.Unstructured) map[string][]
 	return constraintsByKind
 }
 
-func toParsedInput(target string, constraints []*unstructured.Unstructured, review map[string]interface{}) (ast.Value, error) {
-	// Store constraint keys in a format InterfaceToValue does not need to
-	// round-trip through JSON.
-	constraintKeys := toKeySlice(constraints)
-
-	input := map[string]interface{}{
-		"target":      target,
-		"constraints": constraintKeys,
-		"review":      review,
-	}
-
-	// Parse input into an ast.Value to avoid round-tripping through JSON when
-	// possible.
-	return ast.InterfaceToValue(input)
+// toParsedInput builds the input for the hook module. review is shared, not
+// copied, between the inputs for each compiler.
+func toParsedInput(target string, constraints []*unstructured.Unstructured, review ast.Value) ast.Value {
+	return ast.NewObject(
+		[2]*ast.Term{ast.StringTerm("target"), ast.StringTerm(target)},
+		[2]*ast.Term{ast.StringTerm("constraints"), ast.NewTerm(toKeySlice(constraints))},
+		[2]*ast.Term{ast.StringTerm("review"), ast.NewTerm(review)},
+	)
 }
@@ -0,0 +1,142 @@
+package rego
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/handler/handlertest"
+	"github.com/open-policy-agent/opa/ast"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const benchModule = `
+package foobar
+
+violation[{"msg": msg}] {
+  some i
+  container := input.review.object.spec.containers[i]
+  not startswith(container.image, input.parameters.repo)
+  msg := sprintf("container <%v> has an invalid image repo <%v>", [container.name, container.image])
+}
+`
+
+// BenchmarkDriver_Query measures the latency of a single Query as the number of
+// Templates grows, with kinds evaluated sequentially and in parallel.
+//
+// Parallel evaluation only reduces latency when GOMAXPROCS is greater than 1.
+func BenchmarkDriver_Query(b *testing.B) {
+	ctx := context.Background()
+
+	review := map[string]interface{}{
+		"object": map[string]interface{}{
+			"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "foo", "image": "example.com/foo:latest"},
+					map[string]interface{}{"name": "bar", "image": "other.com/bar:latest"},
+				},
+			},
+		},
+	}
+
+	for _, templates := range []int{10, 100, 250} {
+		for _, workers := range []int{1, 4, 16} {
+			d, err := New(QueryParallelism(workers))
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			var constraints []*unstructured.Unstructured
+			for i := 0; i < templates; i++ {
+				kind := fmt.Sprintf("Fakes%d", i)
+
+				tmpl := cts.New(cts.OptName(strings.ToLower(kind)), cts.OptCRDNames(kind),
+					cts.OptTargets(cts.Target(cts.MockTargetHandler, benchModule)))
+				if err := d.AddTemplate(ctx, tmpl); err != nil {
+					b.Fatal(err)
+				}
+
+				constraint := cts.MakeConstraint(b, kind, "foo", cts.Set("example.com/", "spec", "parameters", "repo"))
+				if err := d.AddConstraint(ctx, constraint); err != nil {
+					b.Fatal(err)
+				}
+				constraints = append(constraints, constraint)
+			}
+
+			b.Run(fmt.Sprintf("%d Templates %d workers", templates, workers), func(b *testing.B) {
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					_, err := d.Query(ctx, cts.MockTargetHandler, constraints, review)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkToReviewValue compares converting reviews into Rego Values directly
+// with round-tripping them through JSON.
+func BenchmarkToReviewValue(b *testing.B) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":      "foo",
+			"namespace": "bar",
+			"labels": map[string]interface{}{
+				"app":  "foo",
+				"team": "bar",
+			},
+		},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "foo", "image": "example.com/foo:latest"},
+				map[string]interface{}{"name": "bar", "image": "other.com/bar:latest"},
+			},
+			"replicas": int64(3),
+		},
+	}}
+
+	reviews := []struct {
+		name   string
+		review interface{}
+	}{{
+		name:   "unstructured",
+		review: obj,
+	}, {
+		name:   "map",
+		review: map[string]interface{}{"object": obj.Object},
+	}, {
+		name:   "ValueConverter",
+		review: handlertest.NewReview("bar", "foo", "qux"),
+	}}
+
+	for _, tt := range reviews {
+		b.Run(tt.name+" json", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				reviewMap, err := toInterfaceMap(tt.review)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				_, err = ast.InterfaceToValue(reviewMap)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(tt.name+" direct", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := toReviewValue(tt.review)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
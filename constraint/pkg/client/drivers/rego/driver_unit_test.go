@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -646,6 +647,256 @@ func TestDriver_Query_Stats(t *testing.T) {
 	}
 }
 
+// TestDriver_Query_Parallel tests that evaluating kinds in parallel returns the
+// same results, in the same order, as evaluating them sequentially.
+func TestDriver_Query_Parallel(t *testing.T) {
+	ctx := context.Background()
+
+	prepareDriver := func(t *testing.T, args ...Arg) (*Driver, []*unstructured.Unstructured) {
+		d, err := New(args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var constraints []*unstructured.Unstructured
+		for i := 0; i < 20; i++ {
+			kind := fmt.Sprintf("Fakes%d", i)
+			rego := AlwaysViolate
+			if i%2 == 0 {
+				rego = NeverViolate
+			}
+
+			tmpl := cts.New(cts.OptName(strings.ToLower(kind)), cts.OptCRDNames(kind),
+				cts.OptTargets(cts.Target(cts.MockTargetHandler, rego)))
+			if err := d.AddTemplate(ctx, tmpl); err != nil {
+				t.Fatalf("got AddTemplate() error = %v, want %v", err, nil)
+			}
+
+			for j := 0; j < 3; j++ {
+				constraint := cts.MakeConstraint(t, kind, fmt.Sprintf("foo-%d", j))
+				if err := d.AddConstraint(ctx, constraint); err != nil {
+					t.Fatalf("got AddConstraint() error = %v, want %v", err, nil)
+				}
+				constraints = append(constraints, constraint)
+			}
+		}
+
+		return d, constraints
+	}
+
+	sequential, constraints := prepareDriver(t)
+	want, err := sequential.Query(ctx, cts.MockTargetHandler, constraints, map[string]interface{}{}, drivers.Stats(true))
+	if err != nil {
+		t.Fatalf("got sequential Query() error = %v, want %v", err, nil)
+	}
+
+	if len(want.Results) != 30 {
+		t.Fatalf("got %d results, want %d", len(want.Results), 30)
+	}
+
+	for _, workers := range []int{1, 2, 4, 32} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			parallel, _ := prepareDriver(t, QueryParallelism(workers))
+
+			got, err := parallel.Query(ctx, cts.MockTargetHandler, constraints, map[string]interface{}{}, drivers.Stats(true))
+			if err != nil {
+				t.Fatalf("got parallel Query() error = %v, want %v", err, nil)
+			}
+
+			if diff := cmp.Diff(want.Results, got.Results); diff != "" {
+				t.Error(diff)
+			}
+
+			if diff := cmp.Diff(want.StatsEntries, got.StatsEntries,
+				cmpopts.IgnoreFields(instrumentation.Stat{}, "Value")); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestDriver_QueryParallelism_Invalid(t *testing.T) {
+	_, err := New(QueryParallelism(0))
+	if !errors.Is(err, clienterrors.ErrCreatingDriver) {
+		t.Fatalf("got New() error = %v, want %v", err, clienterrors.ErrCreatingDriver)
+	}
+}
+
+func TestDriver_ExternalDataCredentialDirs_Invalid(t *testing.T) {
+	_, err := New(ExternalDataCredentialDirs("credentials"))
+	if !errors.Is(err, clienterrors.ErrCreatingDriver) {
+		t.Fatalf("got New() error = %v, want %v", err, clienterrors.ErrCreatingDriver)
+	}
+}
+
+// TestDriver_Query_PreparedQueries tests that prepared queries are reused
+// across calls to Query and invalidated when Templates change.
+func TestDriver_Query_PreparedQueries(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	countPrepared := func() int {
+		d.preparedQueries.mtx.RLock()
+		defer d.preparedQueries.mtx.RUnlock()
+
+		return len(d.preparedQueries.queries)
+	}
+
+	query := func(opts ...drivers.QueryOpt) int {
+		t.Helper()
+
+		qr, err := d.Query(ctx, cts.MockTargetHandler,
+			[]*unstructured.Unstructured{cts.MakeConstraint(t, "Fakes", "foo-1")},
+			map[string]interface{}{}, opts...)
+		if err != nil {
+			t.Fatalf("got Query() error = %v, want %v", err, nil)
+		}
+
+		return len(qr.Results)
+	}
+
+	tmpl := cts.New(cts.OptTargets(cts.Target(cts.MockTargetHandler, AlwaysViolate)))
+	if err := d.AddTemplate(ctx, tmpl); err != nil {
+		t.Fatalf("got AddTemplate() error = %v, want %v", err, nil)
+	}
+
+	if err := d.AddConstraint(ctx, cts.MakeConstraint(t, "Fakes", "foo-1")); err != nil {
+		t.Fatalf("got AddConstraint() error = %v, want %v", err, nil)
+	}
+
+	if got := query(); got != 1 {
+		t.Fatalf("got %d results, want %d", got, 1)
+	}
+
+	if got := query(); got != 1 {
+		t.Fatalf("got %d results on reused query, want %d", got, 1)
+	}
+
+	if got := countPrepared(); got != 1 {
+		t.Fatalf("got %d prepared queries, want %d", got, 1)
+	}
+
+	// Tracing is part of the cache key.
+	if got := query(drivers.Tracing(true)); got != 1 {
+		t.Fatalf("got %d results with tracing, want %d", got, 1)
+	}
+
+	if got := countPrepared(); got != 2 {
+		t.Fatalf("got %d prepared queries, want %d", got, 2)
+	}
+
+	// Replacing the Template must not reuse queries prepared for the old Rego.
+	tmpl = cts.New(cts.OptTargets(cts.Target(cts.MockTargetHandler, NeverViolate)))
+	if err := d.AddTemplate(ctx, tmpl); err != nil {
+		t.Fatalf("got AddTemplate() error = %v, want %v", err, nil)
+	}
+
+	if got := countPrepared(); got != 0 {
+		t.Fatalf("got %d prepared queries after AddTemplate, want %d", got, 0)
+	}
+
+	if got := query(); got != 0 {
+		t.Fatalf("got %d results after replacing Template, want %d", got, 0)
+	}
+
+	if err := d.RemoveTemplate(ctx, tmpl); err != nil {
+		t.Fatalf("got RemoveTemplate() error = %v, want %v", err, nil)
+	}
+
+	if got := countPrepared(); got != 0 {
+		t.Fatalf("got %d prepared queries after RemoveTemplate, want %d", got, 0)
+	}
+}
+
+// TestToReviewValue tests that converting reviews directly into Rego Values
+// gives the same result as round-tripping them through JSON.
+func TestToReviewValue(t *testing.T) {
+	tests := []struct {
+		name   string
+		review interface{}
+	}{{
+		name:   "nil",
+		review: nil,
+	}, {
+		name: "unstructured",
+		review: &unstructured.Unstructured{Object: map[string]interface{}{
+			"kind": "Pod",
+			"metadata": map[string]interface{}{
+				"name":   "foo",
+				"labels": map[string]interface{}{"app": "foo"},
+			},
+			"spec": map[string]interface{}{
+				"replicas":   int64(3),
+				"ratio":      0.5,
+				"containers": []interface{}{map[string]interface{}{"name": "foo"}},
+				"paused":     false,
+				"nothing":    nil,
+			},
+		}},
+	}, {
+		name: "map",
+		review: map[string]interface{}{
+			"object": map[string]interface{}{"foo": []interface{}{"bar", int64(1)}},
+		},
+	}, {
+		name:   "ValueConverter",
+		review: handlertest.NewReview("bar", "foo", "qux"),
+	}, {
+		name: "struct",
+		review: struct {
+			Foo string `json:"foo"`
+		}{Foo: "bar"},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reviewMap, err := toInterfaceMap(tt.review)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want, err := ast.InterfaceToValue(reviewMap)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := toReviewValue(tt.review)
+			if err != nil {
+				t.Fatalf("got toReviewValue() error = %v, want %v", err, nil)
+			}
+
+			if want.Compare(got) != 0 {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// failOnce returns a SendRequestToProvider which fails to reach the provider on
+// its first call, and returns a valid response afterward.
+func failOnce() externaldata.SendRequestToProvider {
+	calls := 0
+	return func(ctx context.Context, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate) (*externaldata.ProviderResponse, int, error) {
+		calls++
+		if calls == 1 {
+			return nil, http.StatusInternalServerError, errors.New("connection refused")
+		}
+
+		return &externaldata.ProviderResponse{
+			APIVersion: "v1beta1",
+			Kind:       "Provider",
+			Response: externaldata.Response{
+				Idempotent: true,
+				Items:      []externaldata.Item{{Key: "key", Value: "key_valid"}},
+			},
+		}, http.StatusOK, nil
+	}
+}
+
 func TestDriver_ExternalData(t *testing.T) {
 	for _, tt := range []struct {
 		name                  string
@@ -653,6 +904,7 @@ func TestDriver_ExternalData(t *testing.T) {
 		clientCertContent     string
 		clientKeyContent      string
 		sendRequestToProvider externaldata.SendRequestToProvider
+		args                  []Arg
 		errorExpected         bool
 	}{
 		{
@@ -710,6 +962,91 @@ func TestDriver_ExternalData(t *testing.T) {
 				}, http.StatusOK, nil
 			},
 		},
+		{
+			name: "valid response with coalescing",
+			provider: &unversioned.Provider{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy-provider",
+				},
+				Spec: unversioned.ProviderSpec{
+					URL:      "https://example.com",
+					Timeout:  1,
+					CABundle: caBundle,
+				},
+			},
+			clientCertContent: clientCert,
+			clientKeyContent:  clientKey,
+			sendRequestToProvider: func(ctx context.Context, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate) (*externaldata.ProviderResponse, int, error) {
+				return &externaldata.ProviderResponse{
+					APIVersion: "v1beta1",
+					Kind:       "Provider",
+					Response: externaldata.Response{
+						Idempotent: true,
+						Items: []externaldata.Item{
+							{
+								Key:   "key",
+								Value: "key_valid",
+							},
+						},
+					},
+				}, http.StatusOK, nil
+			},
+			args: []Arg{ExternalDataCoalescing(time.Millisecond, 10)},
+		},
+		{
+			name: "error with coalescing",
+			provider: &unversioned.Provider{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy-provider",
+				},
+				Spec: unversioned.ProviderSpec{
+					URL:      "https://example.com",
+					Timeout:  1,
+					CABundle: caBundle,
+				},
+			},
+			clientCertContent: clientCert,
+			clientKeyContent:  clientKey,
+			sendRequestToProvider: func(ctx context.Context, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate) (*externaldata.ProviderResponse, int, error) {
+				return nil, http.StatusBadRequest, errors.New("error from SendRequestToProvider")
+			},
+			args:          []Arg{ExternalDataCoalescing(time.Millisecond, 10)},
+			errorExpected: true,
+		},
+		{
+			name: "error retried with retry policy",
+			provider: &unversioned.Provider{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy-provider",
+				},
+				Spec: unversioned.ProviderSpec{
+					URL:         "https://example.com",
+					Timeout:     1,
+					CABundle:    caBundle,
+					RetryPolicy: &unversioned.RetryPolicy{MaxRetries: 1, InitialBackoffMilliseconds: 1, AssumeIdempotent: true},
+				},
+			},
+			clientCertContent:     clientCert,
+			clientKeyContent:      clientKey,
+			sendRequestToProvider: failOnce(),
+		},
+		{
+			name: "error without retry policy",
+			provider: &unversioned.Provider{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "dummy-provider",
+				},
+				Spec: unversioned.ProviderSpec{
+					URL:      "https://example.com",
+					Timeout:  1,
+					CABundle: caBundle,
+				},
+			},
+			clientCertContent:     clientCert,
+			clientKeyContent:      clientKey,
+			sendRequestToProvider: failOnce(),
+			errorExpected:         true,
+		},
 	} {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx, cancel := context.WithCancel(context.Background())
@@ -742,12 +1079,12 @@ func TestDriver_ExternalData(t *testing.T) {
 				_ = clientCertWatcher.Start(ctx)
 			}()
 
-			d, err := New(
+			d, err := New(append([]Arg{
 				AddExternalDataProviderCache(externaldata.NewCache()),
 				AddExternalDataProviderResponseCache(externaldata.NewProviderResponseCache(context.Background(), 1*time.Minute)),
 				EnableExternalDataClientAuth(),
 				AddExternalDataClientCertWatcher(clientCertWatcher),
-			)
+			}, tt.args...)...)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -791,6 +1128,107 @@ func TestDriver_ExternalData(t *testing.T) {
 	}
 }
 
+func TestDriver_ExternalDataCacheStats(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		responseCache *unversioned.ResponseCachePolicy
+		wantRequests  int
+		wantStats     externaldata.CacheStats
+	}{
+		{
+			// The cache's TTL is zero, so responses are never reused.
+			name:         "cache default TTL",
+			wantRequests: 2,
+			wantStats:    externaldata.CacheStats{Misses: 2, Evictions: 1},
+		},
+		{
+			name:          "provider TTL",
+			responseCache: &unversioned.ResponseCachePolicy{TTLSeconds: 60},
+			wantRequests:  1,
+			wantStats:     externaldata.CacheStats{Hits: 1, Misses: 1},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			d, err := New(
+				AddExternalDataProviderCache(externaldata.NewCache()),
+				ExternalDataResponseCache(externaldata.NewLRUProviderResponseCache(10, 0, 0)),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stats := d.ExternalDataCacheStats(); len(stats) != 0 {
+				t.Fatalf("got stats %v before any requests, want none", stats)
+			}
+
+			err = d.providerCache.Upsert(&unversioned.Provider{
+				ObjectMeta: metav1.ObjectMeta{Name: "dummy-provider"},
+				Spec: unversioned.ProviderSpec{
+					URL:           "https://example.com",
+					Timeout:       1,
+					CABundle:      caBundle,
+					ResponseCache: tt.responseCache,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			requests := 0
+			d.sendRequestToProvider = func(ctx context.Context, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate) (*externaldata.ProviderResponse, int, error) {
+				requests++
+				return &externaldata.ProviderResponse{
+					Response: externaldata.Response{
+						Idempotent: true,
+						Items:      []externaldata.Item{{Key: "key", Value: "key_valid"}},
+					},
+				}, http.StatusOK, nil
+			}
+
+			tmpl := cts.New(cts.OptTargets(cts.Target(cts.MockTargetHandler, ExternalData)))
+			if err := d.AddTemplate(ctx, tmpl); err != nil {
+				t.Fatal(err)
+			}
+			constraint := cts.MakeConstraint(t, "Fakes", "foo-1")
+			if err := d.AddConstraint(ctx, constraint); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				_, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, map[string]interface{}{"hi": "there"})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if requests != tt.wantRequests {
+				t.Errorf("got %d requests to provider, want %d", requests, tt.wantRequests)
+			}
+
+			want := []*instrumentation.StatsEntry{{
+				Scope:    instrumentation.ProviderScope,
+				StatsFor: "dummy-provider",
+				Stats: []*instrumentation.Stat{
+					{Name: externalDataCacheHitsName, Value: tt.wantStats.Hits, Source: instrumentation.RegoSource},
+					{Name: externalDataCacheMissesName, Value: tt.wantStats.Misses, Source: instrumentation.RegoSource},
+					{Name: externalDataCacheEvictionsName, Value: tt.wantStats.Evictions, Source: instrumentation.RegoSource},
+				},
+			}}
+			if diff := cmp.Diff(want, d.ExternalDataCacheStats()); diff != "" {
+				t.Error(diff)
+			}
+
+			for _, stat := range want[0].Stats {
+				if _, err := d.GetDescriptionForStat(stat.Name); err != nil {
+					t.Errorf("got GetDescriptionForStat(%q) error %v", stat.Name, err)
+				}
+			}
+		})
+	}
+}
+
 func TestDriver_AddTemplate(t *testing.T) {
 	testCases := []struct {
 		name          string
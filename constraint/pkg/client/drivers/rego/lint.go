@@ -0,0 +1,458 @@
+package rego
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"github.com/open-policy-agent/opa/ast"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+// LintSeverity is how serious a LintIssue is.
+type LintSeverity string
+
+const (
+	// LintWarning issues are likely mistakes, but do not prevent the Template
+	// from working as intended.
+	LintWarning LintSeverity = "warning"
+	// LintError issues reference parameters which can never be set by a valid
+	// Constraint.
+	LintError LintSeverity = "error"
+)
+
+const (
+	// LintUndeclaredParameter means the Template references a parameter its
+	// schema does not declare.
+	LintUndeclaredParameter = "undeclared_parameter"
+	// LintUnusedParameter means the schema declares a parameter the Template
+	// never references.
+	LintUnusedParameter = "unused_parameter"
+	// LintTypeMismatch means the Template accesses a parameter in a way its
+	// declared type does not allow, such as indexing into a string.
+	LintTypeMismatch = "type_mismatch"
+)
+
+// LintIssue is a problem found by comparing a Template's references to
+// input.parameters with the parameter schema it declares.
+type LintIssue struct {
+	Severity LintSeverity `json:"severity"`
+	Code     string       `json:"code"`
+	// Field is the path to the parameter relative to input.parameters, for
+	// example "labels[_].key".
+	Field   string `json:"field"`
+	Message string `json:"message"`
+	// Location is where the parameter is referenced in the Template's Rego.
+	// Nil for unused parameters.
+	Location *ast.Location `json:"location,omitempty"`
+}
+
+func (i LintIssue) String() string {
+	if i.Location == nil {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+
+	return fmt.Sprintf("%s:%d:%d: %s: %s", i.Location.File, i.Location.Row, i.Location.Col, i.Severity, i.Message)
+}
+
+// LintReporter receives the issues found when linting the Template for kind.
+type LintReporter func(kind string, issues []LintIssue)
+
+// lintParameters walks the Template's compiled Rego for references under
+// input.parameters and compares them with the Template's parameter schema.
+// Does not report anything for Templates without a parameter schema.
+func lintParameters(templ *templates.ConstraintTemplate, compilers map[string]*ast.Compiler) []LintIssue {
+	validation := templ.Spec.CRD.Spec.Validation
+	if validation == nil || validation.OpenAPIV3Schema == nil {
+		return nil
+	}
+
+	l := &linter{
+		schema: validation.OpenAPIV3Schema,
+		seen:   make(map[string]bool),
+	}
+
+	// Visit targets in a stable order so reported issues are deterministic.
+	var targets []string
+	for target := range compilers {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	for _, target := range targets {
+		compiler := compilers[target]
+
+		var names []string
+		for name := range compiler.Modules {
+			if name == hookModulePath {
+				continue
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			for _, rule := range compiler.Modules[name].Rules {
+				l.lintRule(rule)
+			}
+		}
+	}
+
+	l.lintUnused()
+
+	return l.issues
+}
+
+// parameterRef is a reference to a parameter, relative to input.parameters.
+type parameterRef struct {
+	path     ast.Ref
+	location *ast.Location
+}
+
+type linter struct {
+	schema *apiextensions.JSONSchemaProps
+
+	// used are the paths, relative to input.parameters, of every declared
+	// parameter the Template references.
+	used [][]string
+
+	// seen deduplicates issues reported for the same location.
+	seen map[string]bool
+
+	issues []LintIssue
+}
+
+func (l *linter) lintRule(rule *ast.Rule) {
+	// aliases maps local variables to the parameter path they are assigned,
+	// for example `params := input.parameters`.
+	aliases := make(map[ast.Var]ast.Ref)
+	// definitions are the expressions which define aliases.
+	definitions := make(map[*ast.Expr]parameterRef)
+
+	for r := rule; r != nil; r = r.Else {
+		ast.WalkExprs(r.Body, func(expr *ast.Expr) bool {
+			if !expr.IsEquality() && !expr.IsAssignment() {
+				return false
+			}
+
+			lhs, rhs := expr.Operand(0), expr.Operand(1)
+			if _, ok := rhs.Value.(ast.Var); ok {
+				lhs, rhs = rhs, lhs
+			}
+
+			v, ok := lhs.Value.(ast.Var)
+			if !ok {
+				return false
+			}
+
+			if ref, ok := l.resolve(rhs, aliases); ok {
+				aliases[v] = ref.path
+				definitions[expr] = ref
+			}
+
+			return false
+		})
+	}
+
+	vis := ast.NewGenericVisitor(func(x interface{}) bool {
+		switch x := x.(type) {
+		case *ast.Expr:
+			ref, isDefinition := definitions[x]
+			if !isDefinition {
+				return false
+			}
+
+			// Defining an alias does not use the parameter; only the alias's uses
+			// do.
+			l.lintRef(ref, false)
+			return true
+		case *ast.Term:
+			if v, isVar := x.Value.(ast.Var); isVar {
+				if alias, isAlias := aliases[v]; isAlias {
+					// The alias is used as a whole, for example passed to a function.
+					l.lintRef(parameterRef{path: alias, location: x.Location}, true)
+				}
+				return false
+			}
+
+			ref, ok := l.resolve(x, aliases)
+			if !ok {
+				return false
+			}
+
+			l.lintRef(ref, true)
+
+			// Do not also lint the terms within ref.
+			return true
+		}
+
+		return false
+	})
+	vis.Walk(rule)
+}
+
+// resolve returns the path relative to input.parameters that term references,
+// if any.
+func (l *linter) resolve(term *ast.Term, aliases map[ast.Var]ast.Ref) (parameterRef, bool) {
+	ref, ok := term.Value.(ast.Ref)
+	if !ok {
+		return parameterRef{}, false
+	}
+
+	if ref.HasPrefix(parametersRef) {
+		return parameterRef{path: ref[len(parametersRef):], location: term.Location}, true
+	}
+
+	head, ok := ref[0].Value.(ast.Var)
+	if !ok {
+		return parameterRef{}, false
+	}
+
+	alias, ok := aliases[head]
+	if !ok {
+		return parameterRef{}, false
+	}
+
+	path := make(ast.Ref, 0, len(alias)+len(ref)-1)
+	path = append(path, alias...)
+	path = append(path, ref[1:]...)
+
+	return parameterRef{path: path, location: term.Location}, true
+}
+
+var parametersRef = ast.MustParseRef("input.parameters")
+
+// lintRef checks a single reference against the schema. If use is true,
+// records which declared parameters it uses.
+func (l *linter) lintRef(ref parameterRef, use bool) {
+	schema := l.schema
+	var used []string
+
+	for i, term := range ref.path {
+		field := formatField(ref.path[:i+1])
+
+		if schema == nil || isUnconstrained(schema) {
+			// Anything may be referenced under an unconstrained field.
+			break
+		}
+
+		switch schema.Type {
+		case "array":
+			if _, isString := term.Value.(ast.String); isString {
+				l.report(LintError, LintTypeMismatch, field, ref.location,
+					fmt.Sprintf("parameter %q is an array and cannot be accessed by key %v", formatField(ref.path[:i]), term))
+				l.markUsed(used, use)
+				return
+			}
+
+			used = append(used, "[]")
+			if schema.Items == nil {
+				schema = nil
+			} else {
+				schema = schema.Items.Schema
+			}
+
+		case "string", "integer", "number", "boolean":
+			l.report(LintError, LintTypeMismatch, field, ref.location,
+				fmt.Sprintf("parameter %q is of type %s and cannot be accessed by %v", formatField(ref.path[:i]), schema.Type, term))
+			l.markUsed(used, use)
+			return
+
+		default:
+			key, isString := term.Value.(ast.String)
+			if !isString {
+				// The Template iterates over or dynamically indexes this object, so
+				// any of its properties may be used.
+				l.markUsed(used, use)
+				return
+			}
+
+			prop, found := schema.Properties[string(key)]
+			if found {
+				used = append(used, string(key))
+				schema = &prop
+				continue
+			}
+
+			if schema.AdditionalProperties != nil && schema.AdditionalProperties.Allows {
+				used = append(used, "*")
+				schema = schema.AdditionalProperties.Schema
+				continue
+			}
+
+			l.report(LintError, LintUndeclaredParameter, field, ref.location,
+				fmt.Sprintf("parameter %q is not declared in the Template's schema", field))
+			// Do not mark the enclosing object used, or a typo would hide its
+			// unused siblings.
+			return
+		}
+	}
+
+	l.markUsed(used, use)
+}
+
+func (l *linter) markUsed(path []string, use bool) {
+	if !use {
+		return
+	}
+
+	l.used = append(l.used, path)
+}
+
+// lintUnused reports declared parameters which are never referenced. Only the
+// outermost unused parameter of a subtree is reported.
+func (l *linter) lintUnused() {
+	var walk func(schema *apiextensions.JSONSchemaProps, path []string)
+	walk = func(schema *apiextensions.JSONSchemaProps, path []string) {
+		if schema == nil {
+			return
+		}
+
+		switch {
+		case schema.Type == "array" && schema.Items != nil:
+			walk(schema.Items.Schema, append(path, "[]"))
+		case len(schema.Properties) > 0:
+			var keys []string
+			for key := range schema.Properties {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				propPath := append(append([]string{}, path...), key)
+				if !l.isUsed(propPath) {
+					field := formatPath(propPath)
+					l.report(LintWarning, LintUnusedParameter, field, nil,
+						fmt.Sprintf("parameter %q is declared but never referenced", field))
+					continue
+				}
+
+				prop := schema.Properties[key]
+				walk(&prop, propPath)
+			}
+		}
+	}
+
+	walk(l.schema, nil)
+}
+
+// isUsed returns true if path, its descendants, or the whole of one of its
+// ancestors is referenced.
+func (l *linter) isUsed(path []string) bool {
+	for _, used := range l.used {
+		n := len(path)
+		if len(used) < n {
+			n = len(used)
+		}
+
+		matches := true
+		for i := 0; i < n; i++ {
+			if path[i] != used[i] {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *linter) report(severity LintSeverity, code, field string, location *ast.Location, msg string) {
+	key := fmt.Sprintf("%s/%s", code, field)
+	if location != nil {
+		key = fmt.Sprintf("%s/%s:%d:%d", key, location.File, location.Row, location.Col)
+	}
+
+	if l.seen[key] {
+		return
+	}
+	l.seen[key] = true
+
+	l.issues = append(l.issues, LintIssue{
+		Severity: severity,
+		Code:     code,
+		Field:    field,
+		Message:  msg,
+		Location: location,
+	})
+}
+
+// isUnconstrained returns true if schema allows arbitrary values beneath it.
+func isUnconstrained(schema *apiextensions.JSONSchemaProps) bool {
+	if schema.XPreserveUnknownFields != nil && *schema.XPreserveUnknownFields {
+		return true
+	}
+
+	switch schema.Type {
+	case "array", "string", "integer", "number", "boolean":
+		return false
+	case "object":
+		return len(schema.Properties) == 0 && schema.AdditionalProperties == nil
+	default:
+		return len(schema.Properties) == 0
+	}
+}
+
+// formatField formats a reference relative to input.parameters for display.
+func formatField(ref ast.Ref) string {
+	b := strings.Builder{}
+	for _, term := range ref {
+		switch v := term.Value.(type) {
+		case ast.String:
+			if b.Len() > 0 {
+				b.WriteString(".")
+			}
+			b.WriteString(string(v))
+		case ast.Var:
+			b.WriteString("[_]")
+		default:
+			b.WriteString(fmt.Sprintf("[%v]", v))
+		}
+	}
+
+	return b.String()
+}
+
+// formatPath formats a path of schema properties for display.
+func formatPath(path []string) string {
+	b := strings.Builder{}
+	for _, p := range path {
+		switch p {
+		case "[]":
+			b.WriteString("[_]")
+		case "*":
+			b.WriteString(".*")
+		default:
+			if b.Len() > 0 {
+				b.WriteString(".")
+			}
+			b.WriteString(p)
+		}
+	}
+
+	return b.String()
+}
+
+// lintErrors returns an error summarizing the issues with LintError severity,
+// or nil if there are none.
+func lintErrors(kind string, issues []LintIssue) error {
+	var msgs []string
+	for _, issue := range issues {
+		if issue.Severity == LintError {
+			msgs = append(msgs, issue.String())
+		}
+	}
+
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: parameters of %q do not match schema: %s",
+		clienterrors.ErrInvalidConstraintTemplate, kind, strings.Join(msgs, "; "))
+}
@@ -0,0 +1,208 @@
+package rego
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+func TestLintParameters(t *testing.T) {
+	schema := cts.PropMap{
+		"labels": {
+			Type: "array",
+			Items: &apiextensions.JSONSchemaPropsOrArray{
+				Schema: &apiextensions.JSONSchemaProps{
+					Type: "object",
+					Properties: map[string]apiextensions.JSONSchemaProps{
+						"key":          cts.PropTyped("string"),
+						"allowedRegex": cts.PropTyped("string"),
+					},
+				},
+			},
+		},
+		"message": cts.PropTyped("string"),
+		"extra":   cts.PropUnstructured(),
+	}
+
+	tests := []struct {
+		name   string
+		schema cts.PropMap
+		rego   string
+		want   []LintIssue
+	}{{
+		name:   "all parameters used",
+		schema: schema,
+		rego: `package foo
+
+violation[{"msg": msg}] {
+  label := input.parameters.labels[_]
+  not input.review.object.metadata.labels[label.key]
+  regex.match(label.allowedRegex, "")
+  msg := sprintf("%v %v", [input.parameters.message, input.parameters.extra.anything])
+}
+`,
+	}, {
+		name:   "undeclared and unused parameters",
+		schema: schema,
+		rego: `package foo
+
+violation[{"msg": msg}] {
+  input.parameters.labelsList[_] == "foo"
+  msg := input.parameters.message
+}
+`,
+		want: []LintIssue{{
+			Severity: LintError,
+			Code:     LintUndeclaredParameter,
+			Field:    "labelsList",
+		}, {
+			Severity: LintWarning,
+			Code:     LintUnusedParameter,
+			Field:    "extra",
+		}, {
+			Severity: LintWarning,
+			Code:     LintUnusedParameter,
+			Field:    "labels",
+		}},
+	}, {
+		name:   "unused nested parameter through alias",
+		schema: schema,
+		rego: `package foo
+
+violation[{"msg": msg}] {
+  params := input.parameters
+  label := params.labels[_]
+  label.key == "foo"
+  msg := sprintf("%v %v", [params.message, params.extra])
+}
+`,
+		want: []LintIssue{{
+			Severity: LintWarning,
+			Code:     LintUnusedParameter,
+			Field:    "labels[_].allowedRegex",
+		}},
+	}, {
+		name:   "type mismatches",
+		schema: schema,
+		rego: `package foo
+
+violation[{"msg": msg}] {
+  input.parameters.labels.key == "foo"
+  input.parameters.message.foo == "bar"
+  msg := sprintf("%v", [input.parameters.extra])
+}
+`,
+		want: []LintIssue{{
+			Severity: LintError,
+			Code:     LintTypeMismatch,
+			Field:    "labels.key",
+		}, {
+			Severity: LintError,
+			Code:     LintTypeMismatch,
+			Field:    "message.foo",
+		}},
+	}, {
+		name:   "whole parameters object used",
+		schema: schema,
+		rego: `package foo
+
+violation[{"msg": msg}] {
+  msg := sprintf("%v", [input.parameters])
+}
+`,
+	}, {
+		name:   "no schema properties",
+		schema: nil,
+		rego: `package foo
+
+violation[{"msg": msg}] {
+  msg := input.parameters.anything
+}
+`,
+	}, {
+		name:   "iteration over object",
+		schema: cts.PropMap{"foo": cts.PropTyped("string"), "bar": cts.PropTyped("string")},
+		rego: `package foo
+
+violation[{"msg": msg}] {
+  msg := input.parameters[_]
+}
+`,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []LintIssue
+			d, err := New(LintParameters(func(kind string, issues []LintIssue) {
+				got = issues
+			}, false))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opts := []cts.Opt{cts.OptTargets(cts.Target(cts.MockTargetHandler, tt.rego))}
+			if tt.schema != nil {
+				opts = append(opts, cts.OptCRDSchema(tt.schema))
+			}
+
+			err = d.AddTemplate(context.Background(), cts.New(opts...))
+			if err != nil {
+				t.Fatalf("got AddTemplate() error = %v, want %v", err, nil)
+			}
+
+			if diff := cmp.Diff(tt.want, got, cmpopts.EquateEmpty(),
+				cmpopts.IgnoreFields(LintIssue{}, "Message", "Location")); diff != "" {
+				t.Error(diff)
+			}
+
+			for _, issue := range got {
+				if issue.Code != LintUnusedParameter && issue.Location == nil {
+					t.Errorf("got nil Location for issue %v", issue)
+				}
+			}
+		})
+	}
+}
+
+func TestLintParameters_FailOnError(t *testing.T) {
+	ctx := context.Background()
+
+	d, err := New(LintParameters(nil, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := cts.New(
+		cts.OptCRDSchema(cts.PropMap{"foo": cts.PropTyped("string")}),
+		cts.OptTargets(cts.Target(cts.MockTargetHandler, `package foo
+
+violation[{"msg": msg}] {
+  msg := input.parameters.fooo
+}
+`)))
+
+	err = d.AddTemplate(ctx, tmpl)
+	if !errors.Is(err, clienterrors.ErrInvalidConstraintTemplate) {
+		t.Fatalf("got AddTemplate() error = %v, want %v", err, clienterrors.ErrInvalidConstraintTemplate)
+	}
+
+	if got := listCompilers(d); len(got) != 0 {
+		t.Errorf("got compilers %v after failed AddTemplate, want none", got)
+	}
+
+	// Unused parameters are only warnings.
+	tmpl = cts.New(
+		cts.OptCRDSchema(cts.PropMap{"foo": cts.PropTyped("string")}),
+		cts.OptTargets(cts.Target(cts.MockTargetHandler, AlwaysViolate)))
+
+	err = d.AddTemplate(ctx, tmpl)
+	if err != nil {
+		t.Fatalf("got AddTemplate() error = %v, want %v", err, nil)
+	}
+}
@@ -0,0 +1,72 @@
+package rego
+
+import (
+	"sync"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// preparedQueryKey identifies a prepared query for a Template.
+type preparedQueryKey struct {
+	target string
+	kind   string
+	path   string
+
+	tracingEnabled bool
+	printEnabled   bool
+}
+
+// preparedQuery is a query prepared against a specific Template's compiler.
+type preparedQuery struct {
+	// compiler is the compiler query was prepared against. A query is only
+	// reused if the Template's current compiler is identical.
+	compiler *ast.Compiler
+
+	query rego.PreparedEvalQuery
+}
+
+// preparedQueries is a threadsafe cache of prepared Rego queries, so queries
+// do not need to be planned again on every call to Query.
+type preparedQueries struct {
+	mtx sync.RWMutex
+
+	queries map[preparedQueryKey]*preparedQuery
+}
+
+// get returns the prepared query for key, if one exists and it was prepared
+// against compiler.
+func (p *preparedQueries) get(key preparedQueryKey, compiler *ast.Compiler) (rego.PreparedEvalQuery, bool) {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	prepared, found := p.queries[key]
+	if !found || prepared.compiler != compiler {
+		return rego.PreparedEvalQuery{}, false
+	}
+
+	return prepared.query, true
+}
+
+func (p *preparedQueries) set(key preparedQueryKey, compiler *ast.Compiler, query rego.PreparedEvalQuery) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.queries == nil {
+		p.queries = make(map[preparedQueryKey]*preparedQuery)
+	}
+
+	p.queries[key] = &preparedQuery{compiler: compiler, query: query}
+}
+
+// removeKind removes all prepared queries for the Template with kind.
+func (p *preparedQueries) removeKind(kind string) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for key := range p.queries {
+		if key.kind == kind {
+			delete(p.queries, key)
+		}
+	}
+}
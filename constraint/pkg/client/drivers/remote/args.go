@@ -0,0 +1,145 @@
+package remote
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+)
+
+const (
+	defaultRoot              = "gatekeeper"
+	defaultMaxRetries        = 3
+	defaultRetryBackoff      = 100 * time.Millisecond
+	defaultDataBatchSize     = 100
+	defaultDataBatchInterval = 100 * time.Millisecond
+)
+
+// validRoot matches roots which are valid as both Rego package names and
+// policy ID prefixes.
+var validRoot = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type Arg func(*Driver) error
+
+// URL sets the base URL of the OPA server, for example
+// "http://localhost:8181". Required.
+func URL(serverURL string) Arg {
+	return func(d *Driver) error {
+		u, err := url.Parse(serverURL)
+		if err != nil {
+			return fmt.Errorf("%w: invalid OPA server URL %q: %v",
+				clienterrors.ErrCreatingDriver, serverURL, err)
+		}
+
+		d.url = u
+
+		return nil
+	}
+}
+
+// Tracing enables tracing for all queries. If enabled, individual queries
+// cannot disable tracing.
+func Tracing(enabled bool) Arg {
+	return func(d *Driver) error {
+		d.traceEnabled = enabled
+
+		return nil
+	}
+}
+
+// HTTPClient sets the client used to make requests to the OPA server, for
+// example to configure TLS or authentication. Defaults to http.DefaultClient.
+func HTTPClient(client *http.Client) Arg {
+	return func(d *Driver) error {
+		d.client = client
+
+		return nil
+	}
+}
+
+// Root sets the top-level package and data document the Driver stores
+// Templates, Constraints, and data under in the OPA server. The Driver owns
+// everything under root, and clears it when created, so Drivers connected to
+// the same OPA server must use distinct roots. Defaults to "gatekeeper".
+func Root(root string) Arg {
+	return func(d *Driver) error {
+		if !validRoot.MatchString(root) {
+			return fmt.Errorf("%w: invalid root %q: must match %s",
+				clienterrors.ErrCreatingDriver, root, validRoot)
+		}
+
+		d.root = root
+
+		return nil
+	}
+}
+
+// Retries sets how many times requests which fail with transient errors are
+// retried, and how long to wait before the first retry. The wait doubles with
+// each subsequent retry. Defaults to 3 retries, starting at 100 milliseconds.
+func Retries(maxRetries int, backoff time.Duration) Arg {
+	return func(d *Driver) error {
+		if maxRetries < 0 || backoff < 0 {
+			return fmt.Errorf("%w: retries and backoff must not be negative, got %d and %v",
+				clienterrors.ErrCreatingDriver, maxRetries, backoff)
+		}
+
+		d.maxRetries = maxRetries
+		d.retryBackoff = backoff
+
+		return nil
+	}
+}
+
+// DataBatching sets how writes from AddData and RemoveData are batched. Writes
+// are sent to the OPA server once size writes are pending, or interval after
+// the first pending write, whichever is sooner. Pending writes are always sent
+// before a Query. A size of 1 sends each write as it is made. Defaults to
+// batches of up to 100 writes, sent at least every 100 milliseconds.
+func DataBatching(size int, interval time.Duration) Arg {
+	return func(d *Driver) error {
+		if size < 1 || interval <= 0 {
+			return fmt.Errorf("%w: batch size and interval must be positive, got %d and %v",
+				clienterrors.ErrCreatingDriver, size, interval)
+		}
+
+		d.data.batchSize = size
+		d.data.batchInterval = interval
+
+		return nil
+	}
+}
+
+// Externs sets the fields under `data` that Rego in ConstraintTemplates
+// can access. Defaults to "inventory", which is the only field supported.
+func Externs(externs ...string) Arg {
+	return func(d *Driver) error {
+		fields := make([]string, len(externs))
+
+		for i, field := range externs {
+			if field != inventory {
+				return fmt.Errorf("%w: invalid data field %q; allowed fields are: %v",
+					clienterrors.ErrCreatingDriver, field, []string{inventory})
+			}
+
+			fields[i] = fmt.Sprintf("data.%s", field)
+		}
+
+		d.externs = fields
+
+		return nil
+	}
+}
+
+// GatherStats starts collecting various stats around the
+// underlying engine's calls.
+func GatherStats() Arg {
+	return func(d *Driver) error {
+		d.gatherStats = true
+
+		return nil
+	}
+}
@@ -0,0 +1,19 @@
+package remote
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/conformance"
+)
+
+func TestDriver_Conformance(t *testing.T) {
+	suite := conformance.RegoSuite(func(t *testing.T) drivers.Driver {
+		d, _ := newFakeDriver(t)
+		return d
+	})
+	suite.Tracing = true
+	suite.Stats = []string{templateRunTimeNS, constraintCountName}
+
+	suite.Run(t)
+}
@@ -0,0 +1,325 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/opa/storage"
+)
+
+// patchOp is a JSON Patch operation on the OPA server's data.
+type patchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// write is a pending call to AddData or RemoveData.
+type write struct {
+	// path is the written path, relative to the store's inventory.
+	path storage.Path
+	// remove is whether the write removes path rather than adding data at it.
+	remove bool
+	data   interface{}
+
+	// op is the equivalent JSON Patch operation, relative to the store's
+	// inventory. Nil if the write has no effect.
+	op *patchOp
+	// unbatched is whether the write must be sent on its own because it is
+	// unknown whether the write's parents exist.
+	unbatched bool
+}
+
+// node is a path known to exist in the inventory stored in the OPA server.
+type node struct {
+	children map[string]*node
+	// opaque is whether the node was written as a whole by AddData, so which of
+	// its descendants exist is unknown.
+	opaque bool
+}
+
+// errClosed is returned when writing data after the Driver is closed.
+var errClosed = errors.New("driver is closed")
+
+// batcher batches writes to the inventory stored in the OPA server.
+//
+// JSON Patch operations fail if their parents do not exist, so batcher mirrors
+// which paths exist in the OPA server to create parents as needed. The Driver
+// owns its store, so the mirror only diverges if a batch is partially
+// applied or a write is dropped, in which case batcher falls back to
+// individual requests which create parents and ignore missing paths.
+type batcher struct {
+	batchSize     int
+	batchInterval time.Duration
+
+	// flush sends writes to the OPA server. Returns the writes which remain to
+	// be sent because of a transient failure and the error which caused it,
+	// and the errors of writes which were dropped because they can never
+	// succeed.
+	flush func(ctx context.Context, writes []*write) (unsent []*write, dropped, err error)
+
+	// mtx guards pending, tree, timer, dropped, and closed.
+	mtx     sync.Mutex
+	pending []*write
+	tree    *node
+	timer   *time.Timer
+	// dropped is the error from writes dropped by a flush no caller waited
+	// for, which is returned by the next call to send.
+	dropped error
+	closed  bool
+
+	// flushMtx serializes flushes so writes are applied in order.
+	flushMtx sync.Mutex
+}
+
+// enqueue records a write to be sent with the next batch. Sends the batch if it
+// is full. Only returns an error if w can't be enqueued: errors sending the
+// batch are returned by the next call to send, as they may belong to other
+// writes.
+func (b *batcher) enqueue(ctx context.Context, w *write) error {
+	b.mtx.Lock()
+	if b.closed {
+		b.mtx.Unlock()
+		return errClosed
+	}
+	b.apply(w)
+	b.pending = append(b.pending, w)
+	full := len(b.pending) >= b.batchSize
+	if !full && b.timer == nil {
+		b.timer = time.AfterFunc(b.batchInterval, b.sendScheduled)
+	}
+	b.mtx.Unlock()
+
+	if full {
+		b.sendDeferred(ctx)
+	}
+
+	return nil
+}
+
+// sendScheduled sends pending writes once the batch interval has passed.
+func (b *batcher) sendScheduled() {
+	b.sendDeferred(context.Background())
+}
+
+// sendDeferred sends pending writes without returning errors to the caller.
+// Writes which fail transiently remain pending and are retried by the next
+// flush. The errors of dropped writes are returned by the next call to send.
+func (b *batcher) sendDeferred(ctx context.Context) {
+	dropped, _ := b.sendPending(ctx)
+	if dropped == nil {
+		return
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.dropped = errors.Join(b.dropped, dropped)
+}
+
+// send sends all pending writes to the OPA server. Writes which fail
+// transiently remain pending. Writes the OPA server rejects are dropped, as
+// retrying them would fail every later flush, and are reported by the
+// returned error along with those dropped by scheduled flushes.
+func (b *batcher) send(ctx context.Context) error {
+	b.mtx.Lock()
+	previous := b.dropped
+	b.dropped = nil
+	b.mtx.Unlock()
+
+	dropped, err := b.sendPending(ctx)
+
+	return errors.Join(previous, dropped, err)
+}
+
+// sendPending sends all pending writes to the OPA server. Returns the errors of
+// dropped writes, and the error which caused any writes to remain pending.
+func (b *batcher) sendPending(ctx context.Context) (dropped, err error) {
+	b.flushMtx.Lock()
+	defer b.flushMtx.Unlock()
+
+	b.mtx.Lock()
+	writes := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mtx.Unlock()
+
+	if len(writes) == 0 {
+		return nil, nil
+	}
+
+	unsent, dropped, err := b.flush(ctx, writes)
+	if len(unsent) > 0 {
+		b.mtx.Lock()
+		b.pending = append(unsent, b.pending...)
+		b.mtx.Unlock()
+	}
+
+	return dropped, err
+}
+
+// close sends any pending writes, and stops scheduling flushes. Later writes
+// fail.
+func (b *batcher) close(ctx context.Context) error {
+	b.mtx.Lock()
+	b.closed = true
+	b.mtx.Unlock()
+
+	return b.send(ctx)
+}
+
+// apply updates the tree with the effect of w, and sets how w is sent.
+func (b *batcher) apply(w *write) {
+	parent := b.tree
+	for i, key := range w.path {
+		if parent.opaque {
+			// It is unknown whether the rest of the path exists.
+			w.unbatched = true
+			return
+		}
+
+		child, found := parent.children[key]
+		if found && i < len(w.path)-1 {
+			parent = child
+			continue
+		}
+
+		if w.remove {
+			if found {
+				delete(parent.children, key)
+				w.op = &patchOp{Op: "remove", Path: pointer(w.path)}
+			}
+			// Otherwise the path does not exist, so there is nothing to remove.
+			return
+		}
+
+		// Create the missing parents along with the data.
+		value := w.data
+		for j := len(w.path) - 1; j > i; j-- {
+			value = map[string]interface{}{w.path[j]: value}
+		}
+
+		for j := i; j < len(w.path); j++ {
+			if parent.children == nil {
+				parent.children = make(map[string]*node)
+			}
+			next := &node{}
+			parent.children[w.path[j]] = next
+			parent = next
+		}
+		parent.opaque = true
+
+		w.op = &patchOp{Op: "add", Path: pointer(w.path[:i+1]), Value: value}
+		return
+	}
+}
+
+// pointer returns path as a JSON Pointer.
+func pointer(path []string) string {
+	var sb strings.Builder
+	for _, p := range path {
+		sb.WriteString("/")
+		p = strings.ReplaceAll(p, "~", "~0")
+		sb.WriteString(strings.ReplaceAll(p, "/", "~1"))
+	}
+
+	return sb.String()
+}
+
+// flushData sends writes to the OPA server, batching consecutive writes which
+// can be expressed as JSON Patch operations into a single request. Stops at
+// the first transient failure, and returns the writes which remain to be sent.
+// Writes which fail permanently are dropped.
+func (d *Driver) flushData(ctx context.Context, writes []*write) ([]*write, error, error) {
+	base := []string{"data", d.root, storePath, inventory}
+
+	var dropped []error
+	// writeOne sends w on its own, dropping it if it fails permanently.
+	writeOne := func(w *write) error {
+		err := d.writeData(ctx, base, w)
+		if err == nil || isTransient(err) {
+			return err
+		}
+
+		dropped = append(dropped, fmt.Errorf("dropped write to %s: %w", pointer(w.path), err))
+		return nil
+	}
+
+	for len(writes) > 0 {
+		var ops []*patchOp
+		n := 0
+		for ; n < len(writes) && !writes[n].unbatched; n++ {
+			if writes[n].op != nil {
+				ops = append(ops, writes[n].op)
+			}
+		}
+
+		if n == 0 {
+			if err := writeOne(writes[0]); err != nil {
+				return writes, errors.Join(dropped...), err
+			}
+			writes = writes[1:]
+			continue
+		}
+
+		if len(ops) > 0 {
+			err := d.patchData(ctx, base, ops)
+			if statusCode(err) >= http.StatusBadRequest && statusCode(err) < http.StatusInternalServerError {
+				// The OPA server's data does not match the mirror, for example
+				// because a request which timed out was applied anyway, or a
+				// write in the batch is invalid. Individual writes are
+				// idempotent.
+				for i, w := range writes[:n] {
+					if err := writeOne(w); err != nil {
+						return writes[i:], errors.Join(dropped...), err
+					}
+				}
+			} else if err != nil {
+				return writes, errors.Join(dropped...), err
+			}
+		}
+
+		writes = writes[n:]
+	}
+
+	return nil, errors.Join(dropped...), nil
+}
+
+func (d *Driver) patchData(ctx context.Context, base []string, ops []*patchOp) error {
+	body, err := json.Marshal(ops)
+	if err != nil {
+		return fmt.Errorf("%w: %v", clienterrors.ErrWrite, err)
+	}
+
+	return d.do(ctx, &request{method: http.MethodPatch, path: base, contentType: contentTypePatch, body: body}, nil)
+}
+
+// writeData sends a single write to the OPA server. Adding data creates the
+// path's parents, and removing a path which does not exist succeeds.
+func (d *Driver) writeData(ctx context.Context, base []string, w *write) error {
+	path := append(base[:len(base):len(base)], w.path...)
+
+	if w.remove {
+		err := d.do(ctx, &request{method: http.MethodDelete, path: path}, nil)
+		if statusCode(err) == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+
+	req, err := jsonRequest(http.MethodPut, path, w.data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", clienterrors.ErrWrite, err)
+	}
+
+	return d.do(ctx, req, nil)
+}
@@ -0,0 +1,590 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/apis/constraints"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/rego/schema"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/instrumentation"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/types"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	templateRunTimeNS     = "templateRunTimeNS"
+	templateRunTimeNsDesc = "the number of nanoseconds it took to evaluate all constraints for a template, including the round trip to the OPA server"
+
+	constraintCountName        = "constraintCount"
+	constraintCountDescription = "the number of constraints that were evaluated for the given constraint kind"
+
+	tracingEnabledLabelName = "TracingEnabled"
+)
+
+var _ drivers.Driver = &Driver{}
+
+// Driver evaluates ConstraintTemplates' Rego in an OPA server, which it
+// manages through OPA's REST API.
+//
+// Templates are parsed and rewritten as the Rego Driver rewrites them, and
+// stored as policies beneath the Driver's root. Constraints' parameters and
+// data are stored in documents beneath the root. Data writes are batched.
+//
+// Templates are compiled by the OPA server rather than by the Driver, so unlike
+// the Rego Driver:
+//   - the OPA server's capabilities apply, so builtins disabled for the Rego
+//     Driver are available, and the external_data builtin is not.
+//   - Templates' METADATA annotations are not parsed, so the Driver does not
+//     implement drivers.AnnotationsDriver.
+type Driver struct {
+	url    *url.URL
+	client *http.Client
+
+	// root is the package and data document the Driver stores everything under.
+	root string
+
+	// externs are the subpaths of "data" which ConstraintTemplates are allowed to
+	// reference without being defined.
+	externs []string
+
+	// traceEnabled is whether tracing is enabled for queries by default.
+	// If enabled, individual queries cannot disable tracing.
+	traceEnabled bool
+
+	// gatherStats controls whether the driver gathers any stats around its API calls.
+	gatherStats bool
+
+	maxRetries   int
+	retryBackoff time.Duration
+
+	// generation distinguishes the modules of successive versions of each
+	// Template, so an updated Template's modules never conflict with the
+	// modules they replace.
+	generation uint64
+
+	// mtx guards templates and targets.
+	mtx sync.RWMutex
+
+	// templates is a map from each Template's kind to the modules stored for
+	// each of its targets.
+	templates map[string]map[string]*targetModules
+
+	// targets is a map from the ID used in paths for each target to the
+	// target's name.
+	targets map[string]string
+
+	data batcher
+}
+
+// Name returns the name of the driver. The Driver evaluates Templates' Rego
+// code, so it shares the Rego Driver's name.
+func (d *Driver) Name() string {
+	return schema.Name
+}
+
+// AddTemplate stores templ's modules in the OPA server, replacing the modules
+// of any previous version of templ.
+func (d *Driver) AddTemplate(ctx context.Context, templ *templates.ConstraintTemplate) error {
+	generation := fmt.Sprintf("g%d", atomic.AddUint64(&d.generation, 1))
+
+	modules, err := d.templateModules(templ, generation)
+	if err != nil {
+		return err
+	}
+
+	var stored [][]string
+	for _, target := range sortedKeys(modules) {
+		for _, p := range modules[target].policies {
+			err = d.putPolicy(ctx, p)
+			if err != nil {
+				// Remove the partially-stored Template. Modules left behind are
+				// removed the next time a Driver is created with this root.
+				for _, id := range stored {
+					_ = d.deletePolicy(ctx, id)
+				}
+
+				return err
+			}
+
+			stored = append(stored, p.id)
+		}
+	}
+
+	kind := templ.Spec.CRD.Spec.Names.Kind
+
+	d.mtx.Lock()
+	replaced := d.templates[kind]
+	d.templates[kind] = modules
+	for target := range modules {
+		d.targets[targetID(target)] = target
+	}
+	d.mtx.Unlock()
+
+	// The previous version's modules are no longer queried, so failing to
+	// remove them does not fail adding the Template.
+	d.deletePolicies(ctx, replaced)
+
+	return nil
+}
+
+// RemoveTemplate removes templ's modules and Constraints from the OPA server.
+// Returns nil if templ does not exist.
+func (d *Driver) RemoveTemplate(ctx context.Context, templ *templates.ConstraintTemplate) error {
+	kind := templ.Spec.CRD.Spec.Names.Kind
+
+	d.mtx.Lock()
+	removed := d.templates[kind]
+	delete(d.templates, kind)
+	d.mtx.Unlock()
+
+	for _, target := range sortedKeys(removed) {
+		path := []string{"data", d.root, storePath, constraintsPath, targetID(target), kind}
+		err := d.do(ctx, &request{method: http.MethodDelete, path: path}, nil)
+		if err != nil && statusCode(err) != http.StatusNotFound {
+			return fmt.Errorf("%w: %v", clienterrors.ErrWrite, err)
+		}
+	}
+
+	d.deletePolicies(ctx, removed)
+
+	return nil
+}
+
+func (d *Driver) putPolicy(ctx context.Context, p policy) error {
+	req := &request{
+		method:      http.MethodPut,
+		path:        append([]string{"policies"}, p.id...),
+		contentType: contentTypeRego,
+		body:        []byte(p.source),
+	}
+
+	err := d.do(ctx, req, nil)
+	if statusCode(err) == http.StatusBadRequest {
+		return fmt.Errorf("%w: %v", clienterrors.ErrCompile, err)
+	}
+
+	return err
+}
+
+func (d *Driver) deletePolicy(ctx context.Context, id []string) error {
+	err := d.do(ctx, &request{method: http.MethodDelete, path: append([]string{"policies"}, id...)}, nil)
+	if statusCode(err) == http.StatusNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// deletePolicies removes modules from the OPA server on a best-effort basis.
+// Modules which fail to be removed are removed the next time a Driver is
+// created with this root.
+func (d *Driver) deletePolicies(ctx context.Context, modules map[string]*targetModules) {
+	for _, target := range sortedKeys(modules) {
+		policies := modules[target].policies
+		// Remove the hooks and entry point before the libraries they import.
+		for i := len(policies) - 1; i >= 0; i-- {
+			_ = d.deletePolicy(ctx, policies[i].id)
+		}
+	}
+}
+
+// AddConstraint stores Constraint's parameters in the OPA server. Future calls
+// to Query will be evaluated against Constraint if the Constraint's key is
+// passed.
+func (d *Driver) AddConstraint(ctx context.Context, constraint *unstructured.Unstructured) error {
+	// Note that this discards "status" as we only copy spec.parameters.
+	params, _, err := unstructured.NestedFieldNoCopy(constraint.Object, "spec", "parameters")
+	if err != nil {
+		return fmt.Errorf("%w: %v", constraints.ErrInvalidConstraint, err)
+	}
+
+	// default .spec.parameters so that we don't need to default this in Rego.
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+
+	key := drivers.ConstraintKeyFrom(constraint)
+
+	for _, target := range d.templateTargets(key.Kind) {
+		req, err := jsonRequest(http.MethodPut, d.constraintPath(target, key), params)
+		if err != nil {
+			return fmt.Errorf("%w: %v", clienterrors.ErrWrite, err)
+		}
+
+		err = d.do(ctx, req, nil)
+		if err != nil {
+			return fmt.Errorf("%w: %v", clienterrors.ErrWrite, err)
+		}
+	}
+
+	return nil
+}
+
+// RemoveConstraint removes Constraint's parameters from the OPA server. Future
+// calls to Query will not be evaluated against the constraint.
+func (d *Driver) RemoveConstraint(ctx context.Context, constraint *unstructured.Unstructured) error {
+	key := drivers.ConstraintKeyFrom(constraint)
+
+	for _, target := range d.templateTargets(key.Kind) {
+		err := d.do(ctx, &request{method: http.MethodDelete, path: d.constraintPath(target, key)}, nil)
+		if err != nil && statusCode(err) != http.StatusNotFound {
+			return fmt.Errorf("%w: %v", clienterrors.ErrWrite, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Driver) constraintPath(target string, key drivers.ConstraintKey) []string {
+	return []string{"data", d.root, storePath, constraintsPath, targetID(target), key.Kind, key.Name}
+}
+
+// templateTargets returns the targets of the Template for kind.
+func (d *Driver) templateTargets(kind string) []string {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+
+	return sortedKeys(d.templates[kind])
+}
+
+// AddData adds data to the OPA server at data.inventory.path, as seen by
+// target's Templates. The write is batched, so AddData only returns an error if
+// data can't be encoded or the Driver is closed. Errors sending the write are
+// returned by the next call to Flush, Query, or Close.
+func (d *Driver) AddData(ctx context.Context, target string, path storage.Path, data interface{}) error {
+	// Encode data now so it is not affected by later changes by the caller.
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", clienterrors.ErrWrite, err)
+	}
+
+	err = d.data.enqueue(ctx, &write{path: d.inventoryPath(target, path), data: json.RawMessage(raw)})
+	if err != nil {
+		return fmt.Errorf("%w: %v", clienterrors.ErrWrite, err)
+	}
+
+	return nil
+}
+
+// RemoveData removes data from the OPA server at data.inventory.path, as seen
+// by target's Templates. The write is batched, so RemoveData only returns an
+// error if the Driver is closed. Errors sending the write are returned by the
+// next call to Flush, Query, or Close.
+func (d *Driver) RemoveData(ctx context.Context, target string, path storage.Path) error {
+	err := d.data.enqueue(ctx, &write{path: d.inventoryPath(target, path), remove: true})
+	if err != nil {
+		return fmt.Errorf("%w: %v", clienterrors.ErrWrite, err)
+	}
+
+	return nil
+}
+
+// inventoryPath returns the path data for target is written to, relative to
+// the inventory in the Driver's store.
+func (d *Driver) inventoryPath(target string, path storage.Path) storage.Path {
+	tid := targetID(target)
+
+	d.mtx.Lock()
+	d.targets[tid] = target
+	d.mtx.Unlock()
+
+	return append(storage.Path{tid}, path...)
+}
+
+// Flush sends any pending writes from AddData and RemoveData to the OPA
+// server. Returns the errors of writes the OPA server rejected since the
+// previous call to Flush, Query, or Close, which are dropped, and the error
+// which prevented sending any writes which remain pending.
+func (d *Driver) Flush(ctx context.Context) error {
+	err := d.data.send(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", clienterrors.ErrWrite, err)
+	}
+
+	return nil
+}
+
+// Close sends any pending writes from AddData and RemoveData to the OPA
+// server, and stops batching writes. Later calls to AddData and RemoveData
+// fail.
+func (d *Driver) Close(ctx context.Context) error {
+	err := d.data.close(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", clienterrors.ErrWrite, err)
+	}
+
+	return nil
+}
+
+func (d *Driver) Query(ctx context.Context, target string, constraints []*unstructured.Unstructured, review interface{}, opts ...drivers.QueryOpt) (*drivers.QueryResponse, error) {
+	if len(constraints) == 0 {
+		return nil, nil
+	}
+
+	cfg := &drivers.QueryCfg{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	// Queries observe all data written before they were made. Errors writing
+	// data fail the Query rather than being lost, as AddData and RemoveData
+	// defer them.
+	if err := d.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	constraintsByKind := make(map[string][]*unstructured.Unstructured)
+	for _, constraint := range constraints {
+		kind := constraint.GetKind()
+		constraintsByKind[kind] = append(constraintsByKind[kind], constraint)
+	}
+
+	constraintsMap := drivers.KeyMap(constraints)
+
+	var results []*types.Result
+	var statsEntries []*instrumentation.StatsEntry
+	traceBuilder := strings.Builder{}
+
+	for _, kind := range sortedKeys(constraintsByKind) {
+		kindConstraints := constraintsByKind[kind]
+
+		evalStartTime := time.Now()
+		resultSet, trace, err := d.queryKind(ctx, target, kind, kindConstraints, review, cfg)
+		evalEndTime := time.Since(evalStartTime)
+		if err != nil {
+			return nil, err
+		}
+
+		kindResults, err := drivers.ToResults(constraintsMap, resultSet)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, kindResults...)
+
+		if trace != nil {
+			traceBuilder.WriteString(*trace)
+		}
+
+		if d.gatherStats || cfg.StatsEnabled {
+			statsEntries = append(statsEntries, &instrumentation.StatsEntry{
+				Scope:    instrumentation.TemplateScope,
+				StatsFor: kind,
+				Stats: []*instrumentation.Stat{
+					{
+						Name:  templateRunTimeNS,
+						Value: uint64(evalEndTime.Nanoseconds()),
+						Source: instrumentation.Source{
+							Type:  instrumentation.EngineSourceType,
+							Value: schema.Name,
+						},
+					},
+					{
+						Name:  constraintCountName,
+						Value: len(kindConstraints),
+						Source: instrumentation.Source{
+							Type:  instrumentation.EngineSourceType,
+							Value: schema.Name,
+						},
+					},
+				},
+				Labels: []*instrumentation.Label{
+					{
+						Name:  tracingEnabledLabelName,
+						Value: d.traceEnabled || cfg.TracingEnabled,
+					},
+				},
+			})
+		}
+	}
+
+	traceString := traceBuilder.String()
+	if len(traceString) != 0 {
+		return &drivers.QueryResponse{Results: results, Trace: &traceString, StatsEntries: statsEntries}, nil
+	}
+
+	return &drivers.QueryResponse{Results: results, StatsEntries: statsEntries}, nil
+}
+
+// queryResponse is the OPA server's response to a query of a Template's
+// violations.
+type queryResponse struct {
+	Result      []map[string]interface{} `json:"result"`
+	Explanation json.RawMessage          `json:"explanation,omitempty"`
+}
+
+// queryKind evaluates the Constraints of a single kind against review in the
+// OPA server.
+func (d *Driver) queryKind(ctx context.Context, target string, kind string, kindConstraints []*unstructured.Unstructured, review interface{}, cfg *drivers.QueryCfg) (rego.ResultSet, *string, error) {
+	d.mtx.RLock()
+	modules := d.templates[kind][target]
+	d.mtx.RUnlock()
+
+	if modules == nil {
+		// The Template was just removed, so the Driver is in an inconsistent
+		// state with Client. Raise this as an error rather than attempting to
+		// continue.
+		return nil, nil, fmt.Errorf("missing Template %q for target %q", kind, target)
+	}
+
+	keys := make([]map[string]string, len(kindConstraints))
+	for i, constraint := range kindConstraints {
+		key := drivers.ConstraintKeyFrom(constraint)
+		keys[i] = map[string]string{"kind": key.Kind, "name": key.Name}
+	}
+
+	path := []string{"data"}
+	for _, term := range modules.hooks[1:] {
+		path = append(path, string(term.Value.(ast.String)))
+	}
+	path = append(path, violation)
+
+	req, err := jsonRequest(http.MethodPost, path, map[string]interface{}{
+		"input": map[string]interface{}{
+			"target":      target,
+			"constraints": keys,
+			"review":      review,
+		},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("encoding review: %w", err)
+	}
+
+	tracingEnabled := d.traceEnabled || cfg.TracingEnabled
+	if tracingEnabled {
+		req.query = url.Values{"explain": []string{"full"}, "pretty": []string{"true"}}
+	}
+
+	resp := &queryResponse{}
+	err = d.do(ctx, req, resp)
+	if statusCode(err) == http.StatusInternalServerError {
+		// The Template failed to evaluate, so report the error as a violation of
+		// each Constraint as the Rego Driver does.
+		resultSet := make(rego.ResultSet, 0, len(kindConstraints))
+		for _, key := range keys {
+			resultSet = append(resultSet, rego.Result{
+				Bindings: map[string]interface{}{
+					"result": map[string]interface{}{
+						"msg": err.Error(),
+						"key": map[string]interface{}{"kind": key["kind"], "name": key["name"]},
+					},
+				},
+			})
+		}
+
+		return resultSet, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	resultSet := make(rego.ResultSet, len(resp.Result))
+	for i, r := range resp.Result {
+		resultSet[i] = rego.Result{Bindings: map[string]interface{}{"result": r}}
+	}
+
+	var trace *string
+	if tracingEnabled {
+		t := explanation(resp.Explanation)
+		trace = &t
+	}
+
+	return resultSet, trace, nil
+}
+
+// explanation returns the trace of a query. The OPA server returns pretty
+// traces as lines of text.
+func explanation(raw json.RawMessage) string {
+	var lines []string
+	if err := json.Unmarshal(raw, &lines); err == nil {
+		return strings.Join(lines, "\n") + "\n"
+	}
+
+	return string(raw)
+}
+
+func (d *Driver) Dump(ctx context.Context) (string, error) {
+	// we want to create:
+	// targetName.modules.kind.moduleName = contents
+	// targetName.data = data
+	if err := d.Flush(ctx); err != nil {
+		return "", err
+	}
+
+	store := &struct {
+		Result map[string]map[string]interface{} `json:"result"`
+	}{}
+	err := d.do(ctx, &request{method: http.MethodGet, path: []string{"data", d.root, storePath}}, store)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", clienterrors.ErrRead, err)
+	}
+
+	dt := make(map[string]map[string]interface{})
+
+	d.mtx.RLock()
+	for kind, kindModules := range d.templates {
+		for target, modules := range kindModules {
+			if dt[target] == nil {
+				dt[target] = map[string]interface{}{"modules": make(map[string]map[string]string)}
+			}
+
+			sources := make(map[string]string, len(modules.policies))
+			for _, p := range modules.policies {
+				sources[policyID(p.id)] = p.source
+			}
+			dt[target]["modules"].(map[string]map[string]string)[kind] = sources
+		}
+	}
+
+	for tid, target := range d.targets {
+		if dt[target] == nil {
+			dt[target] = map[string]interface{}{"modules": make(map[string]map[string]string)}
+		}
+
+		dt[target]["data"] = map[string]interface{}{
+			inventory:       store.Result[inventory][tid],
+			constraintsPath: store.Result[constraintsPath][tid],
+		}
+	}
+	d.mtx.RUnlock()
+
+	b, err := json.MarshalIndent(dt, "", "   ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func (d *Driver) GetDescriptionForStat(statName string) (string, error) {
+	switch statName {
+	case templateRunTimeNS:
+		return templateRunTimeNsDesc, nil
+	case constraintCountName:
+		return constraintCountDescription, nil
+	default:
+		return "", fmt.Errorf("unknown stat name")
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,673 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/conformance"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/types"
+	"github.com/open-policy-agent/opa/storage"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	moduleParameters = `
+package foo
+
+violation[{"msg": msg}] {
+  msg := input.parameters.msg
+}
+`
+
+	moduleConflict = `
+package foo
+
+x = 1 { true }
+x = 2 { true }
+
+violation[{"msg": msg}] {
+  x == 1
+  msg := "unreachable"
+}
+`
+)
+
+func TestNew_NoURL(t *testing.T) {
+	_, err := New()
+	if !errors.Is(err, clienterrors.ErrCreatingDriver) {
+		t.Errorf("got error %v, want %v", err, clienterrors.ErrCreatingDriver)
+	}
+}
+
+func TestNew_Reset(t *testing.T) {
+	ctx := context.Background()
+	f, server := newFakeOPA(t)
+
+	d, err := New(URL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.AddTemplate(ctx, conformance.RegoTemplate(cts.ModuleDeny))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := New(URL(server.URL), Root("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = other.AddTemplate(ctx, conformance.RegoTemplate(cts.ModuleDeny))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Creating a Driver with the same root clears its predecessor's modules,
+	// but not those of other roots.
+	_, err = New(URL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range f.policyIDs() {
+		if !strings.HasPrefix(id, "other/") {
+			t.Errorf("got policy %q left from previous Driver", id)
+		}
+	}
+	if len(f.policyIDs()) == 0 {
+		t.Error("got other root's policies removed")
+	}
+}
+
+func TestDriver_Query(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newFakeDriver(t)
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(cts.ModuleDeny))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*types.Result{{
+		Msg:               "denied",
+		Constraint:        constraint,
+		EnforcementAction: "deny",
+		Metadata:          map[string]interface{}{"details": map[string]interface{}{}},
+	}}
+	if diff := cmp.Diff(want, resp.Results); diff != "" {
+		t.Error(diff)
+	}
+	if resp.Trace != nil {
+		t.Errorf("got trace %q, want none", *resp.Trace)
+	}
+
+	// Constraints which were never added are not evaluated.
+	got := conformance.QueryMessages(ctx, t, d, map[string]interface{}{}, cts.MakeConstraint(t, cts.MockTemplate, "bar"))
+	if len(got) != 0 {
+		t.Errorf("got results %v for Constraint which was not added", got)
+	}
+}
+
+func TestDriver_Query_Parameters(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newFakeDriver(t)
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(moduleParameters))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo", cts.Set("hello", "spec", "parameters", "msg"))
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"hello"}, conformance.QueryMessages(ctx, t, d, map[string]interface{}{}, constraint)); diff != "" {
+		t.Error(diff)
+	}
+
+	err = d.RemoveConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := conformance.QueryMessages(ctx, t, d, map[string]interface{}{}, constraint); len(got) != 0 {
+		t.Errorf("got results %v for removed Constraint", got)
+	}
+}
+
+func TestDriver_Query_Inventory(t *testing.T) {
+	ctx := context.Background()
+	d, f := newFakeDriver(t, DataBatching(100, time.Hour))
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(conformance.ModuleInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		err = d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", name}, map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = d.RemoveData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Removing data which does not exist succeeds.
+	err = d.RemoveData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Pod", "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Data for other targets is not visible to this target's Templates.
+	err = d.AddData(ctx, "other", storage.Path{"cluster", "v1", "Namespace", "e"}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := f.countRequests("PATCH", "/v1/data/"); got != 0 {
+		t.Errorf("got %d data writes before Query, want 0", got)
+	}
+
+	want := []string{"namespace a exists", "namespace c exists"}
+	if diff := cmp.Diff(want, conformance.QueryMessages(ctx, t, d, map[string]interface{}{}, constraint)); diff != "" {
+		t.Error(diff)
+	}
+
+	if got := f.countRequests("PATCH", "/v1/data/"); got != 1 {
+		t.Errorf("got %d data writes, want 1 batch", got)
+	}
+}
+
+func TestDriver_AddData_BatchSize(t *testing.T) {
+	ctx := context.Background()
+	d, f := newFakeDriver(t, DataBatching(2, time.Hour))
+
+	for _, name := range []string{"a", "b", "c"} {
+		err := d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", name}, map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := f.countRequests("PATCH", "/v1/data/"); got != 1 {
+		t.Errorf("got %d data writes, want 1 full batch", got)
+	}
+
+	err := d.Flush(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := f.countRequests("PATCH", "/v1/data/"); got != 2 {
+		t.Errorf("got %d data writes, want 2", got)
+	}
+}
+
+func TestDriver_AddData_BatchInterval(t *testing.T) {
+	ctx := context.Background()
+	d, f := newFakeDriver(t, DataBatching(100, time.Millisecond))
+
+	err := d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "a"}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for f.countRequests("PATCH", "/v1/data/") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("pending write was never sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDriver_AddData_Rejected(t *testing.T) {
+	ctx := context.Background()
+	d, f := newFakeDriver(t, DataBatching(100, time.Hour))
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(conformance.ModuleInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.mtx.Lock()
+	f.rejected = "bad"
+	f.mtx.Unlock()
+
+	for _, name := range []string{"a", "bad", "c"} {
+		err = d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", name}, map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = d.Flush(ctx)
+	if !errors.Is(err, clienterrors.ErrWrite) || !strings.Contains(err.Error(), "bad") {
+		t.Fatalf("got Flush() error = %v, want rejected write reported", err)
+	}
+
+	// The rejected write is dropped rather than retried by later flushes.
+	err = d.Flush(ctx)
+	if err != nil {
+		t.Fatalf("got Flush() error = %v, want %v", err, nil)
+	}
+
+	want := []string{"namespace a exists", "namespace c exists"}
+	if diff := cmp.Diff(want, conformance.QueryMessages(ctx, t, d, map[string]interface{}{}, constraint)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestDriver_AddData_RejectedScheduled(t *testing.T) {
+	ctx := context.Background()
+	d, f := newFakeDriver(t, DataBatching(100, time.Millisecond))
+
+	f.mtx.Lock()
+	f.rejected = "bad"
+	f.mtx.Unlock()
+
+	err := d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "bad"}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The batch and then the individual write are rejected.
+	deadline := time.Now().Add(10 * time.Second)
+	for f.countRequests("PUT", "/v1/data/") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("pending write was never sent")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The error is reported by the next flush once the scheduled flush
+	// completes.
+	deadline = time.Now().Add(10 * time.Second)
+	for {
+		err = d.Flush(ctx)
+		if err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("rejected write was never reported")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !errors.Is(err, clienterrors.ErrWrite) || !strings.Contains(err.Error(), "bad") {
+		t.Fatalf("got Flush() error = %v, want rejected write reported", err)
+	}
+
+	err = d.Flush(ctx)
+	if err != nil {
+		t.Fatalf("got Flush() error = %v, want %v", err, nil)
+	}
+}
+
+func TestDriver_AddData_RejectedFullBatch(t *testing.T) {
+	ctx := context.Background()
+	d, f := newFakeDriver(t, DataBatching(2, time.Hour))
+
+	f.mtx.Lock()
+	f.rejected = "bad"
+	f.mtx.Unlock()
+
+	// The second write fills the batch, which is sent but fails because of
+	// the first write. Neither AddData returns the error, as it may belong to
+	// a different write.
+	for _, name := range []string{"bad", "b"} {
+		err := d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", name}, map[string]interface{}{})
+		if err != nil {
+			t.Fatalf("got AddData(%q) error = %v, want %v", name, err, nil)
+		}
+	}
+
+	if got := f.countRequests("PUT", "/v1/data/"); got == 0 {
+		t.Error("got no individual writes, want full batch sent")
+	}
+
+	err := d.Flush(ctx)
+	if !errors.Is(err, clienterrors.ErrWrite) || !strings.Contains(err.Error(), "bad") {
+		t.Fatalf("got Flush() error = %v, want rejected write reported", err)
+	}
+}
+
+func TestDriver_Close(t *testing.T) {
+	ctx := context.Background()
+	d, f := newFakeDriver(t, DataBatching(100, time.Hour))
+
+	err := d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "a"}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := f.countRequests("PATCH", "/v1/data/"); got != 1 {
+		t.Errorf("got %d data writes, want pending writes sent by Close", got)
+	}
+
+	err = d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "b"}, map[string]interface{}{})
+	if !errors.Is(err, clienterrors.ErrWrite) {
+		t.Errorf("got AddData() error = %v, want %v", err, clienterrors.ErrWrite)
+	}
+}
+
+func TestDriver_AddData_Nested(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newFakeDriver(t, DataBatching(100, time.Hour))
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(conformance.ModuleInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Write whole documents, and then paths within them, which the Driver cannot
+	// know exist.
+	err = d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1"}, map[string]interface{}{
+		"Namespace": map[string]interface{}{"a": map[string]interface{}{}, "b": map[string]interface{}{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "c"}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.RemoveData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.RemoveData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"namespace b exists", "namespace c exists"}
+	if diff := cmp.Diff(want, conformance.QueryMessages(ctx, t, d, map[string]interface{}{}, constraint)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestDriver_AddTemplate_Libs(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newFakeDriver(t)
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(conformance.ModuleLib, conformance.LibMessages))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"denied by lib"}, conformance.QueryMessages(ctx, t, d, map[string]interface{}{}, constraint)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestDriver_AddTemplate_Errors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		rego    string
+		wantErr error
+	}{
+		{
+			name:    "parse error",
+			rego:    "package foo\nviolation[{",
+			wantErr: clienterrors.ErrInvalidConstraintTemplate,
+		},
+		{
+			name:    "missing violation",
+			rego:    "package foo\nallow := true",
+			wantErr: clienterrors.ErrInvalidConstraintTemplate,
+		},
+		{
+			name:    "compile error",
+			rego:    "package foo\nviolation[{\"msg\": msg}] {\n  msg := no_such_function(1)\n}",
+			wantErr: clienterrors.ErrCompile,
+		},
+		{
+			name:    "undeclared data reference",
+			rego:    "package foo\nviolation[{\"msg\": msg}] {\n  msg := data.other.msg\n}",
+			wantErr: clienterrors.ErrInvalidConstraintTemplate,
+		},
+		{
+			// The OPA server does not define the Rego Driver's external_data
+			// builtin.
+			name:    "external data",
+			rego:    "package foo\nviolation[{\"msg\": msg}] {\n  external_data({\"provider\": \"p\", \"keys\": [\"k\"]})\n  msg := \"denied\"\n}",
+			wantErr: clienterrors.ErrCompile,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			d, f := newFakeDriver(t)
+
+			err := d.AddTemplate(ctx, conformance.RegoTemplate(tc.rego))
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+
+			if got := f.policyIDs(); len(got) != 0 {
+				t.Errorf("got policies %v left by failed AddTemplate", got)
+			}
+		})
+	}
+}
+
+func TestDriver_AddTemplate_Replace(t *testing.T) {
+	ctx := context.Background()
+	d, f := newFakeDriver(t)
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(cts.ModuleDeny))
+	if err != nil {
+		t.Fatal(err)
+	}
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo", cts.Set("replaced", "spec", "parameters", "msg"))
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := f.policyIDs()
+
+	err = d.AddTemplate(ctx, conformance.RegoTemplate(moduleParameters))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]string{"replaced"}, conformance.QueryMessages(ctx, t, d, map[string]interface{}{}, constraint)); diff != "" {
+		t.Error(diff)
+	}
+
+	after := f.policyIDs()
+	if len(after) != len(before) || after[0] == before[0] {
+		t.Errorf("got policies %v after replacing %v, want only the new Template's", after, before)
+	}
+}
+
+func TestDriver_RemoveTemplate(t *testing.T) {
+	ctx := context.Background()
+	d, f := newFakeDriver(t)
+
+	templ := conformance.RegoTemplate(cts.ModuleDeny)
+	err := d.AddTemplate(ctx, templ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.RemoveTemplate(ctx, templ)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := f.policyIDs(); len(got) != 0 {
+		t.Errorf("got policies %v after removing Template", got)
+	}
+
+	_, err = d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, map[string]interface{}{})
+	if err == nil {
+		t.Error("got Query of removed Template error = nil, want error")
+	}
+
+	// Re-adding the Template does not restore its Constraints.
+	err = d.AddTemplate(ctx, templ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := conformance.QueryMessages(ctx, t, d, map[string]interface{}{}, constraint); len(got) != 0 {
+		t.Errorf("got results %v for Constraint of removed Template", got)
+	}
+}
+
+func TestDriver_Query_EvalError(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newFakeDriver(t)
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(moduleConflict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := conformance.QueryMessages(ctx, t, d, map[string]interface{}{}, constraint)
+	if len(got) != 1 || !strings.Contains(got[0], "conflict") {
+		t.Errorf("got results %v, want evaluation error", got)
+	}
+}
+
+func TestDriver_Query_Tracing(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newFakeDriver(t, Tracing(true), GatherStats())
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(cts.ModuleDeny))
+	if err != nil {
+		t.Fatal(err)
+	}
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Trace == nil || !strings.Contains(*resp.Trace, "Enter") {
+		t.Errorf("got trace %v, want trace of query", resp.Trace)
+	}
+	if len(resp.StatsEntries) != 1 || resp.StatsEntries[0].StatsFor != cts.MockTemplate {
+		t.Errorf("got stats %v, want stats for %q", resp.StatsEntries, cts.MockTemplate)
+	}
+}
+
+func TestDriver_Retries(t *testing.T) {
+	ctx := context.Background()
+	d, f := newFakeDriver(t)
+
+	f.mtx.Lock()
+	f.unavailable = 3
+	f.mtx.Unlock()
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(cts.ModuleDeny))
+	if err != nil {
+		t.Fatalf("got error %v, want transient failures retried", err)
+	}
+
+	f.mtx.Lock()
+	f.unavailable = 4
+	f.mtx.Unlock()
+
+	err = d.AddConstraint(ctx, cts.MakeConstraint(t, cts.MockTemplate, "foo"))
+	if !errors.Is(err, clienterrors.ErrWrite) || !strings.Contains(err.Error(), "503") {
+		t.Errorf("got error %v, want %v after retries", err, clienterrors.ErrWrite)
+	}
+
+	f.mtx.Lock()
+	f.unavailable = 4
+	f.mtx.Unlock()
+
+	_, err = d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{cts.MakeConstraint(t, cts.MockTemplate, "foo")}, map[string]interface{}{})
+	if !errors.Is(err, ErrRequest) {
+		t.Errorf("got error %v, want %v", err, ErrRequest)
+	}
+}
+
+func TestDriver_Dump(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newFakeDriver(t)
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(cts.ModuleDeny))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "a"}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dump, err := d.Dump(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{`"modules"`, `"Fakes"`, `denied`, `"inventory"`, `"Namespace"`} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("got dump without %s:\n%s", want, dump)
+		}
+	}
+}
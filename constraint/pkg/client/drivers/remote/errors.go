@@ -0,0 +1,59 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrRequest is returned when a request to the OPA server fails, either
+// because the server could not be reached or because it responded with an
+// error.
+var ErrRequest = errors.New("OPA server request failed")
+
+// serverError is an error response from the OPA server's REST API.
+type serverError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	// Errors holds the details of errors, such as the location of each
+	// compilation error in a policy.
+	Errors []serverErrorDetail `json:"errors,omitempty"`
+}
+
+type serverErrorDetail struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	Location *struct {
+		File string `json:"file"`
+		Row  int    `json:"row"`
+		Col  int    `json:"col"`
+	} `json:"location,omitempty"`
+}
+
+func (e *serverError) Error() string {
+	msg := fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+	for _, detail := range e.Errors {
+		if detail.Location != nil {
+			msg += fmt.Sprintf("; %s:%d:%d: %s", detail.Location.File, detail.Location.Row, detail.Location.Col, detail.Message)
+		} else {
+			msg += "; " + detail.Message
+		}
+	}
+
+	return msg
+}
+
+func (e *serverError) Unwrap() error {
+	return ErrRequest
+}
+
+// statusCode returns the HTTP status of the server's response if err is an
+// error response from the OPA server, and 0 otherwise.
+func statusCode(err error) int {
+	var serverErr *serverError
+	if errors.As(err, &serverErr) {
+		return serverErr.StatusCode
+	}
+
+	return 0
+}
@@ -0,0 +1,181 @@
+package remote
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/rego"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/format"
+)
+
+const (
+	violation = "violation"
+	inventory = "inventory"
+
+	// templatesPath is where Templates' modules are stored under the Driver's
+	// root, as templatesPath.<target>.<kind>.<generation>.
+	templatesPath = "templates"
+	// storePath is where Constraints and data are stored under the Driver's
+	// root, as storePath.constraints.<target> and storePath.inventory.<target>.
+	storePath       = "store"
+	constraintsPath = "constraints"
+
+	templateModule = "template"
+	hooksModule    = "hooks"
+	libsPackage    = "libs"
+
+	// hookModuleRego runs a Template's violation rule against each passed
+	// Constraint, as the hook module of the Rego Driver does. Unlike the Rego
+	// Driver, every target shares one data document, so the target's
+	// Constraints and inventory are read from beneath the Driver's store.
+	hookModuleRego = `package %[1]s
+
+violation[response] {
+  key := input.constraints[_]
+
+  inventory := object.get(%[2]s, %[3]q, {})
+  inp := {
+    "review": input.review,
+    "parameters": %[4]s[%[3]q][key.kind][key.name],
+  }
+
+  %[5]s.violation[r] with input as inp with data.inventory as inventory
+
+  response := {
+    "key": key,
+    "details": object.get(r, "details", {}),
+    "msg": r.msg,
+  }
+}
+`
+)
+
+// policy is a Rego module stored in the OPA server.
+type policy struct {
+	// id is the policy's ID, as path segments.
+	id     []string
+	source string
+}
+
+// targetModules are the modules for one target of a Template.
+type targetModules struct {
+	// hooks is the package which evaluates the Template's violations.
+	hooks    ast.Ref
+	policies []policy
+}
+
+// targetID returns the name used for target in package and data paths.
+// Characters which are not valid in Rego identifiers are replaced.
+func targetID(target string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, target)
+}
+
+// dataRef returns the reference to path beneath data.
+func dataRef(path ...string) ast.Ref {
+	ref := ast.Ref{ast.DefaultRootDocument}
+	for _, p := range path {
+		ref = append(ref, ast.StringTerm(p))
+	}
+
+	return ref
+}
+
+// packageName returns ref as it is written in a package declaration.
+func packageName(ref ast.Ref) string {
+	return strings.TrimPrefix((&ast.Package{Path: ref}).String(), "package ")
+}
+
+// templateModules parses templ and rewrites its modules so they do not conflict
+// with other Templates' modules, or other generations of templ's modules.
+// Returns the modules for each of templ's targets.
+func (d *Driver) templateModules(templ *templates.ConstraintTemplate, generation string) (map[string]*targetModules, error) {
+	kind := templ.Spec.CRD.Spec.Names.Kind
+
+	result := make(map[string]*targetModules, len(templ.Spec.Targets))
+	for i := range templ.Spec.Targets {
+		target := &templ.Spec.Targets[i]
+		tid := targetID(target.Target)
+
+		idPrefix := []string{d.root, tid, kind, generation}
+		pkg := dataRef(d.root, templatesPath, tid, kind, generation)
+
+		policies, err := d.parseTarget(target, pkg, idPrefix)
+		if err != nil {
+			return nil, err
+		}
+
+		hooks := pkg.Append(ast.StringTerm(hooksModule))
+		policies = append(policies, policy{
+			id: append(idPrefix[:len(idPrefix):len(idPrefix)], hooksModule),
+			source: fmt.Sprintf(hookModuleRego,
+				packageName(hooks),
+				dataRef(d.root, storePath, inventory),
+				tid,
+				dataRef(d.root, storePath, constraintsPath),
+				pkg.Append(ast.StringTerm(templateModule)),
+			),
+		})
+
+		result[target.Target] = &targetModules{hooks: hooks, policies: policies}
+	}
+
+	return result, nil
+}
+
+// parseTarget validates the Rego in target as the Rego Driver does, and
+// rewrites it to be beneath pkg.
+func (d *Driver) parseTarget(target *templates.Target, pkg ast.Ref, idPrefix []string) ([]policy, error) {
+	libPrefix := make([]string, 0, len(pkg))
+	for _, term := range pkg[1:] {
+		libPrefix = append(libPrefix, string(term.Value.(ast.String)))
+	}
+	libPrefix = append(libPrefix, libsPackage)
+
+	entryPoint, libs, err := rego.ParseTarget(target, pkg.Append(ast.StringTerm(templateModule)), strings.Join(libPrefix, "."), d.externs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Libraries are stored before the entry point which imports them.
+	policies := make([]policy, 0, len(libs)+1)
+	for i, m := range libs {
+		src, err := format.Ast(m)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", clienterrors.ErrInvalidConstraintTemplate, err)
+		}
+		policies = append(policies, policy{
+			id:     append(idPrefix[:len(idPrefix):len(idPrefix)], fmt.Sprintf("lib_%d", i)),
+			source: string(src),
+		})
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policyID(policies[i].id) < policyID(policies[j].id)
+	})
+
+	src, err := format.Ast(entryPoint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", clienterrors.ErrInvalidConstraintTemplate, err)
+	}
+	policies = append(policies, policy{
+		id:     append(idPrefix[:len(idPrefix):len(idPrefix)], templateModule),
+		source: string(src),
+	})
+
+	return policies, nil
+}
+
+// policyID returns id as the OPA server reports it.
+func policyID(id []string) string {
+	return strings.Join(id, "/")
+}
@@ -0,0 +1,90 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+)
+
+// initTimeout bounds how long New waits to prepare the OPA server.
+const initTimeout = 30 * time.Second
+
+// New constructs a Driver which evaluates ConstraintTemplates in the OPA server
+// at URL. Clears any Templates, Constraints, and data left under the Driver's
+// root by a previous Driver.
+func New(args ...Arg) (*Driver, error) {
+	d := &Driver{
+		client:       http.DefaultClient,
+		root:         defaultRoot,
+		externs:      []string{fmt.Sprintf("data.%s", inventory)},
+		maxRetries:   defaultMaxRetries,
+		retryBackoff: defaultRetryBackoff,
+		templates:    make(map[string]map[string]*targetModules),
+		targets:      make(map[string]string),
+	}
+	d.data.batchSize = defaultDataBatchSize
+	d.data.batchInterval = defaultDataBatchInterval
+
+	for _, arg := range args {
+		err := arg(d)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if d.url == nil {
+		return nil, fmt.Errorf("%w: the OPA server's URL must be set", clienterrors.ErrCreatingDriver)
+	}
+
+	d.data.tree = &node{}
+	d.data.flush = d.flushData
+
+	ctx, cancel := context.WithTimeout(context.Background(), initTimeout)
+	defer cancel()
+
+	if err := d.reset(ctx); err != nil {
+		return nil, fmt.Errorf("%w: %v", clienterrors.ErrCreatingDriver, err)
+	}
+
+	return d, nil
+}
+
+// reset removes the modules and data under the Driver's root in the OPA
+// server, and creates an empty store.
+func (d *Driver) reset(ctx context.Context) error {
+	policies := &struct {
+		Result []struct {
+			ID string `json:"id"`
+		} `json:"result"`
+	}{}
+	err := d.do(ctx, &request{method: http.MethodGet, path: []string{"policies"}}, policies)
+	if err != nil {
+		return err
+	}
+
+	prefix := d.root + "/"
+	for _, p := range policies.Result {
+		if !strings.HasPrefix(p.ID, prefix) {
+			continue
+		}
+
+		err = d.deletePolicy(ctx, strings.Split(p.ID, "/"))
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := jsonRequest(http.MethodPut, []string{"data", d.root, storePath}, map[string]interface{}{
+		inventory:       map[string]interface{}{},
+		constraintsPath: map[string]interface{}{},
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.do(ctx, req, nil)
+}
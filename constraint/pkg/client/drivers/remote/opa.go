@@ -0,0 +1,149 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	contentTypeJSON  = "application/json"
+	contentTypeRego  = "text/plain"
+	contentTypePatch = "application/json-patch+json"
+)
+
+// request is a request to the OPA server's REST API.
+type request struct {
+	method string
+	// path is the unescaped path segments after the API version, for example
+	// {"data", "gatekeeper", "store"}.
+	path  []string
+	query url.Values
+
+	contentType string
+	body        []byte
+}
+
+// do sends req to the OPA server, retrying transient failures, and decodes
+// the result into out if it is non-nil.
+func (d *Driver) do(ctx context.Context, req *request, out interface{}) error {
+	backoff := d.retryBackoff
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = d.doOnce(ctx, req, out)
+		if err == nil || attempt >= d.maxRetries || !isTransient(err) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ErrRequest, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	if statusCode(err) == 0 {
+		err = fmt.Errorf("%w: %v", ErrRequest, err)
+	}
+
+	return fmt.Errorf("%s %s: %w", req.method, d.endpoint(req).Path, err)
+}
+
+func (d *Driver) doOnce(ctx context.Context, req *request, out interface{}) error {
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, d.endpoint(req).String(), body)
+	if err != nil {
+		return err
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+
+	resp, err := d.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		serverErr := &serverError{}
+		if jsonErr := json.Unmarshal(respBody, serverErr); jsonErr != nil {
+			serverErr.Message = strings.TrimSpace(string(respBody))
+		}
+		serverErr.StatusCode = resp.StatusCode
+
+		return serverErr
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(respBody, out)
+}
+
+// endpoint returns the URL req is sent to.
+func (d *Driver) endpoint(req *request) *url.URL {
+	escaped := make([]string, len(req.path))
+	for i, segment := range req.path {
+		escaped[i] = url.PathEscape(segment)
+	}
+
+	u := *d.url
+	u.Path = strings.TrimSuffix(d.url.Path, "/") + "/v1/" + strings.Join(req.path, "/")
+	u.RawPath = strings.TrimSuffix(d.url.EscapedPath(), "/") + "/v1/" + strings.Join(escaped, "/")
+	u.RawQuery = req.query.Encode()
+
+	return &u
+}
+
+// isTransient returns true if err may not recur if the request is retried.
+func isTransient(err error) bool {
+	switch statusCode(err) {
+	case 0:
+		// The request did not reach the server, or its response was cut off.
+		return true
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// jsonRequest returns a request with body encoded as JSON.
+func jsonRequest(method string, path []string, body interface{}) (*request, error) {
+	req := &request{method: method, path: path}
+	if body == nil {
+		return req, nil
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req.body = b
+	req.contentType = contentTypeJSON
+
+	return req, nil
+}
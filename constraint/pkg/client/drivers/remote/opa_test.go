@@ -0,0 +1,324 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+	"github.com/open-policy-agent/opa/topdown"
+)
+
+// fakeOPA implements the subset of the OPA server's REST API used by Driver.
+type fakeOPA struct {
+	t *testing.T
+
+	mtx      sync.Mutex
+	policies map[string]*ast.Module
+	compiler *ast.Compiler
+	store    storage.Store
+
+	// unavailable is the number of upcoming requests to fail as if the server
+	// were temporarily unavailable.
+	unavailable int
+	// rejected is a key whose data writes are rejected as invalid, if set.
+	rejected string
+	// requests records the method and path of each request.
+	requests []string
+}
+
+func newFakeOPA(t *testing.T) (*fakeOPA, *httptest.Server) {
+	t.Helper()
+
+	f := &fakeOPA{
+		t:        t,
+		policies: make(map[string]*ast.Module),
+		compiler: ast.NewCompiler(),
+		store:    inmem.New(),
+	}
+
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+
+	return f, server
+}
+
+func newFakeDriver(t *testing.T, args ...Arg) (*Driver, *fakeOPA) {
+	t.Helper()
+
+	f, server := newFakeOPA(t)
+
+	d, err := New(append([]Arg{URL(server.URL), Retries(3, 0)}, args...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d, f
+}
+
+// countRequests returns the number of requests made with method to paths
+// beginning with prefix.
+func (f *fakeOPA) countRequests(method, prefix string) int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	n := 0
+	for _, r := range f.requests {
+		if strings.HasPrefix(r, method+" "+prefix) {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (f *fakeOPA) policyIDs() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	var ids []string
+	for id := range f.policies {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+func (f *fakeOPA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	if f.unavailable > 0 {
+		f.unavailable--
+		writeError(w, http.StatusServiceUnavailable, "unavailable", "try again")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/v1/policies":
+		f.listPolicies(w)
+	case strings.HasPrefix(r.URL.Path, "/v1/policies/"):
+		f.servePolicy(w, r.Method, strings.TrimPrefix(r.URL.Path, "/v1/policies/"), string(body))
+	case strings.HasPrefix(r.URL.Path, "/v1/data/"):
+		f.serveData(w, r, dataPath(strings.TrimPrefix(r.URL.Path, "/v1/data/")), body)
+	default:
+		writeError(w, http.StatusNotFound, "resource_not_found", r.URL.Path)
+	}
+}
+
+func dataPath(p string) storage.Path {
+	var path storage.Path
+	for _, segment := range strings.Split(p, "/") {
+		if segment != "" {
+			path = append(path, segment)
+		}
+	}
+
+	return path
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"code": code, "message": message})
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeOPA) listPolicies(w http.ResponseWriter) {
+	var result []map[string]string
+	for id := range f.policies {
+		result = append(result, map[string]string{"id": id})
+	}
+
+	writeResult(w, map[string]interface{}{"result": result})
+}
+
+func (f *fakeOPA) servePolicy(w http.ResponseWriter, method, id, source string) {
+	policies := make(map[string]*ast.Module, len(f.policies))
+	for k, v := range f.policies {
+		policies[k] = v
+	}
+
+	switch method {
+	case http.MethodPut:
+		module, err := ast.ParseModule(id, source)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+			return
+		}
+		policies[id] = module
+	case http.MethodDelete:
+		if _, found := policies[id]; !found {
+			writeError(w, http.StatusNotFound, "resource_not_found", id)
+			return
+		}
+		delete(policies, id)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "invalid_parameter", method)
+		return
+	}
+
+	compiler := ast.NewCompiler()
+	compiler.Compile(policies)
+	if compiler.Failed() {
+		writeError(w, http.StatusBadRequest, "invalid_parameter", compiler.Errors.Error())
+		return
+	}
+
+	f.policies = policies
+	f.compiler = compiler
+	writeResult(w, map[string]interface{}{})
+}
+
+func (f *fakeOPA) serveData(w http.ResponseWriter, r *http.Request, path storage.Path, body []byte) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		value, err := storage.ReadOne(ctx, f.store, path)
+		if err != nil {
+			writeResult(w, map[string]interface{}{})
+			return
+		}
+		writeResult(w, map[string]interface{}{"result": value})
+
+	case http.MethodPost:
+		f.query(w, r, path, body)
+
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		if f.rejected != "" && (strings.Contains(path.String(), f.rejected) || strings.Contains(string(body), f.rejected)) {
+			writeError(w, http.StatusBadRequest, "invalid_parameter", "rejected "+f.rejected)
+			return
+		}
+		err := storage.Txn(ctx, f.store, storage.WriteParams, func(txn storage.Transaction) error {
+			return f.write(ctx, txn, r.Method, path, body)
+		})
+		if storage.IsNotFound(err) {
+			writeError(w, http.StatusNotFound, "resource_not_found", err.Error())
+			return
+		} else if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "invalid_parameter", r.Method)
+	}
+}
+
+func (f *fakeOPA) write(ctx context.Context, txn storage.Transaction, method string, path storage.Path, body []byte) error {
+	switch method {
+	case http.MethodPut:
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			return err
+		}
+		if err := storage.MakeDir(ctx, f.store, txn, path[:len(path)-1]); err != nil {
+			return err
+		}
+		return f.store.Write(ctx, txn, storage.AddOp, path, value)
+
+	case http.MethodDelete:
+		return f.store.Write(ctx, txn, storage.RemoveOp, path, nil)
+
+	default:
+		var ops []struct {
+			Op    string      `json:"op"`
+			Path  string      `json:"path"`
+			Value interface{} `json:"value"`
+		}
+		if err := json.Unmarshal(body, &ops); err != nil {
+			return err
+		}
+
+		for _, op := range ops {
+			opPath, ok := storage.ParsePathEscaped(op.Path)
+			if !ok {
+				return fmt.Errorf("invalid path %q", op.Path)
+			}
+			opPath = append(path[:len(path):len(path)], opPath...)
+
+			switch op.Op {
+			case "add":
+				if err := f.store.Write(ctx, txn, storage.AddOp, opPath, op.Value); err != nil {
+					return err
+				}
+			case "remove":
+				if err := f.store.Write(ctx, txn, storage.RemoveOp, opPath, nil); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unsupported op %q", op.Op)
+			}
+		}
+		return nil
+	}
+}
+
+func (f *fakeOPA) query(w http.ResponseWriter, r *http.Request, path storage.Path, body []byte) {
+	var req struct {
+		Input interface{} `json:"input"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+		return
+	}
+
+	query := ast.Ref{ast.DefaultRootDocument}
+	for _, p := range path {
+		query = append(query, ast.StringTerm(p))
+	}
+
+	buf := topdown.NewBufferTracer()
+	explain := r.URL.Query().Get("explain") == "full"
+
+	args := []func(*rego.Rego){
+		rego.Compiler(f.compiler),
+		rego.Store(f.store),
+		rego.Query(query.String()),
+		rego.Input(req.Input),
+	}
+	if explain {
+		args = append(args, rego.QueryTracer(buf))
+	}
+
+	rs, err := rego.New(args...).Eval(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	result := map[string]interface{}{}
+	if len(rs) > 0 {
+		result["result"] = rs[0].Expressions[0].Value
+	}
+	if explain {
+		sb := &strings.Builder{}
+		topdown.PrettyTrace(sb, *buf)
+		result["explanation"] = strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n")
+	}
+
+	writeResult(w, result)
+}
@@ -0,0 +1,25 @@
+package wasm
+
+type Arg func(*Driver) error
+
+// GatherStats starts collecting stats for each Query.
+func GatherStats() Arg {
+	return func(d *Driver) error {
+		d.gatherStats = true
+
+		return nil
+	}
+}
+
+// MemoryLimitPages limits the memory each instance of a compiled Template may
+// use to pages 64KiB pages. Data for referential Constraints is copied into
+// every instance's memory, so the limit must account for its size. Each
+// Template has up to GOMAXPROCS instances. Defaults to the runtime's limit of
+// 4GiB.
+func MemoryLimitPages(pages uint32) Arg {
+	return func(d *Driver) error {
+		d.memoryLimitPages = pages
+
+		return nil
+	}
+}
@@ -0,0 +1,17 @@
+package wasm
+
+import (
+	"testing"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/conformance"
+)
+
+func TestDriver_Conformance(t *testing.T) {
+	suite := conformance.RegoSuite(func(t *testing.T) drivers.Driver {
+		return newDriver(t)
+	})
+	suite.Stats = []string{templateRunTimeNS, constraintCountName}
+
+	suite.Run(t)
+}
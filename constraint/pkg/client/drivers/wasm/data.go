@@ -0,0 +1,139 @@
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/open-policy-agent/opa/storage/inmem"
+)
+
+// The Driver keeps each target's data document in a Store in addition to the
+// memory of each of the target's policies. The Store is the source of truth
+// which new or discarded instances are loaded from, and validates writes
+// before they are applied to instances.
+
+func inventoryPath(path []string) storage.Path {
+	return append([]string{"inventory"}, path...)
+}
+
+func constraintsPath(kind string) storage.Path {
+	return storage.Path{"constraints", kind}
+}
+
+// getStorage returns the Store for target, creating it if it does not exist.
+// Must be called with d.mtx write-locked.
+func (d *Driver) getStorage(target string) storage.Store {
+	store, found := d.storage[target]
+	if !found {
+		// Round-tripping writes through JSON ensures the stored data is
+		// identical to what policies read.
+		store = inmem.NewFromObject(map[string]interface{}{
+			"constraints": map[string]interface{}{},
+			"inventory":   map[string]interface{}{},
+		})
+		d.storage[target] = store
+	}
+
+	return store
+}
+
+func addData(ctx context.Context, store storage.Store, path storage.Path, data interface{}) error {
+	if len(path) == 0 {
+		// Sanity-check path.
+		// This would overwrite "data", erasing all Constraints and stored objects.
+		return fmt.Errorf("%w: path must contain at least one path element: %+v", clienterrors.ErrPathInvalid, path)
+	}
+
+	txn, err := store.NewTransaction(ctx, storage.WriteParams)
+	if err != nil {
+		return fmt.Errorf("%w: %v", clienterrors.ErrTransaction, err)
+	}
+
+	// We can't write to a location if its parent doesn't exist.
+	_, err = store.Read(ctx, txn, path)
+	if storage.IsNotFound(err) {
+		err = storage.MakeDir(ctx, store, txn, path[:len(path)-1])
+		if err != nil {
+			store.Abort(ctx, txn)
+			return fmt.Errorf("%w: unable to make directory: %v", clienterrors.ErrWrite, err)
+		}
+	} else if err != nil {
+		store.Abort(ctx, txn)
+		return fmt.Errorf("%w: %v", clienterrors.ErrRead, err)
+	}
+
+	err = store.Write(ctx, txn, storage.AddOp, path, data)
+	if err != nil {
+		store.Abort(ctx, txn)
+		return fmt.Errorf("%w: unable to write data: %v", clienterrors.ErrWrite, err)
+	}
+
+	err = store.Commit(ctx, txn)
+	if err != nil {
+		return fmt.Errorf("%w: %v", clienterrors.ErrTransaction, err)
+	}
+
+	return nil
+}
+
+func removeData(ctx context.Context, store storage.Store, path storage.Path) error {
+	txn, err := store.NewTransaction(ctx, storage.WriteParams)
+	if err != nil {
+		return fmt.Errorf("%w: %v", clienterrors.ErrTransaction, err)
+	}
+
+	err = store.Write(ctx, txn, storage.RemoveOp, path, interface{}(nil))
+	if err != nil {
+		store.Abort(ctx, txn)
+		if storage.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("%w: unable to remove data: %v", clienterrors.ErrWrite, err)
+	}
+
+	err = store.Commit(ctx, txn)
+	if err != nil {
+		return fmt.Errorf("%w: %v", clienterrors.ErrTransaction, err)
+	}
+
+	return nil
+}
+
+// readData returns the value at path, or an empty object if there is none.
+func readData(ctx context.Context, store storage.Store, path storage.Path) (interface{}, error) {
+	value, err := storage.ReadOne(ctx, store, path)
+	if storage.IsNotFound(err) {
+		return map[string]interface{}{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %v", clienterrors.ErrRead, err)
+	}
+
+	return value, nil
+}
+
+// policyData returns the data document for the policy of kind in target: the
+// parameters of its Constraints and the target's inventory. Must be called with
+// d.mtx at least read-locked.
+func (d *Driver) policyData(ctx context.Context, target, kind string) ([]byte, error) {
+	// AddTemplate creates the Store for each of a Template's targets before
+	// creating its policies, so this always exists.
+	store := d.storage[target]
+
+	constraints, err := readData(ctx, store, constraintsPath(kind))
+	if err != nil {
+		return nil, err
+	}
+
+	inventory, err := readData(ctx, store, inventoryPath(nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"constraints": map[string]interface{}{kind: constraints},
+		"inventory":   inventory,
+	})
+}
@@ -0,0 +1,492 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/apis/constraints"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	regodriver "github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/rego"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/rego/schema"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/instrumentation"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/types"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/tetratelabs/wazero"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	templateRunTimeNS     = "templateRunTimeNS"
+	templateRunTimeNsDesc = "the number of nanoseconds it took to evaluate all constraints for a template"
+
+	constraintCountName        = "constraintCount"
+	constraintCountDescription = "the number of constraints that were evaluated for the given constraint kind"
+)
+
+// tracingUnsupported is returned as the trace of queries with tracing enabled.
+const tracingUnsupported = "tracing is not supported by the Wasm driver"
+
+// externs are the subpaths of data Templates may reference without defining.
+var externs = []string{"data.inventory"}
+
+var _ drivers.Driver = &Driver{}
+
+// Driver is a threadsafe Rego driver which compiles each ConstraintTemplate to
+// a WebAssembly policy with OPA's Wasm compiler and evaluates it in wazero, a
+// pure-Go Wasm runtime.
+//
+// Rego builtins which OPA does not compile into Wasm, such as sprintf, are
+// implemented by calling OPA's Go implementations, including any registered
+// with rego.RegisterBuiltin1 and friends. Templates which call builtins that
+// have no Go implementation fail to be added with ErrUnsupportedBuiltin.
+// Tracing and print statements are not supported: Query returns a note in
+// place of a trace when passed drivers.Tracing.
+//
+// Each compiled Template evaluates up to GOMAXPROCS queries at a time, with an
+// instance per query. Each instance holds its own copy of Constraint
+// parameters and referential data.
+type Driver struct {
+	// mtx guards access to policies, targets, and storage.
+	mtx sync.RWMutex
+
+	// policies is a map from target name to a map from Template kind to the
+	// Template compiled for that target.
+	policies map[string]map[string]*policy
+
+	// targets is a map from each Template's kind to the targets for that Template.
+	targets map[string][]string
+
+	// storage is a map from target name to the data document for that target.
+	storage map[string]storage.Store
+
+	// runtimeConfig configures the runtime each policy is instantiated in.
+	runtimeConfig wazero.RuntimeConfig
+
+	// memoryLimitPages is the maximum number of memory pages each policy may use.
+	// Zero means the runtime's default.
+	memoryLimitPages uint32
+
+	// gatherStats controls whether the driver gathers any stats around its API calls.
+	gatherStats bool
+}
+
+// Name returns the name of the driver. The Driver evaluates the Rego code of
+// Templates, so it shares the Rego driver's name.
+func (d *Driver) Name() string {
+	return schema.Name
+}
+
+// AddTemplate compiles templ to Wasm for each of its targets, replacing any
+// previous version of templ.
+func (d *Driver) AddTemplate(ctx context.Context, templ *templates.ConstraintTemplate) error {
+	modules, err := regodriver.TemplateModules(templ, externs)
+	if err != nil {
+		return err
+	}
+
+	kind := templ.Spec.CRD.Spec.Names.Kind
+
+	// Compile outside the lock since it is expensive.
+	policies := make(map[string]*policy, len(modules))
+	for target, targetModules := range modules {
+		p, err := newPolicy(ctx, d.runtimeConfig, targetModules)
+		if err != nil {
+			closePolicies(ctx, policies)
+			return err
+		}
+
+		policies[target] = p
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	targets := make([]string, 0, len(policies))
+	for target, p := range policies {
+		d.getStorage(target)
+
+		data, err := d.policyData(ctx, target, kind)
+		if err == nil {
+			err = p.reset(ctx, data)
+		}
+		if err != nil {
+			closePolicies(ctx, policies)
+			return err
+		}
+
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	d.removePolicies(ctx, kind)
+	for target, p := range policies {
+		targetPolicies := d.policies[target]
+		if targetPolicies == nil {
+			targetPolicies = make(map[string]*policy)
+			d.policies[target] = targetPolicies
+		}
+
+		targetPolicies[kind] = p
+	}
+	d.targets[kind] = targets
+
+	return nil
+}
+
+// RemoveTemplate removes the compiled policies and Constraints for templ.
+// Returns nil if templ does not exist.
+func (d *Driver) RemoveTemplate(ctx context.Context, templ *templates.ConstraintTemplate) error {
+	kind := templ.Spec.CRD.Spec.Names.Kind
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	for _, store := range d.storage {
+		if err := removeData(ctx, store, constraintsPath(kind)); err != nil {
+			return err
+		}
+	}
+
+	d.removePolicies(ctx, kind)
+	delete(d.targets, kind)
+
+	return nil
+}
+
+// removePolicies closes and removes the policies for kind. Must be called with
+// d.mtx locked.
+func (d *Driver) removePolicies(ctx context.Context, kind string) {
+	for _, targetPolicies := range d.policies {
+		if p, found := targetPolicies[kind]; found {
+			p.close(ctx)
+			delete(targetPolicies, kind)
+		}
+	}
+}
+
+// AddConstraint adds constraint's parameters to the data of its Template's
+// policies.
+func (d *Driver) AddConstraint(ctx context.Context, constraint *unstructured.Unstructured) error {
+	// Note that this discards "status" as we only copy spec.parameters.
+	params, _, err := unstructured.NestedFieldNoCopy(constraint.Object, "spec", "parameters")
+	if err != nil {
+		return fmt.Errorf("%w: %v", constraints.ErrInvalidConstraint, err)
+	}
+
+	// default .spec.parameters so that we don't need to default this in Rego.
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("%w: %v", constraints.ErrInvalidConstraint, err)
+	}
+
+	key := drivers.ConstraintKeyFrom(constraint)
+	path := key.StoragePath()
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	for _, target := range d.targets[key.Kind] {
+		if err := addData(ctx, d.getStorage(target), path, params); err != nil {
+			return err
+		}
+
+		if p := d.policies[target][key.Kind]; p != nil {
+			p.addPath(ctx, path, raw)
+		}
+	}
+
+	return nil
+}
+
+// RemoveConstraint removes constraint's parameters from the data of its
+// Template's policies.
+func (d *Driver) RemoveConstraint(ctx context.Context, constraint *unstructured.Unstructured) error {
+	key := drivers.ConstraintKeyFrom(constraint)
+	path := key.StoragePath()
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	for target, store := range d.storage {
+		if err := removeData(ctx, store, path); err != nil {
+			return err
+		}
+
+		if p := d.policies[target][key.Kind]; p != nil {
+			p.removePath(ctx, path)
+		}
+	}
+
+	return nil
+}
+
+// AddData adds data at data.inventory.path for each of target's policies.
+func (d *Driver) AddData(ctx context.Context, target string, path storage.Path, data interface{}) error {
+	path = inventoryPath(path)
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", clienterrors.ErrWrite, err)
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if err := addData(ctx, d.getStorage(target), path, data); err != nil {
+		return err
+	}
+
+	for _, p := range d.policies[target] {
+		p.addPath(ctx, path, raw)
+	}
+
+	return nil
+}
+
+// RemoveData removes data at data.inventory.path for each of target's
+// policies.
+func (d *Driver) RemoveData(ctx context.Context, target string, path storage.Path) error {
+	path = inventoryPath(path)
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if err := removeData(ctx, d.getStorage(target), path); err != nil {
+		return err
+	}
+
+	for _, p := range d.policies[target] {
+		p.removePath(ctx, path)
+	}
+
+	return nil
+}
+
+// queryInput is the input to the hook module.
+type queryInput struct {
+	Target      string                  `json:"target"`
+	Constraints []drivers.ConstraintKey `json:"constraints"`
+	Review      json.RawMessage         `json:"review"`
+}
+
+func (d *Driver) Query(ctx context.Context, target string, constraints []*unstructured.Unstructured, review interface{}, opts ...drivers.QueryOpt) (*drivers.QueryResponse, error) {
+	if len(constraints) == 0 {
+		return nil, nil
+	}
+
+	cfg := &drivers.QueryCfg{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	// Encode review once per call to Query instead of once per Template.
+	rawReview, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+
+	constraintsByKind := make(map[string][]*unstructured.Unstructured)
+	for _, constraint := range constraints {
+		kind := constraint.GetKind()
+		constraintsByKind[kind] = append(constraintsByKind[kind], constraint)
+	}
+
+	kinds := make([]string, 0, len(constraintsByKind))
+	for kind := range constraintsByKind {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	constraintsMap := drivers.KeyMap(constraints)
+
+	var results []*types.Result
+	var statsEntries []*instrumentation.StatsEntry
+
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+
+	for _, kind := range kinds {
+		kindConstraints := constraintsByKind[kind]
+
+		p := d.policies[target][kind]
+		if p == nil {
+			// The Template was just removed, so the Driver is in an inconsistent
+			// state with Client. Raise this as an error rather than attempting to
+			// continue.
+			return nil, fmt.Errorf("missing Template %q for target %q", kind, target)
+		}
+
+		evalStartTime := time.Now()
+		resultSet, err := d.eval(ctx, p, target, kind, kindConstraints, rawReview)
+		evalEndTime := time.Since(evalStartTime)
+		if err != nil {
+			resultSet = make(rego.ResultSet, 0, len(kindConstraints))
+			for _, constraint := range kindConstraints {
+				resultSet = append(resultSet, rego.Result{
+					Bindings: map[string]interface{}{
+						"result": map[string]interface{}{
+							"msg": err.Error(),
+							"key": map[string]interface{}{
+								"kind": constraint.GetKind(),
+								"name": constraint.GetName(),
+							},
+						},
+					},
+				})
+			}
+		}
+
+		kindResults, err := drivers.ToResults(constraintsMap, resultSet)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, kindResults...)
+
+		if d.gatherStats || cfg.StatsEnabled {
+			statsEntries = append(statsEntries, &instrumentation.StatsEntry{
+				Scope:    instrumentation.TemplateScope,
+				StatsFor: kind,
+				Stats: []*instrumentation.Stat{
+					{
+						Name:  templateRunTimeNS,
+						Value: uint64(evalEndTime.Nanoseconds()),
+						Source: instrumentation.Source{
+							Type:  instrumentation.EngineSourceType,
+							Value: schema.Name,
+						},
+					},
+					{
+						Name:  constraintCountName,
+						Value: len(kindConstraints),
+						Source: instrumentation.Source{
+							Type:  instrumentation.EngineSourceType,
+							Value: schema.Name,
+						},
+					},
+				},
+			})
+		}
+	}
+
+	resp := &drivers.QueryResponse{Results: results, StatsEntries: statsEntries}
+	if cfg.TracingEnabled {
+		trace := tracingUnsupported
+		resp.Trace = &trace
+	}
+
+	return resp, nil
+}
+
+// eval evaluates kindConstraints against review with the policy p. Must be
+// called with d.mtx read-locked.
+func (d *Driver) eval(ctx context.Context, p *policy, target, kind string, kindConstraints []*unstructured.Unstructured, review json.RawMessage) (rego.ResultSet, error) {
+	input := queryInput{
+		Target:      target,
+		Constraints: make([]drivers.ConstraintKey, len(kindConstraints)),
+		Review:      review,
+	}
+	for i, constraint := range kindConstraints {
+		input.Constraints[i] = drivers.ConstraintKeyFrom(constraint)
+	}
+
+	rawInput, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := p.eval(ctx, rawInput, func() ([]byte, error) {
+		return d.policyData(ctx, target, kind)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode numbers as json.Number to match the values rego.ResultSet holds.
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.UseNumber()
+
+	var evalResults []struct {
+		Result []interface{} `json:"result"`
+	}
+	if err := dec.Decode(&evalResults); err != nil {
+		return nil, fmt.Errorf("decoding policy result: %w", err)
+	}
+
+	var resultSet rego.ResultSet
+	for _, evalResult := range evalResults {
+		for _, result := range evalResult.Result {
+			resultSet = append(resultSet, rego.Result{
+				Bindings: map[string]interface{}{"result": result},
+			})
+		}
+	}
+
+	return resultSet, nil
+}
+
+// Dump returns the Rego modules each Template was compiled from and the data
+// for each target, in the same shape as the Rego driver.
+func (d *Driver) Dump(ctx context.Context) (string, error) {
+	d.mtx.RLock()
+	defer d.mtx.RUnlock()
+
+	dt := make(map[string]map[string]interface{})
+
+	for targetName, store := range d.storage {
+		targetModules := make(map[string]map[string]string)
+		for kind, p := range d.policies[targetName] {
+			kindModules := make(map[string]string)
+			for modname, contents := range p.modules {
+				kindModules[modname] = contents.String()
+			}
+			targetModules[kind] = kindModules
+		}
+
+		data, err := readData(ctx, store, storage.Path{})
+		if err != nil {
+			return "", err
+		}
+
+		dt[targetName] = map[string]interface{}{
+			"modules": targetModules,
+			"data":    data,
+		}
+	}
+
+	b, err := json.MarshalIndent(dt, "", "   ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func (d *Driver) GetDescriptionForStat(statName string) (string, error) {
+	switch statName {
+	case templateRunTimeNS:
+		return templateRunTimeNsDesc, nil
+	case constraintCountName:
+		return constraintCountDescription, nil
+	default:
+		return "", fmt.Errorf("unknown stat name")
+	}
+}
+
+func closePolicies(ctx context.Context, policies map[string]*policy) {
+	for _, p := range policies {
+		p.close(ctx)
+	}
+}
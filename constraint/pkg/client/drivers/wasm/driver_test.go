@@ -0,0 +1,576 @@
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/conformance"
+	regodriver "github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/rego"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/types"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/storage"
+	opatypes "github.com/open-policy-agent/opa/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	moduleParameters = `
+package foo
+
+violation[{"msg": msg, "details": {"count": count(input.parameters.names)}}] {
+  name := input.parameters.names[_]
+  name == input.review.name
+  msg := sprintf("name %q is not allowed", [name])
+}
+`
+
+	moduleConflict = `
+package foo
+
+x = 1 { input.review.conflict }
+x = 2 { input.review.conflict }
+
+violation[{"msg": msg}] {
+  x == 1
+  msg := "unreachable"
+}
+`
+
+	moduleUnsupported = `
+package foo
+
+violation[{"msg": msg}] {
+  msg := wasm_test.unsupported("denied")
+}
+`
+)
+
+func init() {
+	// Builtins declared to the compiler without an implementation can be
+	// compiled but not called.
+	ast.RegisterBuiltin(&ast.Builtin{
+		Name: "wasm_test.unsupported",
+		Decl: opatypes.NewFunction(opatypes.Args(opatypes.S), opatypes.S),
+	})
+}
+
+func newDriver(t *testing.T, args ...Arg) *Driver {
+	t.Helper()
+
+	d, err := New(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+func TestDriver_Query(t *testing.T) {
+	ctx := context.Background()
+	d := newDriver(t)
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(cts.ModuleDeny))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*types.Result{{
+		Msg:               "denied",
+		Constraint:        constraint,
+		EnforcementAction: "deny",
+		Metadata:          map[string]interface{}{"details": map[string]interface{}{}},
+	}}
+	if diff := cmp.Diff(want, resp.Results); diff != "" {
+		t.Error(diff)
+	}
+
+	// Constraints which were never added are not evaluated.
+	got := conformance.QueryMessages(ctx, t, d, nil, cts.MakeConstraint(t, cts.MockTemplate, "bar"))
+	if len(got) != 0 {
+		t.Errorf("got results %v for Constraint which was not added", got)
+	}
+
+	err = d.RemoveTemplate(ctx, conformance.RegoTemplate(cts.ModuleDeny))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, nil)
+	if err == nil {
+		t.Error("got Query for removed Template to succeed, want error")
+	}
+}
+
+// TestDriver_MatchesRego checks the Driver returns the same results as the
+// Rego driver for the same Templates, Constraints, and data.
+func TestDriver_MatchesRego(t *testing.T) {
+	ctx := context.Background()
+
+	regoDriver, err := regodriver.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name   string
+		templ  *templates.ConstraintTemplate
+		params map[string]interface{}
+		review interface{}
+	}{{
+		name:   "parameters",
+		templ:  conformance.RegoTemplate(moduleParameters),
+		params: map[string]interface{}{"names": []interface{}{"a", "b"}},
+		review: map[string]interface{}{"name": "b"},
+	}, {
+		name:   "inventory",
+		templ:  conformance.RegoTemplate(conformance.ModuleInventory),
+		review: map[string]interface{}{},
+	}, {
+		name:   "lib",
+		templ:  conformance.RegoTemplate(conformance.ModuleLib, conformance.LibMessages),
+		review: map[string]interface{}{},
+	}}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var got [][]*types.Result
+
+			for _, d := range []drivers.Driver{regoDriver, newDriver(t)} {
+				err := d.AddTemplate(ctx, tc.templ)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+				if tc.params != nil {
+					err = unstructured.SetNestedMap(constraint.Object, tc.params, "spec", "parameters")
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				err = d.AddConstraint(ctx, constraint)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, name := range []string{"x", "y"} {
+					err = d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", name}, map[string]interface{}{})
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				resp, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, tc.review)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(resp.Results) == 0 {
+					t.Fatal("got no results")
+				}
+
+				got = append(got, resp.Results)
+
+				err = d.RemoveTemplate(ctx, tc.templ)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if diff := cmp.Diff(got[0], got[1]); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestDriver_Query_Parameters(t *testing.T) {
+	ctx := context.Background()
+	d := newDriver(t)
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(moduleParameters))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo",
+		cts.Set([]interface{}{"a", "b"}, "spec", "parameters", "names"))
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	review := map[string]interface{}{"name": "a"}
+	if diff := cmp.Diff([]string{`name "a" is not allowed`}, conformance.QueryMessages(ctx, t, d, review, constraint)); diff != "" {
+		t.Error(diff)
+	}
+
+	// Updating the Constraint replaces its parameters.
+	constraint = cts.MakeConstraint(t, cts.MockTemplate, "foo",
+		cts.Set([]interface{}{"b"}, "spec", "parameters", "names"))
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := conformance.QueryMessages(ctx, t, d, review, constraint); len(got) != 0 {
+		t.Errorf("got results %v for updated Constraint", got)
+	}
+
+	err = d.RemoveConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := conformance.QueryMessages(ctx, t, d, map[string]interface{}{"name": "b"}, constraint); len(got) != 0 {
+		t.Errorf("got results %v for removed Constraint", got)
+	}
+}
+
+func TestDriver_Query_Inventory(t *testing.T) {
+	ctx := context.Background()
+	d := newDriver(t)
+
+	// Data added before the Template is loaded into its policy.
+	err := d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "a"}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.AddTemplate(ctx, conformance.RegoTemplate(conformance.ModuleInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"b", "c"} {
+		err = d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", name}, map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = d.RemoveData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Removing data which does not exist succeeds.
+	err = d.RemoveData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Pod", "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Data for other targets is not visible to this target's Templates.
+	err = d.AddData(ctx, "other", storage.Path{"cluster", "v1", "Namespace", "e"}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"namespace a exists", "namespace c exists"}
+	if diff := cmp.Diff(want, conformance.QueryMessages(ctx, t, d, nil, constraint)); diff != "" {
+		t.Error(diff)
+	}
+
+	// Replacing the Template keeps its Constraints and data.
+	err = d.AddTemplate(ctx, conformance.RegoTemplate(conformance.ModuleInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, conformance.QueryMessages(ctx, t, d, nil, constraint)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestDriver_AddTemplate_Errors(t *testing.T) {
+	tcs := []struct {
+		name    string
+		templ   *templates.ConstraintTemplate
+		wantErr error
+	}{{
+		name:    "invalid rego",
+		templ:   conformance.RegoTemplate("package foo\n\nviolation["),
+		wantErr: clienterrors.ErrInvalidConstraintTemplate,
+	}, {
+		name:    "undefined function",
+		templ:   conformance.RegoTemplate("package foo\n\nviolation[{\"msg\": msg}] {\n  msg := undefined_function(1)\n}\n"),
+		wantErr: clienterrors.ErrCompile,
+	}, {
+		name:    "unsupported builtin",
+		templ:   conformance.RegoTemplate(moduleUnsupported),
+		wantErr: ErrUnsupportedBuiltin,
+	}}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			d := newDriver(t)
+
+			err := d.AddTemplate(ctx, tc.templ)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+
+			constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+			_, err = d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, nil)
+			if err == nil {
+				t.Error("got Query for Template which failed to be added to succeed, want error")
+			}
+		})
+	}
+}
+
+func TestDriver_AddTemplate_UnsupportedBuiltin(t *testing.T) {
+	err := newDriver(t).AddTemplate(context.Background(), conformance.RegoTemplate(moduleUnsupported))
+	if err == nil || !strings.Contains(err.Error(), "wasm_test.unsupported") {
+		t.Errorf("got error %v, want the name of the unsupported builtin", err)
+	}
+}
+
+func TestDriver_Query_EvalError(t *testing.T) {
+	ctx := context.Background()
+	d := newDriver(t)
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(moduleConflict))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Policies abort on conflicting values, which is reported as a result for
+	// each Constraint.
+	got := conformance.QueryMessages(ctx, t, d, map[string]interface{}{"conflict": true}, constraint)
+	if len(got) != 1 || !strings.Contains(got[0], ErrAbort.Error()) {
+		t.Errorf("got results %v, want policy aborted error", got)
+	}
+
+	// The aborted instance is replaced, keeping the Constraint's parameters.
+	got = conformance.QueryMessages(ctx, t, d, map[string]interface{}{}, constraint)
+	if len(got) != 0 {
+		t.Errorf("got results %v after recovering from abort, want none", got)
+	}
+}
+
+func TestDriver_Query_Stats(t *testing.T) {
+	ctx := context.Background()
+	d := newDriver(t, GatherStats())
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(cts.ModuleDeny))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.StatsEntries) != 1 {
+		t.Fatalf("got %d stats entries, want 1", len(resp.StatsEntries))
+	}
+
+	for _, stat := range resp.StatsEntries[0].Stats {
+		if _, err := d.GetDescriptionForStat(stat.Name); err != nil {
+			t.Errorf("got no description for stat %q: %v", stat.Name, err)
+		}
+	}
+}
+
+func TestDriver_Dump(t *testing.T) {
+	ctx := context.Background()
+	d := newDriver(t)
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(cts.ModuleDeny))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.AddConstraint(ctx, cts.MakeConstraint(t, cts.MockTemplate, "foo", cts.Set("bar", "spec", "parameters", "qux")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dump, err := d.Dump(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]struct {
+		Modules map[string]map[string]string `json:"modules"`
+		Data    map[string]interface{}       `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(dump), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	target := got[cts.MockTargetHandler]
+	if len(target.Modules[cts.MockTemplate]) == 0 {
+		t.Errorf("got no modules for %q in dump %s", cts.MockTemplate, dump)
+	}
+
+	wantData := map[string]interface{}{
+		"constraints": map[string]interface{}{
+			cts.MockTemplate: map[string]interface{}{
+				"foo": map[string]interface{}{"qux": "bar"},
+			},
+		},
+		"inventory": map[string]interface{}{},
+	}
+	if diff := cmp.Diff(wantData, target.Data); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestDriver_Query_Tracing(t *testing.T) {
+	ctx := context.Background()
+	d := newDriver(t)
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(cts.ModuleDeny))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, map[string]interface{}{}, drivers.Tracing(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Trace == nil || *resp.Trace != tracingUnsupported {
+		t.Errorf("got Trace %v, want %q", resp.Trace, tracingUnsupported)
+	}
+}
+
+func TestPolicy_Pool(t *testing.T) {
+	ctx := context.Background()
+	d := newDriver(t)
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(conformance.ModuleInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := d.policies[cts.MockTargetHandler][cts.MockTemplate]
+	data, err := d.policyData(ctx, cts.MockTargetHandler, cts.MockTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the pool as concurrent queries would.
+	for len(p.idle) < cap(p.slots) {
+		inst, err := p.newInstance(ctx, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.idle = append(p.idle, inst)
+	}
+
+	err = d.AddData(ctx, cts.MockTargetHandler, storage.Path{"cluster", "v1", "Namespace", "foo"}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input, err := json.Marshal(queryInput{
+		Target:      cts.MockTargetHandler,
+		Constraints: []drivers.ConstraintKey{drivers.ConstraintKeyFrom(constraint)},
+		Review:      json.RawMessage(`{}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every instance sees the added data.
+	for i, inst := range p.idle {
+		out, err := inst.eval(ctx, input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(out), "namespace foo exists") {
+			t.Errorf("got instance %d result %s, want added data", i, out)
+		}
+	}
+}
+
+func TestPolicy_ConcurrentQueries(t *testing.T) {
+	ctx := context.Background()
+	d := newDriver(t)
+
+	err := d.AddTemplate(ctx, conformance.RegoTemplate(cts.ModuleDeny))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, map[string]interface{}{})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(resp.Results) != 1 {
+				t.Errorf("got %d results, want 1", len(resp.Results))
+			}
+		}()
+	}
+	wg.Wait()
+
+	p := d.policies[cts.MockTargetHandler][cts.MockTemplate]
+	if got := len(p.idle); got < 1 || got > cap(p.slots) {
+		t.Errorf("got %d instances, want between 1 and %d", got, cap(p.slots))
+	}
+}
@@ -0,0 +1,127 @@
+package wasm
+
+// OPA's Wasm policies import their linear memory and host functions from a
+// module named "env". wazero host modules may only export functions, so each
+// policy instance gets a small Wasm module which defines the memory and
+// re-exports the host functions implemented in Go under hostModule.
+
+const (
+	envModule  = "env"
+	hostModule = "gatekeeper_host"
+
+	// policyModule is the name each compiled policy is instantiated with.
+	policyModule = "policy"
+
+	// envMemoryMinPages is the initial size of policy memory. OPA's compiler
+	// currently requires at least two pages.
+	envMemoryMinPages = 2
+
+	// maxBuiltinArgs is the largest number of arguments a Rego builtin
+	// implemented by the host may take.
+	maxBuiltinArgs = 4
+)
+
+const (
+	valTypeI32 = 0x7f
+
+	sectionType   = 0x01
+	sectionImport = 0x02
+	sectionMemory = 0x05
+	sectionExport = 0x07
+
+	externFunc   = 0x00
+	externMemory = 0x02
+)
+
+// hostFunc is a function the host provides to policies.
+type hostFunc struct {
+	name    string
+	params  int
+	results int
+}
+
+// hostFuncs lists the functions of OPA's Wasm ABI which the host implements.
+var hostFuncs = []hostFunc{
+	{name: "opa_abort", params: 1},
+	{name: "opa_println", params: 1},
+	{name: "opa_builtin0", params: 2, results: 1},
+	{name: "opa_builtin1", params: 3, results: 1},
+	{name: "opa_builtin2", params: 4, results: 1},
+	{name: "opa_builtin3", params: 5, results: 1},
+	{name: "opa_builtin4", params: 6, results: 1},
+}
+
+// envBinary is the binary encoding of the env module.
+var envBinary = encodeEnv()
+
+// encodeEnv encodes a module which imports each of hostFuncs from hostModule,
+// exports them under the same names, and exports a memory named "memory".
+func encodeEnv() []byte {
+	types := uvarint(nil, uint32(len(hostFuncs)))
+	imports := uvarint(nil, uint32(len(hostFuncs)))
+	exports := uvarint(nil, uint32(len(hostFuncs)+1))
+
+	for i, f := range hostFuncs {
+		types = append(types, 0x60)
+		types = valTypes(types, f.params)
+		types = valTypes(types, f.results)
+
+		imports = name(imports, hostModule)
+		imports = name(imports, f.name)
+		imports = append(imports, externFunc)
+		imports = uvarint(imports, uint32(i))
+
+		exports = name(exports, f.name)
+		exports = append(exports, externFunc)
+		exports = uvarint(exports, uint32(i))
+	}
+
+	exports = name(exports, "memory")
+	exports = append(exports, externMemory)
+	exports = uvarint(exports, 0)
+
+	// A single memory with a minimum size and no maximum. The runtime's memory
+	// limit bounds how far policies may grow it.
+	memory := uvarint(nil, 1)
+	memory = append(memory, 0x00)
+	memory = uvarint(memory, envMemoryMinPages)
+
+	out := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	out = section(out, sectionType, types)
+	out = section(out, sectionImport, imports)
+	out = section(out, sectionMemory, memory)
+	out = section(out, sectionExport, exports)
+
+	return out
+}
+
+func section(out []byte, id byte, content []byte) []byte {
+	out = append(out, id)
+	out = uvarint(out, uint32(len(content)))
+	return append(out, content...)
+}
+
+func valTypes(out []byte, n int) []byte {
+	out = uvarint(out, uint32(n))
+	for i := 0; i < n; i++ {
+		out = append(out, valTypeI32)
+	}
+	return out
+}
+
+func name(out []byte, s string) []byte {
+	out = uvarint(out, uint32(len(s)))
+	return append(out, s...)
+}
+
+// uvarint appends the unsigned LEB128 encoding of v to out.
+func uvarint(out []byte, v uint32) []byte {
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
@@ -0,0 +1,20 @@
+package wasm
+
+import "errors"
+
+var (
+	// ErrUnsupportedBuiltin indicates a Template calls a Rego builtin which is
+	// not compiled into Wasm and has no Go implementation the Driver can provide.
+	ErrUnsupportedBuiltin = errors.New("unsupported builtin")
+
+	// ErrABI indicates a compiled policy does not implement a version of OPA's
+	// Wasm ABI the Driver supports.
+	ErrABI = errors.New("unsupported Wasm ABI")
+
+	// ErrAbort indicates a policy aborted evaluation, for example because of
+	// a conflict between rule values.
+	ErrAbort = errors.New("policy aborted")
+
+	// ErrMemory indicates a policy exhausted its memory limit.
+	ErrMemory = errors.New("policy memory exhausted")
+)
@@ -0,0 +1,508 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/metrics"
+	"github.com/open-policy-agent/opa/topdown"
+	"github.com/open-policy-agent/opa/topdown/builtins"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+const (
+	// abiVersion and abiMinorVersion are the oldest version of OPA's Wasm ABI
+	// which provides opa_eval.
+	abiVersion      = 1
+	abiMinorVersion = 2
+
+	pageSize = 65536
+)
+
+// instance is an instantiation of a compiled policy along with the data
+// document it evaluates against. Not threadsafe.
+type instance struct {
+	// modules are the host, env, and policy modules, in instantiation order.
+	modules []api.Module
+
+	policy api.Module
+	memory api.Memory
+
+	// builtins is a map from the identifiers the policy uses for builtins it
+	// imports to their implementations.
+	builtins map[uint32]topdown.BuiltinFunc
+
+	// bctx is passed to builtins called during evaluation.
+	bctx *topdown.BuiltinContext
+
+	// trap is the error which caused a host function to abort the call in
+	// progress. wazero wraps panics from host functions with a stack trace, so
+	// the original error is kept here.
+	trap error
+
+	// dataAddr is the address of the data document.
+	dataAddr uint32
+
+	// evalHeapPtr is the start of the heap evaluations may use. Evaluations
+	// reset the heap to this address, so anything allocated below it, such as
+	// the data document, survives between evaluations.
+	evalHeapPtr uint32
+}
+
+// newInstance instantiates compiled in r, which must not have any other
+// instances, and loads data as its data document.
+func newInstance(ctx context.Context, r wazero.Runtime, env, compiled wazero.CompiledModule, data []byte) (*instance, error) {
+	i := &instance{}
+
+	host := r.NewHostModuleBuilder(hostModule).
+		NewFunctionBuilder().WithFunc(i.abort).Export("opa_abort").
+		NewFunctionBuilder().WithFunc(i.println).Export("opa_println").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, id, _ uint32) uint32 {
+		return i.callBuiltin(ctx, id)
+	}).Export("opa_builtin0").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, id, _, a uint32) uint32 {
+		return i.callBuiltin(ctx, id, a)
+	}).Export("opa_builtin1").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, id, _, a, b uint32) uint32 {
+		return i.callBuiltin(ctx, id, a, b)
+	}).Export("opa_builtin2").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, id, _, a, b, c uint32) uint32 {
+		return i.callBuiltin(ctx, id, a, b, c)
+	}).Export("opa_builtin3").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, id, _, a, b, c, d uint32) uint32 {
+		return i.callBuiltin(ctx, id, a, b, c, d)
+	}).Export("opa_builtin4")
+
+	hostMod, err := host.Instantiate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	i.modules = append(i.modules, hostMod)
+
+	envMod, err := r.InstantiateModule(ctx, env, wazero.NewModuleConfig().WithName(envModule))
+	if err != nil {
+		i.close(ctx)
+		return nil, err
+	}
+	i.modules = append(i.modules, envMod)
+	i.memory = envMod.ExportedMemory("memory")
+
+	i.policy, err = r.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName(policyModule))
+	if err != nil {
+		i.close(ctx)
+		return nil, err
+	}
+	i.modules = append(i.modules, i.policy)
+
+	if err := i.init(ctx, data); err != nil {
+		i.close(ctx)
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func (i *instance) init(ctx context.Context, data []byte) error {
+	if err := i.checkABI(); err != nil {
+		return err
+	}
+
+	if err := i.resolveBuiltins(ctx); err != nil {
+		return err
+	}
+
+	var err error
+	i.dataAddr, err = i.parseValue(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	// Keep the free blocks left by parsing data from being leaked when
+	// evaluations reset the heap.
+	if _, err := i.call(ctx, "opa_heap_blocks_stash"); err != nil {
+		return err
+	}
+
+	i.evalHeapPtr, err = i.call(ctx, "opa_heap_ptr_get")
+	return err
+}
+
+func (i *instance) close(ctx context.Context) {
+	for j := len(i.modules) - 1; j >= 0; j-- {
+		_ = i.modules[j].Close(ctx)
+	}
+}
+
+func (i *instance) checkABI() error {
+	version := i.policy.ExportedGlobal("opa_wasm_abi_version")
+	minorVersion := i.policy.ExportedGlobal("opa_wasm_abi_minor_version")
+	if version == nil || minorVersion == nil {
+		return fmt.Errorf("%w: policy does not declare its ABI version", ErrABI)
+	}
+
+	major, minor := int32(version.Get()), int32(minorVersion.Get())
+	if major != abiVersion || minor < abiMinorVersion {
+		return fmt.Errorf("%w: policy requires ABI %d.%d; supported versions are %d.%d and later minor versions",
+			ErrABI, major, minor, abiVersion, abiMinorVersion)
+	}
+
+	return nil
+}
+
+// resolveBuiltins maps the builtins the policy imports from the host to their
+// Go implementations. Returns ErrUnsupportedBuiltin if any have none.
+func (i *instance) resolveBuiltins(ctx context.Context) error {
+	addr, err := i.call(ctx, "builtins")
+	if err != nil {
+		return err
+	}
+
+	raw, err := i.dumpJSON(ctx, addr)
+	if err != nil {
+		return err
+	}
+
+	var ids map[string]uint32
+	if err := json.Unmarshal(raw, &ids); err != nil {
+		return fmt.Errorf("%w: parsing builtins: %v", ErrABI, err)
+	}
+
+	i.builtins = make(map[uint32]topdown.BuiltinFunc, len(ids))
+
+	var unsupported []string
+	for builtin, id := range ids {
+		fn := topdown.GetBuiltin(builtin)
+		if fn == nil {
+			unsupported = append(unsupported, builtin)
+			continue
+		}
+
+		i.builtins[id] = fn
+	}
+
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return fmt.Errorf("%w: %s", ErrUnsupportedBuiltin, strings.Join(unsupported, ", "))
+	}
+
+	return nil
+}
+
+// eval evaluates the policy's entrypoint against input, which must be JSON.
+// Returns the JSON-encoded result set.
+func (i *instance) eval(ctx context.Context, input []byte) ([]byte, error) {
+	inputAddr := i.evalHeapPtr
+	inputLen := uint32(len(input))
+
+	// The input is written directly to the heap rather than allocated, since
+	// evaluation resets the heap anyway.
+	if err := i.reserve(inputAddr + inputLen); err != nil {
+		return nil, err
+	}
+	i.memory.Write(inputAddr, input)
+
+	i.bctx = newBuiltinContext(ctx)
+	defer func() {
+		i.bctx = nil
+	}()
+
+	resultAddr, err := i.call(ctx, "opa_eval",
+		0, // reserved
+		0, // entrypoint
+		i.dataAddr, inputAddr, inputLen, inputAddr+inputLen,
+		0, // JSON result format
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := i.readString(resultAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the result since the memory it is read from is reused by the next
+	// evaluation.
+	return append([]byte(nil), result...), nil
+}
+
+// addPath sets the value at path in the data document to value, which must be
+// JSON, creating intermediate objects as needed.
+func (i *instance) addPath(ctx context.Context, path []string, value []byte) error {
+	return i.patch(ctx, path, func(pathAddr uint32) (uint32, error) {
+		valueAddr, err := i.parseValue(ctx, value)
+		if err != nil {
+			return 0, err
+		}
+
+		return i.call(ctx, "opa_value_add_path", i.dataAddr, pathAddr, valueAddr)
+	})
+}
+
+// removePath removes the value at path from the data document. Paths which
+// do not exist are ignored.
+func (i *instance) removePath(ctx context.Context, path []string) error {
+	err := i.patch(ctx, path, func(pathAddr uint32) (uint32, error) {
+		// The only failure is that the path doesn't exist, which is fine.
+		_, err := i.call(ctx, "opa_value_remove_path", i.dataAddr, pathAddr)
+		return 0, err
+	})
+
+	return err
+}
+
+// patch makes a change to the data document. Allocations made by change are
+// kept above evalHeapPtr so evaluations don't overwrite them.
+func (i *instance) patch(ctx context.Context, path []string, change func(pathAddr uint32) (uint32, error)) error {
+	if _, err := i.call(ctx, "opa_heap_ptr_set", i.evalHeapPtr); err != nil {
+		return err
+	}
+
+	if _, err := i.call(ctx, "opa_heap_blocks_restore"); err != nil {
+		return err
+	}
+
+	rawPath, err := json.Marshal(path)
+	if err != nil {
+		return err
+	}
+
+	pathAddr, err := i.parseValue(ctx, rawPath)
+	if err != nil {
+		return err
+	}
+
+	errc, err := change(pathAddr)
+	if err != nil {
+		return err
+	}
+
+	if _, err := i.call(ctx, "opa_value_free", pathAddr); err != nil {
+		return err
+	}
+
+	if _, err := i.call(ctx, "opa_heap_blocks_stash"); err != nil {
+		return err
+	}
+
+	i.evalHeapPtr, err = i.call(ctx, "opa_heap_ptr_get")
+	if err != nil {
+		return err
+	}
+
+	if errc != 0 {
+		return fmt.Errorf("setting data at path %v: error code %d", path, int32(errc))
+	}
+
+	return nil
+}
+
+// abort implements opa_abort.
+func (i *instance) abort(_ context.Context, addr uint32) {
+	msg, err := i.readString(addr)
+	if err != nil {
+		panic(i.fail(err))
+	}
+
+	panic(i.fail(fmt.Errorf("%w: %s", ErrAbort, msg)))
+}
+
+// println implements opa_println. Print statements are removed when
+// Templates are compiled, so this is never called in practice.
+func (i *instance) println(context.Context, uint32) {}
+
+// callBuiltin implements opa_builtin0 through opa_builtin4 by calling the Go
+// implementation of the builtin identified by id.
+func (i *instance) callBuiltin(ctx context.Context, id uint32, args ...uint32) uint32 {
+	fn, found := i.builtins[id]
+	if !found || i.bctx == nil {
+		panic(i.fail(fmt.Errorf("%w: unexpected call to builtin %d", ErrABI, id)))
+	}
+
+	operands := make([]*ast.Term, len(args))
+	for j, addr := range args {
+		raw, err := i.dumpValue(ctx, addr)
+		if err != nil {
+			panic(i.fail(err))
+		}
+
+		operands[j], err = ast.ParseTerm(string(raw))
+		if err != nil {
+			panic(i.fail(fmt.Errorf("parsing builtin argument: %w", err)))
+		}
+	}
+
+	var output *ast.Term
+	err := fn(*i.bctx, operands, func(t *ast.Term) error {
+		output = t
+		return nil
+	})
+	if err != nil {
+		if errors.As(err, &topdown.Halt{}) {
+			panic(i.fail(err))
+		}
+
+		// As in OPA's Wasm SDK, other errors make the call undefined since
+		// policies always evaluate non-strictly.
+		return 0
+	}
+
+	if output == nil {
+		return 0
+	}
+
+	addr, err := i.parseValue(ctx, []byte(output.String()))
+	if err != nil {
+		panic(i.fail(err))
+	}
+
+	return addr
+}
+
+// fail records err as the reason the call in progress is being aborted.
+func (i *instance) fail(err error) error {
+	i.trap = err
+	return err
+}
+
+// call calls the policy's exported function fn.
+func (i *instance) call(ctx context.Context, fn string, args ...uint32) (uint32, error) {
+	f := i.policy.ExportedFunction(fn)
+	if f == nil {
+		return 0, fmt.Errorf("%w: policy does not export %q", ErrABI, fn)
+	}
+
+	params := make([]uint64, len(args))
+	for j, arg := range args {
+		params[j] = uint64(arg)
+	}
+
+	i.trap = nil
+	results, err := f.Call(ctx, params...)
+	if err != nil {
+		if i.trap != nil {
+			return 0, i.trap
+		}
+
+		return 0, err
+	}
+
+	if len(results) == 0 {
+		return 0, nil
+	}
+
+	return uint32(results[0]), nil
+}
+
+// parseValue allocates a value parsed from raw, which may be JSON or Rego
+// term syntax. Returns the address of the value.
+func (i *instance) parseValue(ctx context.Context, raw []byte) (uint32, error) {
+	n := uint32(len(raw))
+	p, err := i.call(ctx, "opa_malloc", n)
+	if err != nil {
+		return 0, err
+	}
+
+	if !i.memory.Write(p, raw) {
+		return 0, fmt.Errorf("%w: writing %d bytes at %d", ErrMemory, n, p)
+	}
+
+	addr, err := i.call(ctx, "opa_value_parse", p, n)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := i.call(ctx, "opa_free", p); err != nil {
+		return 0, err
+	}
+
+	if addr == 0 {
+		return 0, fmt.Errorf("%w: unable to parse value", ErrABI)
+	}
+
+	return addr, nil
+}
+
+// dumpJSON returns the JSON serialization of the value at addr.
+func (i *instance) dumpJSON(ctx context.Context, addr uint32) ([]byte, error) {
+	return i.dump(ctx, "opa_json_dump", addr)
+}
+
+// dumpValue returns the Rego term serialization of the value at addr, which
+// unlike JSON preserves sets and non-string object keys.
+func (i *instance) dumpValue(ctx context.Context, addr uint32) ([]byte, error) {
+	return i.dump(ctx, "opa_value_dump", addr)
+}
+
+func (i *instance) dump(ctx context.Context, fn string, addr uint32) ([]byte, error) {
+	strAddr, err := i.call(ctx, fn, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := i.readString(strAddr)
+	if err != nil {
+		return nil, err
+	}
+	s = append([]byte(nil), s...)
+
+	if _, err := i.call(ctx, "opa_free", strAddr); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// readString returns a view of the NUL-terminated string at addr.
+func (i *instance) readString(addr uint32) ([]byte, error) {
+	size := i.memory.Size()
+	if addr >= size {
+		return nil, fmt.Errorf("%w: string address %d out of bounds", ErrABI, addr)
+	}
+
+	mem, _ := i.memory.Read(addr, size-addr)
+	n := bytes.IndexByte(mem, 0)
+	if n < 0 {
+		return nil, fmt.Errorf("%w: unterminated string at %d", ErrABI, addr)
+	}
+
+	return mem[:n], nil
+}
+
+// reserve grows memory so that it is at least end bytes long.
+func (i *instance) reserve(end uint32) error {
+	size := i.memory.Size()
+	if end <= size {
+		return nil
+	}
+
+	pages := (end - size + pageSize - 1) / pageSize
+	if _, ok := i.memory.Grow(pages); !ok {
+		return fmt.Errorf("%w: unable to grow memory by %d pages", ErrMemory, pages)
+	}
+
+	return nil
+}
+
+func newBuiltinContext(ctx context.Context) *topdown.BuiltinContext {
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	return &topdown.BuiltinContext{
+		Context: ctx,
+		Metrics: metrics.New(),
+		Seed:    rand.Reader,
+		Time:    ast.NumberTerm(json.Number(now)),
+		Cancel:  topdown.NewCancel(),
+		Cache:   make(builtins.Cache),
+	}
+}
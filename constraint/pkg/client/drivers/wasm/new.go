@@ -0,0 +1,30 @@
+package wasm
+
+import (
+	"github.com/open-policy-agent/opa/storage"
+	"github.com/tetratelabs/wazero"
+)
+
+// New constructs a new Driver which evaluates Templates compiled to Wasm.
+func New(args ...Arg) (*Driver, error) {
+	d := &Driver{
+		policies: make(map[string]map[string]*policy),
+		targets:  make(map[string][]string),
+		storage:  make(map[string]storage.Store),
+	}
+
+	for _, arg := range args {
+		if err := arg(d); err != nil {
+			return nil, err
+		}
+	}
+
+	// Closing modules when the context is done stops evaluations which run
+	// past their deadline.
+	d.runtimeConfig = wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	if d.memoryLimitPages > 0 {
+		d.runtimeConfig = d.runtimeConfig.WithMemoryLimitPages(d.memoryLimitPages)
+	}
+
+	return d, nil
+}
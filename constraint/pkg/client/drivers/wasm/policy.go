@@ -0,0 +1,250 @@
+package wasm
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/tetratelabs/wazero"
+)
+
+// violationQuery is the entrypoint of each compiled policy. Must match the
+// package and rule of the hook module. Policies return the bindings of each
+// variable in the query, so the result is bound to "result".
+const violationQuery = "result = data.hooks.violation"
+
+// policy is a Template compiled to Wasm for a single target.
+//
+// Instances are not threadsafe, so the policy keeps a pool of up to
+// GOMAXPROCS instances to evaluate queries concurrently, each with its own
+// copy of the data document. Data writes happen while the Driver is locked, so
+// no query is in progress and every instance is idle.
+type policy struct {
+	// modules are the Rego modules the policy was compiled from, keyed by
+	// module path.
+	modules map[string]*ast.Module
+
+	// wasm is the compiled policy.
+	wasm []byte
+
+	// config configures the runtime of each instance. Each instance has its
+	// own runtime as the policy always imports the env module by name. The
+	// runtimes share a compilation cache, so the policy is only compiled once.
+	config wazero.RuntimeConfig
+	cache  wazero.CompilationCache
+
+	// slots has room for each instance which may exist at once.
+	slots chan struct{}
+
+	// mtx guards idle.
+	mtx sync.Mutex
+
+	// idle are the instances not evaluating a query. New instances are
+	// created with the target's current data as needed.
+	idle []*pooledInstance
+}
+
+// pooledInstance is an instance along with the runtime it alone is
+// instantiated in.
+type pooledInstance struct {
+	*instance
+
+	runtime wazero.Runtime
+}
+
+func (i *pooledInstance) close(ctx context.Context) {
+	i.instance.close(ctx)
+	_ = i.runtime.Close(ctx)
+}
+
+// newPolicy compiles modules to Wasm and checks the runtime accepts it. The
+// policy has no instances until reset is called.
+func newPolicy(ctx context.Context, config wazero.RuntimeConfig, modules map[string]*ast.Module) (*policy, error) {
+	compiler := ast.NewCompiler()
+	compiler.Compile(modules)
+	if compiler.Failed() {
+		return nil, fmt.Errorf("%w: %v", clienterrors.ErrCompile, compiler.Errors)
+	}
+
+	result, err := rego.New(
+		rego.Compiler(compiler),
+		rego.Query(violationQuery),
+	).Compile(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: compiling to Wasm: %v", clienterrors.ErrCompile, err)
+	}
+
+	cache := wazero.NewCompilationCache()
+	p := &policy{
+		modules: modules,
+		wasm:    result.Bytes,
+		config:  config.WithCompilationCache(cache),
+		cache:   cache,
+		slots:   make(chan struct{}, runtime.GOMAXPROCS(0)),
+	}
+
+	// Compile into the cache now, so compilation errors are returned here.
+	r := wazero.NewRuntimeWithConfig(ctx, p.config)
+	defer func() {
+		_ = r.Close(ctx)
+	}()
+
+	if _, err := r.CompileModule(ctx, envBinary); err != nil {
+		p.close(ctx)
+		return nil, fmt.Errorf("%w: compiling env module: %v", clienterrors.ErrCompile, err)
+	}
+
+	if _, err := r.CompileModule(ctx, p.wasm); err != nil {
+		p.close(ctx)
+		return nil, fmt.Errorf("%w: compiling Wasm module: %v", clienterrors.ErrCompile, err)
+	}
+
+	return p, nil
+}
+
+// newInstance instantiates the policy in a new runtime with data as its data
+// document.
+func (p *policy) newInstance(ctx context.Context, data []byte) (*pooledInstance, error) {
+	r := wazero.NewRuntimeWithConfig(ctx, p.config)
+
+	env, err := r.CompileModule(ctx, envBinary)
+	if err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+
+	compiled, err := r.CompileModule(ctx, p.wasm)
+	if err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+
+	inst, err := newInstance(ctx, r, env, compiled, data)
+	if err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+
+	return &pooledInstance{instance: inst, runtime: r}, nil
+}
+
+// reset replaces the policy's instances with a single new one using data as
+// its data document. Must not be called while the policy is evaluating
+// queries.
+func (p *policy) reset(ctx context.Context, data []byte) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.discardLocked(ctx)
+
+	inst, err := p.newInstance(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	p.idle = append(p.idle, inst)
+	return nil
+}
+
+// discardLocked closes the idle instances, so new ones are created as needed.
+func (p *policy) discardLocked(ctx context.Context) {
+	for _, inst := range p.idle {
+		inst.close(ctx)
+	}
+	p.idle = nil
+}
+
+// update applies fn to each idle instance. Instances which cannot be updated
+// are discarded rather than left inconsistent.
+func (p *policy) update(ctx context.Context, fn func(inst *pooledInstance) error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	kept := p.idle[:0]
+	for _, inst := range p.idle {
+		if err := fn(inst); err != nil {
+			inst.close(ctx)
+			continue
+		}
+		kept = append(kept, inst)
+	}
+	p.idle = kept
+}
+
+// addPath sets the value at path in the data document of each of the policy's
+// instances. Must not be called while the policy is evaluating queries.
+func (p *policy) addPath(ctx context.Context, path []string, value []byte) {
+	p.update(ctx, func(inst *pooledInstance) error {
+		return inst.addPath(ctx, path, value)
+	})
+}
+
+// removePath removes the value at path from the data document of each of the
+// policy's instances. Must not be called while the policy is evaluating
+// queries.
+func (p *policy) removePath(ctx context.Context, path []string) {
+	p.update(ctx, func(inst *pooledInstance) error {
+		return inst.removePath(ctx, path)
+	})
+}
+
+// eval evaluates the policy against input with an idle instance. If there is
+// none, and fewer than GOMAXPROCS instances exist, one is created with the
+// data document returned by data. Otherwise waits for an instance to become
+// idle.
+func (p *policy) eval(ctx context.Context, input []byte, data func() ([]byte, error)) ([]byte, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-p.slots }()
+
+	p.mtx.Lock()
+	var inst *pooledInstance
+	if n := len(p.idle); n > 0 {
+		inst = p.idle[n-1]
+		p.idle = p.idle[:n-1]
+	}
+	p.mtx.Unlock()
+
+	if inst == nil {
+		d, err := data()
+		if err != nil {
+			return nil, err
+		}
+
+		inst, err = p.newInstance(ctx, d)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := inst.eval(ctx, input)
+	if err != nil {
+		// The policy may have aborted partway through modifying its memory, so
+		// don't reuse the instance.
+		inst.close(ctx)
+		return nil, err
+	}
+
+	p.mtx.Lock()
+	p.idle = append(p.idle, inst)
+	p.mtx.Unlock()
+
+	return result, nil
+}
+
+// close releases the policy's instances and compiled modules. Must not be
+// called while the policy is evaluating queries.
+func (p *policy) close(ctx context.Context) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.discardLocked(ctx)
+	_ = p.cache.Close(ctx)
+}
@@ -14,6 +14,7 @@ var (
 	ErrMissingConstraintTemplate = errors.New("missing ConstraintTemplate")
 	ErrInvalidModule             = errors.New("invalid module")
 	ErrReview                    = errors.New("target.HandleReview failed")
+	ErrAnnotationsUnsupported    = errors.New("driver does not support annotations")
 )
 
 // IsUnrecognizedConstraintError returns true if err is an ErrMissingConstraint.
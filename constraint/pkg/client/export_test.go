@@ -0,0 +1,6 @@
+package client
+
+// WaitForShadowQueries waits for c's shadow queries in flight to complete.
+func WaitForShadowQueries(c *Client) {
+	c.shadow.wg.Wait()
+}
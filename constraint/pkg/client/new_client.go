@@ -2,6 +2,7 @@ package client
 
 import (
 	"fmt"
+	"runtime"
 
 	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
 )
@@ -12,6 +13,9 @@ func NewClient(opts ...Opt) (*Client, error) {
 		templates:      make(map[string]*templateClient),
 		drivers:        make(map[string]drivers.Driver),
 		driverPriority: make(map[string]int),
+
+		shadowConcurrency: runtime.GOMAXPROCS(0),
+		shadowTimeout:     defaultShadowTimeout,
 	}
 
 	for _, opt := range opts {
@@ -25,5 +29,10 @@ func NewClient(opts ...Opt) (*Client, error) {
 			ErrCreatingClient)
 	}
 
+	if c.shadow != nil {
+		c.shadow.slots = make(chan struct{}, c.shadowConcurrency)
+		c.shadow.timeout = c.shadowTimeout
+	}
+
 	return c, nil
 }
@@ -0,0 +1,510 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	clienterrors "github.com/open-policy-agent/frameworks/constraint/pkg/client/errors"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/instrumentation"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	shadowComparisonsName        = "shadowComparisons"
+	shadowComparisonsDescription = "the number of times a shadow driver's violations for a constraint were compared with the primary driver's"
+
+	shadowMismatchesName        = "shadowMismatches"
+	shadowMismatchesDescription = "the number of times a shadow driver's violations for a constraint differed from the primary driver's"
+
+	shadowErrorsName        = "shadowErrors"
+	shadowErrorsDescription = "the number of times a shadow driver failed to add, remove, or evaluate a template or constraint"
+
+	primaryDriverLabelName = "primaryDriver"
+
+	defaultShadowTimeout = 10 * time.Second
+)
+
+var shadowStatDescriptions = map[string]string{
+	shadowComparisonsName: shadowComparisonsDescription,
+	shadowMismatchesName:  shadowMismatchesDescription,
+	shadowErrorsName:      shadowErrorsDescription,
+}
+
+// ShadowMismatch describes a difference between a Template's primary driver
+// and one of its shadow drivers.
+type ShadowMismatch struct {
+	// Target is the name of the target the Template is for.
+	Target string
+
+	// Kind is the kind of the Template.
+	Kind string
+
+	// PrimaryDriver is the name of the driver which enforces the Template.
+	PrimaryDriver string
+
+	// ShadowDriver is the name of the driver evaluating the Template in shadow.
+	ShadowDriver string
+
+	// Constraint is the name of the Constraint whose violations differ. Empty
+	// if the mismatch is not for a single Constraint.
+	Constraint string
+
+	// Primary and Shadow are the sorted messages of the violations each driver
+	// found for Constraint. A differing number of violations with the same
+	// message is a mismatch.
+	Primary []string
+	Shadow  []string
+
+	// Err is the error returned by the shadow driver if it failed. Shadow
+	// drivers which fail to add a Template or Constraint stop evaluating the
+	// Template until it is changed.
+	Err error
+}
+
+// ShadowMismatchHandler receives each ShadowMismatch. It may be called while
+// Client is locked, so it must not call Client, and should return quickly.
+type ShadowMismatchHandler func(ctx context.Context, mismatch *ShadowMismatch)
+
+// shadowKey identifies the stats for a Template's shadow driver.
+type shadowKey struct {
+	kind    string
+	primary string
+	shadow  string
+}
+
+type shadowCounts struct {
+	comparisons uint64
+	mismatches  uint64
+	errors      uint64
+}
+
+// shadowState tracks the outcomes of shadow evaluation. Threadsafe.
+type shadowState struct {
+	onMismatch ShadowMismatchHandler
+
+	// reviews is the number of reviews considered for shadow evaluation.
+	reviews uint64
+
+	// slots has room for each shadow query which may be in flight.
+	slots chan struct{}
+	// timeout bounds each shadow query.
+	timeout time.Duration
+	// wg tracks shadow queries in flight.
+	wg sync.WaitGroup
+
+	mtx sync.Mutex
+
+	counts map[shadowKey]*shadowCounts
+}
+
+// sample returns true if the next review is to be evaluated by shadow drivers,
+// given that one in every n reviews is.
+func (s *shadowState) sample(n uint64) bool {
+	count := atomic.AddUint64(&s.reviews, 1)
+	return n <= 1 || (count-1)%n == 0
+}
+
+func newShadowState(onMismatch ShadowMismatchHandler) *shadowState {
+	return &shadowState{
+		onMismatch: onMismatch,
+		counts:     make(map[shadowKey]*shadowCounts),
+	}
+}
+
+// record counts a comparison or error, and passes any mismatch to onMismatch.
+// compared is whether the drivers' violations were compared, and matched is
+// whether they were found equal.
+func (s *shadowState) record(ctx context.Context, mismatch *ShadowMismatch, compared bool, matched bool) {
+	key := shadowKey{kind: mismatch.Kind, primary: mismatch.PrimaryDriver, shadow: mismatch.ShadowDriver}
+
+	s.mtx.Lock()
+	counts, found := s.counts[key]
+	if !found {
+		counts = &shadowCounts{}
+		s.counts[key] = counts
+	}
+
+	if compared {
+		counts.comparisons++
+	}
+	if mismatch.Err != nil {
+		counts.errors++
+	}
+	if compared && !matched {
+		counts.mismatches++
+	}
+	s.mtx.Unlock()
+
+	if !matched && s.onMismatch != nil {
+		s.onMismatch(ctx, mismatch)
+	}
+}
+
+// recordErr records that the shadow driver failed, so its violations were not
+// compared.
+func (s *shadowState) recordErr(ctx context.Context, mismatch *ShadowMismatch) {
+	s.record(ctx, mismatch, false, false)
+}
+
+// ShadowStats returns, for each Template kind and shadow driver, the number of
+// times violations were compared with the primary driver's, how many of those
+// differed, and how many times the shadow driver failed. Counts are cumulative
+// since Client was created. Returns nil unless Client was created with
+// ShadowDrivers.
+func (c *Client) ShadowStats() []*instrumentation.StatsEntry {
+	if c.shadow == nil {
+		return nil
+	}
+
+	c.shadow.mtx.Lock()
+	defer c.shadow.mtx.Unlock()
+
+	keys := make([]shadowKey, 0, len(c.shadow.counts))
+	for key := range c.shadow.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].kind != keys[j].kind {
+			return keys[i].kind < keys[j].kind
+		}
+		return keys[i].shadow < keys[j].shadow
+	})
+
+	entries := make([]*instrumentation.StatsEntry, 0, len(keys))
+	for _, key := range keys {
+		counts := c.shadow.counts[key]
+		source := instrumentation.Source{Type: instrumentation.EngineSourceType, Value: key.shadow}
+
+		entries = append(entries, &instrumentation.StatsEntry{
+			Scope:    instrumentation.TemplateScope,
+			StatsFor: key.kind,
+			Stats: []*instrumentation.Stat{
+				{Name: shadowComparisonsName, Value: counts.comparisons, Source: source},
+				{Name: shadowMismatchesName, Value: counts.mismatches, Source: source},
+				{Name: shadowErrorsName, Value: counts.errors, Source: source},
+			},
+			Labels: []*instrumentation.Label{
+				{Name: primaryDriverLabelName, Value: key.primary},
+			},
+		})
+	}
+
+	return entries
+}
+
+// shadowDriversForTemplate returns the drivers other than primary which have
+// code in template, in order of priority.
+func (c *Client) shadowDriversForTemplate(template *templates.ConstraintTemplate, primary string) []string {
+	if len(template.Spec.Targets) == 0 {
+		return nil
+	}
+
+	var result []string
+	for _, code := range template.Spec.Targets[0].Code {
+		if code.Engine == primary {
+			continue
+		}
+		if _, found := c.drivers[code.Engine]; !found {
+			continue
+		}
+		result = append(result, code.Engine)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return c.driverPriority[result[i]] < c.driverPriority[result[j]]
+	})
+
+	return result
+}
+
+// newShadowMismatch returns a ShadowMismatch for cached's Template.
+func newShadowMismatch(cached *templateClient, primary, shadow string) *ShadowMismatch {
+	mismatch := &ShadowMismatch{
+		Kind:          cached.template.Spec.CRD.Spec.Names.Kind,
+		PrimaryDriver: primary,
+		ShadowDriver:  shadow,
+	}
+
+	if len(cached.targets) > 0 {
+		mismatch.Target = cached.targets[0].GetName()
+	}
+
+	return mismatch
+}
+
+// syncShadowDrivers adds cached's Template and Constraints to each of its
+// shadow drivers and removes it from drivers which no longer shadow it. Must be
+// called with c.mtx locked, after cached is updated with the new Template.
+func (c *Client) syncShadowDrivers(ctx context.Context, cached *templateClient) {
+	if c.shadow == nil {
+		return
+	}
+
+	template := cached.template
+	primary := c.driverForTemplate(template)
+
+	want := make(map[string]bool)
+	for _, name := range c.shadowDriversForTemplate(template, primary) {
+		want[name] = true
+	}
+
+	for _, name := range sortedNames(cached.shadowDrivers) {
+		if want[name] {
+			continue
+		}
+
+		delete(cached.shadowDrivers, name)
+		if cached.activeDrivers[name] {
+			// The driver now enforces the Template.
+			continue
+		}
+
+		if err := c.drivers[name].RemoveTemplate(ctx, template); err != nil {
+			mismatch := newShadowMismatch(cached, primary, name)
+			mismatch.Err = err
+			c.shadow.recordErr(ctx, mismatch)
+		}
+	}
+
+	for _, name := range c.shadowDriversForTemplate(template, primary) {
+		driver := c.drivers[name]
+
+		err := driver.AddTemplate(ctx, template)
+		if err == nil {
+			for _, constraintEntry := range cached.constraints {
+				err = driver.AddConstraint(ctx, constraintEntry.getConstraint())
+				if err != nil {
+					err = fmt.Errorf("%w: while replaying constraints", err)
+					break
+				}
+			}
+		}
+
+		if err != nil {
+			c.dropShadowDriver(ctx, cached, primary, name, "", err)
+			continue
+		}
+
+		cached.shadowDrivers[name] = true
+	}
+}
+
+// dropShadowDriver stops shadow evaluation of cached's Template with the
+// shadow driver after it failed with err. Must be called with c.mtx locked.
+func (c *Client) dropShadowDriver(ctx context.Context, cached *templateClient, primary, shadow, constraint string, err error) {
+	mismatch := newShadowMismatch(cached, primary, shadow)
+	mismatch.Constraint = constraint
+	mismatch.Err = err
+	c.shadow.recordErr(ctx, mismatch)
+
+	delete(cached.shadowDrivers, shadow)
+
+	// Best-effort removal so the driver doesn't keep evaluating a stale version
+	// of the Template. The failure which caused this was already reported.
+	_ = c.drivers[shadow].RemoveTemplate(ctx, cached.template)
+}
+
+// addShadowConstraint adds constraint to the shadow drivers of cached's
+// Template. Must be called with c.mtx locked.
+func (c *Client) addShadowConstraint(ctx context.Context, cached *templateClient, constraint *unstructured.Unstructured) {
+	if c.shadow == nil {
+		return
+	}
+
+	primary := c.driverForTemplate(cached.template)
+	for _, name := range sortedNames(cached.shadowDrivers) {
+		if err := c.drivers[name].AddConstraint(ctx, constraint); err != nil {
+			c.dropShadowDriver(ctx, cached, primary, name, constraint.GetName(), err)
+		}
+	}
+}
+
+// removeShadowConstraint removes constraint from the shadow drivers of
+// cached's Template. Must be called with c.mtx locked.
+func (c *Client) removeShadowConstraint(ctx context.Context, cached *templateClient, constraint *unstructured.Unstructured) {
+	if c.shadow == nil {
+		return
+	}
+
+	primary := c.driverForTemplate(cached.template)
+	for _, name := range sortedNames(cached.shadowDrivers) {
+		if cached.activeDrivers[name] {
+			// Already removed from the driver as an active driver.
+			continue
+		}
+
+		if err := c.drivers[name].RemoveConstraint(ctx, constraint); err != nil {
+			c.dropShadowDriver(ctx, cached, primary, name, constraint.GetName(), err)
+		}
+	}
+}
+
+// removeShadowTemplate removes cached's Template from its shadow drivers. Must
+// be called with c.mtx locked.
+func (c *Client) removeShadowTemplate(ctx context.Context, cached *templateClient) {
+	if c.shadow == nil {
+		return
+	}
+
+	primary := c.driverForTemplate(cached.template)
+	for _, name := range sortedNames(cached.shadowDrivers) {
+		delete(cached.shadowDrivers, name)
+		if cached.activeDrivers[name] {
+			continue
+		}
+
+		if err := c.drivers[name].RemoveTemplate(ctx, cached.template); err != nil {
+			mismatch := newShadowMismatch(cached, primary, name)
+			mismatch.Err = err
+			c.shadow.recordErr(ctx, mismatch)
+		}
+	}
+}
+
+// shadowReview starts evaluating constraints with the shadow drivers of their
+// Templates in the background, and comparing the violations with
+// primaryResults, the results of the Templates' primary drivers. Constraints
+// whose primary driver failed are not compared. Does nothing if the maximum
+// number of shadow queries are already in flight. Must be called with c.mtx
+// read-locked.
+func (c *Client) shadowReview(ctx context.Context, target string, constraints []*unstructured.Unstructured, review interface{}, primaryResults []*types.Result, primaryErrs clienterrors.ErrorMap) {
+	shadowToConstraints := make(map[string][]*unstructured.Unstructured)
+	primaryForKind := make(map[string]string)
+
+	for _, constraint := range constraints {
+		template, found := c.templates[strings.ToLower(constraint.GetKind())]
+		if !found || len(template.shadowDrivers) == 0 {
+			continue
+		}
+
+		primary := c.driverForTemplate(template.template)
+		if _, failed := primaryErrs[primary]; failed {
+			continue
+		}
+		primaryForKind[constraint.GetKind()] = primary
+
+		for name := range template.shadowDrivers {
+			shadowToConstraints[name] = append(shadowToConstraints[name], constraint)
+		}
+	}
+
+	if len(shadowToConstraints) == 0 {
+		return
+	}
+
+	// The primary results are summarized now, as the caller owns them once
+	// Review returns.
+	primaryMessages := messagesByConstraint(primaryResults)
+
+	select {
+	case c.shadow.slots <- struct{}{}:
+	default:
+		return
+	}
+
+	// Shadow queries keep ctx's values, but not its deadline or cancellation,
+	// as they outlive the Review.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.shadow.timeout)
+
+	c.shadow.wg.Add(1)
+	go func() {
+		defer c.shadow.wg.Done()
+		defer func() { <-c.shadow.slots }()
+		defer cancel()
+
+		c.queryShadowDrivers(ctx, target, review, shadowToConstraints, primaryForKind, primaryMessages)
+	}()
+}
+
+// queryShadowDrivers queries each shadow driver for its constraints, and
+// records how the violations compare with primaryMessages. Does not require
+// c.mtx to be locked.
+func (c *Client) queryShadowDrivers(ctx context.Context, target string, review interface{}, shadowToConstraints map[string][]*unstructured.Unstructured, primaryForKind map[string]string, primaryMessages map[drivers.ConstraintKey][]string) {
+	for _, name := range sortedNames(shadowToConstraints) {
+		shadowConstraints := shadowToConstraints[name]
+
+		// Query options such as tracing are for the primary drivers, so shadow
+		// drivers are queried without them.
+		qr, err := c.drivers[name].Query(ctx, target, shadowConstraints, review)
+
+		var shadowMessages map[drivers.ConstraintKey][]string
+		if err == nil && qr != nil {
+			shadowMessages = messagesByConstraint(qr.Results)
+		}
+
+		for _, constraint := range shadowConstraints {
+			key := drivers.ConstraintKeyFrom(constraint)
+
+			mismatch := &ShadowMismatch{
+				Target:        target,
+				Kind:          key.Kind,
+				PrimaryDriver: primaryForKind[key.Kind],
+				ShadowDriver:  name,
+				Constraint:    key.Name,
+				Err:           err,
+			}
+
+			if err != nil {
+				// There are no violations to compare.
+				c.shadow.recordErr(ctx, mismatch)
+				continue
+			}
+
+			mismatch.Primary = primaryMessages[key]
+			mismatch.Shadow = shadowMessages[key]
+			c.shadow.record(ctx, mismatch, true, equalMessages(mismatch.Primary, mismatch.Shadow))
+		}
+	}
+}
+
+// messagesByConstraint returns the sorted messages of results for each
+// Constraint.
+func messagesByConstraint(results []*types.Result) map[drivers.ConstraintKey][]string {
+	messages := make(map[drivers.ConstraintKey][]string)
+	for _, result := range results {
+		if result == nil || result.Constraint == nil {
+			continue
+		}
+
+		key := drivers.ConstraintKeyFrom(result.Constraint)
+		messages[key] = append(messages[key], result.Msg)
+	}
+
+	for _, msgs := range messages {
+		sort.Strings(msgs)
+	}
+
+	return messages
+}
+
+func equalMessages(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
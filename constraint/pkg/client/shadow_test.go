@@ -0,0 +1,494 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/fake"
+	fakeschema "github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/fake/schema"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/handler/handlertest"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/instrumentation"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// comparableDriver is a fake Driver whose messages don't include the driver's
+// name, so drivers with the same code report the same violations.
+type comparableDriver struct {
+	*fake.Driver
+
+	// errOnQuery is whether Query fails.
+	errOnQuery bool
+	// unblock, if set, blocks Query until it is closed or the query's context
+	// is done.
+	unblock chan struct{}
+}
+
+func (d *comparableDriver) Query(ctx context.Context, target string, constraints []*unstructured.Unstructured, review interface{}, opts ...drivers.QueryOpt) (*drivers.QueryResponse, error) {
+	if d.errOnQuery {
+		return nil, fake.ErrTesting
+	}
+
+	if d.unblock != nil {
+		select {
+		case <-d.unblock:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	qr, err := d.Driver.Query(ctx, target, constraints, review, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := fmt.Sprintf("rejected by driver %s: ", d.Name())
+	for _, result := range qr.Results {
+		result.Msg = strings.TrimPrefix(result.Msg, prefix)
+	}
+
+	return qr, nil
+}
+
+func shadowStat(entries []*instrumentation.StatsEntry, statName string) uint64 {
+	for _, entry := range entries {
+		for _, stat := range entry.Stats {
+			if stat.Name == statName {
+				return stat.Value.(uint64)
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestClient_ShadowDrivers(t *testing.T) {
+	tcs := []struct {
+		name               string
+		primaryCode        string
+		shadowCode         string
+		errOnAddTemplate   bool
+		errOnAddConstraint bool
+		errOnQuery         bool
+
+		wantMismatches  []*client.ShadowMismatch
+		wantComparisons uint64
+		wantMismatched  uint64
+		wantErrors      uint64
+	}{{
+		name:            "drivers agree",
+		primaryCode:     "denied",
+		shadowCode:      "denied",
+		wantComparisons: 1,
+	}, {
+		name:        "drivers disagree",
+		primaryCode: "denied",
+		shadowCode:  "forbidden",
+		wantMismatches: []*client.ShadowMismatch{{
+			Target:        handlertest.TargetName,
+			Kind:          cts.MockTemplate,
+			PrimaryDriver: "primary",
+			ShadowDriver:  "shadow",
+			Constraint:    "foo",
+			Primary:       []string{"denied"},
+			Shadow:        []string{"forbidden"},
+		}},
+		wantComparisons: 1,
+		wantMismatched:  1,
+	}, {
+		name:             "shadow fails to add template",
+		primaryCode:      "denied",
+		shadowCode:       "denied",
+		errOnAddTemplate: true,
+		wantMismatches: []*client.ShadowMismatch{{
+			Target:        handlertest.TargetName,
+			Kind:          cts.MockTemplate,
+			PrimaryDriver: "primary",
+			ShadowDriver:  "shadow",
+			Err:           fake.ErrTesting,
+		}},
+		wantErrors: 1,
+	}, {
+		name:               "shadow fails to add constraint",
+		primaryCode:        "denied",
+		shadowCode:         "denied",
+		errOnAddConstraint: true,
+		wantMismatches: []*client.ShadowMismatch{{
+			Target:        handlertest.TargetName,
+			Kind:          cts.MockTemplate,
+			PrimaryDriver: "primary",
+			ShadowDriver:  "shadow",
+			Constraint:    "foo",
+			Err:           fake.ErrTesting,
+		}},
+		wantErrors: 1,
+	}, {
+		name:        "shadow fails to query",
+		primaryCode: "denied",
+		shadowCode:  "denied",
+		errOnQuery:  true,
+		wantMismatches: []*client.ShadowMismatch{{
+			Target:        handlertest.TargetName,
+			Kind:          cts.MockTemplate,
+			PrimaryDriver: "primary",
+			ShadowDriver:  "shadow",
+			Constraint:    "foo",
+			Err:           fake.ErrTesting,
+		}},
+		wantErrors: 1,
+	}}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			primary := &comparableDriver{Driver: fake.New("primary")}
+			shadow := &comparableDriver{Driver: fake.New("shadow"), errOnQuery: tc.errOnQuery}
+			shadow.SetErrOnAddTemplate(tc.errOnAddTemplate)
+			shadow.SetErrOnAddConstraint(tc.errOnAddConstraint)
+
+			var gotMismatches []*client.ShadowMismatch
+			c, err := client.NewClient(
+				client.Targets(&handlertest.Handler{}),
+				client.Driver(primary),
+				client.Driver(shadow),
+				client.ShadowDrivers(func(_ context.Context, mismatch *client.ShadowMismatch) {
+					gotMismatches = append(gotMismatches, mismatch)
+				}),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			template := cts.New(cts.OptTargets(cts.TargetCustomEngines(handlertest.TargetName,
+				cts.Code("primary", (&fakeschema.Source{RejectWith: tc.primaryCode}).ToUnstructured()),
+				cts.Code("shadow", (&fakeschema.Source{RejectWith: tc.shadowCode}).ToUnstructured()),
+			)))
+
+			_, err = c.AddTemplate(ctx, template)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+			_, err = c.AddConstraint(ctx, constraint)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			responses, err := c.Review(ctx, handlertest.NewReview("", "foo", "bar"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.WaitForShadowQueries(c)
+
+			results := responses.Results()
+			if len(results) != 1 || results[0].Msg != tc.primaryCode {
+				t.Errorf("got results %v, want only the primary driver's violation %q", results, tc.primaryCode)
+			}
+
+			if diff := cmp.Diff(tc.wantMismatches, gotMismatches, cmpopts.EquateErrors()); diff != "" {
+				t.Error(diff)
+			}
+
+			stats := c.ShadowStats()
+			if got := shadowStat(stats, "shadowComparisons"); got != tc.wantComparisons {
+				t.Errorf("got %d comparisons, want %d", got, tc.wantComparisons)
+			}
+			if got := shadowStat(stats, "shadowMismatches"); got != tc.wantMismatched {
+				t.Errorf("got %d mismatches, want %d", got, tc.wantMismatched)
+			}
+			if got := shadowStat(stats, "shadowErrors"); got != tc.wantErrors {
+				t.Errorf("got %d errors, want %d", got, tc.wantErrors)
+			}
+		})
+	}
+}
+
+func TestClient_ShadowSampling(t *testing.T) {
+	ctx := context.Background()
+
+	c, err := client.NewClient(
+		client.Targets(&handlertest.Handler{}),
+		client.Driver(&comparableDriver{Driver: fake.New("primary")}),
+		client.Driver(&comparableDriver{Driver: fake.New("shadow")}),
+		client.ShadowDrivers(nil),
+		client.ShadowSampling(3),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := cts.New(cts.OptTargets(cts.TargetCustomEngines(handlertest.TargetName,
+		cts.Code("primary", (&fakeschema.Source{RejectWith: "denied"}).ToUnstructured()),
+		cts.Code("shadow", (&fakeschema.Source{RejectWith: "denied"}).ToUnstructured()),
+	)))
+	_, err = c.AddTemplate(ctx, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.AddConstraint(ctx, cts.MakeConstraint(t, cts.MockTemplate, "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 7; i++ {
+		_, err = c.Review(ctx, handlertest.NewReview("", "foo", "bar"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.WaitForShadowQueries(c)
+	}
+
+	// The first, fourth, and seventh reviews are shadowed.
+	if got := shadowStat(c.ShadowStats(), "shadowComparisons"); got != 3 {
+		t.Errorf("got %d comparisons, want %d", got, 3)
+	}
+}
+
+func TestClient_ShadowSampling_Targets(t *testing.T) {
+	ctx := context.Background()
+
+	other := "other.target"
+	c, err := client.NewClient(
+		client.Targets(&handlertest.Handler{}, &handlertest.Handler{Name: &other}),
+		client.Driver(&comparableDriver{Driver: fake.New("primary")}),
+		client.Driver(&comparableDriver{Driver: fake.New("shadow")}),
+		client.ShadowDrivers(nil),
+		client.ShadowSampling(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := cts.New(cts.OptTargets(cts.TargetCustomEngines(handlertest.TargetName,
+		cts.Code("primary", (&fakeschema.Source{RejectWith: "denied"}).ToUnstructured()),
+		cts.Code("shadow", (&fakeschema.Source{RejectWith: "denied"}).ToUnstructured()),
+	)))
+	_, err = c.AddTemplate(ctx, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.AddConstraint(ctx, cts.MakeConstraint(t, cts.MockTemplate, "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		_, err = c.Review(ctx, handlertest.NewReview("", "foo", "bar"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.WaitForShadowQueries(c)
+	}
+
+	// Each review handled by both targets counts once, so the first and third
+	// reviews are shadowed.
+	if got := shadowStat(c.ShadowStats(), "shadowComparisons"); got != 2 {
+		t.Errorf("got %d comparisons, want %d", got, 2)
+	}
+}
+
+func TestClient_ShadowDrivers_Async(t *testing.T) {
+	shadow := &comparableDriver{Driver: fake.New("shadow"), unblock: make(chan struct{})}
+	c, err := client.NewClient(
+		client.Targets(&handlertest.Handler{}),
+		client.Driver(&comparableDriver{Driver: fake.New("primary")}),
+		client.Driver(shadow),
+		client.ShadowDrivers(nil),
+		client.ShadowConcurrency(1),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := cts.New(cts.OptTargets(cts.TargetCustomEngines(handlertest.TargetName,
+		cts.Code("primary", (&fakeschema.Source{RejectWith: "denied"}).ToUnstructured()),
+		cts.Code("shadow", (&fakeschema.Source{RejectWith: "denied"}).ToUnstructured()),
+	)))
+	_, err = c.AddTemplate(context.Background(), template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.AddConstraint(context.Background(), cts.MakeConstraint(t, cts.MockTemplate, "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The shadow query is blocked, so Review returns only because it doesn't
+	// wait for it. Canceling the Review's context doesn't cancel the shadow
+	// query, and the second review isn't shadowed while the first shadow
+	// query is in flight.
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		responses, err := c.Review(ctx, handlertest.NewReview("", "foo", "bar"))
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results := responses.Results(); len(results) != 1 || results[0].Msg != "denied" {
+			t.Errorf("got results %v, want the primary driver's violation", results)
+		}
+	}
+
+	close(shadow.unblock)
+	client.WaitForShadowQueries(c)
+
+	stats := c.ShadowStats()
+	if got := shadowStat(stats, "shadowComparisons"); got != 1 {
+		t.Errorf("got %d comparisons, want %d", got, 1)
+	}
+	if got := shadowStat(stats, "shadowErrors"); got != 0 {
+		t.Errorf("got %d errors, want %d", got, 0)
+	}
+}
+
+func TestClient_ShadowTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	var gotErr error
+	c, err := client.NewClient(
+		client.Targets(&handlertest.Handler{}),
+		client.Driver(&comparableDriver{Driver: fake.New("primary")}),
+		client.Driver(&comparableDriver{Driver: fake.New("shadow"), unblock: make(chan struct{})}),
+		client.ShadowDrivers(func(_ context.Context, mismatch *client.ShadowMismatch) {
+			gotErr = mismatch.Err
+		}),
+		client.ShadowTimeout(time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := cts.New(cts.OptTargets(cts.TargetCustomEngines(handlertest.TargetName,
+		cts.Code("primary", (&fakeschema.Source{RejectWith: "denied"}).ToUnstructured()),
+		cts.Code("shadow", (&fakeschema.Source{RejectWith: "denied"}).ToUnstructured()),
+	)))
+	_, err = c.AddTemplate(ctx, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.AddConstraint(ctx, cts.MakeConstraint(t, cts.MockTemplate, "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Review(ctx, handlertest.NewReview("", "foo", "bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.WaitForShadowQueries(c)
+
+	if !errors.Is(gotErr, context.DeadlineExceeded) {
+		t.Errorf("got shadow error %v, want %v", gotErr, context.DeadlineExceeded)
+	}
+}
+
+func TestClient_ShadowOpts_Invalid(t *testing.T) {
+	tcs := []struct {
+		name string
+		opt  client.Opt
+	}{{
+		name: "sampling",
+		opt:  client.ShadowSampling(0),
+	}, {
+		name: "concurrency",
+		opt:  client.ShadowConcurrency(0),
+	}, {
+		name: "timeout",
+		opt:  client.ShadowTimeout(0),
+	}}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := client.NewClient(
+				client.Targets(&handlertest.Handler{}),
+				client.Driver(fake.New("primary")),
+				client.ShadowDrivers(nil),
+				tc.opt,
+			)
+			if !errors.Is(err, client.ErrCreatingClient) {
+				t.Errorf("got NewClient() error = %v, want %v", err, client.ErrCreatingClient)
+			}
+		})
+	}
+}
+
+func TestClient_ShadowDrivers_Remove(t *testing.T) {
+	ctx := context.Background()
+
+	primary := fake.New("primary")
+	shadow := fake.New("shadow")
+
+	c, err := client.NewClient(
+		client.Targets(&handlertest.Handler{}),
+		client.Driver(primary),
+		client.Driver(shadow),
+		client.ShadowDrivers(nil),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := cts.New(cts.OptTargets(cts.TargetCustomEngines(handlertest.TargetName,
+		cts.Code("primary", (&fakeschema.Source{RejectWith: "denied"}).ToUnstructured()),
+		cts.Code("shadow", (&fakeschema.Source{RejectWith: "denied"}).ToUnstructured()),
+	)))
+
+	_, err = c.AddTemplate(ctx, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	_, err = c.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := shadow.GetConstraintsForTemplate(template); len(got) != 1 {
+		t.Fatalf("got shadow constraints %v, want %q", got, constraint.GetName())
+	}
+
+	_, err = c.RemoveConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := shadow.GetConstraintsForTemplate(template); len(got) != 0 {
+		t.Errorf("got shadow constraints %v after RemoveConstraint, want none", got)
+	}
+
+	_, err = c.RemoveTemplate(ctx, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := shadow.GetTemplateCode(); len(got) != 0 {
+		t.Errorf("got shadow templates %v after RemoveTemplate, want none", got)
+	}
+}
+
+func TestClient_ShadowDrivers_GetDescriptionForStat(t *testing.T) {
+	c, err := client.NewClient(
+		client.Targets(&handlertest.Handler{}),
+		client.Driver(fake.New("primary")),
+		client.ShadowDrivers(nil),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := instrumentation.Source{Type: instrumentation.EngineSourceType, Value: "primary"}
+	if got := c.GetDescriptionForStat(source, "shadowMismatches"); got == instrumentation.UnknownDescription {
+		t.Errorf("got description %q, want a description", got)
+	}
+}
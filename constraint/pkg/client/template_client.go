@@ -42,12 +42,17 @@ type templateClient struct {
 	// activeDrivers keeps track of drivers that are in an ambiguous state due to a failed
 	// cross-driver update. This allows us to clean up stale state on old drivers.
 	activeDrivers map[string]bool
+
+	// shadowDrivers are the drivers other than the primary driver which
+	// currently evaluate this Template in shadow. See ShadowDrivers.
+	shadowDrivers map[string]bool
 }
 
 func newTemplateClient() *templateClient {
 	return &templateClient{
 		constraints:   make(map[string]*constraintClient),
 		activeDrivers: make(map[string]bool),
+		shadowDrivers: make(map[string]bool),
 	}
 }
 
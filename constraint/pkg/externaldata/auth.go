@@ -0,0 +1,349 @@
+package externaldata
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/apis/externaldata/unversioned"
+)
+
+// ErrNoCredentialResolver is returned for providers whose credentials are in a
+// secret when no CredentialResolver is configured.
+var ErrNoCredentialResolver = errors.New("no credential resolver is configured")
+
+// ErrCredentialNotAllowed is returned for credential files outside the
+// Authenticator's credential directories, and for secrets a CredentialResolver
+// does not allow providers to use.
+var ErrCredentialNotAllowed = errors.New("credential not allowed")
+
+// ErrMissingCredential is returned when a referenced secret does not hold the
+// expected credential.
+var ErrMissingCredential = errors.New("missing credential")
+
+const (
+	defaultTokenKey        = "token"
+	defaultSignatureKeyKey = "key"
+	tlsCertKey             = "tls.crt"
+	tlsKeyKey              = "tls.key"
+
+	signatureAlgorithm = "hmac-sha256"
+	signatureHeaders   = "(request-target) host date digest"
+)
+
+// CredentialResolver resolves references to secrets holding provider
+// credentials, returning the secret's data by key.
+//
+// Resolve is called for every request which needs the secret, so
+// implementations which fetch secrets remotely should cache them, for example
+// with an informer. Rotated credentials take effect as soon as Resolve returns
+// them.
+//
+// Any Provider may reference any secret, so Resolve should return an error
+// wrapping ErrCredentialNotAllowed for secrets providers may not use, for
+// example those outside the namespaces AllowNamespaces permits.
+type CredentialResolver interface {
+	Resolve(ctx context.Context, ref unversioned.SecretReference) (map[string][]byte, error)
+}
+
+// AllowNamespaces returns a CredentialResolver which resolves references with
+// resolver only if they are in one of namespaces, and otherwise rejects them
+// with ErrCredentialNotAllowed.
+func AllowNamespaces(resolver CredentialResolver, namespaces ...string) CredentialResolver {
+	allowed := make(map[string]bool, len(namespaces))
+	for _, namespace := range namespaces {
+		allowed[namespace] = true
+	}
+
+	return &namespaceResolver{resolver: resolver, allowed: allowed}
+}
+
+type namespaceResolver struct {
+	resolver CredentialResolver
+	allowed  map[string]bool
+}
+
+func (r *namespaceResolver) Resolve(ctx context.Context, ref unversioned.SecretReference) (map[string][]byte, error) {
+	if !r.allowed[ref.Namespace] {
+		return nil, fmt.Errorf("%w: namespace %q is not allowed", ErrCredentialNotAllowed, ref.Namespace)
+	}
+
+	return r.resolver.Resolve(ctx, ref)
+}
+
+// Authenticator sends requests to providers, authenticating them as
+// configured by each provider's Auth. Credentials in files are re-read when
+// the files change, and credentials in secrets are resolved for each request,
+// so rotated credentials take effect without a restart.
+//
+// Threadsafe.
+type Authenticator struct {
+	resolver CredentialResolver
+	// credentialDirs are the directories credential files may be read from.
+	credentialDirs []string
+
+	mtx sync.Mutex
+	// files holds the last contents read from each credential file, by path.
+	files map[string]*cachedFile
+	// certs holds the last client certificate parsed for each provider, by
+	// provider name, so unchanged certificates are not parsed for each request.
+	certs map[string]*cachedCert
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+type cachedFile struct {
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+type cachedCert struct {
+	certPEM []byte
+	keyPEM  []byte
+	cert    *tls.Certificate
+}
+
+// NewAuthenticator returns an Authenticator which resolves secrets with
+// resolver, and reads credential files only from within credentialDirs.
+// resolver may be nil if no provider references a secret. Without
+// credentialDirs, providers may not authenticate with credential files, since
+// any Provider could otherwise send any file the driver can read, such as its
+// service account token, to its URL.
+func NewAuthenticator(resolver CredentialResolver, credentialDirs ...string) *Authenticator {
+	return &Authenticator{
+		resolver:       resolver,
+		credentialDirs: credentialDirs,
+		files:          make(map[string]*cachedFile),
+		certs:          make(map[string]*cachedCert),
+		now:            time.Now,
+	}
+}
+
+// Send sends keys to provider like DefaultSendRequestToProvider, authenticating
+// the request as configured by the provider's Auth. clientCert is presented to
+// the provider unless it configures its own client certificate.
+func (a *Authenticator) Send(ctx context.Context, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate) (*ProviderResponse, int, error) {
+	auth := provider.Spec.Auth
+	if auth == nil {
+		return DefaultSendRequestToProvider(ctx, provider, keys, clientCert)
+	}
+
+	if auth.ClientCert != nil {
+		cert, err := a.clientCert(ctx, provider.Name, auth.ClientCert)
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("failed to load client certificate for provider %q: %w", provider.Name, err)
+		}
+		clientCert = cert
+	}
+
+	return sendRequestToProvider(ctx, provider, keys, clientCert, func(req *http.Request, body []byte) error {
+		return a.authorize(ctx, auth, req, body)
+	})
+}
+
+// authorize adds the headers auth requires to req.
+func (a *Authenticator) authorize(ctx context.Context, auth *unversioned.ProviderAuth, req *http.Request, body []byte) error {
+	if auth.BearerToken != nil {
+		token, err := a.credential(ctx, auth.BearerToken.TokenFile, auth.BearerToken.SecretRef, defaultTokenKey)
+		if err != nil {
+			return fmt.Errorf("reading bearer token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	if auth.HTTPSignature != nil {
+		key, err := a.credential(ctx, auth.HTTPSignature.KeyFile, auth.HTTPSignature.SecretRef, defaultSignatureKeyKey)
+		if err != nil {
+			return fmt.Errorf("reading signature key: %w", err)
+		}
+		a.sign(req, body, auth.HTTPSignature.KeyID, key)
+	}
+
+	return nil
+}
+
+// sign adds Date, Digest, and Signature headers to req, signing its target,
+// host, date, and the digest of body with key.
+func (a *Authenticator) sign(req *http.Request, body []byte, keyID string, key []byte) {
+	digest := sha256.Sum256(body)
+	digestHeader := "SHA-256=" + base64.StdEncoding.EncodeToString(digest[:])
+	date := a.now().UTC().Format(http.TimeFormat)
+
+	req.Header.Set("Date", date)
+	req.Header.Set("Digest", digestHeader)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(SigningString(req.Method, req.URL.RequestURI(), req.URL.Host, date, digestHeader)))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req.Header.Set("Signature", fmt.Sprintf("keyId=%q,algorithm=%q,headers=%q,signature=%q",
+		keyID, signatureAlgorithm, signatureHeaders, signature))
+}
+
+// SigningString returns the string a request's Signature header signs, so
+// providers can verify requests signed as configured by HTTPSignatureAuth.
+func SigningString(method, requestURI, host, date, digest string) string {
+	return fmt.Sprintf("(request-target): %s %s\nhost: %s\ndate: %s\ndigest: %s",
+		strings.ToLower(method), requestURI, host, date, digest)
+}
+
+// clientCert returns the client certificate configured by auth for provider.
+func (a *Authenticator) clientCert(ctx context.Context, provider string, auth *unversioned.ClientCertAuth) (*tls.Certificate, error) {
+	var certPEM, keyPEM []byte
+	var err error
+
+	if auth.SecretRef != nil {
+		var data map[string][]byte
+		data, err = a.resolve(ctx, auth.SecretRef)
+		if err != nil {
+			return nil, err
+		}
+		certPEM, keyPEM = data[tlsCertKey], data[tlsKeyKey]
+		if len(certPEM) == 0 || len(keyPEM) == 0 {
+			return nil, fmt.Errorf("%w: secret %s must hold %s and %s",
+				ErrMissingCredential, secretName(auth.SecretRef), tlsCertKey, tlsKeyKey)
+		}
+	} else {
+		if certPEM, err = a.readFile(auth.CertFile); err != nil {
+			return nil, err
+		}
+		if keyPEM, err = a.readFile(auth.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	// Reuse the parsed certificate while it is unchanged, which also lets
+	// concurrent requests presenting it be coalesced.
+	if cached, found := a.certs[provider]; found && bytes.Equal(cached.certPEM, certPEM) && bytes.Equal(cached.keyPEM, keyPEM) {
+		return cached.cert, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parsing client certificate: %w", err)
+	}
+
+	a.certs[provider] = &cachedCert{certPEM: certPEM, keyPEM: keyPEM, cert: &cert}
+	return &cert, nil
+}
+
+// credential returns the credential in file, or in ref under its Key, or
+// defaultKey if ref sets no Key.
+func (a *Authenticator) credential(ctx context.Context, file string, ref *unversioned.SecretReference, defaultKey string) ([]byte, error) {
+	if ref == nil {
+		return a.readFile(file)
+	}
+
+	data, err := a.resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	key := ref.Key
+	if key == "" {
+		key = defaultKey
+	}
+
+	credential, found := data[key]
+	if !found {
+		return nil, fmt.Errorf("%w: secret %s has no key %q", ErrMissingCredential, secretName(ref), key)
+	}
+
+	return credential, nil
+}
+
+func (a *Authenticator) resolve(ctx context.Context, ref *unversioned.SecretReference) (map[string][]byte, error) {
+	if a.resolver == nil {
+		return nil, fmt.Errorf("%w: resolving secret %s", ErrNoCredentialResolver, secretName(ref))
+	}
+
+	data, err := a.resolver.Resolve(ctx, *ref)
+	if err != nil {
+		return nil, fmt.Errorf("resolving secret %s: %w", secretName(ref), err)
+	}
+
+	return data, nil
+}
+
+// readFile returns the contents of path, reading it again only if its
+// modification time or size has changed since it was last read.
+func (a *Authenticator) readFile(path string) ([]byte, error) {
+	path, err := a.allowedFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mtx.Lock()
+	cached, found := a.files[path]
+	a.mtx.Unlock()
+
+	if found && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.data, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mtx.Lock()
+	a.files[path] = &cachedFile{modTime: info.ModTime(), size: info.Size(), data: data}
+	a.mtx.Unlock()
+
+	return data, nil
+}
+
+// allowedFile returns path with symlinks resolved, or an error if it is not
+// within one of the Authenticator's credential directories.
+func (a *Authenticator) allowedFile(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("%w: credential file %q is not an absolute path", ErrCredentialNotAllowed, path)
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+
+	for _, dir := range a.credentialDirs {
+		resolvedDir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+
+		rel, err := filepath.Rel(resolvedDir, resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return resolved, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: credential file %q is not within a credential directory", ErrCredentialNotAllowed, path)
+}
+
+func secretName(ref *unversioned.SecretReference) string {
+	if ref.Namespace == "" {
+		return ref.Name
+	}
+	return ref.Namespace + "/" + ref.Name
+}
@@ -0,0 +1,356 @@
+package externaldata
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/apis/externaldata/unversioned"
+)
+
+// authServer is a provider which records how each request was authenticated.
+type authServer struct {
+	*httptest.Server
+
+	mtx sync.Mutex
+	// clientCN is the common name of the last client certificate presented.
+	clientCN string
+	header   http.Header
+	body     []byte
+}
+
+func newAuthServer(t *testing.T) *authServer {
+	s := &authServer{}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mtx.Lock()
+		s.clientCN = ""
+		if len(r.TLS.PeerCertificates) > 0 {
+			s.clientCN = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		s.header = r.Header.Clone()
+		s.body = body
+		s.mtx.Unlock()
+
+		_ = json.NewEncoder(w).Encode(&ProviderResponse{
+			APIVersion: "externaldata.gatekeeper.sh/v1beta1",
+			Kind:       ProviderResponseKind,
+			Response:   Response{Idempotent: true},
+		})
+	}))
+	s.TLS = &tls.Config{ClientAuth: tls.RequestClientCert, MinVersion: tls.VersionTLS13}
+	s.StartTLS()
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *authServer) provider(auth *unversioned.ProviderAuth) *unversioned.Provider {
+	caBundle := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+
+	provider := testProvider("foo", s.URL)
+	provider.Spec.CABundle = base64.StdEncoding.EncodeToString(caBundle)
+	provider.Spec.Auth = auth
+
+	return provider
+}
+
+func (s *authServer) last() (string, http.Header, []byte) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.clientCN, s.header, s.body
+}
+
+// newClientCert returns a PEM-encoded self-signed certificate and key with
+// common name cn.
+func newClientCert(t *testing.T, cn string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes data to name in dir, with a modification time later than
+// any previous write so the change is observed.
+func writeFile(t *testing.T, dir, name string, data []byte, modTime time.Time) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// fakeResolver holds secrets by namespace/name.
+type fakeResolver map[string]map[string][]byte
+
+func (r fakeResolver) Resolve(_ context.Context, ref unversioned.SecretReference) (map[string][]byte, error) {
+	data, found := r[ref.Namespace+"/"+ref.Name]
+	if !found {
+		return nil, fmt.Errorf("secret %s/%s not found", ref.Namespace, ref.Name)
+	}
+	return data, nil
+}
+
+func TestAuthenticator_Send(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	globalCertPEM, globalKeyPEM := newClientCert(t, "global")
+	globalCert, err := tls.X509KeyPair(globalCertPEM, globalKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	providerCertPEM, providerKeyPEM := newClientCert(t, "provider")
+	certFile := writeFile(t, dir, "tls.crt", providerCertPEM, now)
+	keyFile := writeFile(t, dir, "tls.key", providerKeyPEM, now)
+	tokenFile := writeFile(t, dir, "token", []byte("file-token\n"), now)
+	signatureKeyFile := writeFile(t, dir, "signature-key", []byte("file-key"), now)
+
+	// outsideFile is not within the Authenticator's credential directory, and
+	// neither is the file linkFile links to.
+	outsideFile := writeFile(t, t.TempDir(), "token", []byte("outside-token"), now)
+	linkFile := filepath.Join(dir, "link")
+	if err := os.Symlink(outsideFile, linkFile); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver := fakeResolver{
+		"gatekeeper-system/provider-tls": {tlsCertKey: providerCertPEM, tlsKeyKey: providerKeyPEM},
+		"gatekeeper-system/provider-token": {
+			defaultTokenKey: []byte("secret-token"),
+			"custom":        []byte("custom-token"),
+		},
+		"gatekeeper-system/provider-signature": {defaultSignatureKeyKey: []byte("secret-key")},
+	}
+	secretRef := func(name, key string) *unversioned.SecretReference {
+		return &unversioned.SecretReference{Name: name, Namespace: "gatekeeper-system", Key: key}
+	}
+
+	tcs := []struct {
+		name          string
+		auth          *unversioned.ProviderAuth
+		resolver      CredentialResolver
+		wantClientCN  string
+		wantAuthz     string
+		wantSignature []byte
+		wantErr       error
+	}{{
+		name:         "no auth presents driver certificate",
+		wantClientCN: "global",
+	}, {
+		name:         "client certificate file",
+		auth:         &unversioned.ProviderAuth{ClientCert: &unversioned.ClientCertAuth{CertFile: certFile, KeyFile: keyFile}},
+		wantClientCN: "provider",
+	}, {
+		name:         "client certificate secret",
+		auth:         &unversioned.ProviderAuth{ClientCert: &unversioned.ClientCertAuth{SecretRef: secretRef("provider-tls", "")}},
+		resolver:     resolver,
+		wantClientCN: "provider",
+	}, {
+		name:         "bearer token file",
+		auth:         &unversioned.ProviderAuth{BearerToken: &unversioned.BearerTokenAuth{TokenFile: tokenFile}},
+		wantClientCN: "global",
+		wantAuthz:    "Bearer file-token",
+	}, {
+		name:         "bearer token secret",
+		auth:         &unversioned.ProviderAuth{BearerToken: &unversioned.BearerTokenAuth{SecretRef: secretRef("provider-token", "")}},
+		resolver:     resolver,
+		wantClientCN: "global",
+		wantAuthz:    "Bearer secret-token",
+	}, {
+		name:         "bearer token secret with key",
+		auth:         &unversioned.ProviderAuth{BearerToken: &unversioned.BearerTokenAuth{SecretRef: secretRef("provider-token", "custom")}},
+		resolver:     resolver,
+		wantClientCN: "global",
+		wantAuthz:    "Bearer custom-token",
+	}, {
+		name: "http signature file",
+		auth: &unversioned.ProviderAuth{HTTPSignature: &unversioned.HTTPSignatureAuth{
+			KeyID: "gatekeeper", KeyFile: signatureKeyFile,
+		}},
+		wantClientCN:  "global",
+		wantSignature: []byte("file-key"),
+	}, {
+		name: "http signature secret",
+		auth: &unversioned.ProviderAuth{HTTPSignature: &unversioned.HTTPSignatureAuth{
+			KeyID: "gatekeeper", SecretRef: secretRef("provider-signature", ""),
+		}},
+		resolver:      resolver,
+		wantClientCN:  "global",
+		wantSignature: []byte("secret-key"),
+	}, {
+		name:    "file outside credential directories",
+		auth:    &unversioned.ProviderAuth{BearerToken: &unversioned.BearerTokenAuth{TokenFile: outsideFile}},
+		wantErr: ErrCredentialNotAllowed,
+	}, {
+		name:    "file linking outside credential directories",
+		auth:    &unversioned.ProviderAuth{BearerToken: &unversioned.BearerTokenAuth{TokenFile: linkFile}},
+		wantErr: ErrCredentialNotAllowed,
+	}, {
+		name:    "relative file",
+		auth:    &unversioned.ProviderAuth{BearerToken: &unversioned.BearerTokenAuth{TokenFile: "token"}},
+		wantErr: ErrCredentialNotAllowed,
+	}, {
+		name:         "secret in allowed namespace",
+		auth:         &unversioned.ProviderAuth{BearerToken: &unversioned.BearerTokenAuth{SecretRef: secretRef("provider-token", "")}},
+		resolver:     AllowNamespaces(resolver, "gatekeeper-system"),
+		wantClientCN: "global",
+		wantAuthz:    "Bearer secret-token",
+	}, {
+		name:     "secret in disallowed namespace",
+		auth:     &unversioned.ProviderAuth{BearerToken: &unversioned.BearerTokenAuth{SecretRef: secretRef("provider-token", "")}},
+		resolver: AllowNamespaces(resolver, "other"),
+		wantErr:  ErrCredentialNotAllowed,
+	}, {
+		name:    "secret without resolver",
+		auth:    &unversioned.ProviderAuth{BearerToken: &unversioned.BearerTokenAuth{SecretRef: secretRef("provider-token", "")}},
+		wantErr: ErrNoCredentialResolver,
+	}, {
+		name:     "secret without key",
+		auth:     &unversioned.ProviderAuth{BearerToken: &unversioned.BearerTokenAuth{SecretRef: secretRef("provider-token", "missing")}},
+		resolver: resolver,
+		wantErr:  ErrMissingCredential,
+	}, {
+		name:     "secret without certificate",
+		auth:     &unversioned.ProviderAuth{ClientCert: &unversioned.ClientCertAuth{SecretRef: secretRef("provider-token", "")}},
+		resolver: resolver,
+		wantErr:  ErrMissingCredential,
+	}}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newAuthServer(t)
+			a := NewAuthenticator(tc.resolver, dir)
+
+			_, statusCode, err := a.Send(context.Background(), server.provider(tc.auth), []string{"a"}, &globalCert)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+			if statusCode != http.StatusOK {
+				t.Errorf("got status code %d, want %d", statusCode, http.StatusOK)
+			}
+
+			clientCN, header, body := server.last()
+			if clientCN != tc.wantClientCN {
+				t.Errorf("got client certificate %q, want %q", clientCN, tc.wantClientCN)
+			}
+			if got := header.Get("Authorization"); got != tc.wantAuthz {
+				t.Errorf("got Authorization %q, want %q", got, tc.wantAuthz)
+			}
+
+			if tc.wantSignature == nil {
+				if got := header.Get("Signature"); got != "" {
+					t.Errorf("got Signature %q, want none", got)
+				}
+				return
+			}
+
+			digest := sha256.Sum256(body)
+			wantDigest := "SHA-256=" + base64.StdEncoding.EncodeToString(digest[:])
+			if got := header.Get("Digest"); got != wantDigest {
+				t.Errorf("got Digest %q, want %q", got, wantDigest)
+			}
+
+			mac := hmac.New(sha256.New, tc.wantSignature)
+			mac.Write([]byte(SigningString(http.MethodPost, "/", server.Listener.Addr().String(), header.Get("Date"), wantDigest)))
+			wantSignature := fmt.Sprintf(`keyId="gatekeeper",algorithm="hmac-sha256",headers="(request-target) host date digest",signature=%q`,
+				base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+			if got := header.Get("Signature"); got != wantSignature {
+				t.Errorf("got Signature %q, want %q", got, wantSignature)
+			}
+		})
+	}
+}
+
+func TestAuthenticator_Send_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	certPEM, keyPEM := newClientCert(t, "before")
+	certFile := writeFile(t, dir, "tls.crt", certPEM, now)
+	keyFile := writeFile(t, dir, "tls.key", keyPEM, now)
+	tokenFile := writeFile(t, dir, "token", []byte("before"), now)
+
+	server := newAuthServer(t)
+	provider := server.provider(&unversioned.ProviderAuth{
+		ClientCert:  &unversioned.ClientCertAuth{CertFile: certFile, KeyFile: keyFile},
+		BearerToken: &unversioned.BearerTokenAuth{TokenFile: tokenFile},
+	})
+	a := NewAuthenticator(nil, dir)
+
+	send := func(wantCN, wantAuthz string) {
+		t.Helper()
+
+		if _, _, err := a.Send(context.Background(), provider, []string{"a"}, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		clientCN, header, _ := server.last()
+		if clientCN != wantCN {
+			t.Errorf("got client certificate %q, want %q", clientCN, wantCN)
+		}
+		if got := header.Get("Authorization"); got != wantAuthz {
+			t.Errorf("got Authorization %q, want %q", got, wantAuthz)
+		}
+	}
+
+	send("before", "Bearer before")
+
+	later := now.Add(time.Minute)
+	certPEM, keyPEM = newClientCert(t, "after")
+	writeFile(t, dir, "tls.crt", certPEM, later)
+	writeFile(t, dir, "tls.key", keyPEM, later)
+	writeFile(t, dir, "token", []byte("after"), later)
+
+	send("after", "Bearer after")
+}
@@ -19,9 +19,16 @@ type ProviderCache struct {
 	mux   sync.RWMutex
 }
 
+// ProviderResponseCache is an unbounded ResponseCache which evicts expired
+// values periodically in a background goroutine.
 type ProviderResponseCache struct {
 	cache sync.Map
 	TTL   time.Duration
+	// ErrorTTL, if positive, is how long values with errors are cached unless
+	// they set their own TTL. Otherwise, TTL applies.
+	ErrorTTL time.Duration
+
+	stats cacheStats
 }
 
 type CacheKey struct {
@@ -34,6 +41,9 @@ type CacheValue struct {
 	Value      interface{}
 	Error      string
 	Idempotent bool
+	// TTL, if positive, is how long the value is cached after Received instead
+	// of the cache's TTL.
+	TTL time.Duration
 }
 
 func NewProviderResponseCache(ctx context.Context, ttl time.Duration) *ProviderResponseCache {
@@ -43,7 +53,7 @@ func NewProviderResponseCache(ctx context.Context, ttl time.Duration) *ProviderR
 	}
 
 	go wait.UntilWithContext(ctx, func(ctx context.Context) {
-		providerResponseCache.invalidateProviderResponseCache(providerResponseCache.TTL)
+		providerResponseCache.invalidateProviderResponseCache()
 	}, ttl)
 
 	return providerResponseCache
@@ -55,9 +65,13 @@ func (c *ProviderResponseCache) Get(key CacheKey) (*CacheValue, error) {
 		if !ok {
 			return nil, fmt.Errorf("value is not of type CacheValue")
 		}
-		return value, nil
+		if !value.expired(time.Now(), c.TTL, c.ErrorTTL) {
+			c.stats.hit(key.ProviderName)
+			return value, nil
+		}
 	}
-	return nil, fmt.Errorf("key '%s:%s' is not found in provider response cache", key.ProviderName, key.Key)
+	c.stats.miss(key.ProviderName)
+	return nil, errKeyNotFound(key)
 }
 
 func (c *ProviderResponseCache) Upsert(key CacheKey, value CacheValue) {
@@ -68,19 +82,25 @@ func (c *ProviderResponseCache) Remove(key CacheKey) {
 	c.cache.Delete(key)
 }
 
-func (c *ProviderResponseCache) invalidateProviderResponseCache(ttl time.Duration) {
+func (c *ProviderResponseCache) Stats() map[string]CacheStats {
+	return c.stats.snapshot()
+}
+
+func (c *ProviderResponseCache) invalidateProviderResponseCache() {
+	now := time.Now()
 	c.cache.Range(func(k, v interface{}) bool {
 		value, ok := v.(*CacheValue)
 		if !ok {
 			return false
 		}
 
-		if time.Since(time.Unix(value.Received, 0)) > ttl {
+		if value.expired(now, c.TTL, c.ErrorTTL) {
 			key, ok := k.(CacheKey)
 			if !ok {
 				return false
 			}
 			c.Remove(key)
+			c.stats.evict(key.ProviderName)
 		}
 		return true
 	})
@@ -119,6 +139,22 @@ func (c *ProviderCache) Upsert(provider *unversioned.Provider) error {
 	if err := isValidCABundle(provider); err != nil {
 		return err
 	}
+	if !isValidRetryPolicy(provider.Spec.RetryPolicy) {
+		return fmt.Errorf("provider retryPolicy fields should be non-negative integers. value: %+v", *provider.Spec.RetryPolicy)
+	}
+	if !isValidCircuitBreaker(provider.Spec.CircuitBreaker) {
+		return fmt.Errorf("provider circuitBreaker fields should be non-negative integers. value: %+v", *provider.Spec.CircuitBreaker)
+	}
+	if !isValidResponseCachePolicy(provider.Spec.ResponseCache) {
+		return fmt.Errorf("provider responseCache fields should be non-negative integers. value: %+v", *provider.Spec.ResponseCache)
+	}
+	if !isValidFailurePolicy(provider.Spec.FailurePolicy) {
+		return fmt.Errorf("provider failurePolicy should be %q or %q. value: %s",
+			unversioned.FailurePolicyFail, unversioned.FailurePolicyIgnore, provider.Spec.FailurePolicy)
+	}
+	if err := isValidAuth(provider.Spec.Auth); err != nil {
+		return err
+	}
 
 	c.cache[provider.GetName()] = *provider.DeepCopy()
 	return nil
@@ -143,6 +179,78 @@ func isValidTimeout(timeout int) bool {
 	return timeout >= 0
 }
 
+func isValidRetryPolicy(policy *unversioned.RetryPolicy) bool {
+	if policy == nil {
+		return true
+	}
+	return policy.MaxRetries >= 0 && policy.InitialBackoffMilliseconds >= 0 && policy.MaxBackoffMilliseconds >= 0
+}
+
+func isValidCircuitBreaker(cb *unversioned.CircuitBreaker) bool {
+	if cb == nil {
+		return true
+	}
+	return cb.FailureThreshold >= 0 && cb.OpenSeconds >= 0
+}
+
+func isValidResponseCachePolicy(policy *unversioned.ResponseCachePolicy) bool {
+	if policy == nil {
+		return true
+	}
+	return policy.TTLSeconds >= 0 && policy.ErrorTTLSeconds >= 0
+}
+
+func isValidFailurePolicy(policy unversioned.FailurePolicyType) bool {
+	switch policy {
+	case "", unversioned.FailurePolicyFail, unversioned.FailurePolicyIgnore:
+		return true
+	default:
+		return false
+	}
+}
+
+func isValidAuth(auth *unversioned.ProviderAuth) error {
+	if auth == nil {
+		return nil
+	}
+
+	// oneSource returns an error unless exactly one of a file or secretRef
+	// holds the credential.
+	oneSource := func(field string, hasFile bool, secretRef *unversioned.SecretReference) error {
+		if hasFile == (secretRef != nil) {
+			return fmt.Errorf("provider auth.%s should set exactly one of its file and secretRef", field)
+		}
+		if secretRef != nil && secretRef.Name == "" {
+			return fmt.Errorf("provider auth.%s.secretRef name can not be empty", field)
+		}
+		return nil
+	}
+
+	if cert := auth.ClientCert; cert != nil {
+		if (cert.CertFile == "") != (cert.KeyFile == "") {
+			return fmt.Errorf("provider auth.clientCert should set both certFile and keyFile")
+		}
+		if err := oneSource("clientCert", cert.CertFile != "", cert.SecretRef); err != nil {
+			return err
+		}
+	}
+	if token := auth.BearerToken; token != nil {
+		if err := oneSource("bearerToken", token.TokenFile != "", token.SecretRef); err != nil {
+			return err
+		}
+	}
+	if signature := auth.HTTPSignature; signature != nil {
+		if signature.KeyID == "" {
+			return fmt.Errorf("provider auth.httpSignature keyID can not be empty")
+		}
+		if err := oneSource("httpSignature", signature.KeyFile != "", signature.SecretRef); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func isValidCABundle(provider *unversioned.Provider) error {
 	// verify attempts to parse the caBundle as a PEM encoded certificate
 	// to make sure it is valid before adding it to the cache
@@ -35,6 +35,11 @@ func createProvider(name string, url string, timeout int, caBundle string) *unve
 	}
 }
 
+func withSpec(provider *unversioned.Provider, mutate func(spec *unversioned.ProviderSpec)) *unversioned.Provider {
+	mutate(&provider.Spec)
+	return provider
+}
+
 func TestUpsert(t *testing.T) {
 	tc := []cacheTestCase{
 		{
@@ -97,6 +102,91 @@ func TestUpsert(t *testing.T) {
 			Provider:      &unversioned.Provider{},
 			ErrorExpected: true,
 		},
+		{
+			Name: "valid resilience settings",
+			Provider: withSpec(createProvider("test", "https://test", 1, validCABundle), func(spec *unversioned.ProviderSpec) {
+				spec.RetryPolicy = &unversioned.RetryPolicy{MaxRetries: 3, InitialBackoffMilliseconds: 10}
+				spec.CircuitBreaker = &unversioned.CircuitBreaker{FailureThreshold: 5}
+				spec.FailurePolicy = unversioned.FailurePolicyIgnore
+			}),
+			ErrorExpected: false,
+		},
+		{
+			Name: "negative max retries",
+			Provider: withSpec(createProvider("test", "https://test", 1, validCABundle), func(spec *unversioned.ProviderSpec) {
+				spec.RetryPolicy = &unversioned.RetryPolicy{MaxRetries: -1}
+			}),
+			ErrorExpected: true,
+		},
+		{
+			Name: "negative failure threshold",
+			Provider: withSpec(createProvider("test", "https://test", 1, validCABundle), func(spec *unversioned.ProviderSpec) {
+				spec.CircuitBreaker = &unversioned.CircuitBreaker{FailureThreshold: -1}
+			}),
+			ErrorExpected: true,
+		},
+		{
+			Name: "negative response cache TTL",
+			Provider: withSpec(createProvider("test", "https://test", 1, validCABundle), func(spec *unversioned.ProviderSpec) {
+				spec.ResponseCache = &unversioned.ResponseCachePolicy{ErrorTTLSeconds: -1}
+			}),
+			ErrorExpected: true,
+		},
+		{
+			Name: "valid auth",
+			Provider: withSpec(createProvider("test", "https://test", 1, validCABundle), func(spec *unversioned.ProviderSpec) {
+				spec.Auth = &unversioned.ProviderAuth{
+					ClientCert:    &unversioned.ClientCertAuth{CertFile: "tls.crt", KeyFile: "tls.key"},
+					BearerToken:   &unversioned.BearerTokenAuth{SecretRef: &unversioned.SecretReference{Name: "token"}},
+					HTTPSignature: &unversioned.HTTPSignatureAuth{KeyID: "gatekeeper", KeyFile: "key"},
+				}
+			}),
+			ErrorExpected: false,
+		},
+		{
+			Name: "client cert without key file",
+			Provider: withSpec(createProvider("test", "https://test", 1, validCABundle), func(spec *unversioned.ProviderSpec) {
+				spec.Auth = &unversioned.ProviderAuth{ClientCert: &unversioned.ClientCertAuth{CertFile: "tls.crt"}}
+			}),
+			ErrorExpected: true,
+		},
+		{
+			Name: "bearer token with file and secret",
+			Provider: withSpec(createProvider("test", "https://test", 1, validCABundle), func(spec *unversioned.ProviderSpec) {
+				spec.Auth = &unversioned.ProviderAuth{BearerToken: &unversioned.BearerTokenAuth{
+					TokenFile: "token", SecretRef: &unversioned.SecretReference{Name: "token"},
+				}}
+			}),
+			ErrorExpected: true,
+		},
+		{
+			Name: "bearer token without source",
+			Provider: withSpec(createProvider("test", "https://test", 1, validCABundle), func(spec *unversioned.ProviderSpec) {
+				spec.Auth = &unversioned.ProviderAuth{BearerToken: &unversioned.BearerTokenAuth{}}
+			}),
+			ErrorExpected: true,
+		},
+		{
+			Name: "secret ref without name",
+			Provider: withSpec(createProvider("test", "https://test", 1, validCABundle), func(spec *unversioned.ProviderSpec) {
+				spec.Auth = &unversioned.ProviderAuth{BearerToken: &unversioned.BearerTokenAuth{SecretRef: &unversioned.SecretReference{}}}
+			}),
+			ErrorExpected: true,
+		},
+		{
+			Name: "http signature without key ID",
+			Provider: withSpec(createProvider("test", "https://test", 1, validCABundle), func(spec *unversioned.ProviderSpec) {
+				spec.Auth = &unversioned.ProviderAuth{HTTPSignature: &unversioned.HTTPSignatureAuth{KeyFile: "key"}}
+			}),
+			ErrorExpected: true,
+		},
+		{
+			Name: "unknown failure policy",
+			Provider: withSpec(createProvider("test", "https://test", 1, validCABundle), func(spec *unversioned.ProviderSpec) {
+				spec.FailurePolicy = "Retry"
+			}),
+			ErrorExpected: true,
+		},
 	}
 	for _, tt := range tc {
 		cache := NewCache()
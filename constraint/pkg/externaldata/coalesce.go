@@ -0,0 +1,211 @@
+package externaldata
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/apis/externaldata/unversioned"
+)
+
+// Coalescer merges concurrent requests to the same provider into a single
+// ProviderRequest. Keys requested within window of the first pending request
+// for a provider are sent together once window elapses, or as soon as the
+// batch holds maxBatchSize distinct keys. Each key is sent at most once per
+// batch, and each caller receives only the items for the keys it requested.
+//
+// Threadsafe.
+type Coalescer struct {
+	window       time.Duration
+	maxBatchSize int
+
+	mtx sync.Mutex
+
+	// pending is the batch accepting keys for each provider, by provider name.
+	pending map[string]*batch
+}
+
+// batch is a ProviderRequest waiting to be sent on behalf of one or more
+// callers.
+type batch struct {
+	send       SendRequestToProvider
+	provider   *unversioned.Provider
+	clientCert *tls.Certificate
+
+	// keys are the distinct keys to send, in the order they were requested.
+	keys []string
+	seen map[string]bool
+
+	timer *time.Timer
+	sent  bool
+
+	// done is closed once the response has been received, after which resp,
+	// statusCode, and err may be read.
+	done       chan struct{}
+	resp       *ProviderResponse
+	statusCode int
+	err        error
+}
+
+// NewCoalescer returns a Coalescer which waits up to window to merge requests
+// to the same provider. If maxBatchSize is not positive, batches are limited
+// only by window. A single call with more than maxBatchSize keys is sent in a
+// batch of its own.
+func NewCoalescer(window time.Duration, maxBatchSize int) *Coalescer {
+	return &Coalescer{
+		window:       window,
+		maxBatchSize: maxBatchSize,
+		pending:      make(map[string]*batch),
+	}
+}
+
+// Send requests keys from provider with send, merged with the keys of
+// concurrent calls for the same provider. Calls are only merged if they use the
+// same provider spec and client certificate, and the batch is sent with the
+// send function of its first call.
+//
+// Blocks until the batch's response is received or ctx is done. The batch is
+// not canceled if ctx is done, since other callers may still be waiting for
+// it; send is expected to enforce the provider's timeout.
+func (c *Coalescer) Send(ctx context.Context, send SendRequestToProvider, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate) (*ProviderResponse, int, error) {
+	if c.window <= 0 || len(keys) == 0 {
+		return send(ctx, provider, keys, clientCert)
+	}
+
+	b := c.join(send, provider, keys, clientCert)
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to send external data request: %w", ctx.Err())
+	}
+
+	if b.err != nil {
+		return nil, b.statusCode, b.err
+	}
+
+	return b.responseFor(keys), b.statusCode, nil
+}
+
+// join adds keys to the pending batch for provider, starting a new batch if
+// there is none or the pending batch cannot accept keys.
+func (c *Coalescer) join(send SendRequestToProvider, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate) *batch {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	b := c.pending[provider.Name]
+	if b != nil && !c.accepts(b, provider, keys, clientCert) {
+		c.flushLocked(b)
+		b = nil
+	}
+
+	if b == nil {
+		b = &batch{
+			send:       send,
+			provider:   provider.DeepCopy(),
+			clientCert: clientCert,
+			seen:       make(map[string]bool),
+			done:       make(chan struct{}),
+		}
+		c.pending[provider.Name] = b
+		b.timer = time.AfterFunc(c.window, func() {
+			c.mtx.Lock()
+			defer c.mtx.Unlock()
+
+			c.flushLocked(b)
+		})
+	}
+
+	for _, key := range keys {
+		if b.seen[key] {
+			continue
+		}
+		b.seen[key] = true
+		b.keys = append(b.keys, key)
+	}
+
+	if c.maxBatchSize > 0 && len(b.keys) >= c.maxBatchSize {
+		c.flushLocked(b)
+	}
+
+	return b
+}
+
+// accepts returns true if keys may be added to b without exceeding
+// maxBatchSize, and the request would be sent to the same provider in the same
+// way.
+func (c *Coalescer) accepts(b *batch, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate) bool {
+	if b.clientCert != clientCert || !reflect.DeepEqual(b.provider.Spec, provider.Spec) {
+		return false
+	}
+
+	if c.maxBatchSize <= 0 {
+		return true
+	}
+
+	added := 0
+	for _, key := range keys {
+		if !b.seen[key] {
+			added++
+		}
+	}
+
+	return len(b.keys)+added <= c.maxBatchSize
+}
+
+// flushLocked sends b if it has not been sent already. Must be called with
+// c.mtx locked.
+func (c *Coalescer) flushLocked(b *batch) {
+	if c.pending[b.provider.Name] == b {
+		delete(c.pending, b.provider.Name)
+	}
+
+	if b.sent {
+		return
+	}
+	b.sent = true
+	b.timer.Stop()
+
+	go b.run()
+}
+
+// run sends b's request and records the response.
+func (b *batch) run() {
+	defer close(b.done)
+
+	// The request outlives the callers which joined b, so it is not bound to
+	// any of their contexts.
+	b.resp, b.statusCode, b.err = b.send(context.Background(), b.provider, b.keys, b.clientCert)
+	if b.err == nil && b.resp == nil {
+		b.resp = &ProviderResponse{}
+	}
+}
+
+// responseFor returns a copy of b's response with only the items for keys.
+func (b *batch) responseFor(keys []string) *ProviderResponse {
+	requested := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		requested[key] = true
+	}
+
+	resp := &ProviderResponse{
+		APIVersion: b.resp.APIVersion,
+		Kind:       b.resp.Kind,
+		Response: Response{
+			Idempotent:  b.resp.Response.Idempotent,
+			SystemError: b.resp.Response.SystemError,
+		},
+	}
+
+	for _, item := range b.resp.Response.Items {
+		if requested[item.Key] {
+			resp.Response.Items = append(resp.Response.Items, item)
+		}
+	}
+
+	return resp
+}
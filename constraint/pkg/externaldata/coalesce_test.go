@@ -0,0 +1,236 @@
+package externaldata
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/apis/externaldata/unversioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// recordingProvider answers each key with "value-<key>" and records the keys
+// of each request it receives.
+type recordingProvider struct {
+	mtx      sync.Mutex
+	requests [][]string
+
+	// release, if non-nil, blocks requests until it is closed.
+	release chan struct{}
+	err     error
+}
+
+func (p *recordingProvider) send(_ context.Context, _ *unversioned.Provider, keys []string, _ *tls.Certificate) (*ProviderResponse, int, error) {
+	p.mtx.Lock()
+	sorted := append([]string{}, keys...)
+	sort.Strings(sorted)
+	p.requests = append(p.requests, sorted)
+	p.mtx.Unlock()
+
+	if p.release != nil {
+		<-p.release
+	}
+
+	if p.err != nil {
+		return nil, http.StatusInternalServerError, p.err
+	}
+
+	resp := &ProviderResponse{
+		APIVersion: "externaldata.gatekeeper.sh/v1beta1",
+		Kind:       ProviderResponseKind,
+		Response:   Response{Idempotent: true},
+	}
+	for _, key := range keys {
+		resp.Response.Items = append(resp.Response.Items, Item{Key: key, Value: "value-" + key})
+	}
+
+	return resp, http.StatusOK, nil
+}
+
+func (p *recordingProvider) getRequests() [][]string {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return p.requests
+}
+
+func testProvider(name, url string) *unversioned.Provider {
+	return &unversioned.Provider{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       unversioned.ProviderSpec{URL: url, Timeout: 1},
+	}
+}
+
+func itemKeys(resp *ProviderResponse) []string {
+	var keys []string
+	for _, item := range resp.Response.Items {
+		if item.Value != "value-"+item.Key {
+			keys = append(keys, "wrong value for "+item.Key)
+			continue
+		}
+		keys = append(keys, item.Key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func TestCoalescer_Send(t *testing.T) {
+	tcs := []struct {
+		name         string
+		window       time.Duration
+		maxBatchSize int
+		providers    []*unversioned.Provider
+		calls        [][]string
+		wantRequests [][]string
+	}{{
+		name:         "overlapping keys are merged",
+		window:       time.Minute,
+		maxBatchSize: 4,
+		calls:        [][]string{{"a", "x"}, {"b", "x"}, {"c", "x", "x"}},
+		wantRequests: [][]string{{"a", "b", "c", "x"}},
+	}, {
+		name:         "window elapses",
+		window:       10 * time.Millisecond,
+		calls:        [][]string{{"a", "a"}},
+		wantRequests: [][]string{{"a"}},
+	}, {
+		name:         "oversized call is sent alone",
+		window:       time.Minute,
+		maxBatchSize: 1,
+		calls:        [][]string{{"a", "b"}},
+		wantRequests: [][]string{{"a", "b"}},
+	}, {
+		name:         "different providers are not merged",
+		window:       time.Minute,
+		maxBatchSize: 1,
+		providers:    []*unversioned.Provider{testProvider("foo", "https://foo"), testProvider("bar", "https://bar")},
+		calls:        [][]string{{"a"}, {"a"}},
+		wantRequests: [][]string{{"a"}, {"a"}},
+	}, {
+		name:         "no window",
+		calls:        [][]string{{"a"}},
+		wantRequests: [][]string{{"a"}},
+	}}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			p := &recordingProvider{}
+			c := NewCoalescer(tc.window, tc.maxBatchSize)
+
+			var wg sync.WaitGroup
+			for i, keys := range tc.calls {
+				provider := testProvider("foo", "https://foo")
+				if tc.providers != nil {
+					provider = tc.providers[i]
+				}
+
+				wg.Add(1)
+				go func(keys []string) {
+					defer wg.Done()
+
+					resp, statusCode, err := c.Send(ctx, p.send, provider, keys, nil)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if statusCode != http.StatusOK {
+						t.Errorf("got status code %d, want %d", statusCode, http.StatusOK)
+					}
+
+					want := map[string]bool{}
+					for _, key := range keys {
+						want[key] = true
+					}
+					var wantKeys []string
+					for key := range want {
+						wantKeys = append(wantKeys, key)
+					}
+					sort.Strings(wantKeys)
+
+					if diff := cmp.Diff(wantKeys, itemKeys(resp)); diff != "" {
+						t.Errorf("items for keys %v: %s", keys, diff)
+					}
+				}(keys)
+			}
+			wg.Wait()
+
+			got := p.getRequests()
+			sort.Slice(got, func(i, j int) bool {
+				return len(got[i]) < len(got[j])
+			})
+			if diff := cmp.Diff(tc.wantRequests, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCoalescer_Send_Error(t *testing.T) {
+	ctx := context.Background()
+	wantErr := errors.New("provider down")
+	p := &recordingProvider{err: wantErr}
+	c := NewCoalescer(time.Minute, 2)
+
+	var wg sync.WaitGroup
+	for _, key := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+
+			_, statusCode, err := c.Send(ctx, p.send, testProvider("foo", "https://foo"), []string{key}, nil)
+			if !errors.Is(err, wantErr) {
+				t.Errorf("got error %v, want %v", err, wantErr)
+			}
+			if statusCode != http.StatusInternalServerError {
+				t.Errorf("got status code %d, want %d", statusCode, http.StatusInternalServerError)
+			}
+		}(key)
+	}
+	wg.Wait()
+
+	if got := len(p.getRequests()); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestCoalescer_Send_ContextDone(t *testing.T) {
+	p := &recordingProvider{release: make(chan struct{})}
+	c := NewCoalescer(time.Millisecond, 0)
+	provider := testProvider("foo", "https://foo")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error)
+	go func() {
+		_, _, err := c.Send(ctx, p.send, provider, []string{"a"}, nil)
+		canceled <- err
+	}()
+
+	// Wait for the batch to be sent before canceling its first caller.
+	for len(p.getRequests()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+
+	if err := <-canceled; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+
+	// The request is not canceled with its first caller, so later callers
+	// are unaffected.
+	close(p.release)
+	resp, _, err := c.Send(context.Background(), p.send, provider, []string{"a"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"a"}, itemKeys(resp)); diff != "" {
+		t.Error(diff)
+	}
+}
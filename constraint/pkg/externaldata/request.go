@@ -61,6 +61,12 @@ type SendRequestToProvider func(ctx context.Context, provider *unversioned.Provi
 
 // DefaultSendRequestToProvider is the default function to send the request to the external data provider.
 func DefaultSendRequestToProvider(ctx context.Context, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate) (*ProviderResponse, int, error) {
+	return sendRequestToProvider(ctx, provider, keys, clientCert, nil)
+}
+
+// sendRequestToProvider sends keys to provider, presenting clientCert. If
+// authorize is non-nil, it authenticates the request before it is sent.
+func sendRequestToProvider(ctx context.Context, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate, authorize func(req *http.Request, body []byte) error) (*ProviderResponse, int, error) {
 	externaldataRequest := NewProviderRequest(keys)
 	body, err := json.Marshal(externaldataRequest)
 	if err != nil {
@@ -78,6 +84,12 @@ func DefaultSendRequestToProvider(ctx context.Context, provider *unversioned.Pro
 	}
 	req.Header.Set("Content-Type", "application/json")
 
+	if authorize != nil {
+		if err := authorize(req, body); err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("failed to authenticate external data request: %w", err)
+		}
+	}
+
 	ctxWithDeadline, cancel := context.WithDeadline(ctx, time.Now().Add(time.Duration(provider.Spec.Timeout)*time.Second))
 	defer cancel()
 
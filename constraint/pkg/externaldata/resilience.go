@@ -0,0 +1,281 @@
+package externaldata
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/apis/externaldata/unversioned"
+)
+
+// ErrCircuitOpen is returned for requests which are not sent because the
+// provider's circuit breaker is open.
+var ErrCircuitOpen = errors.New("provider circuit breaker is open")
+
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 5 * time.Second
+	defaultOpenDuration   = 30 * time.Second
+)
+
+// Resilience sends requests to providers according to their RetryPolicy,
+// CircuitBreaker, and FailurePolicy. A provider which sets none of these is
+// sent exactly one request, whose result is returned unchanged.
+//
+// Threadsafe.
+type Resilience struct {
+	mtx sync.Mutex
+
+	// providers is the state of each provider, by provider name.
+	providers map[string]*providerState
+
+	rand *rand.Rand
+
+	// now and sleep are replaced in tests.
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// providerState is what Resilience has observed about a provider.
+type providerState struct {
+	// circuitBreaker is the configuration the breaker state was recorded under.
+	// The breaker is reset if the configuration changes.
+	circuitBreaker *unversioned.CircuitBreaker
+
+	// failures is the number of consecutive failed requests.
+	failures int
+	// open is true if requests fail without being sent until openUntil.
+	open      bool
+	openUntil time.Time
+	// trial is true if a trial request is in flight for an open circuit.
+	trial bool
+
+	// responded is true once the provider has sent a successful response.
+	responded bool
+	// idempotent is whether the provider's last successful response was
+	// idempotent. Failed requests are only retried if it was, or if the
+	// provider has not yet responded and its RetryPolicy assumes idempotency.
+	idempotent bool
+}
+
+// NewResilience returns a Resilience which has observed no requests.
+func NewResilience() *Resilience {
+	return &Resilience{
+		providers: make(map[string]*providerState),
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())), // nolint:gosec // Jitter need not be cryptographically secure.
+		now:       time.Now,
+		sleep: func(ctx context.Context, d time.Duration) error {
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
+
+// Send requests keys from provider with send, retrying failed requests and
+// failing fast while the provider's circuit breaker is open.
+//
+// A request has failed if send returns an error, or the provider responds with
+// status 429 or 5xx. If the provider's FailurePolicy is Ignore, a failure is
+// returned as a response with status 200, no items, and the failure as its
+// SystemError.
+func (r *Resilience) Send(ctx context.Context, send SendRequestToProvider, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate) (*ProviderResponse, int, error) {
+	resp, statusCode, err := r.sendWithRetries(ctx, send, provider, keys, clientCert)
+	if provider.Spec.FailurePolicy != unversioned.FailurePolicyIgnore || !failed(statusCode, err) {
+		return resp, statusCode, err
+	}
+
+	if err == nil {
+		err = fmt.Errorf("provider responded with status code %d", statusCode)
+	}
+
+	return &ProviderResponse{
+		APIVersion: "externaldata.gatekeeper.sh/v1beta1",
+		Kind:       ProviderResponseKind,
+		Response: Response{
+			SystemError: fmt.Sprintf("failed to query provider %q: %v", provider.Name, err),
+		},
+	}, http.StatusOK, nil
+}
+
+func (r *Resilience) sendWithRetries(ctx context.Context, send SendRequestToProvider, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate) (*ProviderResponse, int, error) {
+	policy := provider.Spec.RetryPolicy
+
+	for retry := 0; ; retry++ {
+		resp, statusCode, err := r.attempt(ctx, send, provider, keys, clientCert)
+		if !failed(statusCode, err) || errors.Is(err, ErrCircuitOpen) {
+			return resp, statusCode, err
+		}
+
+		if policy == nil || retry >= policy.MaxRetries || !r.idempotent(provider.Name, policy) {
+			return resp, statusCode, err
+		}
+
+		if r.sleep(ctx, r.backoff(policy, retry)) != nil {
+			// The caller has given up, so return the last failure.
+			return resp, statusCode, err
+		}
+	}
+}
+
+// attempt sends a single request to provider unless its circuit breaker is
+// open, and records the outcome.
+func (r *Resilience) attempt(ctx context.Context, send SendRequestToProvider, provider *unversioned.Provider, keys []string, clientCert *tls.Certificate) (*ProviderResponse, int, error) {
+	allowed, trial := r.allow(provider)
+	if !allowed {
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("%w: %q", ErrCircuitOpen, provider.Name)
+	}
+
+	resp, statusCode, err := send(ctx, provider, keys, clientCert)
+
+	// A request abandoned by its caller says nothing about the provider.
+	abandoned := err != nil && ctx.Err() != nil
+	r.record(provider, trial, abandoned, resp, statusCode, err)
+
+	return resp, statusCode, err
+}
+
+// allow returns whether a request may be sent to provider, and whether it is
+// the trial request for an open circuit.
+func (r *Resilience) allow(provider *unversioned.Provider) (allowed bool, trial bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	s := r.stateLocked(provider)
+	if !s.open {
+		return true, false
+	}
+
+	if s.trial || r.now().Before(s.openUntil) {
+		return false, false
+	}
+
+	s.trial = true
+	return true, true
+}
+
+// record updates provider's state with the outcome of a request.
+func (r *Resilience) record(provider *unversioned.Provider, trial, abandoned bool, resp *ProviderResponse, statusCode int, err error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	s := r.stateLocked(provider)
+	if trial {
+		s.trial = false
+	}
+
+	if abandoned {
+		return
+	}
+
+	if !failed(statusCode, err) {
+		s.failures = 0
+		s.open = false
+		if resp != nil {
+			s.responded = true
+			s.idempotent = resp.Response.Idempotent
+		}
+		return
+	}
+
+	s.failures++
+
+	cb := s.circuitBreaker
+	if cb == nil || cb.FailureThreshold <= 0 {
+		return
+	}
+
+	if trial || (!s.open && s.failures >= cb.FailureThreshold) {
+		s.open = true
+		s.openUntil = r.now().Add(openDuration(cb))
+	}
+}
+
+// stateLocked returns the state of provider, resetting its circuit breaker if
+// the breaker's configuration has changed. Must be called with r.mtx locked.
+func (r *Resilience) stateLocked(provider *unversioned.Provider) *providerState {
+	s, found := r.providers[provider.Name]
+	if !found {
+		s = &providerState{}
+		r.providers[provider.Name] = s
+	}
+
+	if !found || !reflect.DeepEqual(s.circuitBreaker, provider.Spec.CircuitBreaker) {
+		s.circuitBreaker = provider.Spec.CircuitBreaker.DeepCopy()
+		s.failures = 0
+		s.open = false
+		s.trial = false
+	}
+
+	return s
+}
+
+// idempotent returns whether failed requests to the named provider may be
+// retried under policy.
+func (r *Resilience) idempotent(name string, policy *unversioned.RetryPolicy) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	s, found := r.providers[name]
+	if !found || !s.responded {
+		return policy.AssumeIdempotent
+	}
+	return s.idempotent
+}
+
+// backoff returns how long to wait before the retry following retry previous
+// retries. The backoff doubles with each retry up to the policy's maximum, and
+// is jittered so concurrent callers do not retry in lockstep.
+func (r *Resilience) backoff(policy *unversioned.RetryPolicy, retry int) time.Duration {
+	backoff := defaultInitialBackoff
+	if policy.InitialBackoffMilliseconds > 0 {
+		backoff = time.Duration(policy.InitialBackoffMilliseconds) * time.Millisecond
+	}
+
+	maxBackoff := defaultMaxBackoff
+	if policy.MaxBackoffMilliseconds > 0 {
+		maxBackoff = time.Duration(policy.MaxBackoffMilliseconds) * time.Millisecond
+	}
+
+	for i := 0; i < retry && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	half := backoff / 2
+	if half <= 0 {
+		return backoff
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return half + time.Duration(r.rand.Int63n(int64(half)))
+}
+
+func openDuration(cb *unversioned.CircuitBreaker) time.Duration {
+	if cb.OpenSeconds > 0 {
+		return time.Duration(cb.OpenSeconds) * time.Second
+	}
+	return defaultOpenDuration
+}
+
+// failed returns true if a request with the given outcome failed to get a
+// usable response from the provider.
+func failed(statusCode int, err error) bool {
+	return err != nil || statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,372 @@
+package externaldata
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-policy-agent/frameworks/constraint/pkg/apis/externaldata/unversioned"
+)
+
+var errProviderDown = errors.New("provider down")
+
+// outcome is the result of a single request to a scriptedProvider.
+type outcome struct {
+	statusCode    int
+	err           error
+	notIdempotent bool
+}
+
+var (
+	okOutcome          = outcome{statusCode: http.StatusOK}
+	downOutcome        = outcome{statusCode: http.StatusInternalServerError, err: errProviderDown}
+	unavailableOutcome = outcome{statusCode: http.StatusServiceUnavailable}
+)
+
+// scriptedProvider returns outcomes in order, repeating the last one once they
+// are exhausted.
+type scriptedProvider struct {
+	mtx      sync.Mutex
+	outcomes []outcome
+	attempts int
+}
+
+func (p *scriptedProvider) send(_ context.Context, _ *unversioned.Provider, keys []string, _ *tls.Certificate) (*ProviderResponse, int, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	o := p.outcomes[len(p.outcomes)-1]
+	if p.attempts < len(p.outcomes) {
+		o = p.outcomes[p.attempts]
+	}
+	p.attempts++
+
+	if o.err != nil {
+		return nil, o.statusCode, o.err
+	}
+
+	resp := &ProviderResponse{
+		APIVersion: "externaldata.gatekeeper.sh/v1beta1",
+		Kind:       ProviderResponseKind,
+		Response:   Response{Idempotent: !o.notIdempotent},
+	}
+	for _, key := range keys {
+		resp.Response.Items = append(resp.Response.Items, Item{Key: key, Value: "value-" + key})
+	}
+
+	return resp, o.statusCode, nil
+}
+
+func (p *scriptedProvider) getAttempts() int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return p.attempts
+}
+
+// fakeClock replaces the clock and sleep of a Resilience. Sleeping advances
+// the clock immediately.
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newTestResilience() (*Resilience, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+
+	r := NewResilience()
+	r.now = func() time.Time { return clock.now }
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		clock.sleeps = append(clock.sleeps, d)
+		clock.now = clock.now.Add(d)
+		return ctx.Err()
+	}
+
+	return r, clock
+}
+
+func TestResilience_Send(t *testing.T) {
+	tcs := []struct {
+		name            string
+		spec            func(spec *unversioned.ProviderSpec)
+		outcomes        []outcome
+		wantStatusCode  int
+		wantErr         error
+		wantSystemError bool
+		wantAttempts    int
+	}{{
+		name:           "no policy sends once",
+		outcomes:       []outcome{downOutcome, okOutcome},
+		wantStatusCode: http.StatusInternalServerError,
+		wantErr:        errProviderDown,
+		wantAttempts:   1,
+	}, {
+		name: "retries until success",
+		spec: func(spec *unversioned.ProviderSpec) {
+			spec.RetryPolicy = &unversioned.RetryPolicy{MaxRetries: 3, AssumeIdempotent: true}
+		},
+		outcomes:       []outcome{downOutcome, unavailableOutcome, okOutcome},
+		wantStatusCode: http.StatusOK,
+		wantAttempts:   3,
+	}, {
+		name: "retries too many requests",
+		spec: func(spec *unversioned.ProviderSpec) {
+			spec.RetryPolicy = &unversioned.RetryPolicy{MaxRetries: 1, AssumeIdempotent: true}
+		},
+		outcomes:       []outcome{{statusCode: http.StatusTooManyRequests}, okOutcome},
+		wantStatusCode: http.StatusOK,
+		wantAttempts:   2,
+	}, {
+		name: "gives up after max retries",
+		spec: func(spec *unversioned.ProviderSpec) {
+			spec.RetryPolicy = &unversioned.RetryPolicy{MaxRetries: 1, AssumeIdempotent: true}
+		},
+		outcomes:       []outcome{downOutcome, downOutcome, okOutcome},
+		wantStatusCode: http.StatusInternalServerError,
+		wantErr:        errProviderDown,
+		wantAttempts:   2,
+	}, {
+		name: "does not retry before idempotency is confirmed",
+		spec: func(spec *unversioned.ProviderSpec) {
+			spec.RetryPolicy = &unversioned.RetryPolicy{MaxRetries: 3}
+		},
+		outcomes:       []outcome{downOutcome, okOutcome},
+		wantStatusCode: http.StatusInternalServerError,
+		wantErr:        errProviderDown,
+		wantAttempts:   1,
+	}, {
+		name: "does not retry client errors",
+		spec: func(spec *unversioned.ProviderSpec) {
+			spec.RetryPolicy = &unversioned.RetryPolicy{MaxRetries: 3}
+		},
+		outcomes:       []outcome{{statusCode: http.StatusBadRequest}, okOutcome},
+		wantStatusCode: http.StatusBadRequest,
+		wantAttempts:   1,
+	}, {
+		name: "ignore failure policy",
+		spec: func(spec *unversioned.ProviderSpec) {
+			spec.RetryPolicy = &unversioned.RetryPolicy{MaxRetries: 1, AssumeIdempotent: true}
+			spec.FailurePolicy = unversioned.FailurePolicyIgnore
+		},
+		outcomes:        []outcome{downOutcome, unavailableOutcome},
+		wantStatusCode:  http.StatusOK,
+		wantSystemError: true,
+		wantAttempts:    2,
+	}, {
+		name: "ignore failure policy passes success through",
+		spec: func(spec *unversioned.ProviderSpec) {
+			spec.FailurePolicy = unversioned.FailurePolicyIgnore
+		},
+		outcomes:       []outcome{okOutcome},
+		wantStatusCode: http.StatusOK,
+		wantAttempts:   1,
+	}, {
+		name: "fail failure policy",
+		spec: func(spec *unversioned.ProviderSpec) {
+			spec.FailurePolicy = unversioned.FailurePolicyFail
+		},
+		outcomes:       []outcome{downOutcome},
+		wantStatusCode: http.StatusInternalServerError,
+		wantErr:        errProviderDown,
+		wantAttempts:   1,
+	}}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r, _ := newTestResilience()
+			p := &scriptedProvider{outcomes: tc.outcomes}
+
+			provider := testProvider("foo", "https://foo")
+			if tc.spec != nil {
+				tc.spec(&provider.Spec)
+			}
+
+			resp, statusCode, err := r.Send(context.Background(), p.send, provider, []string{"a"}, nil)
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("got error %v, want %v", err, tc.wantErr)
+			}
+			if statusCode != tc.wantStatusCode {
+				t.Errorf("got status code %d, want %d", statusCode, tc.wantStatusCode)
+			}
+			if got := p.getAttempts(); got != tc.wantAttempts {
+				t.Errorf("got %d attempts, want %d", got, tc.wantAttempts)
+			}
+
+			if tc.wantSystemError {
+				if resp == nil || resp.Response.SystemError == "" {
+					t.Fatalf("got response %+v, want system error", resp)
+				}
+				if len(resp.Response.Items) != 0 {
+					t.Errorf("got items %v, want none", resp.Response.Items)
+				}
+			} else if resp != nil && resp.Response.SystemError != "" {
+				t.Errorf("got system error %q, want none", resp.Response.SystemError)
+			}
+		})
+	}
+}
+
+func TestResilience_Send_Idempotent(t *testing.T) {
+	r, _ := newTestResilience()
+	p := &scriptedProvider{outcomes: []outcome{okOutcome, downOutcome, okOutcome}}
+
+	provider := testProvider("foo", "https://foo")
+	provider.Spec.RetryPolicy = &unversioned.RetryPolicy{MaxRetries: 3}
+
+	ctx := context.Background()
+	if _, _, err := r.Send(ctx, p.send, provider, []string{"a"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The provider has responded that its responses are idempotent, so the
+	// failed request is retried.
+	if _, _, err := r.Send(ctx, p.send, provider, []string{"a"}, nil); err != nil {
+		t.Error(err)
+	}
+	if got := p.getAttempts(); got != 3 {
+		t.Errorf("got %d attempts, want 3", got)
+	}
+}
+
+func TestResilience_Send_NotIdempotent(t *testing.T) {
+	r, _ := newTestResilience()
+	p := &scriptedProvider{outcomes: []outcome{{statusCode: http.StatusOK, notIdempotent: true}, downOutcome, okOutcome}}
+
+	provider := testProvider("foo", "https://foo")
+	provider.Spec.RetryPolicy = &unversioned.RetryPolicy{MaxRetries: 3, AssumeIdempotent: true}
+
+	ctx := context.Background()
+	if _, _, err := r.Send(ctx, p.send, provider, []string{"a"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The provider has responded that its responses are not idempotent, so the
+	// failed request is not retried even though the policy assumes they are.
+	if _, _, err := r.Send(ctx, p.send, provider, []string{"a"}, nil); !errors.Is(err, errProviderDown) {
+		t.Errorf("got error %v, want %v", err, errProviderDown)
+	}
+	if got := p.getAttempts(); got != 2 {
+		t.Errorf("got %d attempts, want 2", got)
+	}
+}
+
+func TestResilience_Send_CircuitBreaker(t *testing.T) {
+	r, clock := newTestResilience()
+	p := &scriptedProvider{outcomes: []outcome{downOutcome, downOutcome, downOutcome, okOutcome}}
+
+	provider := testProvider("foo", "https://foo")
+	provider.Spec.CircuitBreaker = &unversioned.CircuitBreaker{FailureThreshold: 2, OpenSeconds: 10}
+
+	ctx := context.Background()
+	send := func() (int, error) {
+		_, statusCode, err := r.Send(ctx, p.send, provider, []string{"a"}, nil)
+		return statusCode, err
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := send(); !errors.Is(err, errProviderDown) {
+			t.Fatalf("got error %v, want %v", err, errProviderDown)
+		}
+	}
+
+	// The circuit is open, so requests fail without being sent.
+	statusCode, err := send()
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got error %v, want %v", err, ErrCircuitOpen)
+	}
+	if statusCode != http.StatusServiceUnavailable {
+		t.Errorf("got status code %d, want %d", statusCode, http.StatusServiceUnavailable)
+	}
+	if got := p.getAttempts(); got != 2 {
+		t.Fatalf("got %d attempts, want 2", got)
+	}
+
+	// A failed trial request reopens the circuit.
+	clock.now = clock.now.Add(10 * time.Second)
+	if _, err := send(); !errors.Is(err, errProviderDown) {
+		t.Fatalf("got error %v, want %v", err, errProviderDown)
+	}
+	if _, err := send(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got error %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// A successful trial request closes the circuit.
+	clock.now = clock.now.Add(10 * time.Second)
+	for i := 0; i < 2; i++ {
+		if _, err := send(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := p.getAttempts(); got != 5 {
+		t.Errorf("got %d attempts, want 5", got)
+	}
+
+	// Changing the breaker's configuration resets it.
+	p.outcomes = []outcome{downOutcome}
+	p.attempts = 0
+	for i := 0; i < 2; i++ {
+		_, _ = send()
+	}
+	provider.Spec.CircuitBreaker = &unversioned.CircuitBreaker{FailureThreshold: 3}
+	if _, err := send(); !errors.Is(err, errProviderDown) {
+		t.Errorf("got error %v, want %v", err, errProviderDown)
+	}
+}
+
+func TestResilience_Send_Backoff(t *testing.T) {
+	r, clock := newTestResilience()
+	p := &scriptedProvider{outcomes: []outcome{downOutcome}}
+
+	provider := testProvider("foo", "https://foo")
+	provider.Spec.RetryPolicy = &unversioned.RetryPolicy{
+		MaxRetries:                 5,
+		InitialBackoffMilliseconds: 100,
+		MaxBackoffMilliseconds:     500,
+		AssumeIdempotent:           true,
+	}
+
+	if _, _, err := r.Send(context.Background(), p.send, provider, []string{"a"}, nil); !errors.Is(err, errProviderDown) {
+		t.Fatalf("got error %v, want %v", err, errProviderDown)
+	}
+
+	maxBackoffs := []time.Duration{100, 200, 400, 500, 500}
+	if len(clock.sleeps) != len(maxBackoffs) {
+		t.Fatalf("got %d backoffs, want %d", len(clock.sleeps), len(maxBackoffs))
+	}
+	for i, got := range clock.sleeps {
+		maxBackoff := maxBackoffs[i] * time.Millisecond
+		if got < maxBackoff/2 || got >= maxBackoff {
+			t.Errorf("got backoff %v before retry %d, want in [%v, %v)", got, i+1, maxBackoff/2, maxBackoff)
+		}
+	}
+}
+
+func TestResilience_Send_ContextDone(t *testing.T) {
+	r, _ := newTestResilience()
+	p := &scriptedProvider{outcomes: []outcome{downOutcome}}
+
+	provider := testProvider("foo", "https://foo")
+	provider.Spec.RetryPolicy = &unversioned.RetryPolicy{MaxRetries: 5, AssumeIdempotent: true}
+	provider.Spec.CircuitBreaker = &unversioned.CircuitBreaker{FailureThreshold: 1}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The caller has given up, so the request is not retried and its failure
+	// does not open the circuit.
+	if _, _, err := r.Send(ctx, p.send, provider, []string{"a"}, nil); !errors.Is(err, errProviderDown) {
+		t.Fatalf("got error %v, want %v", err, errProviderDown)
+	}
+	if got := p.getAttempts(); got != 1 {
+		t.Errorf("got %d attempts, want 1", got)
+	}
+
+	p.outcomes = []outcome{okOutcome}
+	if _, _, err := r.Send(context.Background(), p.send, provider, []string{"a"}, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,222 @@
+package externaldata
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ResponseCache caches the items of provider responses by provider and key.
+// Implementations must be threadsafe.
+type ResponseCache interface {
+	// Get returns the value cached for key, or an error if there is no value
+	// or it has expired.
+	Get(key CacheKey) (*CacheValue, error)
+
+	// Upsert caches value for key, replacing any value already cached.
+	Upsert(key CacheKey, value CacheValue)
+
+	// Remove removes any value cached for key.
+	Remove(key CacheKey)
+
+	// Stats returns the cache's hits, misses, and evictions for each provider,
+	// by provider name.
+	Stats() map[string]CacheStats
+}
+
+var (
+	_ ResponseCache = &ProviderResponseCache{}
+	_ ResponseCache = &LRUProviderResponseCache{}
+)
+
+// CacheStats counts how a ResponseCache was used for a provider since it was
+// created.
+type CacheStats struct {
+	// Hits is the number of times a fresh value was found.
+	Hits uint64
+	// Misses is the number of times no fresh value was found.
+	Misses uint64
+	// Evictions is the number of values the cache removed on its own, because
+	// they expired or to make room for other values.
+	Evictions uint64
+}
+
+// cacheStats records CacheStats by provider name. The zero value is ready to
+// use.
+type cacheStats struct {
+	mtx        sync.Mutex
+	byProvider map[string]*CacheStats
+}
+
+func (s *cacheStats) record(provider string, record func(stats *CacheStats)) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.byProvider == nil {
+		s.byProvider = make(map[string]*CacheStats)
+	}
+
+	stats, found := s.byProvider[provider]
+	if !found {
+		stats = &CacheStats{}
+		s.byProvider[provider] = stats
+	}
+
+	record(stats)
+}
+
+func (s *cacheStats) hit(provider string) {
+	s.record(provider, func(stats *CacheStats) { stats.Hits++ })
+}
+
+func (s *cacheStats) miss(provider string) {
+	s.record(provider, func(stats *CacheStats) { stats.Misses++ })
+}
+
+func (s *cacheStats) evict(provider string) {
+	s.record(provider, func(stats *CacheStats) { stats.Evictions++ })
+}
+
+func (s *cacheStats) snapshot() map[string]CacheStats {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	out := make(map[string]CacheStats, len(s.byProvider))
+	for provider, stats := range s.byProvider {
+		out[provider] = *stats
+	}
+
+	return out
+}
+
+// expired returns true if value was received longer ago than its TTL. If value
+// sets no TTL, errorTTL applies to values with errors if it is positive, and
+// ttl applies otherwise.
+func (v *CacheValue) expired(now time.Time, ttl, errorTTL time.Duration) bool {
+	switch {
+	case v.TTL > 0:
+		ttl = v.TTL
+	case v.Error != "" && errorTTL > 0:
+		ttl = errorTTL
+	}
+
+	return now.Sub(time.Unix(v.Received, 0)) > ttl
+}
+
+func errKeyNotFound(key CacheKey) error {
+	return fmt.Errorf("key '%s:%s' is not found in provider response cache", key.ProviderName, key.Key)
+}
+
+// LRUProviderResponseCache is a ResponseCache which holds a bounded number of
+// values, evicting the least recently used value to make room for new ones.
+// Expired values are evicted when they are next read rather than by a
+// background goroutine.
+type LRUProviderResponseCache struct {
+	maxEntries int
+	ttl        time.Duration
+	errorTTL   time.Duration
+
+	mtx sync.Mutex
+	// entries holds the element of order for each key.
+	entries map[CacheKey]*list.Element
+	// order holds lruEntries from most to least recently used.
+	order *list.List
+
+	stats cacheStats
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+type lruEntry struct {
+	key   CacheKey
+	value CacheValue
+}
+
+// NewLRUProviderResponseCache returns a cache which holds at most maxEntries
+// values. Values without their own TTL expire after ttl, or after errorTTL if
+// they hold an error and errorTTL is positive. If maxEntries is not positive,
+// the number of values is unbounded.
+func NewLRUProviderResponseCache(maxEntries int, ttl, errorTTL time.Duration) *LRUProviderResponseCache {
+	return &LRUProviderResponseCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		errorTTL:   errorTTL,
+		entries:    make(map[CacheKey]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+func (c *LRUProviderResponseCache) Get(key CacheKey) (*CacheValue, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	elem, found := c.entries[key]
+	if !found {
+		c.stats.miss(key.ProviderName)
+		return nil, errKeyNotFound(key)
+	}
+
+	entry := elem.Value.(*lruEntry)
+	if entry.value.expired(c.now(), c.ttl, c.errorTTL) {
+		c.removeLocked(elem)
+		c.stats.evict(key.ProviderName)
+		c.stats.miss(key.ProviderName)
+		return nil, errKeyNotFound(key)
+	}
+
+	c.order.MoveToFront(elem)
+	c.stats.hit(key.ProviderName)
+
+	value := entry.value
+	return &value, nil
+}
+
+func (c *LRUProviderResponseCache) Upsert(key CacheKey, value CacheValue) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if elem, found := c.entries[key]; found {
+		elem.Value.(*lruEntry).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value})
+
+	if c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.removeLocked(oldest)
+		c.stats.evict(oldest.Value.(*lruEntry).key.ProviderName)
+	}
+}
+
+func (c *LRUProviderResponseCache) Remove(key CacheKey) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if elem, found := c.entries[key]; found {
+		c.removeLocked(elem)
+	}
+}
+
+func (c *LRUProviderResponseCache) Stats() map[string]CacheStats {
+	return c.stats.snapshot()
+}
+
+// Len returns the number of values in the cache, including expired values
+// which have not yet been evicted.
+func (c *LRUProviderResponseCache) Len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.order.Len()
+}
+
+// removeLocked removes elem from the cache. Must be called with c.mtx locked.
+func (c *LRUProviderResponseCache) removeLocked(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*lruEntry).key)
+}
@@ -0,0 +1,175 @@
+package externaldata
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLRUProviderResponseCache(t *testing.T) {
+	now := time.Unix(1000, 0)
+	fooA := CacheKey{ProviderName: "foo", Key: "a"}
+	fooB := CacheKey{ProviderName: "foo", Key: "b"}
+	barA := CacheKey{ProviderName: "bar", Key: "a"}
+
+	tcs := []struct {
+		name       string
+		maxEntries int
+		errorTTL   time.Duration
+		// run performs operations on the cache, advancing time with advance.
+		run       func(c *LRUProviderResponseCache, advance func(time.Duration))
+		wantFresh []CacheKey
+		wantStale []CacheKey
+		wantStats map[string]CacheStats
+	}{{
+		name:       "least recently used value is evicted",
+		maxEntries: 2,
+		run: func(c *LRUProviderResponseCache, _ func(time.Duration)) {
+			c.Upsert(fooA, CacheValue{Received: now.Unix(), Value: "a"})
+			c.Upsert(fooB, CacheValue{Received: now.Unix(), Value: "b"})
+			_, _ = c.Get(fooA)
+			c.Upsert(barA, CacheValue{Received: now.Unix(), Value: "a"})
+		},
+		wantFresh: []CacheKey{fooA, barA},
+		wantStale: []CacheKey{fooB},
+		wantStats: map[string]CacheStats{
+			"foo": {Hits: 2, Misses: 1, Evictions: 1},
+			"bar": {Hits: 1},
+		},
+	}, {
+		name: "unbounded",
+		run: func(c *LRUProviderResponseCache, _ func(time.Duration)) {
+			c.Upsert(fooA, CacheValue{Received: now.Unix()})
+			c.Upsert(fooB, CacheValue{Received: now.Unix()})
+			c.Upsert(barA, CacheValue{Received: now.Unix()})
+		},
+		wantFresh: []CacheKey{fooA, fooB, barA},
+		wantStats: map[string]CacheStats{
+			"foo": {Hits: 2},
+			"bar": {Hits: 1},
+		},
+	}, {
+		name: "expired value is evicted",
+		run: func(c *LRUProviderResponseCache, advance func(time.Duration)) {
+			c.Upsert(fooA, CacheValue{Received: now.Unix()})
+			advance(2 * time.Minute)
+		},
+		wantStale: []CacheKey{fooA},
+		wantStats: map[string]CacheStats{
+			"foo": {Misses: 1, Evictions: 1},
+		},
+	}, {
+		name: "value TTL overrides cache TTL",
+		run: func(c *LRUProviderResponseCache, advance func(time.Duration)) {
+			c.Upsert(fooA, CacheValue{Received: now.Unix(), TTL: time.Hour})
+			c.Upsert(fooB, CacheValue{Received: now.Unix(), TTL: time.Second})
+			advance(30 * time.Second)
+		},
+		wantFresh: []CacheKey{fooA},
+		wantStale: []CacheKey{fooB},
+		wantStats: map[string]CacheStats{
+			"foo": {Hits: 1, Misses: 1, Evictions: 1},
+		},
+	}, {
+		name:     "error values use error TTL",
+		errorTTL: 10 * time.Second,
+		run: func(c *LRUProviderResponseCache, advance func(time.Duration)) {
+			c.Upsert(fooA, CacheValue{Received: now.Unix(), Value: "a"})
+			c.Upsert(fooB, CacheValue{Received: now.Unix(), Error: "not found"})
+			advance(30 * time.Second)
+		},
+		wantFresh: []CacheKey{fooA},
+		wantStale: []CacheKey{fooB},
+		wantStats: map[string]CacheStats{
+			"foo": {Hits: 1, Misses: 1, Evictions: 1},
+		},
+	}, {
+		name: "removed value is not an eviction",
+		run: func(c *LRUProviderResponseCache, _ func(time.Duration)) {
+			c.Upsert(fooA, CacheValue{Received: now.Unix()})
+			c.Remove(fooA)
+		},
+		wantStale: []CacheKey{fooA},
+		wantStats: map[string]CacheStats{
+			"foo": {Misses: 1},
+		},
+	}}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewLRUProviderResponseCache(tc.maxEntries, time.Minute, tc.errorTTL)
+			current := now
+			c.now = func() time.Time { return current }
+
+			tc.run(c, func(d time.Duration) { current = current.Add(d) })
+
+			for _, key := range tc.wantFresh {
+				if _, err := c.Get(key); err != nil {
+					t.Errorf("got Get(%v) error %v, want nil", key, err)
+				}
+			}
+			for _, key := range tc.wantStale {
+				if _, err := c.Get(key); err == nil {
+					t.Errorf("got Get(%v) error nil, want not found", key)
+				}
+			}
+
+			if diff := cmp.Diff(tc.wantStats, c.Stats()); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestLRUProviderResponseCache_Upsert(t *testing.T) {
+	c := NewLRUProviderResponseCache(2, time.Minute, 0)
+	key := CacheKey{ProviderName: "foo", Key: "a"}
+
+	c.Upsert(key, CacheValue{Received: time.Now().Unix(), Value: "old"})
+	c.Upsert(key, CacheValue{Received: time.Now().Unix(), Value: "new"})
+
+	got, err := c.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Value != "new" {
+		t.Errorf("got value %v, want %v", got.Value, "new")
+	}
+	if c.Len() != 1 {
+		t.Errorf("got %d values, want 1", c.Len())
+	}
+}
+
+func TestProviderResponseCache_Stats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	c := NewProviderResponseCache(ctx, time.Minute)
+	c.ErrorTTL = time.Second
+
+	fresh := CacheKey{ProviderName: "foo", Key: "fresh"}
+	stale := CacheKey{ProviderName: "foo", Key: "stale"}
+	staleError := CacheKey{ProviderName: "foo", Key: "stale-error"}
+
+	c.Upsert(fresh, CacheValue{Received: time.Now().Unix()})
+	c.Upsert(stale, CacheValue{Received: time.Now().Add(-time.Hour).Unix()})
+	c.Upsert(staleError, CacheValue{Received: time.Now().Add(-10 * time.Second).Unix(), Error: "not found"})
+
+	if _, err := c.Get(fresh); err != nil {
+		t.Error(err)
+	}
+	for _, key := range []CacheKey{stale, staleError} {
+		if _, err := c.Get(key); err == nil {
+			t.Errorf("got Get(%v) error nil, want not found", key)
+		}
+	}
+
+	c.invalidateProviderResponseCache()
+
+	want := map[string]CacheStats{"foo": {Hits: 1, Misses: 2, Evictions: 2}}
+	if diff := cmp.Diff(want, c.Stats()); diff != "" {
+		t.Error(diff)
+	}
+}
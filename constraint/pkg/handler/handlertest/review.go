@@ -1,5 +1,7 @@
 package handlertest
 
+import "github.com/open-policy-agent/opa/ast"
+
 // Review is the request to review Object.
 type Review struct {
 	Ignored bool   `json:"ignored"`
@@ -13,3 +15,16 @@ func NewReview(namespace, name, data string) *Review {
 		Data:      data,
 	}}
 }
+
+// ToRegoValue converts Review to a Rego Value without round-tripping through
+// JSON. Must be kept in sync with Review's JSON tags.
+func (r *Review) ToRegoValue() (ast.Value, error) {
+	return ast.NewObject(
+		[2]*ast.Term{ast.StringTerm("ignored"), ast.BooleanTerm(r.Ignored)},
+		[2]*ast.Term{ast.StringTerm("object"), ast.ObjectTerm(
+			[2]*ast.Term{ast.StringTerm("name"), ast.StringTerm(r.Object.Name)},
+			[2]*ast.Term{ast.StringTerm("namespace"), ast.StringTerm(r.Object.Namespace)},
+			[2]*ast.Term{ast.StringTerm("data"), ast.StringTerm(r.Object.Data)},
+		)},
+	), nil
+}
@@ -11,6 +11,8 @@ const (
 	TemplateScope = "template"
 	// ConstraintScope means the state is associated with a constraint.
 	ConstraintScope = "constraint"
+	// ProviderScope means the stat is associated with an external data provider.
+	ProviderScope = "provider"
 
 	// description constants.
 	UnknownDescription = "unknown description"
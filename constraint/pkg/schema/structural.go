@@ -7,6 +7,7 @@ import (
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"sigs.k8s.io/yaml"
 )
 
@@ -43,3 +44,19 @@ func CRDSchema(sch *runtime.Scheme, version string) (*schema.Structural, error)
 
 	return nil, fmt.Errorf("no CRD version %q", version)
 }
+
+// Structural converts props, such as the parameters schema of a
+// ConstraintTemplate, to a structural schema. Returns an error if props is not
+// structural.
+func Structural(props *apiextensions.JSONSchemaProps) (*schema.Structural, error) {
+	structural, err := schema.NewStructural(props)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to create Structural", err)
+	}
+
+	if errs := schema.ValidateStructural(field.NewPath("openAPIV3Schema"), structural); len(errs) > 0 {
+		return nil, fmt.Errorf("schema is not structural: %w", errs.ToAggregate())
+	}
+
+	return structural, nil
+}
@@ -0,0 +1,47 @@
+package schema
+
+import (
+	"testing"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+)
+
+func TestStructural(t *testing.T) {
+	testCases := []struct {
+		name    string
+		props   *apiextensions.JSONSchemaProps
+		wantErr bool
+	}{
+		{
+			name: "structural",
+			props: &apiextensions.JSONSchemaProps{
+				Type: "object",
+				Properties: map[string]apiextensions.JSONSchemaProps{
+					"labels": {Type: "array", Items: &apiextensions.JSONSchemaPropsOrArray{Schema: &apiextensions.JSONSchemaProps{Type: "string"}}},
+				},
+			},
+		},
+		{
+			name: "missing type",
+			props: &apiextensions.JSONSchemaProps{
+				Type: "object",
+				Properties: map[string]apiextensions.JSONSchemaProps{
+					"labels": {},
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Structural(tc.props)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got Structural() error = %v, want error %t", err, tc.wantErr)
+			}
+			if !tc.wantErr && got.Properties["labels"].Items == nil {
+				t.Errorf("got Structural() = %v, want labels items", got)
+			}
+		})
+	}
+}
@@ -23,6 +23,11 @@ type Result struct {
 	// Metadata includes the contents of `details` from the Rego rule signature
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
 
+	// Annotations are the audit annotations of the violation, keyed by
+	// annotation key. Only populated by drivers whose templates declare audit
+	// annotations, such as K8sNativeValidation.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
 	// The constraint that was violated
 	Constraint *unstructured.Unstructured `json:"constraint,omitempty"`
 
@@ -1,35 +1,348 @@
 package tests
 
 import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/clienttest/cts"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/conformance"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/rego"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/client/drivers/remote"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/core/templates"
+	"github.com/open-policy-agent/frameworks/constraint/pkg/handler/handlertest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
+// opaURL returns the URL of the OPA server to run the remote Driver against.
+// This is the server at OPA_URL if set, as by test_remote_driver.sh, and
+// otherwise an opa process started for the test. Skips the test if OPA_URL is
+// unset and opa is not on PATH.
+func opaURL(t *testing.T) string {
+	t.Helper()
+
+	url := os.Getenv("OPA_URL")
+	if url == "" {
+		return startOPA(t)
+	}
+
+	if !opaHealthy(url) {
+		t.Fatalf("no OPA server at OPA_URL %s", url)
+	}
+
+	return url
+}
+
+// startOPA runs an opa server for the duration of the test, and returns its
+// URL.
+func startOPA(t *testing.T) string {
+	t.Helper()
+
+	opa, err := exec.LookPath("opa")
+	if err != nil {
+		t.Skip("opa is not on PATH and OPA_URL is unset")
+	}
+
+	// Reserve a free port for the server.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(opa, "run", "--server", "--addr", addr)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	url := "http://" + addr
+	for start := time.Now(); !opaHealthy(url); time.Sleep(50 * time.Millisecond) {
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("opa server at %s did not become healthy", url)
+		}
+	}
+
+	return url
+}
+
+func opaHealthy(url string) bool {
+	httpClient := &http.Client{Timeout: time.Second}
+	resp, err := httpClient.Get(url + "/health")
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+
+	return resp.StatusCode == http.StatusOK
+}
+
+// TestRemoteClientE2E checks the remote Driver returns the same results as the
+// local Rego Driver.
 func TestRemoteClientE2E(t *testing.T) {
-	t.Skip("test does not work yet")
-
-	// This code no longer compiles, but is preserved so the original intent is
-	// preserved once we have a working remote to test the Client against.
-	//
-	// Most likely what we'd want is a TestMain function which can toggle whether
-	// the local or remote Driver is used for E2E tests. If we want these to
-	// execute by default when "go test" is run (including in CI) then we'd want
-	// to call m.Run() twice in TestMain after the local driver tests run
-	// (and pass).
-	//
-	// d, err := remote.New(remote.URL("http://localhost:8181"), remote.Tracing(false))
-	// if err != nil {
-	// 	t.Fatal(err)
-	// }
-	// p, err := client.NewProbe(d)
-	// if err != nil {
-	// 	t.Fatal(err)
-	// }
-	//
-	// for name, f := range p.TestFuncs() {
-	// 	t.Run(name, func(t *testing.T) {
-	// 		if err := f(); err != nil {
-	// 			t.Fatal(err)
-	// 		}
-	// 	})
-	// }
+	url := opaURL(t)
+
+	tcs := []struct {
+		name        string
+		templates   []*templates.ConstraintTemplate
+		constraints []*unstructured.Unstructured
+		inventory   []*handlertest.Object
+		toReview    interface{}
+	}{
+		{
+			name:        "allow",
+			templates:   []*templates.ConstraintTemplate{clienttest.TemplateAllow()},
+			constraints: []*unstructured.Unstructured{cts.MakeConstraint(t, clienttest.KindAllow, "constraint")},
+			toReview:    handlertest.NewReview("", "foo", "bar"),
+		},
+		{
+			name:        "deny",
+			templates:   []*templates.ConstraintTemplate{clienttest.TemplateDeny()},
+			constraints: []*unstructured.Unstructured{cts.MakeConstraint(t, clienttest.KindDeny, "constraint")},
+			toReview:    handlertest.NewReview("", "foo", "bar"),
+		},
+		{
+			name:      "parameters and details",
+			templates: []*templates.ConstraintTemplate{clienttest.TemplateCheckData()},
+			constraints: []*unstructured.Unstructured{
+				cts.MakeConstraint(t, clienttest.KindCheckData, "constraint", cts.WantData("bar")),
+			},
+			toReview: handlertest.NewReview("", "foo", "qux"),
+		},
+		{
+			name:        "libraries",
+			templates:   []*templates.ConstraintTemplate{clienttest.TemplateDenyImport()},
+			constraints: []*unstructured.Unstructured{cts.MakeConstraint(t, clienttest.KindDenyImport, "constraint")},
+			toReview:    handlertest.NewReview("", "foo", "bar"),
+		},
+		{
+			name:        "referential",
+			templates:   []*templates.ConstraintTemplate{clienttest.TemplateForbidDuplicates()},
+			constraints: []*unstructured.Unstructured{cts.MakeConstraint(t, clienttest.KindForbidDuplicates, "constraint")},
+			inventory:   []*handlertest.Object{{Name: "foo-1", Data: "bar"}, {Name: "foo-3", Data: "baz"}},
+			toReview:    handlertest.NewReview("", "foo-2", "bar"),
+		},
+		{
+			name:        "future keywords",
+			templates:   []*templates.ConstraintTemplate{clienttest.TemplateFuture()},
+			constraints: []*unstructured.Unstructured{cts.MakeConstraint(t, clienttest.KindFuture, "constraint")},
+			toReview:    handlertest.NewReview("", "foo", "1"),
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			local, err := rego.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			remoteDriver, err := remote.New(remote.URL(url), remote.Root("conformance"), remote.Tracing(false))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			review := func(d client.Opt) interface{} {
+				c, err := client.NewClient(client.Targets(&handlertest.Handler{Cache: &handlertest.Cache{}}), d)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, ct := range tc.templates {
+					if _, err := c.AddTemplate(ctx, ct); err != nil {
+						t.Fatal(err)
+					}
+				}
+				for _, constraint := range tc.constraints {
+					if _, err := c.AddConstraint(ctx, constraint); err != nil {
+						t.Fatal(err)
+					}
+				}
+				for _, obj := range tc.inventory {
+					if _, err := c.AddData(ctx, obj); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				responses, err := c.Review(ctx, tc.toReview)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return responses.Results()
+			}
+
+			want := review(client.Driver(local))
+			got := review(client.Driver(remoteDriver))
+
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+// TestRemoteConformance runs the Driver conformance tests against the remote
+// Driver.
+func TestRemoteConformance(t *testing.T) {
+	url := opaURL(t)
+
+	suite := conformance.RegoSuite(func(t *testing.T) drivers.Driver {
+		d, err := remote.New(remote.URL(url), remote.Root("conformance"), remote.Tracing(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return d
+	})
+	suite.Tracing = true
+	suite.Stats = []string{"templateRunTimeNS", "constraintCount"}
+
+	suite.Run(t)
+}
+
+// TestRemoteDataE2E checks data written through JSON Patch batches is seen by
+// the OPA server's queries as the local Rego Driver sees it.
+func TestRemoteDataE2E(t *testing.T) {
+	ctx := context.Background()
+	url := opaURL(t)
+
+	tmpl := cts.New(cts.OptTargets(cts.Target(cts.MockTargetHandler, `
+package foo
+
+violation[{"msg": msg}] {
+  data.inventory.cluster.v1.Namespace[name]
+  msg := name
+}
+`)))
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+
+	namespaces := []string{"cluster", "v1", "Namespace"}
+	writes := []struct {
+		path   []string
+		remove bool
+		data   interface{}
+	}{
+		{path: append(namespaces[:3:3], "a"), data: map[string]interface{}{}},
+		{path: append(namespaces[:3:3], "b", "metadata"), data: map[string]interface{}{"name": "b"}},
+		// Removing a path which does not exist succeeds.
+		{path: append(namespaces[:3:3], "c"), remove: true},
+		{path: append(namespaces[:3:3], "a"), remove: true},
+		// Replacing a parent replaces its children.
+		{path: namespaces, data: map[string]interface{}{"d": map[string]interface{}{}}},
+		{path: append(namespaces[:3:3], "e"), data: map[string]interface{}{}},
+	}
+
+	run := func(d drivers.Driver) []string {
+		if err := d.AddTemplate(ctx, tmpl); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.AddConstraint(ctx, constraint); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, w := range writes {
+			var err error
+			if w.remove {
+				err = d.RemoveData(ctx, cts.MockTargetHandler, w.path)
+			} else {
+				err = d.AddData(ctx, cts.MockTargetHandler, w.path, w.data)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		resp, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var msgs []string
+		for _, r := range resp.Results {
+			msgs = append(msgs, r.Msg)
+		}
+		sort.Strings(msgs)
+
+		return msgs
+	}
+
+	local, err := rego.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remoteDriver, err := remote.New(remote.URL(url), remote.DataBatching(100, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := run(local)
+	if diff := cmp.Diff([]string{"d", "e"}, want); diff != "" {
+		t.Fatal(diff)
+	}
+	if diff := cmp.Diff(want, run(remoteDriver)); diff != "" {
+		t.Error(diff)
+	}
+}
+
+// TestRemoteEvalErrorE2E checks Templates which fail to evaluate in the OPA
+// server are reported as violations, as the local Rego Driver reports them.
+func TestRemoteEvalErrorE2E(t *testing.T) {
+	ctx := context.Background()
+	url := opaURL(t)
+
+	d, err := remote.New(remote.URL(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.AddTemplate(ctx, cts.New(cts.OptTargets(cts.Target(cts.MockTargetHandler, `
+package foo
+
+x = 1 { true }
+x = 2 { true }
+
+violation[{"msg": msg}] {
+  x == 1
+  msg := "unreachable"
+}
+`))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	constraint := cts.MakeConstraint(t, cts.MockTemplate, "foo")
+	err = d.AddConstraint(ctx, constraint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := d.Query(ctx, cts.MockTargetHandler, []*unstructured.Unstructured{constraint}, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Results) != 1 {
+		t.Fatalf("got %d results, want 1", len(resp.Results))
+	}
+	if msg := resp.Results[0].Msg; !strings.Contains(msg, "500") || !strings.Contains(msg, "multiple outputs") {
+		t.Errorf("got message %q, want the server's evaluation error", msg)
+	}
 }
@@ -11,4 +11,4 @@ clean() {
 
 trap clean EXIT
 
-go test ./tests
+OPA_URL=http://localhost:8181 go test ./tests